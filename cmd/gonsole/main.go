@@ -1,24 +1,107 @@
 package main
 
 import (
+	"flag"
+
 	"github.com/kakkky/gonsole/completer"
+	"github.com/kakkky/gonsole/config"
 	"github.com/kakkky/gonsole/declregistry"
 	"github.com/kakkky/gonsole/errs"
 	"github.com/kakkky/gonsole/executor"
+	"github.com/kakkky/gonsole/metacmd"
+	"github.com/kakkky/gonsole/pkgindex"
 	"github.com/kakkky/gonsole/repl"
+	"github.com/kakkky/gonsole/targetpkg"
 )
 
 func main() {
+	execModeFlag := flag.String("exec", string(executor.ExecModeReplay), "execution mode of the session (replay, snapshot, worker)")
+	pkgFlag := flag.String("pkg", "", "package to run the session in, which allows access to its unexported identifiers (e.g. ./internal/animal)")
+	configFlag := flag.String("config", config.DefaultFileName, "config file of the project (e.g. import paths to use for package names)")
+	timeoutFlag := flag.String("timeout", "", "maximum time to run each input before it is interrupted (e.g. 30s, off); overrides the config file")
+	flag.Parse()
+
+	cfg, err := config.Load(*configFlag)
+	if err != nil {
+		errs.HandleError(err)
+		return
+	}
+
+	execMode, err := executor.ParseExecMode(*execModeFlag)
+	if err != nil {
+		errs.HandleError(err)
+		return
+	}
+	dispatcher := metacmd.NewDispatcher()
+	// 補完候補の生成で読み込んだパッケージをimportパスの解決にも使う
+	pkgIndex := pkgindex.New(".")
+	executorOpts := []executor.Option{
+		executor.WithExecMode(execMode),
+		executor.WithImportPathBindings(cfg.ImportPathBindings()),
+		executor.WithPkgIndex(pkgIndex),
+	}
+	completerOpts := []completer.Option{
+		completer.WithMetaCommands(dispatcher),
+		completer.WithPkgIndex(pkgIndex),
+	}
+	if cfg.Completion.Matching != "" {
+		matchMode, err := completer.ParseMatchMode(cfg.Completion.Matching)
+		if err != nil {
+			errs.HandleError(err)
+			return
+		}
+		completerOpts = append(completerOpts, completer.WithMatchMode(matchMode))
+	}
+	if cfg.Display.Format != "" {
+		displayFormat, err := executor.ParseDisplayFormat(cfg.Display.Format)
+		if err != nil {
+			errs.HandleError(err)
+			return
+		}
+		executorOpts = append(executorOpts, executor.WithDisplayFormat(displayFormat))
+	}
+	// フラグで指定された場合は、設定ファイルより優先する
+	timeout := cfg.Exec.Timeout
+	if *timeoutFlag != "" {
+		timeout = *timeoutFlag
+	}
+	if timeout != "" {
+		d, err := executor.ParseTimeout(timeout)
+		if err != nil {
+			errs.HandleError(err)
+			return
+		}
+		executorOpts = append(executorOpts, executor.WithTimeout(d))
+	}
+	if *pkgFlag != "" {
+		targetPkg, err := targetpkg.Load(*pkgFlag)
+		if err != nil {
+			errs.HandleError(err)
+			return
+		}
+		executorOpts = append(executorOpts, executor.WithTargetPkg(targetPkg))
+		completerOpts = append(completerOpts, completer.WithTargetPkg(targetPkg))
+	}
+
 	registry := declregistry.NewRegistry()
-	executor, err := executor.NewExecutor(registry)
+	executor, err := executor.NewExecutor(registry, executorOpts...)
 	if err != nil {
 		errs.HandleError(err)
+		return
 	}
-	completer, err := completer.NewCompleter(registry)
+	defer func() {
+		if err := executor.Close(); err != nil {
+			errs.HandleError(err)
+		}
+	}()
+	// `:bind`や設定ファイルで確定させたimportパスを補完にも使う
+	completerOpts = append(completerOpts, completer.WithImportPathBindings(executor.ImportPathBindings))
+	completer, err := completer.NewCompleter(registry, completerOpts...)
 	if err != nil {
 		errs.HandleError(err)
+		return
 	}
-	repl := repl.NewRepl(completer, executor)
+	repl := repl.NewRepl(completer, executor, registry, dispatcher)
 	if err := repl.Run(); err != nil {
 		errs.HandleError(err)
 	}
@@ -0,0 +1,186 @@
+package completer
+
+import (
+	"go/token"
+	"strings"
+
+	"github.com/kakkky/go-prompt"
+
+	"github.com/kakkky/gonsole/types"
+)
+
+// callInput は入力中の関数やメソッドの呼び出しで、括弧内の引数を入力している状態を表す
+type callInput struct {
+	callee   string // 呼び出している関数やメソッド（例: animal.NewDog, dog.Owner().Rename）
+	argIndex int    // 入力中の引数の位置
+}
+
+// callee は呼び出している関数やメソッドのシグネチャと、関数やメソッドが宣言されたパッケージ
+type callee struct {
+	name      types.DeclName
+	signature string
+	params    []paramSet
+	pkgPath   types.ImportPath
+}
+
+// parseCallInput は入力が関数やメソッドの呼び出しの括弧内であれば、呼び出しの情報を返す
+// 入力例: "animal.NewDog(\"pochi\", a" は callee が "animal.NewDog"、argIndex が1になる
+func parseCallInput(text string) (callInput, bool) {
+	tokens := tokenize(text)
+	open := innermostOpenIndex(tokens, len(tokens))
+	// 複合リテラルやインデックスの中は、呼び出しの引数ではない
+	if open < 0 || tokens[open].tok != token.LPAREN {
+		return callInput{}, false
+	}
+	calleeStart := exprStartIndex(tokens, open)
+	if calleeStart == open || tokens[calleeStart].tok != token.IDENT || tokens[open-1].tok == token.PERIOD {
+		return callInput{}, false
+	}
+	return callInput{
+		callee:   text[tokens[calleeStart].pos:tokens[open].pos],
+		argIndex: elementIndex(tokens, open, len(tokens)),
+	}, true
+}
+
+// findCallSuggestions は呼び出しの括弧内で、シグネチャのヒントと、引数の型に合う変数やパッケージの要素を補完する
+// 呼び出している関数やメソッドが見つからない場合は、falseを返す
+func (c *Completer) findCallSuggestions(sb *suggestionBuilder, call callInput) ([]prompt.Suggest, bool) {
+	callee, ok := c.resolveCallee(call.callee)
+	if !ok {
+		return nil, false
+	}
+
+	param, ok := paramAt(callee.params, call.argIndex)
+	// 入力中の引数に対応するパラメータがない場合（パラメータのない関数など）は、パラメータの説明を表示しない
+	var description string
+	if ok {
+		description = sb.buildSuggestDescription(suggestTypeParameter, strings.TrimSpace(param.Name+" "+param.TypeStr))
+	}
+	// ヒントは選択しても入力が変わらないようにする
+	suggestions := []prompt.Suggest{{
+		Text:        sb.buildReplacingText(sb.input.raw),
+		DisplayText: string(callee.name) + callee.signature,
+		Description: description,
+	}}
+	if !ok {
+		return suggestions, true
+	}
+
+	for _, decl := range c.declRegistry.Decls {
+		if decl.Shadowed || decl.TypeName != param.TypeName || decl.TypePkgPath != param.TypePkgPath {
+			continue
+		}
+		var candidate string
+		switch {
+		case decl.Pointered == param.Pointered:
+			candidate = string(decl.Name)
+		case param.Pointered:
+			candidate = and + string(decl.Name)
+		default:
+			continue
+		}
+		if sb.matches(candidate, sb.input.raw) {
+			suggestions = append(suggestions, sb.buildExpr(candidate, suggestTypeVariable, decl.TypeStr()))
+		}
+	}
+
+	// 呼び出している関数やメソッドのパッケージと、引数の型のパッケージから探す
+	pkgPaths := []types.ImportPath{callee.pkgPath}
+	if param.TypePkgPath != "" && param.TypePkgPath != callee.pkgPath {
+		pkgPaths = append(pkgPaths, param.TypePkgPath)
+	}
+	for _, pkgPath := range pkgPaths {
+		pkgRef, ok := c.pkgRefOf(pkgPath)
+		if !ok {
+			continue
+		}
+		isCandidate := func(name types.DeclName, typeName types.TypeName, typePkgPath types.ImportPath) bool {
+			return typeName == param.TypeName && typePkgPath == param.TypePkgPath &&
+				sb.matches(pkgRef+"."+string(name), sb.input.raw) && !c.isHidden(pkgPath, string(name))
+		}
+		for _, varSet := range c.candidates.Vars[pkgPath] {
+			if isCandidate(varSet.Name, varSet.TypeName, varSet.TypePkgPath) {
+				suggestions = append(suggestions, sb.buildExpr(pkgRef+"."+string(varSet.Name), suggestTypeVariable, varSet.Description))
+			}
+		}
+		for _, constSet := range c.candidates.Consts[pkgPath] {
+			if isCandidate(constSet.Name, constSet.TypeName, constSet.TypePkgPath) {
+				suggestions = append(suggestions, sb.buildExpr(pkgRef+"."+string(constSet.Name), suggestTypeConstant, constSet.Description))
+			}
+		}
+		for _, funcSet := range c.candidates.Funcs[pkgPath] {
+			if len(funcSet.Returns) == 1 && isCandidate(funcSet.Name, funcSet.Returns[0].TypeName, funcSet.Returns[0].TypePkgPath) {
+				suggestions = append(suggestions, sb.buildExpr(pkgRef+"."+string(funcSet.Name), suggestTypeFunction, funcSet.Description, "()"))
+			}
+		}
+	}
+	return suggestions, true
+}
+
+// resolveCallee は呼び出している式から、関数やメソッドの候補を探す
+// パッケージの関数、セッション内で宣言された関数、変数やメソッドチェーンの結果のメソッドを探す
+func (c *Completer) resolveCallee(calleeExpr string) (callee, bool) {
+	if !strings.Contains(calleeExpr, ".") {
+		for _, topLevelDecl := range c.declRegistry.TopLevelDecls {
+			if string(topLevelDecl.Name) != calleeExpr || topLevelDecl.ReceiverTypeName != "" {
+				continue
+			}
+			for _, funcSet := range c.candidates.Funcs[topLevelDecl.PkgPath] {
+				if funcSet.Name == topLevelDecl.Name {
+					return callee{name: funcSet.Name, signature: funcSet.Signature, params: funcSet.Params, pkgPath: topLevelDecl.PkgPath}, true
+				}
+			}
+		}
+		return callee{}, false
+	}
+
+	sb := newSuggestionBuilder(calleeExpr)
+	if _, ok := c.lookupDecl(types.DeclName(sb.input.basePart)); !ok && !strings.Contains(sb.input.selectorPart, ".") {
+		for _, pkgPath := range c.pkgPathsOf(sb.input.basePart) {
+			for _, funcSet := range c.candidates.Funcs[pkgPath] {
+				if string(funcSet.Name) == sb.input.selectorPart {
+					return callee{name: funcSet.Name, signature: funcSet.Signature, params: funcSet.Params, pkgPath: pkgPath}, true
+				}
+			}
+		}
+		return callee{}, false
+	}
+
+	recvTyp, methodName, ok := c.resolveSelectorType(sb)
+	if !ok {
+		return callee{}, false
+	}
+	for _, methodSet := range c.candidates.Methods[recvTyp.TypePkgPath] {
+		if string(methodSet.Name) == methodName && types.TypeName(methodSet.ReceiverTypeName) == recvTyp.TypeName {
+			return callee{name: methodSet.Name, signature: methodSet.Signature, params: methodSet.Params, pkgPath: recvTyp.TypePkgPath}, true
+		}
+	}
+	return callee{}, false
+}
+
+// paramAt は引数の位置に対応する引数を返す。可変長引数は、残りのすべての位置に対応する
+func paramAt(params []paramSet, argIndex int) (paramSet, bool) {
+	if argIndex < len(params) {
+		return params[argIndex], true
+	}
+	if len(params) > 0 && params[len(params)-1].Variadic {
+		return params[len(params)-1], true
+	}
+	return paramSet{}, false
+}
+
+// pkgRefOf はimportパスのパッケージを、入力で参照する名前を返す
+// import文で宣言したパッケージは、別名を付けていればその別名になる
+func (c *Completer) pkgRefOf(pkgPath types.ImportPath) (string, bool) {
+	for _, declaredImport := range c.declRegistry.Imports {
+		if declaredImport.ImportPath == pkgPath && declaredImport.Name != "_" && declaredImport.Name != "." {
+			return string(declaredImport.Name), true
+		}
+	}
+	for _, pkg := range c.candidates.Pkgs {
+		if pkg.ImportPath == pkgPath {
+			return string(pkg.Name), true
+		}
+	}
+	return "", false
+}
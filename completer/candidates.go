@@ -4,9 +4,12 @@ import (
 	"go/ast"
 	gotypes "go/types"
 	"slices"
+	"strconv"
 	"strings"
 
+	"github.com/kakkky/gonsole/declregistry"
 	"github.com/kakkky/gonsole/errs"
+	"github.com/kakkky/gonsole/pkgindex"
 	"github.com/kakkky/gonsole/types"
 	"golang.org/x/tools/go/packages"
 )
@@ -17,42 +20,70 @@ var BuildStdPkgCandidatesMode bool
 // SkipStdPkgMergeはテスト時に標準パッケージのマージをスキップするフラグ
 var SkipStdPkgMergeMode bool
 
+// candidates の要素はパッケージのimportパスごとに保持し、同名の別のパッケージと区別する
 type candidates struct {
-	Pkgs         []types.PkgName
-	Funcs        map[types.PkgName][]funcSet
-	Methods      map[types.PkgName][]methodSet
-	Vars         map[types.PkgName][]varSet
-	Consts       map[types.PkgName][]constSet
-	Structs      map[types.PkgName][]structSet
-	Interfaces   map[types.PkgName][]interfaceSet
-	DefinedTypes map[types.PkgName][]DefinedTypeSet
+	Pkgs         []pkgSet
+	Funcs        map[types.ImportPath][]funcSet
+	Methods      map[types.ImportPath][]methodSet
+	Vars         map[types.ImportPath][]varSet
+	Consts       map[types.ImportPath][]constSet
+	Structs      map[types.ImportPath][]structSet
+	Interfaces   map[types.ImportPath][]interfaceSet
+	DefinedTypes map[types.ImportPath][]DefinedTypeSet
 }
 
 type (
+	pkgSet struct {
+		Name       types.PkgName
+		ImportPath types.ImportPath
+	}
 	funcSet struct {
 		Name        types.DeclName
 		Description string // TODO: descriptionにも型をつけたい
 		Returns     []returnSet
+		// Signature は引数と戻り値の型を表示する文字列（例: (name string) *animal.Dog）
+		Signature string
+		Params    []paramSet
 	}
 	methodSet struct {
 		Name             types.DeclName
 		Description      string
 		ReceiverTypeName types.ReceiverTypeName
 		Returns          []returnSet
+		Signature        string
+		Params           []paramSet
+		// PromotedFrom は埋め込まれた型から昇格したメソッドの場合に、メソッドが宣言された型になる
+		// ドキュメントはマージした後に、宣言された型のメソッドから引き継ぐ
+		PromotedFrom returnSet
 	}
 	varSet struct {
 		Name        types.DeclName
 		Description string
 		TypeName    types.TypeName
-		TypePkgName types.PkgName
+		TypePkgPath types.ImportPath
 	}
 	constSet struct {
 		Name        types.DeclName
 		Description string
+		// 型のない定数は、デフォルトの型（例: int, string）になる
+		TypeName    types.TypeName
+		TypePkgPath types.ImportPath
 	}
 	structSet struct {
-		Name        types.DeclName
-		Fields      []types.StructFieldName // 型情報を持たせてSetにしても良さそう。
+		Name   types.DeclName
+		Fields []types.StructFieldName // 複合リテラルのテンプレートに使う
+		// FieldSets はフィールドの型などの情報で、フィールドアクセスの補完に使う
+		FieldSets   []fieldSet
+		Description string
+	}
+	fieldSet struct {
+		Name types.StructFieldName
+		// TypeStr は説明に表示する型（例: *animal.BaseAnimal）
+		TypeStr     string
+		TypeName    types.TypeName
+		TypePkgPath types.ImportPath
+		// Embedded は埋め込みフィールドかどうかで、埋め込まれた構造体のフィールドは昇格したフィールドとして補完する
+		Embedded    bool
 		Description string
 	}
 	// interfaceの候補を返すわけではなく、関数がinterfaceを返す場合に、
@@ -61,55 +92,122 @@ type (
 		Name         types.DeclName
 		Methods      []types.DeclName
 		Descriptions []string
+		// PromotedFrom は埋め込まれたインターフェースのメソッドごとの、メソッドが宣言されたインターフェース
+		PromotedFrom map[types.DeclName]returnSet
 	}
 	DefinedTypeSet struct {
 		Name                  types.DeclName
 		UnderlyingType        types.TypeName
-		UnderlyingTypePkgName types.PkgName
+		UnderlyingTypePkgPath types.ImportPath
 		Description           string
 	}
 )
 
 type returnSet struct {
 	TypeName    types.TypeName
-	TypePkgName types.PkgName
+	TypePkgPath types.ImportPath
+}
+
+// paramSet は関数やメソッドの引数で、呼び出しの括弧内で型の合う値を補完するために使う
+type paramSet struct {
+	Name string
+	// TypeStr は表示する型（例: *animal.Dog, ...string）
+	TypeStr     string
+	Pointered   bool
+	TypeName    types.TypeName
+	TypePkgPath types.ImportPath
+	// Variadic は可変長引数かどうかで、型は要素の型になる
+	Variadic bool
 }
 
+// unexportedPkgPathに指定したパッケージ（対象パッケージ）は、非公開の要素も候補に含める
+// pkgIndexを指定した場合は、読み込んだパッケージでパッケージの索引を作る
 // nolint:staticcheck // 定義されている変数名、関数名など名前だけに関心があるため、*ast.Packageだけで十分
-func NewCandidates(projectRootPath string) (*candidates, error) {
-	pkgs, err := loadProject(projectRootPath)
+func NewCandidates(projectRootPath string, unexportedPkgPath types.ImportPath, pkgIndex *pkgindex.Index) (*candidates, error) {
+	projectPkgs, err := loadProjectPkgs(projectRootPath, unexportedPkgPath, pkgIndex)
 	if err != nil {
 		return nil, err
 	}
-	c := candidates{
-		Pkgs:         make([]types.PkgName, 0),
-		Funcs:        make(map[types.PkgName][]funcSet),
-		Methods:      make(map[types.PkgName][]methodSet),
-		Vars:         make(map[types.PkgName][]varSet),
-		Consts:       make(map[types.PkgName][]constSet),
-		Structs:      make(map[types.PkgName][]structSet),
-		Interfaces:   make(map[types.PkgName][]interfaceSet),
-		DefinedTypes: make(map[types.PkgName][]DefinedTypeSet),
+	return mergeProjectPkgs(projectPkgs), nil
+}
+
+// loadProjectPkgs はプロジェクト内のパッケージを読み込んで、パッケージごとの候補を作る
+func loadProjectPkgs(projectRootPath string, unexportedPkgPath types.ImportPath, pkgIndex *pkgindex.Index) ([]*projectPkg, error) {
+	pkgs, err := loadProject(projectRootPath, "./...")
+	if err != nil {
+		return nil, err
 	}
+	if pkgIndex != nil {
+		if err := pkgIndex.Set(pkgs); err != nil {
+			return nil, err
+		}
+	}
+	return newProjectPkgs(pkgs, unexportedPkgPath), nil
+}
 
-	// パッケージスコープごとに処理
-	for _, pkg := range pkgs {
-		pkgName := types.PkgName(pkg.Name)
-		c.Pkgs = append(c.Pkgs, pkgName)
-		c.processScope(pkgName, pkg.Types.Scope(), pkg.Syntax)
+// mergeProjectPkgs はパッケージごとの候補をまとめて、標準パッケージの候補とマージする
+func mergeProjectPkgs(projectPkgs []*projectPkg) *candidates {
+	c := newEmptyCandidates()
+	for _, projectPkg := range projectPkgs {
+		c.mergeCandidates(projectPkg.candidates)
 	}
 
 	// 標準パッケージの候補とマージ（テスト時、標準パッケージ候補の生成スクリプト実行時はスキップ）
 	if !SkipStdPkgMergeMode {
 		c.mergeCandidates(stdPkgCandidates)
 	}
+	c.fillPromotedMethodDescriptions()
+	return c
+}
 
-	return &c, nil
+func newEmptyCandidates() *candidates {
+	return &candidates{
+		Pkgs:         make([]pkgSet, 0),
+		Funcs:        make(map[types.ImportPath][]funcSet),
+		Methods:      make(map[types.ImportPath][]methodSet),
+		Vars:         make(map[types.ImportPath][]varSet),
+		Consts:       make(map[types.ImportPath][]constSet),
+		Structs:      make(map[types.ImportPath][]structSet),
+		Interfaces:   make(map[types.ImportPath][]interfaceSet),
+		DefinedTypes: make(map[types.ImportPath][]DefinedTypeSet),
+	}
+}
+
+// withTopLevelDecls はREPLセッション内で宣言された関数・メソッド・型を加えたcandidatesを返す
+// セッション内の宣言は入力のたびに変わるので、元のcandidatesは書き換えずに新しく作る
+func (c *candidates) withTopLevelDecls(topLevelDecls []declregistry.TopLevelDecl) *candidates {
+	merged := newEmptyCandidates()
+	merged.mergeCandidates(c)
+	for _, topLevelDecl := range topLevelDecls {
+		switch objV := topLevelDecl.Obj.(type) {
+		case *gotypes.Func:
+			funcDecl, ok := topLevelDecl.Node.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			if funcDecl.Recv != nil {
+				merged.processMethodDeclObj(topLevelDecl.PkgPath, objV, funcDecl)
+				continue
+			}
+			merged.processFuncDeclObj(topLevelDecl.PkgPath, objV, funcDecl)
+		case *gotypes.TypeName:
+			genDecl, ok := topLevelDecl.Node.(*ast.GenDecl)
+			if !ok {
+				continue
+			}
+			merged.processTypeDeclObj(topLevelDecl.PkgPath, objV, genDecl)
+			if namedType, ok := objV.Type().(*gotypes.Named); ok {
+				merged.processPromotedMethodObjs(topLevelDecl.PkgPath, namedType, true)
+			}
+		}
+	}
+	merged.fillPromotedMethodDescriptions()
+	return merged
 }
 
 // mergeCandidates は他のcandidatesをマージする
 func (c *candidates) mergeCandidates(other *candidates) {
-	// パッケージ名をマージ
+	// パッケージをマージ
 	for _, pkg := range other.Pkgs {
 		if !slices.Contains(c.Pkgs, pkg) {
 			c.Pkgs = append(c.Pkgs, pkg)
@@ -117,49 +215,51 @@ func (c *candidates) mergeCandidates(other *candidates) {
 	}
 
 	// 関数をマージ
-	for pkgName, funcs := range other.Funcs {
-		c.Funcs[pkgName] = append(c.Funcs[pkgName], funcs...)
+	for pkgPath, funcs := range other.Funcs {
+		c.Funcs[pkgPath] = append(c.Funcs[pkgPath], funcs...)
 	}
 
 	// メソッドをマージ
-	for pkgName, methods := range other.Methods {
-		c.Methods[pkgName] = append(c.Methods[pkgName], methods...)
+	for pkgPath, methods := range other.Methods {
+		c.Methods[pkgPath] = append(c.Methods[pkgPath], methods...)
 	}
 
 	// 変数をマージ
-	for pkgName, vars := range other.Vars {
-		c.Vars[pkgName] = append(c.Vars[pkgName], vars...)
+	for pkgPath, vars := range other.Vars {
+		c.Vars[pkgPath] = append(c.Vars[pkgPath], vars...)
 	}
 
 	// 定数をマージ
-	for pkgName, consts := range other.Consts {
-		c.Consts[pkgName] = append(c.Consts[pkgName], consts...)
+	for pkgPath, consts := range other.Consts {
+		c.Consts[pkgPath] = append(c.Consts[pkgPath], consts...)
 	}
 
 	// 構造体をマージ
-	for pkgName, structs := range other.Structs {
-		c.Structs[pkgName] = append(c.Structs[pkgName], structs...)
+	for pkgPath, structs := range other.Structs {
+		c.Structs[pkgPath] = append(c.Structs[pkgPath], structs...)
 	}
 
 	// インターフェースをマージ
-	for pkgName, interfaces := range other.Interfaces {
-		c.Interfaces[pkgName] = append(c.Interfaces[pkgName], interfaces...)
+	for pkgPath, interfaces := range other.Interfaces {
+		c.Interfaces[pkgPath] = append(c.Interfaces[pkgPath], interfaces...)
 	}
 	// 定義済み型をマージ
-	for pkgName, definedTypes := range other.DefinedTypes {
-		c.DefinedTypes[pkgName] = append(c.DefinedTypes[pkgName], definedTypes...)
+	for pkgPath, definedTypes := range other.DefinedTypes {
+		c.DefinedTypes[pkgPath] = append(c.DefinedTypes[pkgPath], definedTypes...)
 	}
 }
 
-func loadProject(path string) ([]*packages.Package, error) {
+// loadProject はpath以下のパッケージのうち、patternsに一致するものを読み込む
+func loadProject(path string, patterns ...string) ([]*packages.Package, error) {
 	cfg := &packages.Config{
 		Mode: packages.NeedName |
+			packages.NeedFiles | // 変更の検知のためにパッケージのディレクトリを使う
 			packages.NeedTypes |
 			packages.NeedTypesInfo |
 			packages.NeedSyntax, // コメント情報などはASTからしか取れない
 		Dir: path,
 	}
-	pkgs, err := packages.Load(cfg, "./...")
+	pkgs, err := packages.Load(cfg, patterns...)
 	if err != nil {
 		return nil, errs.NewInternalError("failed to load packages").Wrap(err)
 	}
@@ -175,17 +275,17 @@ func loadProject(path string) ([]*packages.Package, error) {
 	return pkgs, nil
 }
 
-func (c *candidates) processScope(pkgName types.PkgName, scope *gotypes.Scope, astFiles []*ast.File) {
+func (c *candidates) processScope(pkgPath types.ImportPath, scope *gotypes.Scope, astFiles []*ast.File, includeUnexported bool) {
 	for _, declName := range scope.Names() {
 		declObj := scope.Lookup(declName)
-		if !declObj.Exported() {
+		if !declObj.Exported() && !includeUnexported {
 			continue
 		}
 		if declName == "" || declName == "_" || strings.HasPrefix(declName, "_") {
 			continue
 		}
 
-		declAst := detectDecl(declName, astFiles)
+		declAst := detectDecl(declObj, astFiles)
 		if declAst == nil {
 			continue
 		}
@@ -196,18 +296,18 @@ func (c *candidates) processScope(pkgName types.PkgName, scope *gotypes.Scope, a
 			if !ok {
 				continue
 			}
-			c.processFuncDeclObj(pkgName, declObjV, funcDecl)
+			c.processFuncDeclObj(pkgPath, declObjV, funcDecl)
 		case *gotypes.TypeName:
 			genDecl, ok := declAst.(*ast.GenDecl)
 			if !ok {
 				continue
 			}
-			c.processTypeDeclObj(pkgName, declObjV, genDecl)
+			c.processTypeDeclObj(pkgPath, declObjV, genDecl)
 			switch decTypeObjV := declObjV.Type().(type) {
 			case *gotypes.Named:
 				for i := 0; i < decTypeObjV.NumMethods(); i++ {
 					methodObj := decTypeObjV.Method(i)
-					methodDeclAst := detectDecl(methodObj.Name(), astFiles)
+					methodDeclAst := detectDecl(methodObj, astFiles)
 					if methodDeclAst == nil {
 						continue
 					}
@@ -215,44 +315,46 @@ func (c *candidates) processScope(pkgName types.PkgName, scope *gotypes.Scope, a
 					if !ok {
 						continue
 					}
-					c.processMethodDeclObj(pkgName, methodObj, methodDecl)
+					c.processMethodDeclObj(pkgPath, methodObj, methodDecl)
 				}
+				c.processPromotedMethodObjs(pkgPath, decTypeObjV, includeUnexported)
 			}
 		case *gotypes.Var:
 			genDecl, ok := declAst.(*ast.GenDecl)
 			if !ok {
 				continue
 			}
-			c.processVarDeclObj(pkgName, declObjV, genDecl)
+			c.processVarDeclObj(pkgPath, declObjV, genDecl)
 		case *gotypes.Const:
 			genDecl, ok := declAst.(*ast.GenDecl)
 			if !ok {
 				continue
 			}
-			c.processConstDeclObj(pkgName, declObjV, genDecl)
+			c.processConstDeclObj(pkgPath, declObjV, genDecl)
 		}
 	}
 }
 
-// detectDecl は与えられた名前の宣言をASTファイル群から探し出す
-func detectDecl(declName string, astFiles []*ast.File) ast.Decl {
+// detectDecl は与えられたオブジェクトの宣言をASTファイル群から探し出す
+// 名前ではなく位置で探すので、同名のメソッド（例: time.Hour と Time.Hour）を取り違えない
+func detectDecl(declObj gotypes.Object, astFiles []*ast.File) ast.Decl {
 	for _, astFile := range astFiles {
 		for _, decl := range astFile.Decls {
 			switch declV := decl.(type) {
 			case *ast.FuncDecl:
-				if declV.Name.Name == declName {
+				if declV.Name.Pos() == declObj.Pos() {
 					return declV
 				}
 			case *ast.GenDecl:
 				for _, spec := range declV.Specs {
 					switch specV := spec.(type) {
 					case *ast.TypeSpec:
-						if specV.Name.Name == declName {
+						if specV.Name.Pos() == declObj.Pos() {
 							return declV
 						}
 					case *ast.ValueSpec:
 						for _, name := range specV.Names {
-							if name.Name == declName {
+							if name.Pos() == declObj.Pos() {
 								return declV
 							}
 						}
@@ -265,7 +367,7 @@ func detectDecl(declName string, astFiles []*ast.File) ast.Decl {
 }
 
 // processFuncDeclObj は関数宣言オブジェクトを処理して候補に追加する
-func (c *candidates) processFuncDeclObj(pkgName types.PkgName, funcDeclObj *gotypes.Func, funcDeclAst *ast.FuncDecl) {
+func (c *candidates) processFuncDeclObj(pkgPath types.ImportPath, funcDeclObj *gotypes.Func, funcDeclAst *ast.FuncDecl) {
 	var description string
 	if funcDeclAst.Doc != nil {
 		description = funcDeclAst.Doc.Text()
@@ -273,44 +375,24 @@ func (c *candidates) processFuncDeclObj(pkgName types.PkgName, funcDeclObj *goty
 
 	var returns []returnSet
 	results := funcDeclObj.Signature().Results()
-
-	if results != nil {
-		for i := 0; i < results.Len(); i++ {
-			returnType := results.At(i).Type()
-			var returnTypeName types.TypeName
-			var returnTypePkgName types.PkgName
-
-			switch returnTypeV := returnType.(type) {
-			case *gotypes.Named:
-				returnTypeName = types.TypeName(returnTypeV.Obj().Name())
-				if returnTypeV.Obj().Pkg() != nil {
-					returnTypePkgName = types.PkgName(returnTypeV.Obj().Pkg().Name())
-				}
-			case *gotypes.Pointer:
-				switch pointedTypeV := returnTypeV.Elem().(type) {
-				case *gotypes.Named:
-					returnTypeName = types.TypeName(pointedTypeV.Obj().Name())
-					if pointedTypeV.Obj().Pkg() != nil {
-						returnTypePkgName = types.PkgName(pointedTypeV.Obj().Pkg().Name())
-					}
-				default:
-					returnTypeName = types.TypeName(returnType.String())
-				}
-			default:
-				returnTypeName = types.TypeName(returnType.String())
-			}
-			returns = append(returns, returnSet{
-				TypeName:    returnTypeName,
-				TypePkgName: returnTypePkgName,
-			})
-		}
+	for i := 0; i < results.Len(); i++ {
+		returnTypeName, returnTypePkgPath := namedTypeOf(results.At(i).Type())
+		returns = append(returns, returnSet{TypeName: returnTypeName, TypePkgPath: returnTypePkgPath})
 	}
 
-	c.Funcs[pkgName] = append(c.Funcs[pkgName], funcSet{Name: types.DeclName(funcDeclObj.Name()), Description: description, Returns: returns})
+	signature, params := signatureOf(funcDeclObj.Signature())
+
+	c.Funcs[pkgPath] = append(c.Funcs[pkgPath], funcSet{
+		Name:        types.DeclName(funcDeclObj.Name()),
+		Description: description,
+		Returns:     returns,
+		Signature:   signature,
+		Params:      params,
+	})
 }
 
 // processMethodDeclObj はメソッド宣言オブジェクトを処理して候補に追加する
-func (c *candidates) processMethodDeclObj(pkgName types.PkgName, methodDeclObj *gotypes.Func, methodDeclAst *ast.FuncDecl) {
+func (c *candidates) processMethodDeclObj(pkgPath types.ImportPath, methodDeclObj *gotypes.Func, methodDeclAst *ast.FuncDecl) {
 	var description string
 	if methodDeclAst.Doc != nil {
 		description = methodDeclAst.Doc.Text()
@@ -330,51 +412,118 @@ func (c *candidates) processMethodDeclObj(pkgName types.PkgName, methodDeclObj *
 
 	var returns []returnSet
 	results := methodDeclObj.Signature().Results()
-
-	if results != nil {
-		for i := 0; i < results.Len(); i++ {
-			returnType := results.At(i).Type()
-			var returnTypeName types.TypeName
-			var returnTypePkgName types.PkgName
-
-			switch returnTypeV := returnType.(type) {
-			case *gotypes.Named:
-				returnTypeName = types.TypeName(returnTypeV.Obj().Name())
-				if returnTypeV.Obj().Pkg() != nil {
-					returnTypePkgName = types.PkgName(returnTypeV.Obj().Pkg().Name())
-				}
-			case *gotypes.Pointer:
-				switch pointedTypeV := returnTypeV.Elem().(type) {
-				case *gotypes.Named:
-					returnTypeName = types.TypeName(pointedTypeV.Obj().Name())
-					if pointedTypeV.Obj().Pkg() != nil {
-						returnTypePkgName = types.PkgName(pointedTypeV.Obj().Pkg().Name())
-					}
-				default:
-					returnTypeName = types.TypeName(returnTypeV.String())
-				}
-			default:
-				returnTypeName = types.TypeName(returnType.String())
-			}
-
-			returns = append(returns, returnSet{
-				TypeName:    returnTypeName,
-				TypePkgName: returnTypePkgName,
-			})
-		}
+	for i := 0; i < results.Len(); i++ {
+		returnTypeName, returnTypePkgPath := namedTypeOf(results.At(i).Type())
+		returns = append(returns, returnSet{TypeName: returnTypeName, TypePkgPath: returnTypePkgPath})
 	}
 
-	c.Methods[pkgName] = append(c.Methods[pkgName], methodSet{
+	signature, params := signatureOf(methodDeclObj.Signature())
+
+	c.Methods[pkgPath] = append(c.Methods[pkgPath], methodSet{
 		Name:             types.DeclName(methodDeclObj.Name()),
 		Description:      description,
 		ReceiverTypeName: receiverTypeName,
 		Returns:          returns,
+		Signature:        signature,
+		Params:           params,
 	})
 
 }
 
+// processPromotedMethodObjs は埋め込まれた構造体やインターフェースから昇格したメソッドを、型のメソッドとして候補に追加する
+// ポインタ型のメソッドセットには値のレシーバのメソッドも含まれるので、ポインタ型のメソッドセットから求める
+func (c *candidates) processPromotedMethodObjs(pkgPath types.ImportPath, namedType *gotypes.Named, includeUnexported bool) {
+	if _, ok := namedType.Underlying().(*gotypes.Interface); ok {
+		return
+	}
+	methodSelections := gotypes.NewMethodSet(gotypes.NewPointer(namedType))
+	for i := 0; i < methodSelections.Len(); i++ {
+		selection := methodSelections.At(i)
+		// 型に直接宣言されたメソッドは、ASTからドキュメントを取れるので別に処理している
+		if len(selection.Index()) == 1 {
+			continue
+		}
+		methodObj, ok := selection.Obj().(*gotypes.Func)
+		if !ok {
+			continue
+		}
+		// 他のパッケージの非公開のメソッドは、昇格しても呼び出せない
+		if !methodObj.Exported() && (!includeUnexported || methodObj.Pkg() != namedType.Obj().Pkg()) {
+			continue
+		}
+
+		var returns []returnSet
+		results := methodObj.Signature().Results()
+		for i := 0; i < results.Len(); i++ {
+			returnTypeName, returnTypePkgPath := namedTypeOf(results.At(i).Type())
+			returns = append(returns, returnSet{TypeName: returnTypeName, TypePkgPath: returnTypePkgPath})
+		}
+		promotedFromTypeName, promotedFromPkgPath := namedTypeOf(methodObj.Signature().Recv().Type())
+		signature, params := signatureOf(methodObj.Signature())
+
+		c.Methods[pkgPath] = append(c.Methods[pkgPath], methodSet{
+			Name:             types.DeclName(methodObj.Name()),
+			ReceiverTypeName: types.ReceiverTypeName(namedType.Obj().Name()),
+			Returns:          returns,
+			Signature:        signature,
+			Params:           params,
+			PromotedFrom:     returnSet{TypeName: promotedFromTypeName, TypePkgPath: promotedFromPkgPath},
+		})
+	}
+}
+
+// fillPromotedMethodDescriptions は昇格したメソッドのドキュメントを、メソッドが宣言された型のメソッドから引き継ぐ
+// 宣言された型は他のパッケージにあることがあるので、すべてのパッケージをマージした後に呼び出す
+func (c *candidates) fillPromotedMethodDescriptions() {
+	for _, methodSets := range c.Methods {
+		for i, promoted := range methodSets {
+			if promoted.PromotedFrom.TypeName == "" || promoted.Description != "" {
+				continue
+			}
+			methodSets[i].Description = c.methodDescription(promoted.PromotedFrom, promoted.Name)
+		}
+	}
+	for _, interfaceSets := range c.Interfaces {
+		for j, interfaceSet := range interfaceSets {
+			if len(interfaceSet.PromotedFrom) == 0 {
+				continue
+			}
+			// Descriptionsはマージ元のパッケージごとの候補と共有しているので、書き換えずに作り直す
+			descriptions := slices.Clone(interfaceSet.Descriptions)
+			for i, method := range interfaceSet.Methods {
+				if promotedFrom, ok := interfaceSet.PromotedFrom[method]; ok && descriptions[i] == "" {
+					descriptions[i] = c.methodDescription(promotedFrom, method)
+				}
+			}
+			interfaceSets[j].Descriptions = descriptions
+		}
+	}
+}
+
+// methodDescription は型に宣言されたメソッドのドキュメントを返す
+// インターフェースのメソッドは、インターフェースの候補から探す
+func (c *candidates) methodDescription(recvTyp returnSet, methodName types.DeclName) string {
+	for _, methodSet := range c.Methods[recvTyp.TypePkgPath] {
+		if methodSet.Name == methodName && types.TypeName(methodSet.ReceiverTypeName) == recvTyp.TypeName && methodSet.PromotedFrom.TypeName == "" {
+			return methodSet.Description
+		}
+	}
+	for _, interfaceSet := range c.Interfaces[recvTyp.TypePkgPath] {
+		if types.TypeName(interfaceSet.Name) != recvTyp.TypeName {
+			continue
+		}
+		if _, promoted := interfaceSet.PromotedFrom[methodName]; promoted {
+			continue
+		}
+		if idx := slices.Index(interfaceSet.Methods, methodName); idx >= 0 {
+			return interfaceSet.Descriptions[idx]
+		}
+	}
+	return ""
+}
+
 // processTypeDeclObj は型宣言オブジェクトを処理して候補に追加する
-func (c *candidates) processTypeDeclObj(pkgName types.PkgName, typeDeclObj *gotypes.TypeName, genDeclAst *ast.GenDecl) {
+func (c *candidates) processTypeDeclObj(pkgPath types.ImportPath, typeDeclObj *gotypes.TypeName, genDeclAst *ast.GenDecl) {
 	declName := types.DeclName(typeDeclObj.Name())
 
 	var typeDeclAst *ast.TypeSpec
@@ -391,44 +540,181 @@ func (c *candidates) processTypeDeclObj(pkgName types.PkgName, typeDeclObj *goty
 	underlyingType := typeDeclObj.Type().Underlying()
 	switch underlyingTypeV := underlyingType.(type) {
 	case *gotypes.Struct:
-		c.processStructTypeDeclObj(pkgName, declName, underlyingTypeV, genDeclAst)
+		c.processStructTypeDeclObj(pkgPath, declName, underlyingTypeV, genDeclAst)
 	case *gotypes.Interface:
-		c.processInterfaceTypeDeclObj(pkgName, declName, underlyingTypeV, typeDeclAst)
+		c.processInterfaceTypeDeclObj(pkgPath, declName, underlyingTypeV, typeDeclAst)
 	default:
-		c.processDefinedTypeDeclObj(pkgName, declName, underlyingTypeV, genDeclAst)
+		c.processDefinedTypeDeclObj(pkgPath, declName, underlyingTypeV, genDeclAst)
 	}
 }
 
 // processStructTypeDeclObj は構造体型宣言オブジェクトを処理して候補に追加する
-func (c *candidates) processStructTypeDeclObj(pkgName types.PkgName, declName types.DeclName, structDeclObj *gotypes.Struct, genDeclAst *ast.GenDecl) {
+func (c *candidates) processStructTypeDeclObj(pkgPath types.ImportPath, declName types.DeclName, structDeclObj *gotypes.Struct, genDeclAst *ast.GenDecl) {
 	var description string
 	if genDeclAst != nil && genDeclAst.Doc != nil {
 		description = genDeclAst.Doc.Text()
 	}
 
 	var fields []types.StructFieldName
+	var fieldSets []fieldSet
+	fieldDocs := structFieldDocs(declName, genDeclAst)
 	for i := 0; i < structDeclObj.NumFields(); i++ {
 		fieldObj := structDeclObj.Field(i)
 		fields = append(fields, types.StructFieldName(fieldObj.Name()))
+
+		fieldTypeName, fieldTypePkgPath := namedTypeOf(fieldObj.Type())
+		fieldSets = append(fieldSets, fieldSet{
+			Name:        types.StructFieldName(fieldObj.Name()),
+			TypeStr:     gotypes.TypeString(fieldObj.Type(), qualifyByPkgName),
+			TypeName:    fieldTypeName,
+			TypePkgPath: fieldTypePkgPath,
+			Embedded:    fieldObj.Embedded(),
+			Description: fieldDocs[fieldObj.Name()],
+		})
 	}
 
-	c.Structs[pkgName] = append(c.Structs[pkgName], structSet{
+	c.Structs[pkgPath] = append(c.Structs[pkgPath], structSet{
 		Name:        declName,
 		Fields:      fields,
+		FieldSets:   fieldSets,
 		Description: description,
 	})
 }
 
+// namedTypeOf は型から、候補を引くための型名とパッケージのimportパスを取り出す
+// ポインタ型は指している型として扱い、名前のない型は型の文字列を型名とする
+func namedTypeOf(typ gotypes.Type) (types.TypeName, types.ImportPath) {
+	if pointerType, ok := typ.(*gotypes.Pointer); ok {
+		if _, ok := pointerType.Elem().(*gotypes.Named); ok {
+			typ = pointerType.Elem()
+		}
+	}
+	namedType, ok := typ.(*gotypes.Named)
+	if !ok {
+		return types.TypeName(typ.String()), ""
+	}
+	var pkgPath types.ImportPath
+	if namedType.Obj().Pkg() != nil {
+		pkgPath = importPathOf(namedType.Obj().Pkg())
+	}
+	return types.TypeName(namedType.Obj().Name()), pkgPath
+}
+
+// signatureOf は関数の型から、表示するシグネチャと引数を取り出す
+func signatureOf(signature *gotypes.Signature) (string, []paramSet) {
+	var params []paramSet
+	for i := 0; i < signature.Params().Len(); i++ {
+		param := signature.Params().At(i)
+		typ := param.Type()
+		typeStr := gotypes.TypeString(typ, qualifyByPkgName)
+		variadic := signature.Variadic() && i == signature.Params().Len()-1
+		if variadic {
+			if sliceType, ok := typ.(*gotypes.Slice); ok {
+				typ = sliceType.Elem()
+				typeStr = "..." + gotypes.TypeString(typ, qualifyByPkgName)
+			}
+		}
+		var pointered bool
+		if pointerType, ok := typ.(*gotypes.Pointer); ok {
+			pointered = true
+			typ = pointerType.Elem()
+		}
+		typeName, typePkgPath := namedTypeOf(typ)
+		params = append(params, paramSet{
+			Name:        param.Name(),
+			TypeStr:     typeStr,
+			Pointered:   pointered,
+			TypeName:    typeName,
+			TypePkgPath: typePkgPath,
+			Variadic:    variadic,
+		})
+	}
+	return strings.TrimPrefix(gotypes.TypeString(signature, qualifyByPkgName), "func"), params
+}
+
+// importPathOf はパッケージのimportパスを、import文と同じく引用符で囲んで返す
+func importPathOf(pkg *gotypes.Package) types.ImportPath {
+	return types.ImportPath(strconv.Quote(pkg.Path()))
+}
+
+// qualifyByPkgName は型を文字列にする時に、パッケージをパッケージ名で修飾する
+func qualifyByPkgName(pkg *gotypes.Package) string {
+	return pkg.Name()
+}
+
+// structFieldDocs は構造体の宣言のASTから、フィールドごとのドキュメントを取り出す
+// フィールドの前にコメントがなければ、行末のコメントを使う
+func structFieldDocs(declName types.DeclName, genDeclAst *ast.GenDecl) map[string]string {
+	fieldDocs := make(map[string]string)
+	if genDeclAst == nil {
+		return fieldDocs
+	}
+	for _, spec := range genDeclAst.Specs {
+		typeSpec, ok := spec.(*ast.TypeSpec)
+		if !ok || typeSpec.Name.Name != string(declName) {
+			continue
+		}
+		structType, ok := typeSpec.Type.(*ast.StructType)
+		if !ok {
+			continue
+		}
+		for _, field := range structType.Fields.List {
+			doc := field.Doc
+			if doc == nil {
+				doc = field.Comment
+			}
+			if doc == nil {
+				continue
+			}
+			for _, name := range field.Names {
+				fieldDocs[name.Name] = doc.Text()
+			}
+			// 埋め込みフィールドは型名がフィールド名になる
+			if len(field.Names) == 0 {
+				fieldDocs[embeddedFieldName(field.Type)] = doc.Text()
+			}
+		}
+	}
+	return fieldDocs
+}
+
+// embeddedFieldName は埋め込みフィールドの型の式から、フィールド名を返す
+func embeddedFieldName(typeExpr ast.Expr) string {
+	switch typeExprV := typeExpr.(type) {
+	case *ast.StarExpr:
+		return embeddedFieldName(typeExprV.X)
+	case *ast.SelectorExpr:
+		return typeExprV.Sel.Name
+	case *ast.IndexExpr:
+		return embeddedFieldName(typeExprV.X)
+	case *ast.IndexListExpr:
+		return embeddedFieldName(typeExprV.X)
+	case *ast.Ident:
+		return typeExprV.Name
+	}
+	return ""
+}
+
 // processInterfaceTypeDeclObj はインターフェース型宣言オブジェクトを処理して候補に追加する
-func (c *candidates) processInterfaceTypeDeclObj(pkgName types.PkgName, declName types.DeclName, interfaceDeclObj *gotypes.Interface, typeDeclAst *ast.TypeSpec) {
+func (c *candidates) processInterfaceTypeDeclObj(pkgPath types.ImportPath, declName types.DeclName, interfaceDeclObj *gotypes.Interface, typeDeclAst *ast.TypeSpec) {
 	var methods []types.DeclName
 	var descriptions []string
+	var promotedFrom map[types.DeclName]returnSet
 
 	// 各メソッドのドキュメントを取得
+	// 埋め込まれたインターフェースのメソッドも含まれるが、そのドキュメントはマージした後に引き継ぐ
 	for i := 0; i < interfaceDeclObj.NumMethods(); i++ {
 		methodObj := interfaceDeclObj.Method(i)
 		methods = append(methods, types.DeclName(methodObj.Name()))
 
+		declaredTypeName, declaredPkgPath := namedTypeOf(methodObj.Signature().Recv().Type())
+		if declaredTypeName != types.TypeName(declName) || declaredPkgPath != pkgPath {
+			if promotedFrom == nil {
+				promotedFrom = make(map[types.DeclName]returnSet)
+			}
+			promotedFrom[types.DeclName(methodObj.Name())] = returnSet{TypeName: declaredTypeName, TypePkgPath: declaredPkgPath}
+		}
+
 		// ASTからメソッドのドキュメントを探す
 		var description string
 		switch typeDeclAstV := typeDeclAst.Type.(type) {
@@ -447,21 +733,22 @@ func (c *candidates) processInterfaceTypeDeclObj(pkgName types.PkgName, declName
 		descriptions = append(descriptions, description)
 	}
 
-	c.Interfaces[pkgName] = append(c.Interfaces[pkgName], interfaceSet{
+	c.Interfaces[pkgPath] = append(c.Interfaces[pkgPath], interfaceSet{
 		Name:         declName,
 		Methods:      methods,
 		Descriptions: descriptions,
+		PromotedFrom: promotedFrom,
 	})
 }
 
-func (c *candidates) processDefinedTypeDeclObj(pkgName types.PkgName, declName types.DeclName, underlyingType gotypes.Type, genDeclAst *ast.GenDecl) {
+func (c *candidates) processDefinedTypeDeclObj(pkgPath types.ImportPath, declName types.DeclName, underlyingType gotypes.Type, genDeclAst *ast.GenDecl) {
 	var description string
 	if genDeclAst != nil && genDeclAst.Doc != nil {
 		description = genDeclAst.Doc.Text()
 	}
 
 	var underlyingTypeName types.TypeName
-	var underlyingTypePkgName types.PkgName
+	var underlyingTypePkgPath types.ImportPath
 
 	switch typeV := underlyingType.(type) {
 	case *gotypes.Pointer:
@@ -469,7 +756,7 @@ func (c *candidates) processDefinedTypeDeclObj(pkgName types.PkgName, declName t
 		case *gotypes.Named:
 			underlyingTypeName = types.TypeName(pointedTypeV.Obj().Name())
 			if pointedTypeV.Obj().Pkg() != nil {
-				underlyingTypePkgName = types.PkgName(pointedTypeV.Obj().Pkg().Name())
+				underlyingTypePkgPath = importPathOf(pointedTypeV.Obj().Pkg())
 			}
 		default:
 			underlyingTypeName = types.TypeName(typeV.String())
@@ -478,15 +765,15 @@ func (c *candidates) processDefinedTypeDeclObj(pkgName types.PkgName, declName t
 		underlyingTypeName = types.TypeName(typeV.String())
 	}
 
-	c.DefinedTypes[pkgName] = append(c.DefinedTypes[pkgName], DefinedTypeSet{
+	c.DefinedTypes[pkgPath] = append(c.DefinedTypes[pkgPath], DefinedTypeSet{
 		Name:                  declName,
 		UnderlyingType:        underlyingTypeName,
-		UnderlyingTypePkgName: underlyingTypePkgName,
+		UnderlyingTypePkgPath: underlyingTypePkgPath,
 		Description:           description,
 	})
 }
 
-func (c *candidates) processVarDeclObj(pkgName types.PkgName, varDeclObj *gotypes.Var, genDeclAst *ast.GenDecl) {
+func (c *candidates) processVarDeclObj(pkgPath types.ImportPath, varDeclObj *gotypes.Var, genDeclAst *ast.GenDecl) {
 	declName := types.DeclName(varDeclObj.Name())
 
 	var varDeclAst *ast.ValueSpec
@@ -509,37 +796,17 @@ func (c *candidates) processVarDeclObj(pkgName types.PkgName, varDeclObj *gotype
 		description = genDeclAst.Doc.Text()
 	}
 
-	var typeName types.TypeName
-	var typePkgName types.PkgName
-	switch varTypeV := varDeclObj.Type().(type) {
-	case *gotypes.Named:
-		typeName = types.TypeName(varTypeV.Obj().Name())
-		if varTypeV.Obj().Pkg() != nil {
-			typePkgName = types.PkgName(varTypeV.Obj().Pkg().Name())
-		}
-	case *gotypes.Pointer:
-		switch pointedTypeV := varTypeV.Elem().(type) {
-		case *gotypes.Named:
-			typeName = types.TypeName(pointedTypeV.Obj().Name())
-			if pointedTypeV.Obj().Pkg() != nil {
-				typePkgName = types.PkgName(pointedTypeV.Obj().Pkg().Name())
-			}
-		default:
-			typeName = types.TypeName(varTypeV.String())
-		}
-	default:
-		typeName = types.TypeName(varTypeV.String())
-	}
+	typeName, typePkgPath := namedTypeOf(varDeclObj.Type())
 
-	c.Vars[pkgName] = append(c.Vars[pkgName], varSet{
+	c.Vars[pkgPath] = append(c.Vars[pkgPath], varSet{
 		Name:        declName,
 		Description: description,
 		TypeName:    typeName,
-		TypePkgName: typePkgName,
+		TypePkgPath: typePkgPath,
 	})
 }
 
-func (c *candidates) processConstDeclObj(pkgName types.PkgName, constDeclObj *gotypes.Const, genDeclAst *ast.GenDecl) {
+func (c *candidates) processConstDeclObj(pkgPath types.ImportPath, constDeclObj *gotypes.Const, genDeclAst *ast.GenDecl) {
 	declName := types.DeclName(constDeclObj.Name())
 
 	var constDeclAst *ast.ValueSpec
@@ -562,8 +829,12 @@ func (c *candidates) processConstDeclObj(pkgName types.PkgName, constDeclObj *go
 		description = genDeclAst.Doc.Text()
 	}
 
-	c.Consts[pkgName] = append(c.Consts[pkgName], constSet{
+	typeName, typePkgPath := namedTypeOf(gotypes.Default(constDeclObj.Type()))
+
+	c.Consts[pkgPath] = append(c.Consts[pkgPath], constSet{
 		Name:        declName,
 		Description: description,
+		TypeName:    typeName,
+		TypePkgPath: typePkgPath,
 	})
 }
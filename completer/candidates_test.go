@@ -14,298 +14,385 @@ func TestCandidates(t *testing.T) {
 	defer func() { SkipStdPkgMergeMode = false }()
 
 	tests := []struct {
-		name string
-		path string
-		want *candidates
+		name              string
+		path              string
+		unexportedPkgPath types.ImportPath
+		want              *candidates
 	}{
 		{
 			name: "functions",
 			path: "./testdata/candidates/funcs",
 			want: &candidates{
-				Pkgs: []types.PkgName{"funcs"},
-				Funcs: map[types.PkgName][]funcSet{
-					"funcs": {
-						{Name: "Add", Description: "Add adds two integers and returns the sum\n", Returns: []returnSet{{TypeName: "int", TypePkgName: ""}}},
-						{Name: "ReturnMultiple", Description: "ReturnMultiple returns multiple values\n", Returns: []returnSet{{TypeName: "int", TypePkgName: ""}, {TypeName: "string", TypePkgName: ""}}},
+				Pkgs: []pkgSet{{Name: "funcs", ImportPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/funcs"`}},
+				Funcs: map[types.ImportPath][]funcSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/funcs"`: {
+						{Name: "Add", Description: "Add adds two integers and returns the sum\n", Returns: []returnSet{{TypeName: "int", TypePkgPath: ""}}, Signature: "(a int, b int) int", Params: []paramSet{{Name: "a", TypeStr: "int", TypeName: "int"}, {Name: "b", TypeStr: "int", TypeName: "int"}}},
+						{Name: "ReturnMultiple", Description: "ReturnMultiple returns multiple values\n", Returns: []returnSet{{TypeName: "int", TypePkgPath: ""}, {TypeName: "string", TypePkgPath: ""}}, Signature: "() (int, string)"},
 					},
 				},
-				Methods:      map[types.PkgName][]methodSet{},
-				Vars:         map[types.PkgName][]varSet{},
-				Consts:       map[types.PkgName][]constSet{},
-				Structs:      map[types.PkgName][]structSet{},
-				Interfaces:   map[types.PkgName][]interfaceSet{},
-				DefinedTypes: map[types.PkgName][]DefinedTypeSet{},
+				Methods:      map[types.ImportPath][]methodSet{},
+				Vars:         map[types.ImportPath][]varSet{},
+				Consts:       map[types.ImportPath][]constSet{},
+				Structs:      map[types.ImportPath][]structSet{},
+				Interfaces:   map[types.ImportPath][]interfaceSet{},
+				DefinedTypes: map[types.ImportPath][]DefinedTypeSet{},
 			},
 		},
 		{
 			name: "methods",
 			path: "./testdata/candidates/methods",
 			want: &candidates{
-				Pkgs:  []types.PkgName{"methods"},
-				Funcs: map[types.PkgName][]funcSet{},
-				Methods: map[types.PkgName][]methodSet{
-					"methods": {
-						{Name: "Increment", Description: "Increment increments the counter value\n", ReceiverTypeName: "Counter", Returns: []returnSet{{TypeName: "int", TypePkgName: ""}}},
-						{Name: "GetValue", Description: "GetValue returns the current value\n", ReceiverTypeName: "Counter", Returns: []returnSet{{TypeName: "int", TypePkgName: ""}}},
+				Pkgs:  []pkgSet{{Name: "methods", ImportPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/methods"`}},
+				Funcs: map[types.ImportPath][]funcSet{},
+				Methods: map[types.ImportPath][]methodSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/methods"`: {
+						{Name: "Increment", Description: "Increment increments the counter value\n", ReceiverTypeName: "Counter", Returns: []returnSet{{TypeName: "int", TypePkgPath: ""}}, Signature: "() int"},
+						{Name: "GetValue", Description: "GetValue returns the current value\n", ReceiverTypeName: "Counter", Returns: []returnSet{{TypeName: "int", TypePkgPath: ""}}, Signature: "() int"},
 					},
 				},
-				Vars:   map[types.PkgName][]varSet{},
-				Consts: map[types.PkgName][]constSet{},
-				Structs: map[types.PkgName][]structSet{
-					"methods": {{Name: "Counter", Fields: []types.StructFieldName{"Value"}, Description: "Counter is a simple counter type\n"}},
+				Vars:   map[types.ImportPath][]varSet{},
+				Consts: map[types.ImportPath][]constSet{},
+				Structs: map[types.ImportPath][]structSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/methods"`: {{Name: "Counter", Fields: []types.StructFieldName{"Value"}, FieldSets: []fieldSet{{Name: "Value", TypeStr: "int", TypeName: "int"}}, Description: "Counter is a simple counter type\n"}},
 				},
-				Interfaces:   map[types.PkgName][]interfaceSet{},
-				DefinedTypes: map[types.PkgName][]DefinedTypeSet{},
+				Interfaces:   map[types.ImportPath][]interfaceSet{},
+				DefinedTypes: map[types.ImportPath][]DefinedTypeSet{},
 			},
 		},
 		{
 			name: "vars_basiclit",
 			path: "./testdata/candidates/vars_basiclit",
 			want: &candidates{
-				Pkgs:    []types.PkgName{"varsbasiclit"},
-				Funcs:   map[types.PkgName][]funcSet{},
-				Methods: map[types.PkgName][]methodSet{},
-				Vars: map[types.PkgName][]varSet{
-					"varsbasiclit": {
-						{Name: "IntVar", Description: "IntVar is an integer variable\n", TypeName: "int", TypePkgName: ""},
-						{Name: "StringVar", Description: "StringVar is a string variable\n", TypeName: "string", TypePkgName: ""},
-						{Name: "FloatVar", Description: "FloatVar is a float variable\n", TypeName: "float64", TypePkgName: ""},
+				Pkgs:    []pkgSet{{Name: "varsbasiclit", ImportPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/vars_basiclit"`}},
+				Funcs:   map[types.ImportPath][]funcSet{},
+				Methods: map[types.ImportPath][]methodSet{},
+				Vars: map[types.ImportPath][]varSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/vars_basiclit"`: {
+						{Name: "IntVar", Description: "IntVar is an integer variable\n", TypeName: "int", TypePkgPath: ""},
+						{Name: "StringVar", Description: "StringVar is a string variable\n", TypeName: "string", TypePkgPath: ""},
+						{Name: "FloatVar", Description: "FloatVar is a float variable\n", TypeName: "float64", TypePkgPath: ""},
 					},
 				},
-				Consts:       map[types.PkgName][]constSet{},
-				Structs:      map[types.PkgName][]structSet{},
-				Interfaces:   map[types.PkgName][]interfaceSet{},
-				DefinedTypes: map[types.PkgName][]DefinedTypeSet{},
+				Consts:       map[types.ImportPath][]constSet{},
+				Structs:      map[types.ImportPath][]structSet{},
+				Interfaces:   map[types.ImportPath][]interfaceSet{},
+				DefinedTypes: map[types.ImportPath][]DefinedTypeSet{},
 			},
 		},
 		{
 			name: "vars_compositelit",
 			path: "./testdata/candidates/vars_compositelit",
 			want: &candidates{
-				Pkgs:    []types.PkgName{"varscompositelit"},
-				Funcs:   map[types.PkgName][]funcSet{},
-				Methods: map[types.PkgName][]methodSet{},
-				Vars: map[types.PkgName][]varSet{
-					"varscompositelit": {
-						{Name: "SimplePerson", Description: "SimplePerson is initialized with a composite literal\n", TypeName: "Person", TypePkgName: "varscompositelit"},
-						{Name: "PersonPtr", Description: "PersonPtr is initialized with a pointer to composite literal\n", TypeName: "Person", TypePkgName: "varscompositelit"},
+				Pkgs:    []pkgSet{{Name: "varscompositelit", ImportPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/vars_compositelit"`}},
+				Funcs:   map[types.ImportPath][]funcSet{},
+				Methods: map[types.ImportPath][]methodSet{},
+				Vars: map[types.ImportPath][]varSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/vars_compositelit"`: {
+						{Name: "SimplePerson", Description: "SimplePerson is initialized with a composite literal\n", TypeName: "Person", TypePkgPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/vars_compositelit"`},
+						{Name: "PersonPtr", Description: "PersonPtr is initialized with a pointer to composite literal\n", TypeName: "Person", TypePkgPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/vars_compositelit"`},
 					},
 				},
-				Consts: map[types.PkgName][]constSet{},
-				Structs: map[types.PkgName][]structSet{
-					"varscompositelit": {{Name: "Person", Fields: []types.StructFieldName{"Name", "Age"}, Description: "Person is a simple struct\n"}},
+				Consts: map[types.ImportPath][]constSet{},
+				Structs: map[types.ImportPath][]structSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/vars_compositelit"`: {{Name: "Person", Fields: []types.StructFieldName{"Name", "Age"}, FieldSets: []fieldSet{{Name: "Name", TypeStr: "string", TypeName: "string"}, {Name: "Age", TypeStr: "int", TypeName: "int"}}, Description: "Person is a simple struct\n"}},
 				},
-				Interfaces:   map[types.PkgName][]interfaceSet{},
-				DefinedTypes: map[types.PkgName][]DefinedTypeSet{},
+				Interfaces:   map[types.ImportPath][]interfaceSet{},
+				DefinedTypes: map[types.ImportPath][]DefinedTypeSet{},
 			},
 		},
 		{
 			name: "vars_funccall",
 			path: "./testdata/candidates/vars_funccall",
 			want: &candidates{
-				Pkgs: []types.PkgName{"varsfunccall"},
-				Funcs: map[types.PkgName][]funcSet{
-					"varsfunccall": {{Name: "NewConfig", Description: "NewConfig creates a new Config instance\n", Returns: []returnSet{{TypeName: "Config", TypePkgName: "varsfunccall"}}}},
+				Pkgs: []pkgSet{{Name: "varsfunccall", ImportPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/vars_funccall"`}},
+				Funcs: map[types.ImportPath][]funcSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/vars_funccall"`: {{Name: "NewConfig", Description: "NewConfig creates a new Config instance\n", Returns: []returnSet{{TypeName: "Config", TypePkgPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/vars_funccall"`}}, Signature: "() varsfunccall.Config"}},
 				},
-				Methods: map[types.PkgName][]methodSet{},
-				Vars: map[types.PkgName][]varSet{
-					"varsfunccall": {{Name: "ConfigVar", Description: "ConfigVar is initialized by a function call\n", TypeName: "Config", TypePkgName: "varsfunccall"}},
+				Methods: map[types.ImportPath][]methodSet{},
+				Vars: map[types.ImportPath][]varSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/vars_funccall"`: {{Name: "ConfigVar", Description: "ConfigVar is initialized by a function call\n", TypeName: "Config", TypePkgPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/vars_funccall"`}},
 				},
-				Consts: map[types.PkgName][]constSet{},
-				Structs: map[types.PkgName][]structSet{
-					"varsfunccall": {{Name: "Config", Fields: []types.StructFieldName{"Name"}, Description: "Config is a configuration struct\n"}},
+				Consts: map[types.ImportPath][]constSet{},
+				Structs: map[types.ImportPath][]structSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/vars_funccall"`: {{Name: "Config", Fields: []types.StructFieldName{"Name"}, FieldSets: []fieldSet{{Name: "Name", TypeStr: "string", TypeName: "string"}}, Description: "Config is a configuration struct\n"}},
 				},
-				Interfaces:   map[types.PkgName][]interfaceSet{},
-				DefinedTypes: map[types.PkgName][]DefinedTypeSet{},
+				Interfaces:   map[types.ImportPath][]interfaceSet{},
+				DefinedTypes: map[types.ImportPath][]DefinedTypeSet{},
 			},
 		},
 		{
 			name: "vars_methodcall",
 			path: "./testdata/candidates/vars_methodcall",
 			want: &candidates{
-				Pkgs: []types.PkgName{"varsmethodcall"},
-				Funcs: map[types.PkgName][]funcSet{
-					"varsmethodcall": {{Name: "NewLogger", Description: "NewLogger creates a new Logger instance\n", Returns: []returnSet{{TypeName: "Logger", TypePkgName: "varsmethodcall"}}}},
+				Pkgs: []pkgSet{{Name: "varsmethodcall", ImportPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/vars_methodcall"`}},
+				Funcs: map[types.ImportPath][]funcSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/vars_methodcall"`: {{Name: "NewLogger", Description: "NewLogger creates a new Logger instance\n", Returns: []returnSet{{TypeName: "Logger", TypePkgPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/vars_methodcall"`}}, Signature: "() varsmethodcall.Logger"}},
 				},
-				Methods: map[types.PkgName][]methodSet{
-					"varsmethodcall": {
-						{Name: "Info", Description: "Info logs an info message and returns the logged message\n", ReceiverTypeName: "Logger", Returns: []returnSet{{TypeName: "string", TypePkgName: ""}}},
+				Methods: map[types.ImportPath][]methodSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/vars_methodcall"`: {
+						{Name: "Info", Description: "Info logs an info message and returns the logged message\n", ReceiverTypeName: "Logger", Returns: []returnSet{{TypeName: "string", TypePkgPath: ""}}, Signature: "(msg string) string", Params: []paramSet{{Name: "msg", TypeStr: "string", TypeName: "string"}}},
 					},
 				},
-				Vars: map[types.PkgName][]varSet{
-					"varsmethodcall": {
-						{Name: "GlobalLogger", Description: "GlobalLogger is a top-level variable\n", TypeName: "Logger", TypePkgName: "varsmethodcall"},
-						{Name: "ResultFromMethod", Description: "ResultFromMethod is initialized by a method call on a top-level variable\n", TypeName: "string", TypePkgName: ""},
+				Vars: map[types.ImportPath][]varSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/vars_methodcall"`: {
+						{Name: "GlobalLogger", Description: "GlobalLogger is a top-level variable\n", TypeName: "Logger", TypePkgPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/vars_methodcall"`},
+						{Name: "ResultFromMethod", Description: "ResultFromMethod is initialized by a method call on a top-level variable\n", TypeName: "string", TypePkgPath: ""},
 					},
 				},
-				Consts: map[types.PkgName][]constSet{},
-				Structs: map[types.PkgName][]structSet{
-					"varsmethodcall": {{Name: "Logger", Fields: []types.StructFieldName{"Name"}, Description: "Logger is a simple logger type\n"}},
+				Consts: map[types.ImportPath][]constSet{},
+				Structs: map[types.ImportPath][]structSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/vars_methodcall"`: {{Name: "Logger", Fields: []types.StructFieldName{"Name"}, FieldSets: []fieldSet{{Name: "Name", TypeStr: "string", TypeName: "string"}}, Description: "Logger is a simple logger type\n"}},
 				},
-				Interfaces:   map[types.PkgName][]interfaceSet{},
-				DefinedTypes: map[types.PkgName][]DefinedTypeSet{},
+				Interfaces:   map[types.ImportPath][]interfaceSet{},
+				DefinedTypes: map[types.ImportPath][]DefinedTypeSet{},
 			},
 		},
 		{
 			name: "consts",
 			path: "./testdata/candidates/consts",
 			want: &candidates{
-				Pkgs:    []types.PkgName{"consts"},
-				Funcs:   map[types.PkgName][]funcSet{},
-				Methods: map[types.PkgName][]methodSet{},
-				Vars:    map[types.PkgName][]varSet{},
-				Consts: map[types.PkgName][]constSet{
-					"consts": {
-						{Name: "MaxSize", Description: "MaxSize is the maximum size\n"},
-						{Name: "MinValue", Description: "MinValue is the minimum value\n"},
-						{Name: "MaxValue", Description: "MaxValue is the maximum value\n"},
-						{Name: "DefaultWidth", Description: "Multiple names in one spec\n"},
-						{Name: "DefaultHeight", Description: "Multiple names in one spec\n"},
+				Pkgs:    []pkgSet{{Name: "consts", ImportPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/consts"`}},
+				Funcs:   map[types.ImportPath][]funcSet{},
+				Methods: map[types.ImportPath][]methodSet{},
+				Vars:    map[types.ImportPath][]varSet{},
+				Consts: map[types.ImportPath][]constSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/consts"`: {
+						{Name: "MaxSize", Description: "MaxSize is the maximum size\n", TypeName: "int"},
+						{Name: "MinValue", Description: "MinValue is the minimum value\n", TypeName: "int"},
+						{Name: "MaxValue", Description: "MaxValue is the maximum value\n", TypeName: "int"},
+						{Name: "DefaultWidth", Description: "Multiple names in one spec\n", TypeName: "int"},
+						{Name: "DefaultHeight", Description: "Multiple names in one spec\n", TypeName: "int"},
 					},
 				},
-				Structs:      map[types.PkgName][]structSet{},
-				Interfaces:   map[types.PkgName][]interfaceSet{},
-				DefinedTypes: map[types.PkgName][]DefinedTypeSet{},
+				Structs:      map[types.ImportPath][]structSet{},
+				Interfaces:   map[types.ImportPath][]interfaceSet{},
+				DefinedTypes: map[types.ImportPath][]DefinedTypeSet{},
 			},
 		},
 		{
 			name: "structs",
 			path: "./testdata/candidates/structs",
 			want: &candidates{
-				Pkgs:    []types.PkgName{"structs"},
-				Funcs:   map[types.PkgName][]funcSet{},
-				Methods: map[types.PkgName][]methodSet{},
-				Vars:    map[types.PkgName][]varSet{},
-				Consts:  map[types.PkgName][]constSet{},
-				Structs: map[types.PkgName][]structSet{
-					"structs": {
-						{Name: "SimpleStruct", Fields: []types.StructFieldName{"FieldA", "FieldB"}, Description: "SimpleStruct has simple fields\n"},
-						{Name: "MultiFieldStruct", Fields: []types.StructFieldName{"X", "Y", "Z"}, Description: "MultiFieldStruct has multiple fields on same line\n"},
-						{Name: "Base", Fields: []types.StructFieldName{"ID"}, Description: "Base is used for embedding\n"},
-						{Name: "Derived", Fields: []types.StructFieldName{"Base", "Name"}, Description: "Derived embeds Base\n"},
+				Pkgs:    []pkgSet{{Name: "structs", ImportPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/structs"`}},
+				Funcs:   map[types.ImportPath][]funcSet{},
+				Methods: map[types.ImportPath][]methodSet{},
+				Vars:    map[types.ImportPath][]varSet{},
+				Consts:  map[types.ImportPath][]constSet{},
+				Structs: map[types.ImportPath][]structSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/structs"`: {
+						{Name: "SimpleStruct", Fields: []types.StructFieldName{"FieldA", "FieldB"}, FieldSets: []fieldSet{{Name: "FieldA", TypeStr: "string", TypeName: "string"}, {Name: "FieldB", TypeStr: "int", TypeName: "int"}}, Description: "SimpleStruct has simple fields\n"},
+						{Name: "MultiFieldStruct", Fields: []types.StructFieldName{"X", "Y", "Z"}, FieldSets: []fieldSet{{Name: "X", TypeStr: "int", TypeName: "int"}, {Name: "Y", TypeStr: "int", TypeName: "int"}, {Name: "Z", TypeStr: "int", TypeName: "int"}}, Description: "MultiFieldStruct has multiple fields on same line\n"},
+						{Name: "Base", Fields: []types.StructFieldName{"ID"}, FieldSets: []fieldSet{{Name: "ID", TypeStr: "int", TypeName: "int", Description: "ID identifies the entity\n"}}, Description: "Base is used for embedding\n"},
+						{Name: "Derived", Fields: []types.StructFieldName{"Base", "Name"}, FieldSets: []fieldSet{
+							{Name: "Base", TypeStr: "structs.Base", TypeName: "Base", TypePkgPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/structs"`, Embedded: true, Description: "Base holds the common fields\n"},
+							{Name: "Name", TypeStr: "string", TypeName: "string"},
+						}, Description: "Derived embeds Base\n"},
 					},
 				},
-				Interfaces:   map[types.PkgName][]interfaceSet{},
-				DefinedTypes: map[types.PkgName][]DefinedTypeSet{},
+				Interfaces:   map[types.ImportPath][]interfaceSet{},
+				DefinedTypes: map[types.ImportPath][]DefinedTypeSet{},
 			},
 		},
 		{
 			name: "interfaces",
 			path: "./testdata/candidates/interfaces",
 			want: &candidates{
-				Pkgs:    []types.PkgName{"interfaces"},
-				Funcs:   map[types.PkgName][]funcSet{},
-				Methods: map[types.PkgName][]methodSet{},
-				Vars:    map[types.PkgName][]varSet{},
-				Consts:  map[types.PkgName][]constSet{},
-				Structs: map[types.PkgName][]structSet{},
-				Interfaces: map[types.PkgName][]interfaceSet{
-					"interfaces": {
+				Pkgs:    []pkgSet{{Name: "interfaces", ImportPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/interfaces"`}},
+				Funcs:   map[types.ImportPath][]funcSet{},
+				Methods: map[types.ImportPath][]methodSet{},
+				Vars:    map[types.ImportPath][]varSet{},
+				Consts:  map[types.ImportPath][]constSet{},
+				Structs: map[types.ImportPath][]structSet{},
+				Interfaces: map[types.ImportPath][]interfaceSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/interfaces"`: {
 						{Name: "Reader", Methods: []types.DeclName{"Read"}, Descriptions: []string{"Read reads data\n"}},
 						{Name: "Writer", Methods: []types.DeclName{"Write"}, Descriptions: []string{"Write writes data\n"}},
 					},
 				},
-				DefinedTypes: map[types.PkgName][]DefinedTypeSet{},
+				DefinedTypes: map[types.ImportPath][]DefinedTypeSet{},
+			},
+		},
+		{
+			name: "promoted",
+			path: "./testdata/candidates/promoted",
+			want: &candidates{
+				Pkgs:  []pkgSet{{Name: "animal", ImportPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/promoted/animal"`}, {Name: "base", ImportPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/promoted/base"`}},
+				Funcs: map[types.ImportPath][]funcSet{},
+				Methods: map[types.ImportPath][]methodSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/promoted/animal"`: {
+						{Name: "Bark", Description: "Bark barks\n", ReceiverTypeName: "Dog", Signature: "()"},
+						{Name: "Eat", Description: "Eat eats food\n", ReceiverTypeName: "Dog", Returns: []returnSet{{TypeName: "string"}}, PromotedFrom: returnSet{TypeName: "Base", TypePkgPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/promoted/base"`}, Signature: "() string"},
+						{Name: "Speak", Description: "Speak says something\n", ReceiverTypeName: "Dog", Returns: []returnSet{{TypeName: "string"}}, PromotedFrom: returnSet{TypeName: "Speaker", TypePkgPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/promoted/base"`}, Signature: "() string"},
+					},
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/promoted/base"`: {
+						{Name: "Eat", Description: "Eat eats food\n", ReceiverTypeName: "Base", Returns: []returnSet{{TypeName: "string"}}, Signature: "() string"},
+						{Name: "digest", ReceiverTypeName: "Base", Signature: "()"},
+					},
+				},
+				Vars:   map[types.ImportPath][]varSet{},
+				Consts: map[types.ImportPath][]constSet{},
+				Structs: map[types.ImportPath][]structSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/promoted/animal"`: {{
+						Name:   "Dog",
+						Fields: []types.StructFieldName{"Base", "Speaker"},
+						FieldSets: []fieldSet{
+							{Name: "Base", TypeStr: "*base.Base", TypeName: "Base", TypePkgPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/promoted/base"`, Embedded: true},
+							{Name: "Speaker", TypeStr: "base.Speaker", TypeName: "Speaker", TypePkgPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/promoted/base"`, Embedded: true},
+						},
+						Description: "Dog embeds Base and Speaker from another package\n",
+					}},
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/promoted/base"`: {{Name: "Base", Description: "Base is embedded in animals\n"}},
+				},
+				Interfaces: map[types.ImportPath][]interfaceSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/promoted/animal"`: {{
+						Name:         "LoudSpeaker",
+						Methods:      []types.DeclName{"Shout", "Speak"},
+						Descriptions: []string{"Shout shouts\n", "Speak says something\n"},
+						PromotedFrom: map[types.DeclName]returnSet{"Speak": {TypeName: "Speaker", TypePkgPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/promoted/base"`}},
+					}},
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/promoted/base"`: {{Name: "Speaker", Methods: []types.DeclName{"Speak"}, Descriptions: []string{"Speak says something\n"}}},
+				},
+				DefinedTypes: map[types.ImportPath][]DefinedTypeSet{},
 			},
 		},
 		{
 			name: "multipackage",
 			path: "./testdata/candidates/multipackage",
 			want: &candidates{
-				Pkgs: []types.PkgName{"myapp", "types"},
-				Funcs: map[types.PkgName][]funcSet{
-					"myapp": {
-						{Name: "GetConfig", Description: "GetConfig returns a Config from another package\n", Returns: []returnSet{{TypeName: "Config", TypePkgName: "types"}}},
-						{Name: "GetLogger", Description: "GetLogger returns a Logger from another package\n", Returns: []returnSet{{TypeName: "Logger", TypePkgName: "types"}}},
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/multipackage/main"`}, {Name: "types", ImportPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/multipackage/types"`}},
+				Funcs: map[types.ImportPath][]funcSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/multipackage/main"`: {
+						{Name: "GetConfig", Description: "GetConfig returns a Config from another package\n", Returns: []returnSet{{TypeName: "Config", TypePkgPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/multipackage/types"`}}, Signature: "() types.Config"},
+						{Name: "GetLogger", Description: "GetLogger returns a Logger from another package\n", Returns: []returnSet{{TypeName: "Logger", TypePkgPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/multipackage/types"`}}, Signature: "() types.Logger"},
 					},
 				},
-				Methods: map[types.PkgName][]methodSet{
-					"myapp": {
-						{Name: "GetConfigFromMethod", Description: "GetConfigFromMethod returns a Config from another package via method\n", ReceiverTypeName: "Service", Returns: []returnSet{{TypeName: "Config", TypePkgName: "types"}}},
+				Methods: map[types.ImportPath][]methodSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/multipackage/main"`: {
+						{Name: "GetConfigFromMethod", Description: "GetConfigFromMethod returns a Config from another package via method\n", ReceiverTypeName: "Service", Returns: []returnSet{{TypeName: "Config", TypePkgPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/multipackage/types"`}}, Signature: "() types.Config"},
 					},
-					"types": {
-						{Name: "Info", Description: "Info logs an info message\n", ReceiverTypeName: "Logger", Returns: []returnSet{{TypeName: "string", TypePkgName: ""}}},
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/multipackage/types"`: {
+						{Name: "Info", Description: "Info logs an info message\n", ReceiverTypeName: "Logger", Returns: []returnSet{{TypeName: "string", TypePkgPath: ""}}, Signature: "(msg string) string", Params: []paramSet{{Name: "msg", TypeStr: "string", TypeName: "string"}}},
 					},
 				},
-				Vars:   map[types.PkgName][]varSet{},
-				Consts: map[types.PkgName][]constSet{},
-				Structs: map[types.PkgName][]structSet{
-					"myapp": {{Name: "Service", Fields: []types.StructFieldName{"Name"}, Description: "Service has a method that returns a type from another package\n"}},
-					"types": {
-						{Name: "Config", Fields: []types.StructFieldName{"Name", "Value"}, Description: "Config is a configuration struct from another package\n"},
-						{Name: "Logger", Fields: []types.StructFieldName{"Level"}, Description: "Logger is a logger struct from another package\n"},
+				Vars:   map[types.ImportPath][]varSet{},
+				Consts: map[types.ImportPath][]constSet{},
+				Structs: map[types.ImportPath][]structSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/multipackage/main"`: {{Name: "Service", Fields: []types.StructFieldName{"Name"}, FieldSets: []fieldSet{{Name: "Name", TypeStr: "string", TypeName: "string"}}, Description: "Service has a method that returns a type from another package\n"}},
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/multipackage/types"`: {
+						{Name: "Config", Fields: []types.StructFieldName{"Name", "Value"}, FieldSets: []fieldSet{{Name: "Name", TypeStr: "string", TypeName: "string"}, {Name: "Value", TypeStr: "int", TypeName: "int"}}, Description: "Config is a configuration struct from another package\n"},
+						{Name: "Logger", Fields: []types.StructFieldName{"Level"}, FieldSets: []fieldSet{{Name: "Level", TypeStr: "string", TypeName: "string"}}, Description: "Logger is a logger struct from another package\n"},
 					},
 				},
-				Interfaces:   map[types.PkgName][]interfaceSet{},
-				DefinedTypes: map[types.PkgName][]DefinedTypeSet{},
+				Interfaces:   map[types.ImportPath][]interfaceSet{},
+				DefinedTypes: map[types.ImportPath][]DefinedTypeSet{},
 			},
 		},
 		{
 			name: "multidecl",
 			path: "./testdata/candidates/multidecl",
 			want: &candidates{
-				Pkgs:    []types.PkgName{"multidecl"},
-				Funcs:   map[types.PkgName][]funcSet{},
-				Methods: map[types.PkgName][]methodSet{},
-				Vars: map[types.PkgName][]varSet{
-					"multidecl": {
-						{Name: "VarA", Description: "Multiple variables in one line\n", TypeName: "string", TypePkgName: ""},
-						{Name: "VarB", Description: "Multiple variables in one line\n", TypeName: "string", TypePkgName: ""},
-						{Name: "VarC", Description: "Multiple variables in one var block\n", TypeName: "string", TypePkgName: ""},
-						{Name: "VarD", Description: "Multiple variables in one var block\n", TypeName: "string", TypePkgName: ""},
+				Pkgs:    []pkgSet{{Name: "multidecl", ImportPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/multidecl"`}},
+				Funcs:   map[types.ImportPath][]funcSet{},
+				Methods: map[types.ImportPath][]methodSet{},
+				Vars: map[types.ImportPath][]varSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/multidecl"`: {
+						{Name: "VarA", Description: "Multiple variables in one line\n", TypeName: "string", TypePkgPath: ""},
+						{Name: "VarB", Description: "Multiple variables in one line\n", TypeName: "string", TypePkgPath: ""},
+						{Name: "VarC", Description: "Multiple variables in one var block\n", TypeName: "string", TypePkgPath: ""},
+						{Name: "VarD", Description: "Multiple variables in one var block\n", TypeName: "string", TypePkgPath: ""},
 					},
 				},
-				Consts: map[types.PkgName][]constSet{
-					"multidecl": {
-						{Name: "ConstA", Description: "Multiple constants in one line\n"},
-						{Name: "ConstB", Description: "Multiple constants in one line\n"},
-						{Name: "ConstC", Description: "Multiple constants in one const block\n"},
-						{Name: "ConstD", Description: "Multiple constants in one const block\n"},
+				Consts: map[types.ImportPath][]constSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/multidecl"`: {
+						{Name: "ConstA", Description: "Multiple constants in one line\n", TypeName: "string"},
+						{Name: "ConstB", Description: "Multiple constants in one line\n", TypeName: "string"},
+						{Name: "ConstC", Description: "Multiple constants in one const block\n", TypeName: "string"},
+						{Name: "ConstD", Description: "Multiple constants in one const block\n", TypeName: "string"},
 					},
 				},
-				Structs:      map[types.PkgName][]structSet{},
-				Interfaces:   map[types.PkgName][]interfaceSet{},
-				DefinedTypes: map[types.PkgName][]DefinedTypeSet{},
+				Structs:      map[types.ImportPath][]structSet{},
+				Interfaces:   map[types.ImportPath][]interfaceSet{},
+				DefinedTypes: map[types.ImportPath][]DefinedTypeSet{},
 			},
 		},
 		{
 			name: "defined_type",
 			path: "./testdata/candidates/defined_type",
 			want: &candidates{
-				Pkgs:    []types.PkgName{"definedtype"},
-				Funcs:   map[types.PkgName][]funcSet{},
-				Methods: map[types.PkgName][]methodSet{},
-				Vars:    map[types.PkgName][]varSet{},
-				Consts:  map[types.PkgName][]constSet{},
-				Structs: map[types.PkgName][]structSet{
-					"definedtype": {{Name: "Config", Fields: []types.StructFieldName{"Name"}, Description: "Config is a struct type\n"}},
+				Pkgs:    []pkgSet{{Name: "definedtype", ImportPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/defined_type"`}},
+				Funcs:   map[types.ImportPath][]funcSet{},
+				Methods: map[types.ImportPath][]methodSet{},
+				Vars:    map[types.ImportPath][]varSet{},
+				Consts:  map[types.ImportPath][]constSet{},
+				Structs: map[types.ImportPath][]structSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/defined_type"`: {{Name: "Config", Fields: []types.StructFieldName{"Name"}, FieldSets: []fieldSet{{Name: "Name", TypeStr: "string", TypeName: "string"}}, Description: "Config is a struct type\n"}},
+				},
+				Interfaces: map[types.ImportPath][]interfaceSet{},
+				DefinedTypes: map[types.ImportPath][]DefinedTypeSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/defined_type"`: {
+						{Name: "MyInt", UnderlyingType: "int", UnderlyingTypePkgPath: "", Description: "MyInt is a defined type based on int\n"},
+						{Name: "MyString", UnderlyingType: "string", UnderlyingTypePkgPath: "", Description: "MyString is a defined type based on string\n"},
+						{Name: "MySlice", UnderlyingType: "[]string", UnderlyingTypePkgPath: "", Description: "MySlice is a defined type based on slice\n"},
+						{Name: "MyMap", UnderlyingType: "map[string]int", UnderlyingTypePkgPath: "", Description: "MyMap is a defined type based on map\n"},
+						{Name: "MyPtr", UnderlyingType: "Config", UnderlyingTypePkgPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/defined_type"`, Description: "MyPtr is a pointer to struct\n"},
+						{Name: "MyIntPtr", UnderlyingType: "*int", UnderlyingTypePkgPath: "", Description: "MyIntPtr is a pointer to int\n"},
+						{Name: "MyFunc", UnderlyingType: "func(int) string", UnderlyingTypePkgPath: "", Description: "MyFunc is a function type\n"},
+					},
+				},
+			},
+		},
+		{
+			name: "unexported elements are excluded",
+			path: "./testdata/candidates/unexported",
+			want: &candidates{
+				Pkgs: []pkgSet{{Name: "unexported", ImportPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/unexported"`}},
+				Funcs: map[types.ImportPath][]funcSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/unexported"`: {
+						{Name: "Add", Description: "Add adds two integers and returns the sum\n", Returns: []returnSet{{TypeName: "int", TypePkgPath: ""}}, Signature: "(a int, b int) int", Params: []paramSet{{Name: "a", TypeStr: "int", TypeName: "int"}, {Name: "b", TypeStr: "int", TypeName: "int"}}},
+					},
 				},
-				Interfaces: map[types.PkgName][]interfaceSet{},
-				DefinedTypes: map[types.PkgName][]DefinedTypeSet{
-					"definedtype": {
-						{Name: "MyInt", UnderlyingType: "int", UnderlyingTypePkgName: "", Description: "MyInt is a defined type based on int\n"},
-						{Name: "MyString", UnderlyingType: "string", UnderlyingTypePkgName: "", Description: "MyString is a defined type based on string\n"},
-						{Name: "MySlice", UnderlyingType: "[]string", UnderlyingTypePkgName: "", Description: "MySlice is a defined type based on slice\n"},
-						{Name: "MyMap", UnderlyingType: "map[string]int", UnderlyingTypePkgName: "", Description: "MyMap is a defined type based on map\n"},
-						{Name: "MyPtr", UnderlyingType: "Config", UnderlyingTypePkgName: "definedtype", Description: "MyPtr is a pointer to struct\n"},
-						{Name: "MyIntPtr", UnderlyingType: "*int", UnderlyingTypePkgName: "", Description: "MyIntPtr is a pointer to int\n"},
-						{Name: "MyFunc", UnderlyingType: "func(int) string", UnderlyingTypePkgName: "", Description: "MyFunc is a function type\n"},
+				Methods:      map[types.ImportPath][]methodSet{},
+				Vars:         map[types.ImportPath][]varSet{},
+				Consts:       map[types.ImportPath][]constSet{},
+				Structs:      map[types.ImportPath][]structSet{},
+				Interfaces:   map[types.ImportPath][]interfaceSet{},
+				DefinedTypes: map[types.ImportPath][]DefinedTypeSet{},
+			},
+		},
+		{
+			name:              "unexported elements of target package are included",
+			path:              "./testdata/candidates/unexported",
+			unexportedPkgPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/unexported"`,
+			want: &candidates{
+				Pkgs: []pkgSet{{Name: "unexported", ImportPath: `"github.com/kakkky/gonsole/completer/testdata/candidates/unexported"`}},
+				Funcs: map[types.ImportPath][]funcSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/unexported"`: {
+						{Name: "Add", Description: "Add adds two integers and returns the sum\n", Returns: []returnSet{{TypeName: "int", TypePkgPath: ""}}, Signature: "(a int, b int) int", Params: []paramSet{{Name: "a", TypeStr: "int", TypeName: "int"}, {Name: "b", TypeStr: "int", TypeName: "int"}}},
+						{Name: "add", Description: "add is the unexported implementation of Add\n", Returns: []returnSet{{TypeName: "int", TypePkgPath: ""}}, Signature: "(a int, b int) int", Params: []paramSet{{Name: "a", TypeStr: "int", TypeName: "int"}, {Name: "b", TypeStr: "int", TypeName: "int"}}},
 					},
 				},
+				Methods: map[types.ImportPath][]methodSet{},
+				Vars:    map[types.ImportPath][]varSet{},
+				Consts: map[types.ImportPath][]constSet{
+					`"github.com/kakkky/gonsole/completer/testdata/candidates/unexported"`: {{Name: "limit", Description: "limit is an unexported constant\n", TypeName: "int"}},
+				},
+				Structs:      map[types.ImportPath][]structSet{},
+				Interfaces:   map[types.ImportPath][]interfaceSet{},
+				DefinedTypes: map[types.ImportPath][]DefinedTypeSet{},
 			},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := NewCandidates(tt.path)
+			got, err := NewCandidates(tt.path, tt.unexportedPkgPath, nil)
 			if err != nil {
 				t.Fatalf("NewCandidates() error = %v", err)
 			}
 
 			opts := []cmp.Option{
-				cmp.AllowUnexported(candidates{}, funcSet{}, methodSet{}, varSet{}, constSet{}, structSet{}, interfaceSet{}, DefinedTypeSet{}, returnSet{}),
-				cmpopts.SortSlices(func(a, b types.PkgName) bool { return a < b }),
+				cmp.AllowUnexported(candidates{}, pkgSet{}, funcSet{}, methodSet{}, varSet{}, constSet{}, structSet{}, fieldSet{}, interfaceSet{}, DefinedTypeSet{}, returnSet{}),
+				cmpopts.SortSlices(func(a, b pkgSet) bool { return a.ImportPath < b.ImportPath }),
 				cmpopts.SortSlices(func(a, b funcSet) bool { return a.Name < b.Name }),
 				cmpopts.SortSlices(func(a, b methodSet) bool { return a.Name < b.Name }),
 				cmpopts.SortSlices(func(a, b varSet) bool { return a.Name < b.Name }),
@@ -3,63 +3,279 @@ package completer
 import (
 	"slices"
 	"strings"
+	"time"
 	"unicode"
 
 	"github.com/kakkky/go-prompt"
 
 	"github.com/kakkky/gonsole/declregistry"
+	"github.com/kakkky/gonsole/metacmd"
+	"github.com/kakkky/gonsole/pkgindex"
+	"github.com/kakkky/gonsole/targetpkg"
 	"github.com/kakkky/gonsole/types"
 )
 
 // Completer は補完エンジンを担う
 // go-promptのCompleterインターフェースを実装している
 type Completer struct {
-	candidates   *candidates
-	declRegistry *declregistry.DeclRegistry
+	candidates *candidates
+	// projectCandidates はプロジェクトと標準パッケージの候補で、セッション内の宣言を加える前のもの
+	projectCandidates *candidates
+	// topLevelDecls はcandidatesに加えているセッション内の関数・メソッド・型
+	topLevelDecls []declregistry.TopLevelDecl
+	declRegistry  *declregistry.DeclRegistry
+	targetPkg     *targetpkg.TargetPkg
+	metaCommands  *metacmd.Dispatcher
+	pkgIndex      *pkgindex.Index
+	// importPathBindings はパッケージ名ごとに確定させたimportパスを返す
+	importPathBindings func() map[types.PkgName]types.ImportPath
+	// projectRootPath は補完候補を読み込むプロジェクトのルートディレクトリ
+	projectRootPath string
+	// projectPkgs はプロジェクト内のパッケージごとの候補で、変更されたパッケージだけを読み込み直すために使う
+	projectPkgs []*projectPkg
+	// lastReloadCheck はプロジェクトのコードの変更を最後に確認した時刻
+	lastReloadCheck time.Time
+	// pendingReload はバックグラウンドで読み込み直している、変更されたパッケージ。読み込み中でなければnil
+	pendingReload *pkgReload
+	// matchMode は補完候補と入力の照合方法
+	matchMode MatchMode
+	// recentUses は実行した入力で使われた識別子ごとの、最後に使った順番
+	recentUses map[string]int
+	useCount   int
+}
+
+// Option はCompleterの生成時に指定するオプション
+type Option func(*Completer)
+
+// WithTargetPkg はセッションのコードを組み込む対象のパッケージを指定する
+// 対象パッケージの非公開の要素も補完候補に含まれるようになる
+func WithTargetPkg(targetPkg *targetpkg.TargetPkg) Option {
+	return func(c *Completer) {
+		c.targetPkg = targetPkg
+	}
+}
+
+// WithMetaCommands はメタコマンドを補完候補に含める
+func WithMetaCommands(dispatcher *metacmd.Dispatcher) Option {
+	return func(c *Completer) {
+		c.metaCommands = dispatcher
+	}
+}
+
+// WithMatchMode は補完候補と入力の照合方法を指定する
+func WithMatchMode(mode MatchMode) Option {
+	return func(c *Completer) {
+		c.matchMode = mode
+	}
+}
+
+// WithPkgIndex は補完候補の生成で読み込んだパッケージで、パッケージの索引を作る
+// 索引をExecutorと共有することで、importパスの解決のためにパッケージを読み込み直さずに済む
+func WithPkgIndex(pkgIndex *pkgindex.Index) Option {
+	return func(c *Completer) {
+		c.pkgIndex = pkgIndex
+	}
+}
+
+// WithImportPathBindings はパッケージ名ごとに確定させたimportパスを返す関数を指定する
+// 確定させたパッケージ名の補完候補は、同じ名前の他のパッケージの候補を含めずにそのパッケージから引く
+// セッション中の`:bind`などによる変更も反映されるように、値ではなく関数で受け取る
+func WithImportPathBindings(bindings func() map[types.PkgName]types.ImportPath) Option {
+	return func(c *Completer) {
+		c.importPathBindings = bindings
+	}
 }
 
 // NewCompleter はCompleterのインスタンスを生成する
-func NewCompleter(declRegistry *declregistry.DeclRegistry) (*Completer, error) {
-	candidates, err := NewCandidates(".")
-	if err != nil {
+func NewCompleter(declRegistry *declregistry.DeclRegistry, opts ...Option) (*Completer, error) {
+	c := &Completer{
+		declRegistry:    declRegistry,
+		projectRootPath: ".",
+		matchMode:       MatchModeFuzzy,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if err := c.Reload(); err != nil {
 		return nil, err
 	}
-	return &Completer{
-		candidates:   candidates,
-		declRegistry: declRegistry,
-	}, nil
+	return c, nil
 }
 
 // Complete はgo-promptのCompleterインターフェースを実装するメソッドで、補完候補を返す
 func (c *Completer) Complete(input prompt.Document) []prompt.Suggest {
+	if metacmd.IsMetaCommand(input.Text) {
+		return c.findMetaCommandSuggestions(input.Text)
+	}
+
+	c.reloadChangedPkgs()
+	c.syncTopLevelDecls()
+
+	// 文字列などのリテラルの入力中は補完しない
+	if _, ok := exprUnderCursor(input.Text); !ok {
+		return make([]prompt.Suggest, 0)
+	}
 	sb := newSuggestionBuilder(input.Text)
+	sb.matchMode = c.matchMode
+
+	// 関数やメソッドの呼び出しの括弧内では、シグネチャのヒントと引数の型に合う候補を補完する
+	// 引数の型に合う候補がなければ、ヒントに続けて入力中の式を補完する
+	var hint []prompt.Suggest
+	if call, ok := parseCallInput(input.Text); ok {
+		if suggestions, ok := c.findCallSuggestions(sb, call); ok {
+			if len(suggestions) > 1 || sb.input.raw == "" {
+				return slices.Concat(suggestions[:1], c.rankSuggestions(sb, suggestions[1:], sb.input.raw))
+			}
+			hint = suggestions
+		}
+	}
 
+	var suggestions []prompt.Suggest
 	if !sb.isSelector() {
-		// TODO: repl内で宣言された変数の補完も出すようにしたい
-		return c.findPackageSuggestions(sb)
+		suggestions = slices.Concat(
+			c.findCompositeLitKeySuggestions(input.Text, sb),
+			c.findDeclSuggestions(sb),
+			c.findTopLevelDeclSuggestions(sb),
+			c.findPackageSuggestions(sb),
+			findKeywordSuggestions(sb),
+			findBuiltinSuggestions(sb),
+		)
+	} else {
+		suggestions = c.findSuggestions(sb)
 	}
+	// 入力に一致する候補から順に、ヒントの後に並べる
+	return slices.Concat(hint, c.rankSuggestions(sb, suggestions, sb.query()))
+}
 
-	suggestions := c.findSuggestions(sb)
-
-	return suggestions
+// syncTopLevelDecls はセッション内で宣言された関数・メソッド・型が変わっていれば、補完候補に反映し直す
+func (c *Completer) syncTopLevelDecls() {
+	if slices.Equal(c.topLevelDecls, c.declRegistry.TopLevelDecls) {
+		return
+	}
+	c.candidates = c.projectCandidates.withTopLevelDecls(c.declRegistry.TopLevelDecls)
+	c.topLevelDecls = c.declRegistry.TopLevelDecls
 }
 
 func (c *Completer) findSuggestions(sb *suggestionBuilder) []prompt.Suggest {
 	methodSuggests := c.findMethodSuggestions(sb)
+	fieldSuggests := c.findFieldSuggestions(sb)
 	functionSuggests := c.findFunctionSuggestions(sb)
 	variableSuggests := c.findVariableSuggestions(sb)
 	constantSuggets := c.findConstantSuggestions(sb)
 	structSuggests := c.findStructSuggestions(sb)
 	definedTypeSuggests := c.findDefinedTypeSuggestions(sb)
 
-	return slices.Concat(functionSuggests, methodSuggests, variableSuggests, constantSuggets, structSuggests, definedTypeSuggests)
+	return slices.Concat(functionSuggests, methodSuggests, fieldSuggests, variableSuggests, constantSuggets, structSuggests, definedTypeSuggests)
 }
 
 func (c *Completer) findPackageSuggestions(sb *suggestionBuilder) []prompt.Suggest {
 	suggestions := make([]prompt.Suggest, 0)
+	// 同名のパッケージはimportパスが違っても、入力する名前は同じなので1つだけ補完する
+	var pkgNames []types.PkgName
+	for _, pkg := range c.candidates.Pkgs {
+		if !slices.Contains(pkgNames, pkg.Name) {
+			pkgNames = append(pkgNames, pkg.Name)
+		}
+	}
+	for _, pkgName := range pkgNames {
+		if sb.matches(string(pkgName), sb.input.text) {
+			suggestions = append(suggestions, sb.build(string(pkgName), suggestTypePackage, ""))
+		}
+	}
+	// import文で別名を付けたパッケージは、別名でも補完する
+	for _, declaredImport := range c.declRegistry.Imports {
+		if declaredImport.Name == "_" || slices.Contains(pkgNames, declaredImport.Name) {
+			continue
+		}
+		if sb.matches(string(declaredImport.Name), sb.input.text) {
+			suggestions = append(suggestions, sb.build(string(declaredImport.Name), suggestTypePackage, string(declaredImport.ImportPath)))
+		}
+	}
+	return suggestions
+}
+
+// findDeclSuggestions はセッション内で宣言された変数を、型を説明に付けて補完する
+func (c *Completer) findDeclSuggestions(sb *suggestionBuilder) []prompt.Suggest {
+	suggestions := make([]prompt.Suggest, 0)
+	for _, decl := range c.declRegistry.Decls {
+		// 再宣言により参照できなくなった変数は補完しない
+		if decl.Shadowed {
+			continue
+		}
+		if sb.matches(string(decl.Name), sb.input.text) {
+			suggestions = append(suggestions, sb.build(string(decl.Name), suggestTypeVariable, decl.TypeStr()))
+		}
+	}
+	return suggestions
+}
+
+// findTopLevelDeclSuggestions はセッション内で宣言された関数・型を、パッケージ名を付けずに補完する
+// メソッドはレシーバの変数から補完するので対象外にする
+func (c *Completer) findTopLevelDeclSuggestions(sb *suggestionBuilder) []prompt.Suggest {
+	suggestions := make([]prompt.Suggest, 0)
+	declNamesByPkgPath := make(map[types.ImportPath][]string)
+	for _, topLevelDecl := range c.declRegistry.TopLevelDecls {
+		if topLevelDecl.ReceiverTypeName != "" || !sb.matches(string(topLevelDecl.Name), sb.input.text) {
+			continue
+		}
+		declNamesByPkgPath[topLevelDecl.PkgPath] = append(declNamesByPkgPath[topLevelDecl.PkgPath], string(topLevelDecl.Name))
+	}
+	for pkgPath, declNames := range declNamesByPkgPath {
+		for _, funcSet := range c.candidates.Funcs[pkgPath] {
+			if slices.Contains(declNames, string(funcSet.Name)) {
+				suggestions = append(suggestions, sb.build(string(funcSet.Name), suggestTypeFunction, funcSet.Description, "()"))
+			}
+		}
+		for _, structSet := range c.candidates.Structs[pkgPath] {
+			if slices.Contains(declNames, string(structSet.Name)) {
+				var compositeLit string
+				if len(structSet.Fields) > 0 {
+					compositeLit = compositeLitStr(structSet.Fields)
+				}
+				suggestions = append(suggestions, sb.build(string(structSet.Name), suggestTypeStruct, structSet.Description, "", compositeLit))
+			}
+		}
+		for _, definedTypeSet := range c.candidates.DefinedTypes[pkgPath] {
+			if slices.Contains(declNames, string(definedTypeSet.Name)) {
+				suggestions = append(suggestions, sb.build(string(definedTypeSet.Name), suggestTypeDefinedType, definedTypeSet.Description, "()"))
+			}
+		}
+	}
+	return suggestions
+}
+
+// pkgPathsOf は入力値でパッケージを参照している名前から、補完候補を引くためのimportパスを返す
+// import文で宣言したパッケージや、importパスを確定させたパッケージはそのimportパスだけを、
+// それ以外は同じ名前のパッケージすべてのimportパスを返す
+func (c *Completer) pkgPathsOf(name string) []types.ImportPath {
+	if declaredImport, ok := c.declRegistry.LookupImport(types.PkgName(name)); ok {
+		return []types.ImportPath{declaredImport.ImportPath}
+	}
+	if c.importPathBindings != nil {
+		if importPath, ok := c.importPathBindings()[types.PkgName(name)]; ok {
+			return []types.ImportPath{importPath}
+		}
+	}
+	var pkgPaths []types.ImportPath
 	for _, pkg := range c.candidates.Pkgs {
-		if strings.HasPrefix(string(pkg), sb.input.text) {
-			suggestions = append(suggestions, sb.build(string(pkg), suggestTypePackage, ""))
+		if pkg.Name == types.PkgName(name) {
+			pkgPaths = append(pkgPaths, pkg.ImportPath)
+		}
+	}
+	return pkgPaths
+}
+
+// findMetaCommandSuggestions はコマンド名を入力中の場合にだけメタコマンドを補完する
+func (c *Completer) findMetaCommandSuggestions(inputText string) []prompt.Suggest {
+	suggestions := make([]prompt.Suggest, 0)
+	if c.metaCommands == nil || strings.Contains(inputText, " ") {
+		return suggestions
+	}
+	sb := &suggestionBuilder{input: input{raw: inputText, text: inputText}}
+	for _, command := range c.metaCommands.Commands() {
+		if strings.HasPrefix(command.Name, inputText) {
+			suggestions = append(suggestions, sb.build(command.Name, suggestTypeCommand, command.Description))
 		}
 	}
 	return suggestions
@@ -67,9 +283,9 @@ func (c *Completer) findPackageSuggestions(sb *suggestionBuilder) []prompt.Sugge
 
 func (c *Completer) findFunctionSuggestions(sb *suggestionBuilder) []prompt.Suggest {
 	suggestions := make([]prompt.Suggest, 0)
-	if funcSets, ok := c.candidates.Funcs[types.PkgName(sb.input.basePart)]; ok {
-		for _, funcSet := range funcSets {
-			if strings.HasPrefix(string(funcSet.Name), sb.input.selectorPart) && !isPrivate(string(funcSet.Name)) {
+	for _, pkgPath := range c.pkgPathsOf(sb.input.basePart) {
+		for _, funcSet := range c.candidates.Funcs[pkgPath] {
+			if sb.matches(string(funcSet.Name), sb.input.selectorPart) && !c.isHidden(pkgPath, string(funcSet.Name)) {
 				suggestions = append(suggestions, sb.build(string(funcSet.Name), suggestTypeFunction, funcSet.Description, "()"))
 			}
 		}
@@ -79,6 +295,10 @@ func (c *Completer) findFunctionSuggestions(sb *suggestionBuilder) []prompt.Sugg
 func (c *Completer) findMethodSuggestions(sb *suggestionBuilder) []prompt.Suggest {
 	suggestions := make([]prompt.Suggest, 0)
 
+	// フィールドアクセスを含む場合は、フィールドの型からメソッドを探す
+	if hasFieldAccess(sb.input.selectorPart) {
+		return c.findMethodSuggestionsFromFieldAccess(sb)
+	}
 	// メソッドチェーンの場合は専用処理に移行
 	if isMethodChain(sb.input.selectorPart) {
 		return c.findMethodSuggestionsFromChain(suggestions, sb)
@@ -86,8 +306,8 @@ func (c *Completer) findMethodSuggestions(sb *suggestionBuilder) []prompt.Sugges
 
 	for _, decl := range c.declRegistry.Decls {
 		if sb.input.basePart == string(decl.Name) {
-			for _, methodSet := range c.candidates.Methods[decl.TypePkgName] {
-				if strings.HasPrefix(string(methodSet.Name), sb.input.selectorPart) && !isPrivate(string(methodSet.Name)) {
+			for _, methodSet := range c.candidates.Methods[decl.TypePkgPath] {
+				if sb.matches(string(methodSet.Name), sb.input.selectorPart) && !c.isHidden(decl.TypePkgPath, string(methodSet.Name)) {
 					if decl.TypeName == types.TypeName(methodSet.ReceiverTypeName) {
 						suggestions = append(suggestions, sb.build(string(methodSet.Name), suggestTypeMethod, methodSet.Description, "()"))
 					}
@@ -97,11 +317,11 @@ func (c *Completer) findMethodSuggestions(sb *suggestionBuilder) []prompt.Sugges
 		if len(suggestions) > 0 {
 			return suggestions
 		}
-		for _, interfaceSet := range c.candidates.Interfaces[decl.TypePkgName] {
-			if !isPrivate(string(interfaceSet.Name)) {
+		for _, interfaceSet := range c.candidates.Interfaces[decl.TypePkgPath] {
+			if !c.isHidden(decl.TypePkgPath, string(interfaceSet.Name)) {
 				if decl.TypeName == types.TypeName(interfaceSet.Name) {
 					for i, method := range interfaceSet.Methods {
-						if strings.HasPrefix(string(method), sb.input.selectorPart) && !isPrivate(string(method)) {
+						if sb.matches(string(method), sb.input.selectorPart) && !c.isHidden(decl.TypePkgPath, string(method)) {
 							suggestions = append(suggestions, sb.build(string(method), suggestTypeMethod, interfaceSet.Descriptions[i], "()"))
 						}
 					}
@@ -137,35 +357,35 @@ func (c *Completer) findMethodSuggestionsFromChain(suggestions []prompt.Suggest,
 	if c.declRegistry.IsRegisteredDecl(types.DeclName(sb.input.basePart)) {
 		// 最初の呼び出し要素がメソッド
 		var firstRecvTypeName types.TypeName
-		var firstRecvPkgName types.PkgName
+		var firstRecvPkgPath types.ImportPath
 		for _, decl := range c.declRegistry.Decls {
 			if decl.Name == types.DeclName(sb.input.basePart) {
 				firstRecvTypeName = decl.TypeName
-				firstRecvPkgName = decl.TypePkgName
+				firstRecvPkgPath = decl.TypePkgPath
 			}
 		}
 		var firstReturnElm returnSet
-		for _, methodSet := range c.candidates.Methods[firstRecvPkgName] {
+		for _, methodSet := range c.candidates.Methods[firstRecvPkgPath] {
 			if strings.HasPrefix(string(methodSet.Name), selectorParts[0]) && types.TypeName(methodSet.ReceiverTypeName) == firstRecvTypeName && len(methodSet.Returns) == 1 {
 				firstReturnElm = returnSet{
 					TypeName:    methodSet.Returns[0].TypeName,
-					TypePkgName: methodSet.Returns[0].TypePkgName,
+					TypePkgPath: methodSet.Returns[0].TypePkgPath,
 				}
 				break
 			}
 		}
-		last := c.detectReturnElmFromMethodChainRecursive(sb, firstReturnElm.TypeName, firstReturnElm.TypePkgName, selectorParts[1:len(selectorParts)-1])
+		last := c.detectReturnElmFromMethodChainRecursive(sb, firstReturnElm.TypeName, firstReturnElm.TypePkgPath, selectorParts[1:len(selectorParts)-1])
 		if last == nil {
 			return suggestions
 		}
 		lastReturElm = *last
 	} else {
 		// 最初の呼び出し要素が関数
-		if funcSets, ok := c.candidates.Funcs[types.PkgName(sb.input.basePart)]; ok {
-			for _, funcSet := range funcSets {
+		for _, pkgPath := range c.pkgPathsOf(sb.input.basePart) {
+			for _, funcSet := range c.candidates.Funcs[pkgPath] {
 				if string(funcSet.Name) == selectorParts[0] && len(funcSet.Returns) == 1 {
 					firstReturnElm := funcSet.Returns[0]
-					last := c.detectReturnElmFromMethodChainRecursive(sb, firstReturnElm.TypeName, firstReturnElm.TypePkgName, selectorParts[1:len(selectorParts)-1])
+					last := c.detectReturnElmFromMethodChainRecursive(sb, firstReturnElm.TypeName, firstReturnElm.TypePkgPath, selectorParts[1:len(selectorParts)-1])
 					if last == nil {
 						return suggestions
 					}
@@ -176,18 +396,18 @@ func (c *Completer) findMethodSuggestionsFromChain(suggestions []prompt.Suggest,
 		}
 	}
 
-	for _, methodSet := range c.candidates.Methods[lastReturElm.TypePkgName] {
-		if strings.HasPrefix(string(methodSet.Name), lastSelectorPart) && !isPrivate(string(methodSet.Name)) && types.TypeName(methodSet.ReceiverTypeName) == lastReturElm.TypeName && len(methodSet.Returns) == 1 {
+	for _, methodSet := range c.candidates.Methods[lastReturElm.TypePkgPath] {
+		if sb.matches(string(methodSet.Name), lastSelectorPart) && !c.isHidden(lastReturElm.TypePkgPath, string(methodSet.Name)) && types.TypeName(methodSet.ReceiverTypeName) == lastReturElm.TypeName && len(methodSet.Returns) == 1 {
 			suggestions = append(suggestions, sb.build(string(methodSet.Name), suggestTypeMethod, methodSet.Description, "()"))
 		}
 	}
 	if len(suggestions) > 0 {
 		return suggestions
 	}
-	for _, interfaceSet := range c.candidates.Interfaces[lastReturElm.TypePkgName] {
+	for _, interfaceSet := range c.candidates.Interfaces[lastReturElm.TypePkgPath] {
 		if lastReturElm.TypeName == types.TypeName(interfaceSet.Name) {
 			for i, method := range interfaceSet.Methods {
-				if strings.HasPrefix(string(method), lastSelectorPart) && !isPrivate(string(method)) {
+				if sb.matches(string(method), lastSelectorPart) && !c.isHidden(lastReturElm.TypePkgPath, string(method)) {
 					suggestions = append(suggestions, sb.build(string(method), suggestTypeMethod, interfaceSet.Descriptions[i], "()"))
 				}
 			}
@@ -196,40 +416,40 @@ func (c *Completer) findMethodSuggestionsFromChain(suggestions []prompt.Suggest,
 	return suggestions
 }
 
-func (c *Completer) detectReturnElmFromMethodChainRecursive(sb *suggestionBuilder, prevBasePartTypeName types.TypeName, prevBasePartPkgName types.PkgName, selectorParts []string) *returnSet {
+func (c *Completer) detectReturnElmFromMethodChainRecursive(sb *suggestionBuilder, prevBasePartTypeName types.TypeName, prevBasePartPkgPath types.ImportPath, selectorParts []string) *returnSet {
 	if len(selectorParts) == 0 {
 		return &returnSet{
 			TypeName:    prevBasePartTypeName,
-			TypePkgName: prevBasePartPkgName,
+			TypePkgPath: prevBasePartPkgPath,
 		}
 	}
 	currentSelectorPart := selectorParts[0]
 	selectorParts = selectorParts[1:]
 
-	for _, methodSet := range c.candidates.Methods[prevBasePartPkgName] {
+	for _, methodSet := range c.candidates.Methods[prevBasePartPkgPath] {
 		if strings.HasPrefix(string(methodSet.Name), currentSelectorPart) && types.TypeName(methodSet.ReceiverTypeName) == prevBasePartTypeName && len(methodSet.Returns) == 1 {
 			returnElm := methodSet.Returns[0]
 			if len(selectorParts) == 0 {
 				return &returnElm
 			}
-			nextReturnElm := c.detectReturnElmFromMethodChainRecursive(sb, returnElm.TypeName, returnElm.TypePkgName, selectorParts)
+			nextReturnElm := c.detectReturnElmFromMethodChainRecursive(sb, returnElm.TypeName, returnElm.TypePkgPath, selectorParts)
 			if nextReturnElm != nil {
 				return nextReturnElm
 			}
 		}
 	}
 
-	for _, interfaceSet := range c.candidates.Interfaces[prevBasePartPkgName] {
+	for _, interfaceSet := range c.candidates.Interfaces[prevBasePartPkgPath] {
 		if types.TypeName(interfaceSet.Name) == prevBasePartTypeName {
 			for _, method := range interfaceSet.Methods {
 				if strings.HasPrefix(string(method), currentSelectorPart) {
-					for _, methodSet := range c.candidates.Methods[prevBasePartPkgName] {
+					for _, methodSet := range c.candidates.Methods[prevBasePartPkgPath] {
 						if string(methodSet.Name) == string(method) && len(methodSet.Returns) == 1 {
 							returnElm := methodSet.Returns[0]
 							if len(selectorParts) == 0 {
 								return &returnElm
 							}
-							nextReturnElm := c.detectReturnElmFromMethodChainRecursive(sb, returnElm.TypeName, returnElm.TypePkgName, selectorParts)
+							nextReturnElm := c.detectReturnElmFromMethodChainRecursive(sb, returnElm.TypeName, returnElm.TypePkgPath, selectorParts)
 							if nextReturnElm != nil {
 								return nextReturnElm
 							}
@@ -245,9 +465,9 @@ func (c *Completer) detectReturnElmFromMethodChainRecursive(sb *suggestionBuilde
 
 func (c *Completer) findVariableSuggestions(sb *suggestionBuilder) []prompt.Suggest {
 	suggestions := make([]prompt.Suggest, 0)
-	if varSets, ok := c.candidates.Vars[types.PkgName(sb.input.basePart)]; ok {
-		for _, varSet := range varSets {
-			if strings.HasPrefix(string(varSet.Name), sb.input.selectorPart) && !isPrivate(string(varSet.Name)) {
+	for _, pkgPath := range c.pkgPathsOf(sb.input.basePart) {
+		for _, varSet := range c.candidates.Vars[pkgPath] {
+			if sb.matches(string(varSet.Name), sb.input.selectorPart) && !c.isHidden(pkgPath, string(varSet.Name)) {
 				suggestions = append(suggestions, sb.build(string(varSet.Name), suggestTypeVariable, varSet.Description))
 			}
 		}
@@ -257,9 +477,9 @@ func (c *Completer) findVariableSuggestions(sb *suggestionBuilder) []prompt.Sugg
 
 func (c *Completer) findConstantSuggestions(sb *suggestionBuilder) []prompt.Suggest {
 	suggestions := make([]prompt.Suggest, 0)
-	if constSets, ok := c.candidates.Consts[types.PkgName(sb.input.basePart)]; ok {
-		for _, constSet := range constSets {
-			if strings.HasPrefix(string(constSet.Name), sb.input.selectorPart) && !isPrivate(string(constSet.Name)) {
+	for _, pkgPath := range c.pkgPathsOf(sb.input.basePart) {
+		for _, constSet := range c.candidates.Consts[pkgPath] {
+			if sb.matches(string(constSet.Name), sb.input.selectorPart) && !c.isHidden(pkgPath, string(constSet.Name)) {
 				suggestions = append(suggestions, sb.build(string(constSet.Name), suggestTypeConstant, constSet.Description))
 			}
 		}
@@ -269,9 +489,9 @@ func (c *Completer) findConstantSuggestions(sb *suggestionBuilder) []prompt.Sugg
 
 func (c *Completer) findStructSuggestions(sb *suggestionBuilder) []prompt.Suggest {
 	suggestions := make([]prompt.Suggest, 0)
-	if structSets, ok := c.candidates.Structs[types.PkgName(sb.input.basePart)]; ok {
-		for _, structSet := range structSets {
-			if strings.HasPrefix(string(structSet.Name), sb.input.selectorPart) && !isPrivate(string(structSet.Name)) {
+	for _, pkgPath := range c.pkgPathsOf(sb.input.basePart) {
+		for _, structSet := range c.candidates.Structs[pkgPath] {
+			if sb.matches(string(structSet.Name), sb.input.selectorPart) && !c.isHidden(pkgPath, string(structSet.Name)) {
 				var compositeLit string
 				if len(structSet.Fields) > 0 {
 					compositeLit = compositeLitStr(structSet.Fields)
@@ -298,11 +518,27 @@ func isPrivate(input string) bool {
 	return unicode.IsLower([]rune(input)[0])
 }
 
+// isHidden は補完候補から除外する要素かを返す
+// 対象パッケージやセッション内で宣言した要素は非公開でも参照できるので除外しない
+func (c *Completer) isHidden(pkgPath types.ImportPath, input string) bool {
+	if c.targetPkg != nil && pkgPath == c.targetPkg.ImportPath {
+		return false
+	}
+	if slices.ContainsFunc(c.topLevelDecls, func(topLevelDecl declregistry.TopLevelDecl) bool {
+		return topLevelDecl.PkgPath == pkgPath
+	}) {
+		return false
+	}
+	return isPrivate(input)
+}
+
 func (c *Completer) findDefinedTypeSuggestions(sb *suggestionBuilder) []prompt.Suggest {
 	suggestions := make([]prompt.Suggest, 0)
-	for _, definedTypeSet := range c.candidates.DefinedTypes[types.PkgName(sb.input.basePart)] {
-		if strings.HasPrefix(string(definedTypeSet.Name), sb.input.selectorPart) && !isPrivate(string(definedTypeSet.Name)) {
-			suggestions = append(suggestions, sb.build(string(definedTypeSet.Name), suggestTypeDefinedType, definedTypeSet.Description, "()"))
+	for _, pkgPath := range c.pkgPathsOf(sb.input.basePart) {
+		for _, definedTypeSet := range c.candidates.DefinedTypes[pkgPath] {
+			if sb.matches(string(definedTypeSet.Name), sb.input.selectorPart) && !c.isHidden(pkgPath, string(definedTypeSet.Name)) {
+				suggestions = append(suggestions, sb.build(string(definedTypeSet.Name), suggestTypeDefinedType, definedTypeSet.Description, "()"))
+			}
 		}
 	}
 	return suggestions
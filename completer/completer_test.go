@@ -1,28 +1,146 @@
 package completer
 
 import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	gotypes "go/types"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/kakkky/go-prompt"
 	"github.com/kakkky/gonsole/declregistry"
+	"github.com/kakkky/gonsole/metacmd"
+	"github.com/kakkky/gonsole/targetpkg"
 	"github.com/kakkky/gonsole/types"
 )
 
 func TestCompleter_Complete(t *testing.T) {
+	// フィールドの補完に使う、構造体を埋め込んだ構造体を持つパッケージの候補
+	animalCandidates := &candidates{
+		Pkgs: []pkgSet{{Name: "animal", ImportPath: `"example.com/animal"`}},
+		Methods: map[types.ImportPath][]methodSet{
+			`"example.com/animal"`: {
+				{ReceiverTypeName: "Dog", Name: "Bark", Description: "Bark barks"},
+				{
+					ReceiverTypeName: "Dog",
+					Name:             "Owner",
+					Description:      "Owner returns the owner",
+					Returns:          []returnSet{{TypeName: "Person", TypePkgPath: `"example.com/animal"`}},
+				},
+				{ReceiverTypeName: "BaseAnimal", Name: "Sleep", Description: "Sleep sleeps"},
+			},
+		},
+		Vars: map[types.ImportPath][]varSet{
+			`"example.com/animal"`: {
+				{Name: "DefaultDog", TypeName: "Dog", TypePkgPath: `"example.com/animal"`},
+			},
+		},
+		Structs: map[types.ImportPath][]structSet{
+			`"example.com/animal"`: {
+				{
+					Name:   "Dog",
+					Fields: []types.StructFieldName{"BaseAnimal", "Name", "owner"},
+					FieldSets: []fieldSet{
+						{Name: "BaseAnimal", TypeStr: "*animal.BaseAnimal", TypeName: "BaseAnimal", TypePkgPath: `"example.com/animal"`, Embedded: true},
+						{Name: "Name", TypeStr: "string", TypeName: "string"},
+						{Name: "owner", TypeStr: "*animal.Person", TypeName: "Person", TypePkgPath: `"example.com/animal"`},
+					},
+				},
+				{
+					Name:   "BaseAnimal",
+					Fields: []types.StructFieldName{"Age", "Name"},
+					FieldSets: []fieldSet{
+						{Name: "Age", TypeStr: "int", TypeName: "int"},
+						{Name: "Name", TypeStr: "string", TypeName: "string"},
+					},
+				},
+				{
+					Name:      "Person",
+					Fields:    []types.StructFieldName{"Email"},
+					FieldSets: []fieldSet{{Name: "Email", TypeStr: "string", TypeName: "string"}},
+				},
+			},
+		},
+	}
+	// 関数やメソッドの呼び出しの補完に使う、シグネチャを持つパッケージの候補
+	callCandidates := &candidates{
+		Pkgs: []pkgSet{{Name: "animal", ImportPath: `"example.com/animal"`}},
+		Funcs: map[types.ImportPath][]funcSet{
+			`"example.com/animal"`: {
+				{
+					Name:        "NewDog",
+					Description: "NewDog creates a dog",
+					Signature:   "(name string, owner *animal.Person) *animal.Dog",
+					Params: []paramSet{
+						{Name: "name", TypeStr: "string", TypeName: "string"},
+						{Name: "owner", TypeStr: "*animal.Person", Pointered: true, TypeName: "Person", TypePkgPath: `"example.com/animal"`},
+					},
+					Returns: []returnSet{{TypeName: "Dog", TypePkgPath: `"example.com/animal"`}},
+				},
+				{
+					Name:        "NewPerson",
+					Description: "NewPerson creates a person",
+					Signature:   "() *animal.Person",
+					Returns:     []returnSet{{TypeName: "Person", TypePkgPath: `"example.com/animal"`}},
+				},
+				{
+					Name:        "Walk",
+					Description: "Walk walks dogs",
+					Signature:   "(dogs ...*animal.Dog)",
+					Params: []paramSet{
+						{Name: "dogs", TypeStr: "...*animal.Dog", Pointered: true, TypeName: "Dog", TypePkgPath: `"example.com/animal"`, Variadic: true},
+					},
+				},
+			},
+		},
+		Methods: map[types.ImportPath][]methodSet{
+			`"example.com/animal"`: {
+				{
+					ReceiverTypeName: "Dog",
+					Name:             "SetOwner",
+					Description:      "SetOwner sets the owner",
+					Signature:        "(owner *animal.Person)",
+					Params: []paramSet{
+						{Name: "owner", TypeStr: "*animal.Person", Pointered: true, TypeName: "Person", TypePkgPath: `"example.com/animal"`},
+					},
+				},
+			},
+		},
+		Consts: map[types.ImportPath][]constSet{
+			`"example.com/animal"`: {
+				{Name: "DefaultName", Description: "DefaultName is the default name", TypeName: "string"},
+			},
+		},
+	}
+	dogRegistry := func() *declregistry.DeclRegistry {
+		registry := declregistry.NewRegistry()
+		registry.Decls = append(registry.Decls, declregistry.Decl{
+			Name:        "dog",
+			Pointered:   true,
+			TypeName:    "Dog",
+			TypePkgName: "animal",
+			TypePkgPath: `"example.com/animal"`,
+		})
+		return registry
+	}
+
 	tests := []struct {
 		name            string
 		inputText       string
 		setupCandidates *candidates
 		setupRegistry   *declregistry.DeclRegistry
+		targetPkg       *targetpkg.TargetPkg
+		metaCommands    *metacmd.Dispatcher
+		bindings        map[types.PkgName]types.ImportPath
 		expected        []prompt.Suggest
 	}{
 		{
 			name:      "Complete package name",
 			inputText: "myapp",
 			setupCandidates: &candidates{
-				Pkgs: []types.PkgName{"myapp", "mylib", "myutil"},
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"example.com/myapp"`}, {Name: "mylib", ImportPath: `"example.com/mylib"`}, {Name: "myutil", ImportPath: `"example.com/myutil"`}},
 			},
 			setupRegistry: declregistry.NewRegistry(),
 			expected: []prompt.Suggest{
@@ -37,7 +155,7 @@ func TestCompleter_Complete(t *testing.T) {
 			name:      "Complete package name with multiple candidates",
 			inputText: "my",
 			setupCandidates: &candidates{
-				Pkgs: []types.PkgName{"myapp", "mylib", "myutil"},
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"example.com/myapp"`}, {Name: "mylib", ImportPath: `"example.com/mylib"`}, {Name: "myutil", ImportPath: `"example.com/myutil"`}},
 			},
 			setupRegistry: declregistry.NewRegistry(),
 			expected: []prompt.Suggest{
@@ -62,7 +180,7 @@ func TestCompleter_Complete(t *testing.T) {
 			name:      "Complete package name with & operator",
 			inputText: "&myapp",
 			setupCandidates: &candidates{
-				Pkgs: []types.PkgName{"myapp", "mylib", "myutil"},
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"example.com/myapp"`}, {Name: "mylib", ImportPath: `"example.com/mylib"`}, {Name: "myutil", ImportPath: `"example.com/myutil"`}},
 			},
 			setupRegistry: declregistry.NewRegistry(),
 			expected: []prompt.Suggest{
@@ -73,13 +191,119 @@ func TestCompleter_Complete(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:      "Complete variables declared in session with keywords and builtins",
+			inputText: "d",
+			setupCandidates: &candidates{
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"example.com/myapp"`}},
+			},
+			setupRegistry: &declregistry.DeclRegistry{
+				Decls: []declregistry.Decl{
+					{Name: "dog", Pointered: true, TypeName: "Dog", TypePkgName: "animal", TypePkgPath: `"example.com/animal"`},
+					{Name: "data", TypeName: "[]byte", TypeExpr: "[]byte"},
+					{Name: "gonsoleShadowed1_data", TypeName: "string", TypeExpr: "string", Shadowed: true},
+					{Name: "cat", TypeName: "Cat", TypePkgName: "animal", TypePkgPath: `"example.com/animal"`},
+				},
+			},
+			expected: []prompt.Suggest{
+				{
+					Text:        "dog",
+					DisplayText: "dog",
+					Description: "Variable: *animal.Dog",
+				},
+				{
+					Text:        "data",
+					DisplayText: "data",
+					Description: "Variable: []byte",
+				},
+				{
+					Text:        "default",
+					DisplayText: "default",
+					Description: "Keyword: ",
+				},
+				{
+					Text:        "defer",
+					DisplayText: "defer",
+					Description: "Keyword: ",
+				},
+				{
+					Text:        "delete()",
+					DisplayText: "delete",
+					Description: "Builtin: function",
+				},
+			},
+		},
+		{
+			name:      "Complete builtins and keywords with packages",
+			inputText: "ma",
+			setupCandidates: &candidates{
+				Pkgs: []pkgSet{{Name: "math", ImportPath: `"math"`}},
+			},
+			setupRegistry: declregistry.NewRegistry(),
+			expected: []prompt.Suggest{
+				{
+					Text:        "math",
+					DisplayText: "math",
+					Description: "Package: ",
+				},
+				{
+					Text:        "make()",
+					DisplayText: "make",
+					Description: "Builtin: function",
+				},
+				{
+					Text:        "map",
+					DisplayText: "map",
+					Description: "Keyword: ",
+				},
+				{
+					Text:        "max()",
+					DisplayText: "max",
+					Description: "Builtin: function",
+				},
+			},
+		},
+		{
+			name:      "Complete builtin types and constants",
+			inputText: "x := tr",
+			setupCandidates: &candidates{
+				Pkgs: []pkgSet{},
+			},
+			setupRegistry: declregistry.NewRegistry(),
+			expected: []prompt.Suggest{
+				{
+					Text:        "true",
+					DisplayText: "true",
+					Description: "Builtin: untyped bool",
+				},
+			},
+		},
+		{
+			name:      "Only variables are completed with & operator",
+			inputText: "&d",
+			setupCandidates: &candidates{
+				Pkgs: []pkgSet{},
+			},
+			setupRegistry: &declregistry.DeclRegistry{
+				Decls: []declregistry.Decl{
+					{Name: "dog", TypeName: "Dog", TypePkgName: "animal", TypePkgPath: `"example.com/animal"`, TypeExpr: "animal.Dog"},
+				},
+			},
+			expected: []prompt.Suggest{
+				{
+					Text:        "&dog",
+					DisplayText: "dog",
+					Description: "Variable: animal.Dog",
+				},
+			},
+		},
 		{
 			name:      "Complete functions",
 			inputText: "myapp.P",
 			setupCandidates: &candidates{
-				Pkgs: []types.PkgName{"myapp"},
-				Funcs: map[types.PkgName][]funcSet{
-					"myapp": {
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"example.com/myapp"`}},
+				Funcs: map[types.ImportPath][]funcSet{
+					`"example.com/myapp"`: {
 						{Name: "Print", Description: "Print outputs a message"},
 						{Name: "Printf", Description: "Printf formats a message"},
 						{Name: "Println", Description: "Println outputs a message with newline"},
@@ -105,16 +329,117 @@ func TestCompleter_Complete(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:      "Complete functions of package imported with alias",
+			inputText: "mrand.I",
+			setupCandidates: &candidates{
+				Pkgs: []pkgSet{{Name: "rand", ImportPath: `"math/rand"`}},
+				Funcs: map[types.ImportPath][]funcSet{
+					`"math/rand"`: {
+						{Name: "Intn", Description: "Intn returns a random number"},
+					},
+				},
+			},
+			setupRegistry: &declregistry.DeclRegistry{
+				Imports: []declregistry.Import{
+					{Name: "mrand", PkgName: "rand", ImportPath: `"math/rand"`},
+				},
+			},
+			expected: []prompt.Suggest{
+				{
+					Text:        "mrand.Intn()",
+					DisplayText: "Intn",
+					Description: "Function: Intn returns a random number",
+				},
+			},
+		},
+		{
+			name:      "Complete alias of imported package",
+			inputText: "mr",
+			setupCandidates: &candidates{
+				Pkgs: []pkgSet{{Name: "rand", ImportPath: `"math/rand"`}},
+			},
+			setupRegistry: &declregistry.DeclRegistry{
+				Imports: []declregistry.Import{
+					{Name: "mrand", PkgName: "rand", ImportPath: `"math/rand"`},
+				},
+			},
+			expected: []prompt.Suggest{
+				{
+					Text:        "mrand",
+					DisplayText: "mrand",
+					Description: `Package: "math/rand"`,
+				},
+			},
+		},
+		{
+			name:      "Private functions are hidden",
+			inputText: "myapp.p",
+			setupCandidates: &candidates{
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"example.com/myapp"`}},
+				Funcs: map[types.ImportPath][]funcSet{
+					`"example.com/myapp"`: {
+						{Name: "parse", Description: "parse parses a message"},
+					},
+				},
+			},
+			setupRegistry: declregistry.NewRegistry(),
+			expected:      nil,
+		},
+		{
+			name:      "Complete private functions of target package",
+			inputText: "myapp.p",
+			setupCandidates: &candidates{
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"example.com/myapp"`}, {Name: "mylib", ImportPath: `"example.com/mylib"`}},
+				Funcs: map[types.ImportPath][]funcSet{
+					`"example.com/myapp"`: {
+						{Name: "parse", Description: "parse parses a message"},
+					},
+				},
+			},
+			setupRegistry: declregistry.NewRegistry(),
+			targetPkg:     &targetpkg.TargetPkg{Name: "myapp", ImportPath: `"example.com/myapp"`},
+			expected: []prompt.Suggest{
+				{
+					Text:        "myapp.parse()",
+					DisplayText: "parse",
+					Description: "Function: parse parses a message",
+				},
+			},
+		},
+		{
+			name:      "Complete meta commands",
+			inputText: ":h",
+			setupCandidates: &candidates{
+				Pkgs: []pkgSet{{Name: "help", ImportPath: `"example.com/help"`}},
+			},
+			setupRegistry: declregistry.NewRegistry(),
+			metaCommands: func() *metacmd.Dispatcher {
+				d := metacmd.NewDispatcher()
+				d.Register(
+					metacmd.Command{Name: ":help", Description: "show available commands"},
+					metacmd.Command{Name: ":quit", Description: "exit the session"},
+				)
+				return d
+			}(),
+			expected: []prompt.Suggest{
+				{
+					Text:        ":help",
+					DisplayText: ":help",
+					Description: "Command: show available commands",
+				},
+			},
+		},
 		{
 			name:      "Complete variables",
 			inputText: "myapp.S",
 			setupCandidates: &candidates{
-				Pkgs: []types.PkgName{"myapp"},
-				Vars: map[types.PkgName][]varSet{
-					"myapp": {
-						{Name: "StdIn", Description: "Standard input", TypeName: types.TypeName("Stream"), TypePkgName: "myapp"},
-						{Name: "StdOut", Description: "Standard output", TypeName: types.TypeName("Stream"), TypePkgName: "myapp"},
-						{Name: "StdErr", Description: "Standard error", TypeName: types.TypeName("Stream"), TypePkgName: "myapp"},
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"example.com/myapp"`}},
+				Vars: map[types.ImportPath][]varSet{
+					`"example.com/myapp"`: {
+						{Name: "StdIn", Description: "Standard input", TypeName: types.TypeName("Stream"), TypePkgPath: `"example.com/myapp"`},
+						{Name: "StdOut", Description: "Standard output", TypeName: types.TypeName("Stream"), TypePkgPath: `"example.com/myapp"`},
+						{Name: "StdErr", Description: "Standard error", TypeName: types.TypeName("Stream"), TypePkgPath: `"example.com/myapp"`},
 					},
 				},
 			},
@@ -141,9 +466,9 @@ func TestCompleter_Complete(t *testing.T) {
 			name:      "Complete constants",
 			inputText: "mylib.M",
 			setupCandidates: &candidates{
-				Pkgs: []types.PkgName{"mylib"},
-				Consts: map[types.PkgName][]constSet{
-					"mylib": {
+				Pkgs: []pkgSet{{Name: "mylib", ImportPath: `"example.com/mylib"`}},
+				Consts: map[types.ImportPath][]constSet{
+					`"example.com/mylib"`: {
 						{Name: "MaxRetries", Description: "Maximum number of retries"},
 						{Name: "MinBufferSize", Description: "Minimum buffer size"},
 					},
@@ -167,9 +492,9 @@ func TestCompleter_Complete(t *testing.T) {
 			name:      "Complete structs",
 			inputText: "myapp.C",
 			setupCandidates: &candidates{
-				Pkgs: []types.PkgName{"myapp"},
-				Structs: map[types.PkgName][]structSet{
-					"myapp": {
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"example.com/myapp"`}},
+				Structs: map[types.ImportPath][]structSet{
+					`"example.com/myapp"`: {
 						{Name: "Client", Description: "A client for API calls", Fields: []types.StructFieldName{"Timeout", "BaseURL"}},
 						{Name: "Config", Description: "A configuration structure", Fields: []types.StructFieldName{"Name", "Value"}},
 					},
@@ -193,9 +518,9 @@ func TestCompleter_Complete(t *testing.T) {
 			name:      "Complete structs with & operator",
 			inputText: "&myapp.C",
 			setupCandidates: &candidates{
-				Pkgs: []types.PkgName{"myapp"},
-				Structs: map[types.PkgName][]structSet{
-					"myapp": {
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"example.com/myapp"`}},
+				Structs: map[types.ImportPath][]structSet{
+					`"example.com/myapp"`: {
 						{Name: "Client", Description: "A client for API calls", Fields: []types.StructFieldName{"Timeout", "BaseURL"}},
 						{Name: "Config", Description: "A configuration structure", Fields: []types.StructFieldName{"Name", "Value"}},
 					},
@@ -219,9 +544,9 @@ func TestCompleter_Complete(t *testing.T) {
 			name:      "Complete defined types",
 			inputText: "myapp.M",
 			setupCandidates: &candidates{
-				Pkgs: []types.PkgName{"myapp"},
-				DefinedTypes: map[types.PkgName][]DefinedTypeSet{
-					"myapp": {
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"example.com/myapp"`}},
+				DefinedTypes: map[types.ImportPath][]DefinedTypeSet{
+					`"example.com/myapp"`: {
 						{Name: "MyInt", UnderlyingType: "int", Description: "MyInt is a custom int type"},
 						{Name: "MyString", UnderlyingType: "string", Description: "MyString is a custom string type"},
 					},
@@ -245,9 +570,9 @@ func TestCompleter_Complete(t *testing.T) {
 			name:      "Complete after variable declaration with =",
 			inputText: "var client = myapp.C",
 			setupCandidates: &candidates{
-				Pkgs: []types.PkgName{"myapp"},
-				Structs: map[types.PkgName][]structSet{
-					"myapp": {
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"example.com/myapp"`}},
+				Structs: map[types.ImportPath][]structSet{
+					`"example.com/myapp"`: {
 						{Name: "Client", Description: "A client for API calls", Fields: []types.StructFieldName{"Timeout", "BaseURL"}},
 						{Name: "Config", Description: "A configuration structure", Fields: []types.StructFieldName{"Name", "Value"}},
 					},
@@ -271,16 +596,16 @@ func TestCompleter_Complete(t *testing.T) {
 			name:      "Complete methods of variable declared from struct literal",
 			inputText: "client.",
 			setupCandidates: &candidates{
-				Pkgs: []types.PkgName{"myapp"},
-				Methods: map[types.PkgName][]methodSet{
-					"myapp": {
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"example.com/myapp"`}},
+				Methods: map[types.ImportPath][]methodSet{
+					`"example.com/myapp"`: {
 						{
 							ReceiverTypeName: "Client",
 							Name:             "Do",
 							Description:      "Do executes a request",
 							Returns: []returnSet{
-								{TypeName: types.TypeName("Response"), TypePkgName: types.PkgName("myapp")},
-								{TypeName: types.TypeName("error"), TypePkgName: types.PkgName("")},
+								{TypeName: types.TypeName("Response"), TypePkgPath: `"example.com/myapp"`},
+								{TypeName: types.TypeName("error"), TypePkgPath: ""},
 							},
 						},
 						{
@@ -288,8 +613,8 @@ func TestCompleter_Complete(t *testing.T) {
 							Name:             "Get",
 							Description:      "Get sends a GET request",
 							Returns: []returnSet{
-								{TypeName: types.TypeName("Response"), TypePkgName: types.PkgName("myapp")},
-								{TypeName: types.TypeName("error"), TypePkgName: types.PkgName("")},
+								{TypeName: types.TypeName("Response"), TypePkgPath: `"example.com/myapp"`},
+								{TypeName: types.TypeName("error"), TypePkgPath: ""},
 							},
 						},
 					},
@@ -301,6 +626,7 @@ func TestCompleter_Complete(t *testing.T) {
 					Name:        "client",
 					TypeName:    "Client",
 					TypePkgName: "myapp",
+					TypePkgPath: `"example.com/myapp"`,
 				})
 
 				return registry
@@ -322,21 +648,21 @@ func TestCompleter_Complete(t *testing.T) {
 			name:      "Complete methods of variable declared from another variable",
 			inputText: "stream.",
 			setupCandidates: &candidates{
-				Pkgs: []types.PkgName{"myapp"},
-				Vars: map[types.PkgName][]varSet{
-					"myapp": {
-						{Name: "StdOut", Description: "Standard output", TypeName: types.TypeName("Stream"), TypePkgName: "myapp"},
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"example.com/myapp"`}},
+				Vars: map[types.ImportPath][]varSet{
+					`"example.com/myapp"`: {
+						{Name: "StdOut", Description: "Standard output", TypeName: types.TypeName("Stream"), TypePkgPath: `"example.com/myapp"`},
 					},
 				},
-				Methods: map[types.PkgName][]methodSet{
-					"myapp": {
+				Methods: map[types.ImportPath][]methodSet{
+					`"example.com/myapp"`: {
 						{
 							ReceiverTypeName: "Stream",
 							Name:             "Write",
 							Description:      "Write writes data to the stream",
 							Returns: []returnSet{
-								{TypeName: types.TypeName("int"), TypePkgName: types.PkgName("")},
-								{TypeName: types.TypeName("error"), TypePkgName: types.PkgName("")},
+								{TypeName: types.TypeName("int"), TypePkgPath: ""},
+								{TypeName: types.TypeName("error"), TypePkgPath: ""},
 							},
 						},
 						{
@@ -344,7 +670,7 @@ func TestCompleter_Complete(t *testing.T) {
 							Name:             "Close",
 							Description:      "Close closes the stream",
 							Returns: []returnSet{
-								{TypeName: types.TypeName("error"), TypePkgName: types.PkgName("")},
+								{TypeName: types.TypeName("error"), TypePkgPath: ""},
 							},
 						},
 					},
@@ -356,6 +682,7 @@ func TestCompleter_Complete(t *testing.T) {
 					Name:        "stream",
 					TypeName:    "Stream",
 					TypePkgName: "myapp",
+					TypePkgPath: `"example.com/myapp"`,
 				})
 				return registry
 			}(),
@@ -376,27 +703,27 @@ func TestCompleter_Complete(t *testing.T) {
 			name:      "Complete methods of variable declared from function return",
 			inputText: "response.",
 			setupCandidates: &candidates{
-				Pkgs: []types.PkgName{"myapp"},
-				Funcs: map[types.PkgName][]funcSet{
-					"myapp": {
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"example.com/myapp"`}},
+				Funcs: map[types.ImportPath][]funcSet{
+					`"example.com/myapp"`: {
 						{
 							Name:        "FetchData",
 							Description: "FetchData retrieves data from a source",
 							Returns: []returnSet{
-								{TypeName: types.TypeName("Response"), TypePkgName: types.PkgName("myapp")},
-								{TypeName: types.TypeName("error"), TypePkgName: types.PkgName("")},
+								{TypeName: types.TypeName("Response"), TypePkgPath: `"example.com/myapp"`},
+								{TypeName: types.TypeName("error"), TypePkgPath: ""},
 							},
 						},
 					},
 				},
-				Methods: map[types.PkgName][]methodSet{
-					"myapp": {
+				Methods: map[types.ImportPath][]methodSet{
+					`"example.com/myapp"`: {
 						{
 							ReceiverTypeName: "Response",
 							Name:             "GetContent",
 							Description:      "GetContent returns the response content",
 							Returns: []returnSet{
-								{TypeName: types.TypeName("Content"), TypePkgName: types.PkgName("myapp")},
+								{TypeName: types.TypeName("Content"), TypePkgPath: `"example.com/myapp"`},
 							},
 						},
 					},
@@ -408,6 +735,7 @@ func TestCompleter_Complete(t *testing.T) {
 					Name:        "response",
 					TypeName:    "Response",
 					TypePkgName: "myapp",
+					TypePkgPath: `"example.com/myapp"`,
 				})
 				return registry
 			}(),
@@ -423,27 +751,27 @@ func TestCompleter_Complete(t *testing.T) {
 			name:      "Complete methods of variable declared from method return",
 			inputText: "content.",
 			setupCandidates: &candidates{
-				Pkgs: []types.PkgName{"myapp"},
-				Funcs: map[types.PkgName][]funcSet{
-					"myapp": {
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"example.com/myapp"`}},
+				Funcs: map[types.ImportPath][]funcSet{
+					`"example.com/myapp"`: {
 						{
 							Name:        "FetchData",
 							Description: "FetchData retrieves data from a source",
 							Returns: []returnSet{
-								{TypeName: types.TypeName("Response"), TypePkgName: types.PkgName("myapp")},
-								{TypeName: types.TypeName("error"), TypePkgName: types.PkgName("")},
+								{TypeName: types.TypeName("Response"), TypePkgPath: `"example.com/myapp"`},
+								{TypeName: types.TypeName("error"), TypePkgPath: ""},
 							},
 						},
 					},
 				},
-				Methods: map[types.PkgName][]methodSet{
-					"myapp": {
+				Methods: map[types.ImportPath][]methodSet{
+					`"example.com/myapp"`: {
 						{
 							ReceiverTypeName: "Response",
 							Name:             "GetContent",
 							Description:      "GetContent returns the response content",
 							Returns: []returnSet{
-								{TypeName: types.TypeName("Content"), TypePkgName: types.PkgName("myapp")},
+								{TypeName: types.TypeName("Content"), TypePkgPath: `"example.com/myapp"`},
 							},
 						},
 						{
@@ -451,8 +779,8 @@ func TestCompleter_Complete(t *testing.T) {
 							Name:             "Read",
 							Description:      "Read reads data from the content",
 							Returns: []returnSet{
-								{TypeName: types.TypeName("int"), TypePkgName: types.PkgName("")},
-								{TypeName: types.TypeName("error"), TypePkgName: types.PkgName("")},
+								{TypeName: types.TypeName("int"), TypePkgPath: ""},
+								{TypeName: types.TypeName("error"), TypePkgPath: ""},
 							},
 						},
 						{
@@ -460,7 +788,7 @@ func TestCompleter_Complete(t *testing.T) {
 							Name:             "Type",
 							Description:      "Type returns the content type",
 							Returns: []returnSet{
-								{TypeName: types.TypeName("string"), TypePkgName: types.PkgName("")},
+								{TypeName: types.TypeName("string"), TypePkgPath: ""},
 							},
 						},
 					},
@@ -472,11 +800,13 @@ func TestCompleter_Complete(t *testing.T) {
 					Name:        "response",
 					TypeName:    "Response",
 					TypePkgName: "myapp",
+					TypePkgPath: `"example.com/myapp"`,
 				},
 					declregistry.Decl{
 						Name:        "content",
 						TypeName:    "Content",
 						TypePkgName: "myapp",
+						TypePkgPath: `"example.com/myapp"`,
 					})
 				return registry
 			}(),
@@ -497,28 +827,28 @@ func TestCompleter_Complete(t *testing.T) {
 			name:      "Complete methods of variable storing interface return value",
 			inputText: "reader.",
 			setupCandidates: &candidates{
-				Pkgs: []types.PkgName{"myapp"},
-				Funcs: map[types.PkgName][]funcSet{
-					"myapp": {
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"example.com/myapp"`}},
+				Funcs: map[types.ImportPath][]funcSet{
+					`"example.com/myapp"`: {
 						{
 							Name:        "NewReader",
 							Description: "NewReader creates a new reader",
 							Returns: []returnSet{
-								{TypeName: types.TypeName("Reader"), TypePkgName: types.PkgName("myapp")},
-								{TypeName: types.TypeName("error"), TypePkgName: types.PkgName("")},
+								{TypeName: types.TypeName("Reader"), TypePkgPath: `"example.com/myapp"`},
+								{TypeName: types.TypeName("error"), TypePkgPath: ""},
 							},
 						},
 					},
 				},
-				Methods: map[types.PkgName][]methodSet{
-					"myapp": {
+				Methods: map[types.ImportPath][]methodSet{
+					`"example.com/myapp"`: {
 						{
 							ReceiverTypeName: "MyReader",
 							Name:             "Read",
 							Description:      "Read reads data from the reader",
 							Returns: []returnSet{
-								{TypeName: types.TypeName("int"), TypePkgName: types.PkgName("")},
-								{TypeName: types.TypeName("error"), TypePkgName: types.PkgName("")},
+								{TypeName: types.TypeName("int"), TypePkgPath: ""},
+								{TypeName: types.TypeName("error"), TypePkgPath: ""},
 							},
 						},
 						{
@@ -526,13 +856,13 @@ func TestCompleter_Complete(t *testing.T) {
 							Name:             "Close",
 							Description:      "Close closes the reader",
 							Returns: []returnSet{
-								{TypeName: types.TypeName("error"), TypePkgName: types.PkgName("")},
+								{TypeName: types.TypeName("error"), TypePkgPath: ""},
 							},
 						},
 					},
 				},
-				Interfaces: map[types.PkgName][]interfaceSet{
-					"myapp": {
+				Interfaces: map[types.ImportPath][]interfaceSet{
+					`"example.com/myapp"`: {
 						{
 							Name:         "Reader",
 							Methods:      []types.DeclName{"Read", "Close"},
@@ -547,6 +877,7 @@ func TestCompleter_Complete(t *testing.T) {
 					Name:        "reader",
 					TypeName:    "MyReader",
 					TypePkgName: "myapp",
+					TypePkgPath: `"example.com/myapp"`,
 				})
 				return registry
 			}(),
@@ -567,33 +898,33 @@ func TestCompleter_Complete(t *testing.T) {
 			name:      "Complete methods of variable storing interface return value from method",
 			inputText: "resource.",
 			setupCandidates: &candidates{
-				Pkgs: []types.PkgName{"myapp"},
-				Funcs: map[types.PkgName][]funcSet{
-					"myapp": {
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"example.com/myapp"`}},
+				Funcs: map[types.ImportPath][]funcSet{
+					`"example.com/myapp"`: {
 						{
 							Name:        "CreateClient",
 							Description: "CreateClient creates a new client",
 							Returns: []returnSet{
-								{TypeName: types.TypeName("Client"), TypePkgName: types.PkgName("myapp")},
-								{TypeName: types.TypeName("error"), TypePkgName: types.PkgName("")},
+								{TypeName: types.TypeName("Client"), TypePkgPath: `"example.com/myapp"`},
+								{TypeName: types.TypeName("error"), TypePkgPath: ""},
 							},
 						},
 					},
 				},
-				Methods: map[types.PkgName][]methodSet{
-					"myapp": {
+				Methods: map[types.ImportPath][]methodSet{
+					`"example.com/myapp"`: {
 						{
 							ReceiverTypeName: "Client",
 							Name:             "GetResource",
 							Description:      "GetResource returns a resource interface",
 							Returns: []returnSet{
-								{TypeName: types.TypeName("Resource"), TypePkgName: types.PkgName("myapp")},
+								{TypeName: types.TypeName("Resource"), TypePkgPath: `"example.com/myapp"`},
 							},
 						},
 					},
 				},
-				Interfaces: map[types.PkgName][]interfaceSet{
-					"myapp": {
+				Interfaces: map[types.ImportPath][]interfaceSet{
+					`"example.com/myapp"`: {
 						{
 							Name:    "Resource",
 							Methods: []types.DeclName{"Open", "Save", "Delete"},
@@ -612,11 +943,13 @@ func TestCompleter_Complete(t *testing.T) {
 					Name:        "client",
 					TypeName:    "Client",
 					TypePkgName: "myapp",
+					TypePkgPath: `"example.com/myapp"`,
 				},
 					declregistry.Decl{
 						Name:        "resource",
 						TypeName:    "Resource",
 						TypePkgName: "myapp",
+						TypePkgPath: `"example.com/myapp"`,
 					},
 				)
 				return registry
@@ -643,15 +976,15 @@ func TestCompleter_Complete(t *testing.T) {
 			name:      "Do not complete private symbols",
 			inputText: "myapp.",
 			setupCandidates: &candidates{
-				Pkgs: []types.PkgName{"myapp"},
-				Funcs: map[types.PkgName][]funcSet{
-					"myapp": {
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"example.com/myapp"`}},
+				Funcs: map[types.ImportPath][]funcSet{
+					`"example.com/myapp"`: {
 						{Name: "Print", Description: "Print outputs a message"},
 						{Name: "printf", Description: "Internal printing function"},
 					},
 				},
-				Vars: map[types.PkgName][]varSet{
-					"myapp": {
+				Vars: map[types.ImportPath][]varSet{
+					`"example.com/myapp"`: {
 						{Name: "Version", Description: "Package:  version"},
 						{Name: "privateVar", Description: "Internal variable"},
 					},
@@ -676,26 +1009,26 @@ func TestCompleter_Complete(t *testing.T) {
 			name:      "Method chain after function with single return value",
 			inputText: "myapp.NewClient().",
 			setupCandidates: &candidates{
-				Pkgs: []types.PkgName{"myapp"},
-				Funcs: map[types.PkgName][]funcSet{
-					"myapp": {
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"example.com/myapp"`}},
+				Funcs: map[types.ImportPath][]funcSet{
+					`"example.com/myapp"`: {
 						{
 							Name:        "NewClient",
 							Description: "Create new client",
 							Returns: []returnSet{
-								{TypeName: types.TypeName("Client"), TypePkgName: "myapp"},
+								{TypeName: types.TypeName("Client"), TypePkgPath: `"example.com/myapp"`},
 							},
 						},
 					},
 				},
-				Methods: map[types.PkgName][]methodSet{
-					"myapp": {
+				Methods: map[types.ImportPath][]methodSet{
+					`"example.com/myapp"`: {
 						{
 							ReceiverTypeName: "Client",
 							Name:             "Do",
 							Description:      "Do something",
 							Returns: []returnSet{
-								{TypeName: types.TypeName("Result"), TypePkgName: "myapp"},
+								{TypeName: types.TypeName("Result"), TypePkgPath: `"example.com/myapp"`},
 							},
 						},
 					},
@@ -710,31 +1043,192 @@ func TestCompleter_Complete(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:      "Method chain after function returning type of another package",
+			inputText: "myapp.NewRequest().C",
+			setupCandidates: &candidates{
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"example.com/myapp"`}, {Name: "http", ImportPath: `"net/http"`}},
+				Funcs: map[types.ImportPath][]funcSet{
+					`"example.com/myapp"`: {
+						{
+							Name:        "NewRequest",
+							Description: "Create new request",
+							Returns: []returnSet{
+								{TypeName: types.TypeName("Request"), TypePkgPath: `"net/http"`},
+							},
+						},
+					},
+				},
+				Methods: map[types.ImportPath][]methodSet{
+					`"example.com/myapp"`: {
+						{
+							ReceiverTypeName: "Request",
+							Name:             "Cancel",
+							Description:      "Cancel the request",
+							Returns:          []returnSet{{TypeName: types.TypeName("error")}},
+						},
+					},
+					`"net/http"`: {
+						{
+							ReceiverTypeName: "Request",
+							Name:             "Context",
+							Description:      "Context returns the request's context",
+							Returns:          []returnSet{{TypeName: types.TypeName("Context"), TypePkgPath: `"context"`}},
+						},
+						{
+							ReceiverTypeName: "Request",
+							Name:             "Cookie",
+							Description:      "Cookie returns the named cookie",
+							Returns: []returnSet{
+								{TypeName: types.TypeName("Cookie"), TypePkgPath: `"net/http"`},
+								{TypeName: types.TypeName("error")},
+							},
+						},
+					},
+				},
+			},
+			setupRegistry: declregistry.NewRegistry(),
+			expected: []prompt.Suggest{
+				{
+					Text:        "myapp.NewRequest().Context()",
+					DisplayText: "Context",
+					Description: "Method: Context returns the request's context",
+				},
+			},
+		},
+		{
+			name:      "Complete methods of type from one of packages with same name",
+			inputText: "r.",
+			setupCandidates: &candidates{
+				Pkgs: []pkgSet{{Name: "rand", ImportPath: `"math/rand"`}, {Name: "rand", ImportPath: `"example.com/rand"`}},
+				Methods: map[types.ImportPath][]methodSet{
+					`"math/rand"`: {
+						{ReceiverTypeName: "Rand", Name: "Intn", Description: "Intn returns a random number"},
+					},
+					`"example.com/rand"`: {
+						{ReceiverTypeName: "Rand", Name: "Roll", Description: "Roll rolls a dice"},
+					},
+				},
+			},
+			setupRegistry: &declregistry.DeclRegistry{
+				Decls: []declregistry.Decl{
+					{Name: "r", Pointered: true, TypeName: "Rand", TypePkgName: "rand", TypePkgPath: `"math/rand"`},
+				},
+			},
+			expected: []prompt.Suggest{
+				{
+					Text:        "r.Intn()",
+					DisplayText: "Intn",
+					Description: "Method: Intn returns a random number",
+				},
+			},
+		},
+		{
+			name:      "Complete functions of packages with same name",
+			inputText: "rand.",
+			setupCandidates: &candidates{
+				Pkgs: []pkgSet{{Name: "rand", ImportPath: `"math/rand"`}, {Name: "rand", ImportPath: `"example.com/rand"`}},
+				Funcs: map[types.ImportPath][]funcSet{
+					`"math/rand"`: {
+						{Name: "Intn", Description: "Intn returns a random number"},
+					},
+					`"example.com/rand"`: {
+						{Name: "Roll", Description: "Roll rolls a dice"},
+					},
+				},
+			},
+			setupRegistry: declregistry.NewRegistry(),
+			expected: []prompt.Suggest{
+				{
+					Text:        "rand.Intn()",
+					DisplayText: "Intn",
+					Description: "Function: Intn returns a random number",
+				},
+				{
+					Text:        "rand.Roll()",
+					DisplayText: "Roll",
+					Description: "Function: Roll rolls a dice",
+				},
+			},
+		},
+		{
+			name:      "Complete functions of imported one of packages with same name",
+			inputText: "rand.",
+			setupCandidates: &candidates{
+				Pkgs: []pkgSet{{Name: "rand", ImportPath: `"math/rand"`}, {Name: "rand", ImportPath: `"example.com/rand"`}},
+				Funcs: map[types.ImportPath][]funcSet{
+					`"math/rand"`: {
+						{Name: "Intn", Description: "Intn returns a random number"},
+					},
+					`"example.com/rand"`: {
+						{Name: "Roll", Description: "Roll rolls a dice"},
+					},
+				},
+			},
+			setupRegistry: &declregistry.DeclRegistry{
+				Imports: []declregistry.Import{
+					{Name: "rand", PkgName: "rand", ImportPath: `"example.com/rand"`},
+				},
+			},
+			expected: []prompt.Suggest{
+				{
+					Text:        "rand.Roll()",
+					DisplayText: "Roll",
+					Description: "Function: Roll rolls a dice",
+				},
+			},
+		},
+		{
+			name:      "Complete functions of bound one of packages with same name",
+			inputText: "rand.",
+			setupCandidates: &candidates{
+				Pkgs: []pkgSet{{Name: "rand", ImportPath: `"math/rand"`}, {Name: "rand", ImportPath: `"example.com/rand"`}},
+				Funcs: map[types.ImportPath][]funcSet{
+					`"math/rand"`: {
+						{Name: "Intn", Description: "Intn returns a random number"},
+					},
+					`"example.com/rand"`: {
+						{Name: "Roll", Description: "Roll rolls a dice"},
+					},
+				},
+			},
+			setupRegistry: declregistry.NewRegistry(),
+			bindings: map[types.PkgName]types.ImportPath{
+				"rand": `"math/rand"`,
+			},
+			expected: []prompt.Suggest{
+				{
+					Text:        "rand.Intn()",
+					DisplayText: "Intn",
+					Description: "Function: Intn returns a random number",
+				},
+			},
+		},
 		{
 			name:      "No method chain after function with multiple return values",
 			inputText: "myapp.NewClient().",
 			setupCandidates: &candidates{
-				Pkgs: []types.PkgName{"myapp"},
-				Funcs: map[types.PkgName][]funcSet{
-					"myapp": {
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"example.com/myapp"`}},
+				Funcs: map[types.ImportPath][]funcSet{
+					`"example.com/myapp"`: {
 						{
 							Name:        "NewClient",
 							Description: "Create new client",
 							Returns: []returnSet{
-								{TypeName: types.TypeName("Client"), TypePkgName: "myapp"},
-								{TypeName: types.TypeName("error"), TypePkgName: ""},
+								{TypeName: types.TypeName("Client"), TypePkgPath: `"example.com/myapp"`},
+								{TypeName: types.TypeName("error"), TypePkgPath: ""},
 							},
 						},
 					},
 				},
-				Methods: map[types.PkgName][]methodSet{
-					"myapp": {
+				Methods: map[types.ImportPath][]methodSet{
+					`"example.com/myapp"`: {
 						{
 							ReceiverTypeName: "Client",
 							Name:             "Do",
 							Description:      "Do something",
 							Returns: []returnSet{
-								{TypeName: types.TypeName("Result"), TypePkgName: "myapp"},
+								{TypeName: types.TypeName("Result"), TypePkgPath: `"example.com/myapp"`},
 							},
 						},
 					},
@@ -747,20 +1241,20 @@ func TestCompleter_Complete(t *testing.T) {
 			name:      "Method chain after function returning interface",
 			inputText: "myapp.NewReader().",
 			setupCandidates: &candidates{
-				Pkgs: []types.PkgName{"myapp"},
-				Funcs: map[types.PkgName][]funcSet{
-					"myapp": {
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"example.com/myapp"`}},
+				Funcs: map[types.ImportPath][]funcSet{
+					`"example.com/myapp"`: {
 						{
 							Name:        "NewReader",
 							Description: "Create new reader",
 							Returns: []returnSet{
-								{TypeName: types.TypeName("Reader"), TypePkgName: "myapp"},
+								{TypeName: types.TypeName("Reader"), TypePkgPath: `"example.com/myapp"`},
 							},
 						},
 					},
 				},
-				Interfaces: map[types.PkgName][]interfaceSet{
-					"myapp": {
+				Interfaces: map[types.ImportPath][]interfaceSet{
+					`"example.com/myapp"`: {
 						{
 							Name:         "Reader",
 							Methods:      []types.DeclName{"Read", "Close"},
@@ -787,15 +1281,15 @@ func TestCompleter_Complete(t *testing.T) {
 			name:      "Method chain after method with single return value",
 			inputText: "client.GetResource().",
 			setupCandidates: &candidates{
-				Pkgs: []types.PkgName{"myapp"},
-				Methods: map[types.PkgName][]methodSet{
-					"myapp": {
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"example.com/myapp"`}},
+				Methods: map[types.ImportPath][]methodSet{
+					`"example.com/myapp"`: {
 						{
 							ReceiverTypeName: "Client",
 							Name:             "GetResource",
 							Description:      "Get resource",
 							Returns: []returnSet{
-								{TypeName: types.TypeName("Resource"), TypePkgName: types.PkgName("myapp")},
+								{TypeName: types.TypeName("Resource"), TypePkgPath: `"example.com/myapp"`},
 							},
 						},
 						{
@@ -803,7 +1297,7 @@ func TestCompleter_Complete(t *testing.T) {
 							Name:             "Open",
 							Description:      "Open resource",
 							Returns: []returnSet{
-								{TypeName: types.TypeName("error"), TypePkgName: types.PkgName("")},
+								{TypeName: types.TypeName("error"), TypePkgPath: ""},
 							},
 						},
 					},
@@ -815,6 +1309,7 @@ func TestCompleter_Complete(t *testing.T) {
 					Name:        "client",
 					TypeName:    "Client",
 					TypePkgName: "myapp",
+					TypePkgPath: `"example.com/myapp"`,
 				})
 				return registry
 			}(),
@@ -830,16 +1325,16 @@ func TestCompleter_Complete(t *testing.T) {
 			name:      "No method chain after method with multiple return values",
 			inputText: "client.GetResource().",
 			setupCandidates: &candidates{
-				Pkgs: []types.PkgName{"myapp"},
-				Methods: map[types.PkgName][]methodSet{
-					"myapp": {
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"example.com/myapp"`}},
+				Methods: map[types.ImportPath][]methodSet{
+					`"example.com/myapp"`: {
 						{
 							ReceiverTypeName: "Client",
 							Name:             "GetResource",
 							Description:      "Get resource",
 							Returns: []returnSet{
-								{TypeName: types.TypeName("Resource"), TypePkgName: types.PkgName("myapp")},
-								{TypeName: types.TypeName("error"), TypePkgName: types.PkgName("")},
+								{TypeName: types.TypeName("Resource"), TypePkgPath: `"example.com/myapp"`},
+								{TypeName: types.TypeName("error"), TypePkgPath: ""},
 							},
 						},
 						{
@@ -847,7 +1342,7 @@ func TestCompleter_Complete(t *testing.T) {
 							Name:             "Open",
 							Description:      "Open resource",
 							Returns: []returnSet{
-								{TypeName: types.TypeName("error"), TypePkgName: types.PkgName("")},
+								{TypeName: types.TypeName("error"), TypePkgPath: ""},
 							},
 						},
 					},
@@ -859,6 +1354,7 @@ func TestCompleter_Complete(t *testing.T) {
 					Name:        "client",
 					TypeName:    "Client",
 					TypePkgName: "myapp",
+					TypePkgPath: `"example.com/myapp"`,
 				})
 				return registry
 			}(),
@@ -868,26 +1364,26 @@ func TestCompleter_Complete(t *testing.T) {
 			name:      "Method chain after interface-returning method chain",
 			inputText: "reader.Read().",
 			setupCandidates: &candidates{
-				Pkgs: []types.PkgName{"myapp"},
-				Funcs: map[types.PkgName][]funcSet{
-					"myapp": {
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"example.com/myapp"`}},
+				Funcs: map[types.ImportPath][]funcSet{
+					`"example.com/myapp"`: {
 						{
 							Name:        "NewReader",
 							Description: "NewReader creates a new reader",
 							Returns: []returnSet{
-								{TypeName: types.TypeName("Reader"), TypePkgName: types.PkgName("myapp")},
+								{TypeName: types.TypeName("Reader"), TypePkgPath: `"example.com/myapp"`},
 							},
 						},
 					},
 				},
-				Methods: map[types.PkgName][]methodSet{
-					"myapp": {
+				Methods: map[types.ImportPath][]methodSet{
+					`"example.com/myapp"`: {
 						{
 							ReceiverTypeName: "Reader",
 							Name:             "Read",
 							Description:      "Read reads data from the reader",
 							Returns: []returnSet{
-								{TypeName: types.TypeName("Reader"), TypePkgName: types.PkgName("myapp")},
+								{TypeName: types.TypeName("Reader"), TypePkgPath: `"example.com/myapp"`},
 							},
 						},
 						{
@@ -895,13 +1391,13 @@ func TestCompleter_Complete(t *testing.T) {
 							Name:             "Close",
 							Description:      "Close closes the reader",
 							Returns: []returnSet{
-								{TypeName: types.TypeName("error"), TypePkgName: types.PkgName("")},
+								{TypeName: types.TypeName("error"), TypePkgPath: ""},
 							},
 						},
 					},
 				},
-				Interfaces: map[types.PkgName][]interfaceSet{
-					"myapp": {
+				Interfaces: map[types.ImportPath][]interfaceSet{
+					`"example.com/myapp"`: {
 						{
 							Name:         "Reader",
 							Methods:      []types.DeclName{"Read", "Close"},
@@ -916,6 +1412,7 @@ func TestCompleter_Complete(t *testing.T) {
 					Name:        "reader",
 					TypeName:    "Reader",
 					TypePkgName: "myapp",
+					TypePkgPath: `"example.com/myapp"`,
 				})
 				return registry
 			}(),
@@ -932,13 +1429,363 @@ func TestCompleter_Complete(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:            "Complete fields of variable including promoted fields",
+			inputText:       "dog.",
+			setupCandidates: animalCandidates,
+			setupRegistry:   dogRegistry(),
+			expected: []prompt.Suggest{
+				{
+					Text:        "dog.Bark()",
+					DisplayText: "Bark",
+					Description: "Method: Bark barks",
+				},
+				{
+					Text:        "dog.Owner()",
+					DisplayText: "Owner",
+					Description: "Method: Owner returns the owner",
+				},
+				{
+					Text:        "dog.BaseAnimal",
+					DisplayText: "BaseAnimal",
+					Description: "Field: *animal.BaseAnimal",
+				},
+				{
+					Text:        "dog.Name",
+					DisplayText: "Name",
+					Description: "Field: string",
+				},
+				{
+					Text:        "dog.Age",
+					DisplayText: "Age",
+					Description: "Field: int",
+				},
+			},
+		},
+		{
+			name:            "Complete fields with prefix",
+			inputText:       "dog.A",
+			setupCandidates: animalCandidates,
+			setupRegistry:   dogRegistry(),
+			expected: []prompt.Suggest{
+				{
+					Text:        "dog.Age",
+					DisplayText: "Age",
+					Description: "Field: int",
+				},
+			},
+		},
+		{
+			name:            "Complete fields and methods of field",
+			inputText:       "dog.BaseAnimal.",
+			setupCandidates: animalCandidates,
+			setupRegistry:   dogRegistry(),
+			expected: []prompt.Suggest{
+				{
+					Text:        "dog.BaseAnimal.Sleep()",
+					DisplayText: "Sleep",
+					Description: "Method: Sleep sleeps",
+				},
+				{
+					Text:        "dog.BaseAnimal.Age",
+					DisplayText: "Age",
+					Description: "Field: int",
+				},
+				{
+					Text:        "dog.BaseAnimal.Name",
+					DisplayText: "Name",
+					Description: "Field: string",
+				},
+			},
+		},
+		{
+			name:            "Complete fields of method chain result",
+			inputText:       "dog.Owner().",
+			setupCandidates: animalCandidates,
+			setupRegistry:   dogRegistry(),
+			expected: []prompt.Suggest{
+				{
+					Text:        "dog.Owner().Email",
+					DisplayText: "Email",
+					Description: "Field: string",
+				},
+			},
+		},
+		{
+			name:            "Complete fields of package variable",
+			inputText:       "animal.DefaultDog.N",
+			setupCandidates: animalCandidates,
+			setupRegistry:   declregistry.NewRegistry(),
+			expected: []prompt.Suggest{
+				{
+					Text:        "animal.DefaultDog.Name",
+					DisplayText: "Name",
+					Description: "Field: string",
+				},
+			},
+		},
+		{
+			name:            "Complete methods of variable in function argument",
+			inputText:       "fmt.Println(dog.B",
+			setupCandidates: animalCandidates,
+			setupRegistry:   dogRegistry(),
+			expected: []prompt.Suggest{
+				{
+					Text:        "fmt.Println(dog.Bark()",
+					DisplayText: "Bark",
+					Description: "Method: Bark barks",
+				},
+				{
+					Text:        "fmt.Println(dog.BaseAnimal",
+					DisplayText: "BaseAnimal",
+					Description: "Field: *animal.BaseAnimal",
+				},
+			},
+		},
+		{
+			name:            "Complete fields in binary expression",
+			inputText:       "x := len(dog.Name) + dog.A",
+			setupCandidates: animalCandidates,
+			setupRegistry:   dogRegistry(),
+			expected: []prompt.Suggest{
+				{
+					Text:        "dog.Age",
+					DisplayText: "Age",
+					Description: "Field: int",
+				},
+			},
+		},
+		{
+			name:            "Complete fields in index expression",
+			inputText:       "ages[dog.N",
+			setupCandidates: animalCandidates,
+			setupRegistry:   dogRegistry(),
+			expected: []prompt.Suggest{
+				{
+					Text:        "ages[dog.Name",
+					DisplayText: "Name",
+					Description: "Field: string",
+				},
+			},
+		},
+		{
+			name:            "Complete fields in composite literal field",
+			inputText:       "p := animal.Person{Email: dog.N",
+			setupCandidates: animalCandidates,
+			setupRegistry:   dogRegistry(),
+			expected: []prompt.Suggest{
+				{
+					Text:        "dog.Name",
+					DisplayText: "Name",
+					Description: "Field: string",
+				},
+			},
+		},
+		{
+			name:            "Complete keys of composite literal",
+			inputText:       `d := animal.Dog{Name: "pochi", B`,
+			setupCandidates: animalCandidates,
+			setupRegistry:   dogRegistry(),
+			expected: []prompt.Suggest{
+				{
+					Text:        "BaseAnimal: ",
+					DisplayText: "BaseAnimal",
+					Description: "Field: *animal.BaseAnimal",
+				},
+			},
+		},
+		{
+			name:            "Complete method chain in function argument with arguments containing selectors",
+			inputText:       "fmt.Println(dog.Owner(animal.DefaultDog.Name).E",
+			setupCandidates: animalCandidates,
+			setupRegistry:   dogRegistry(),
+			expected: []prompt.Suggest{
+				{
+					Text:        "fmt.Println(dog.Owner(animal.DefaultDog.Name).Email",
+					DisplayText: "Email",
+					Description: "Field: string",
+				},
+			},
+		},
+		{
+			name:      "Complete signature hint and expression when no argument matches parameter type",
+			inputText: "animal.NewDog(dog.N",
+			setupCandidates: func() *candidates {
+				c := *animalCandidates
+				c.Funcs = callCandidates.Funcs
+				return &c
+			}(),
+			setupRegistry: dogRegistry(),
+			expected: []prompt.Suggest{
+				{
+					Text:        "animal.NewDog(dog.N",
+					DisplayText: "NewDog(name string, owner *animal.Person) *animal.Dog",
+					Description: "Parameter: name string",
+				},
+				{
+					Text:        "animal.NewDog(dog.Name",
+					DisplayText: "Name",
+					Description: "Field: string",
+				},
+			},
+		},
+		{
+			name:            "Nothing is completed inside string literal",
+			inputText:       `fmt.Println("dog.`,
+			setupCandidates: animalCandidates,
+			setupRegistry:   dogRegistry(),
+			expected:        []prompt.Suggest{},
+		},
+		{
+			name:            "Complete signature hint and arguments of function call",
+			inputText:       "animal.NewDog(",
+			setupCandidates: callCandidates,
+			setupRegistry: &declregistry.DeclRegistry{
+				Decls: []declregistry.Decl{
+					{Name: "n", TypeName: "string", TypeExpr: "string"},
+					{Name: "age", TypeName: "int", TypeExpr: "int"},
+				},
+			},
+			expected: []prompt.Suggest{
+				{
+					Text:        "animal.NewDog(",
+					DisplayText: "NewDog(name string, owner *animal.Person) *animal.Dog",
+					Description: "Parameter: name string",
+				},
+				{
+					Text:        "animal.NewDog(n",
+					DisplayText: "n",
+					Description: "Variable: string",
+				},
+				{
+					Text:        "animal.NewDog(animal.DefaultName",
+					DisplayText: "animal.DefaultName",
+					Description: "Constant: DefaultName is the default name",
+				},
+			},
+		},
+		{
+			name:            "Complete pointer arguments of function call after comma",
+			inputText:       `animal.NewDog("pochi", `,
+			setupCandidates: callCandidates,
+			setupRegistry: &declregistry.DeclRegistry{
+				Decls: []declregistry.Decl{
+					{Name: "p", TypeName: "Person", TypePkgName: "animal", TypePkgPath: `"example.com/animal"`},
+				},
+			},
+			expected: []prompt.Suggest{
+				{
+					Text:        "",
+					DisplayText: "NewDog(name string, owner *animal.Person) *animal.Dog",
+					Description: "Parameter: owner *animal.Person",
+				},
+				{
+					Text:        "&p",
+					DisplayText: "&p",
+					Description: "Variable: animal.Person",
+				},
+				{
+					Text:        "animal.NewPerson()",
+					DisplayText: "animal.NewPerson",
+					Description: "Function: NewPerson creates a person",
+				},
+			},
+		},
+		{
+			name:            "Complete arguments of method call with prefix",
+			inputText:       "dog.SetOwner(o",
+			setupCandidates: callCandidates,
+			setupRegistry: func() *declregistry.DeclRegistry {
+				registry := dogRegistry()
+				registry.Decls = append(registry.Decls, declregistry.Decl{
+					Name:        "owner",
+					Pointered:   true,
+					TypeName:    "Person",
+					TypePkgName: "animal",
+					TypePkgPath: `"example.com/animal"`,
+				})
+				return registry
+			}(),
+			expected: []prompt.Suggest{
+				{
+					Text:        "dog.SetOwner(o",
+					DisplayText: "SetOwner(owner *animal.Person)",
+					Description: "Parameter: owner *animal.Person",
+				},
+				{
+					Text:        "dog.SetOwner(owner",
+					DisplayText: "owner",
+					Description: "Variable: *animal.Person",
+				},
+			},
+		},
+		{
+			name:            "Complete variadic arguments of function call",
+			inputText:       "animal.Walk(dog, ",
+			setupCandidates: callCandidates,
+			setupRegistry:   dogRegistry(),
+			expected: []prompt.Suggest{
+				{
+					Text:        "",
+					DisplayText: "Walk(dogs ...*animal.Dog)",
+					Description: "Parameter: dogs ...*animal.Dog",
+				},
+				{
+					Text:        "dog",
+					DisplayText: "dog",
+					Description: "Variable: *animal.Dog",
+				},
+				{
+					Text:        "animal.NewDog()",
+					DisplayText: "animal.NewDog",
+					Description: "Function: NewDog creates a dog",
+				},
+			},
+		},
+		{
+			name:      "Complete only signature hint of function without parameters",
+			inputText: "animal.Walk(",
+			setupCandidates: &candidates{
+				Pkgs: []pkgSet{{Name: "animal", ImportPath: `"example.com/animal"`}},
+				Funcs: map[types.ImportPath][]funcSet{
+					`"example.com/animal"`: {
+						{Name: "Walk", Description: "Walk walks", Signature: "()"},
+					},
+				},
+			},
+			setupRegistry: dogRegistry(),
+			expected: []prompt.Suggest{
+				{
+					Text:        "animal.Walk(",
+					DisplayText: "Walk()",
+				},
+			},
+		},
+		{
+			name:            "Complete only signature hint of argument after last parameter",
+			inputText:       `animal.NewDog("pochi", nil, `,
+			setupCandidates: callCandidates,
+			setupRegistry:   dogRegistry(),
+			expected: []prompt.Suggest{
+				{
+					Text:        "",
+					DisplayText: "NewDog(name string, owner *animal.Person) *animal.Dog",
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			completer := Completer{
-				candidates:   tt.setupCandidates,
-				declRegistry: tt.setupRegistry,
+				candidates:        tt.setupCandidates,
+				projectCandidates: tt.setupCandidates,
+				declRegistry:      tt.setupRegistry,
+				targetPkg:         tt.targetPkg,
+				metaCommands:      tt.metaCommands,
+				importPathBindings: func() map[types.PkgName]types.ImportPath {
+					return tt.bindings
+				},
 			}
 			doc := prompt.Document{
 				Text: tt.inputText,
@@ -961,3 +1808,263 @@ func TestCompleter_Complete(t *testing.T) {
 		})
 	}
 }
+
+func TestCompleter_Complete_TopLevelDecls(t *testing.T) {
+	topLevelDecls := typeCheckTopLevelDecls(t, `package main
+
+type Counter struct {
+	Value int
+}
+
+// Inc increments the counter
+func (c *Counter) Inc() int {
+	c.Value++
+	return c.Value
+}
+
+func (c *Counter) reset() {
+	c.Value = 0
+}
+
+type Greeter interface {
+	Greet() string
+}
+
+type Timer struct {
+	Counter
+}
+
+// NewCounter creates a counter
+func NewCounter(start int) *Counter {
+	return &Counter{Value: start}
+}
+
+func helper() int {
+	return 1
+}
+
+type Point struct {
+	X, Y int
+}
+`)
+
+	tests := []struct {
+		name          string
+		inputText     string
+		decls         []declregistry.Decl
+		topLevelDecls []declregistry.TopLevelDecl
+		expected      []prompt.Suggest
+	}{
+		{
+			name:      "Complete methods declared in session including unexported ones",
+			inputText: "c.",
+			decls: []declregistry.Decl{
+				{Name: "c", Pointered: true, TypeName: "Counter", TypePkgName: "main", TypePkgPath: `"main"`},
+			},
+			topLevelDecls: topLevelDecls,
+			expected: []prompt.Suggest{
+				{
+					Text:        "c.Inc()",
+					DisplayText: "Inc",
+					Description: "Method: Inc increments the counter\n",
+				},
+				{
+					Text:        "c.reset()",
+					DisplayText: "reset",
+					Description: "Method: ",
+				},
+				{
+					Text:        "c.Value",
+					DisplayText: "Value",
+					Description: "Field: int",
+				},
+			},
+		},
+		{
+			name:      "Complete methods promoted from struct embedded in session",
+			inputText: "t.",
+			decls: []declregistry.Decl{
+				{Name: "t", TypeName: "Timer", TypePkgName: "main", TypePkgPath: `"main"`},
+			},
+			topLevelDecls: topLevelDecls,
+			expected: []prompt.Suggest{
+				{
+					Text:        "t.Inc()",
+					DisplayText: "Inc",
+					Description: "Method: Inc increments the counter\n",
+				},
+				{
+					Text:        "t.reset()",
+					DisplayText: "reset",
+					Description: "Method: ",
+				},
+				{
+					Text:        "t.Counter",
+					DisplayText: "Counter",
+					Description: "Field: main.Counter",
+				},
+				{
+					Text:        "t.Value",
+					DisplayText: "Value",
+					Description: "Field: int",
+				},
+			},
+		},
+		{
+			name:      "Complete methods of interface declared in session",
+			inputText: "g.Gr",
+			decls: []declregistry.Decl{
+				{Name: "g", TypeName: "Greeter", TypePkgName: "main", TypePkgPath: `"main"`},
+			},
+			topLevelDecls: topLevelDecls,
+			expected: []prompt.Suggest{
+				{
+					Text:        "g.Greet()",
+					DisplayText: "Greet",
+					Description: "Method: ",
+				},
+			},
+		},
+		{
+			name:      "Complete signature hint and arguments of function declared in session",
+			inputText: "NewCounter(",
+			decls: []declregistry.Decl{
+				{Name: "n", TypeName: "int", TypeExpr: "int"},
+				{Name: "s", TypeName: "string", TypeExpr: "string"},
+			},
+			topLevelDecls: topLevelDecls,
+			expected: []prompt.Suggest{
+				{
+					Text:        "NewCounter(",
+					DisplayText: "NewCounter(start int) *main.Counter",
+					Description: "Parameter: start int",
+				},
+				{
+					Text:        "NewCounter(n",
+					DisplayText: "n",
+					Description: "Variable: int",
+				},
+			},
+		},
+		{
+			name:          "Complete function declared in session by prefix",
+			inputText:     "hel",
+			topLevelDecls: topLevelDecls,
+			expected: []prompt.Suggest{
+				{
+					Text:        "helper()",
+					DisplayText: "helper",
+					Description: "Function: ",
+				},
+			},
+		},
+		{
+			name:          "Complete type declared in session by prefix",
+			inputText:     "Poi",
+			topLevelDecls: topLevelDecls,
+			expected: []prompt.Suggest{
+				{
+					Text:        "Point{X: ,Y: }",
+					DisplayText: "Point",
+					Description: "Struct: ",
+				},
+			},
+		},
+		{
+			name:          "Functions and types removed from session are not completed",
+			inputText:     "hel",
+			topLevelDecls: nil,
+			expected:      []prompt.Suggest{},
+		},
+		{
+			name:      "Declarations removed from session are not completed",
+			inputText: "c.",
+			decls: []declregistry.Decl{
+				{Name: "c", Pointered: true, TypeName: "Counter", TypePkgName: "main", TypePkgPath: `"main"`},
+			},
+			topLevelDecls: nil,
+			expected:      []prompt.Suggest{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			projectCandidates := &candidates{
+				Pkgs: []pkgSet{{Name: "myapp", ImportPath: `"example.com/myapp"`}},
+			}
+			registry := declregistry.NewRegistry()
+			registry.Decls = tt.decls
+			// 一度セッション内の宣言を反映させてから、入力時点の宣言に差し替える
+			registry.TopLevelDecls = topLevelDecls
+			completer := Completer{
+				candidates:        projectCandidates,
+				projectCandidates: projectCandidates,
+				declRegistry:      registry,
+			}
+			completer.Complete(prompt.Document{Text: tt.inputText})
+			registry.TopLevelDecls = tt.topLevelDecls
+
+			got := completer.Complete(prompt.Document{Text: tt.inputText})
+
+			opts := []cmp.Option{
+				cmp.AllowUnexported(prompt.Suggest{}),
+				cmpopts.EquateEmpty(),
+				cmpopts.SortSlices(func(a, b prompt.Suggest) bool {
+					return a.Text < b.Text
+				}),
+			}
+			if diff := cmp.Diff(tt.expected, got, opts...); diff != "" {
+				t.Errorf("Complete() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// typeCheckTopLevelDecls はソースコードを型チェックして、トップレベルの関数・メソッド・型を登録する形に変換する
+func typeCheckTopLevelDecls(t *testing.T, src string) []declregistry.TopLevelDecl {
+	t.Helper()
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("failed to parse source: %v", err)
+	}
+	info := &gotypes.Info{Defs: make(map[*ast.Ident]gotypes.Object)}
+	if _, err := (&gotypes.Config{}).Check("main", fset, []*ast.File{file}, info); err != nil {
+		t.Fatalf("failed to type check source: %v", err)
+	}
+
+	var topLevelDecls []declregistry.TopLevelDecl
+	for _, decl := range file.Decls {
+		switch declV := decl.(type) {
+		case *ast.FuncDecl:
+			var recvTypeName types.ReceiverTypeName
+			if declV.Recv != nil {
+				recvType := declV.Recv.List[0].Type
+				if starExpr, ok := recvType.(*ast.StarExpr); ok {
+					recvType = starExpr.X
+				}
+				recvTypeName = types.ReceiverTypeName(recvType.(*ast.Ident).Name)
+			}
+			topLevelDecls = append(topLevelDecls, declregistry.TopLevelDecl{
+				Name:             types.DeclName(declV.Name.Name),
+				PkgName:          "main",
+				PkgPath:          `"main"`,
+				ReceiverTypeName: recvTypeName,
+				Obj:              info.Defs[declV.Name],
+				Node:             declV,
+			})
+		case *ast.GenDecl:
+			for _, spec := range declV.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				topLevelDecls = append(topLevelDecls, declregistry.TopLevelDecl{
+					Name:    types.DeclName(typeSpec.Name.Name),
+					PkgName: "main",
+					PkgPath: `"main"`,
+					Obj:     info.Defs[typeSpec.Name],
+					Node:    declV,
+				})
+			}
+		}
+	}
+	return topLevelDecls
+}
@@ -0,0 +1,234 @@
+package completer
+
+import (
+	"go/scanner"
+	"go/token"
+	"strings"
+)
+
+// exprToken は入力を字句解析したトークンと、入力中の位置
+type exprToken struct {
+	tok token.Token
+	pos int // トークンの開始位置
+	end int // トークンの終了位置
+}
+
+// tokenize は入力を字句解析する
+// 閉じていない文字列リテラルなどの入力途中のトークンも、入力の終わりまでを1つのトークンとして返す
+func tokenize(text string) []exprToken {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(text))
+	var s scanner.Scanner
+	// 入力途中の構文エラーは無視する
+	s.Init(file, []byte(text), nil, 0)
+
+	var tokens []exprToken
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		// 改行や入力の終わりで自動挿入されるセミコロンは、入力にはないので除く
+		if tok == token.SEMICOLON && lit == "\n" {
+			continue
+		}
+		offset := file.Offset(pos)
+		length := len(lit)
+		if lit == "" {
+			length = len(tok.String())
+		}
+		tokens = append(tokens, exprToken{tok: tok, pos: offset, end: min(offset+length, len(text))})
+	}
+	return tokens
+}
+
+// exprStartIndex は tokens[:end] の末尾にある式の、最初のトークンのインデックスを返す
+// 式はセレクタ、関数やメソッドの呼び出し、インデックスが連なったもので、入力途中の末尾のドットも含める
+// 入力例: "fmt.Println(dog.Owner()." は "dog.Owner()." の最初のトークンを返す
+func exprStartIndex(tokens []exprToken, end int) int {
+	i := end - 1
+	if i >= 0 && tokens[i].tok == token.PERIOD {
+		i--
+	}
+	for i >= 0 {
+		switch tokens[i].tok {
+		case token.IDENT:
+			if i > 0 && tokens[i-1].tok == token.PERIOD {
+				i -= 2
+				continue
+			}
+			return i
+		case token.RPAREN, token.RBRACK:
+			open := matchingOpenIndex(tokens, i)
+			if open < 0 {
+				return i + 1
+			}
+			// 直前が式であれば呼び出しかインデックスで、そうでなければ括弧で囲んだ式になる
+			if open > 0 && isOperandEnd(tokens[open-1].tok) {
+				i = open - 1
+				continue
+			}
+			return open
+		default:
+			return i + 1
+		}
+	}
+	return i + 1
+}
+
+// matchingOpenIndex は閉じ括弧に対応する開き括弧のインデックスを返す。見つからない場合は-1を返す
+func matchingOpenIndex(tokens []exprToken, closeIdx int) int {
+	closeTok := tokens[closeIdx].tok
+	openTok := token.LPAREN
+	if closeTok == token.RBRACK {
+		openTok = token.LBRACK
+	}
+	depth := 0
+	for i := closeIdx; i >= 0; i-- {
+		switch tokens[i].tok {
+		case closeTok:
+			depth++
+		case openTok:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// isOperandEnd はトークンが式の終わりになりうるかを返す
+func isOperandEnd(tok token.Token) bool {
+	switch tok {
+	case token.IDENT, token.RPAREN, token.RBRACK, token.RBRACE:
+		return true
+	}
+	return tok.IsLiteral()
+}
+
+// exprUnderCursor は入力の末尾にある補完する式の開始位置を返す
+// 単項演算子の&は式に含める。文字列などのリテラルの入力中で補完できない場合は、falseを返す
+func exprUnderCursor(text string) (int, bool) {
+	tokens := tokenize(text)
+	if len(tokens) == 0 {
+		return len(text), true
+	}
+	last := tokens[len(tokens)-1]
+	// 末尾が空白であれば、新しい式を入力し始めている
+	if last.end < len(text) {
+		return len(text), true
+	}
+	if last.tok.IsLiteral() && last.tok != token.IDENT {
+		return 0, false
+	}
+	// キーワードは入力途中の識別子として補完する
+	if last.tok.IsKeyword() {
+		return last.pos, true
+	}
+
+	start := exprStartIndex(tokens, len(tokens))
+	if start > 0 && tokens[start-1].tok == token.AND && (start == 1 || !isOperandEnd(tokens[start-2].tok)) {
+		start--
+	}
+	if start == len(tokens) {
+		return len(text), true
+	}
+	return tokens[start].pos, true
+}
+
+// collapseCallArgs は式の呼び出しの括弧の中身を取り除く
+// 補完では引数を使わないので、引数の中のドットをセレクタと区別できるようにする
+// 入力例: "fmt.Sprint(a.b).Le" は "fmt.Sprint().Le" になる
+func collapseCallArgs(expr string) string {
+	var b strings.Builder
+	depth := 0
+	for _, t := range tokenize(expr) {
+		switch t.tok {
+		case token.LPAREN:
+			depth++
+			if depth == 1 {
+				b.WriteString(expr[t.pos:t.end])
+			}
+			continue
+		case token.RPAREN:
+			depth--
+			if depth == 0 {
+				b.WriteString(expr[t.pos:t.end])
+			}
+			continue
+		}
+		if depth == 0 {
+			b.WriteString(expr[t.pos:t.end])
+		}
+	}
+	return b.String()
+}
+
+// innermostOpenIndex は tokens[:end] で閉じられていない、最も内側の開き括弧のインデックスを返す
+// 見つからない場合は-1を返す
+func innermostOpenIndex(tokens []exprToken, end int) int {
+	var opens []int
+	for i, t := range tokens[:end] {
+		switch t.tok {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			opens = append(opens, i)
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			if len(opens) > 0 {
+				opens = opens[:len(opens)-1]
+			}
+		}
+	}
+	if len(opens) == 0 {
+		return -1
+	}
+	return opens[len(opens)-1]
+}
+
+// elementIndex は開き括弧から tokens[:end] までにあるカンマの数から、入力中の要素（引数など）の位置を返す
+func elementIndex(tokens []exprToken, open int, end int) int {
+	idx, depth := 0, 0
+	for _, t := range tokens[open+1 : end] {
+		switch t.tok {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		case token.COMMA:
+			if depth == 0 {
+				idx++
+			}
+		}
+	}
+	return idx
+}
+
+// compositeLitTypeOf は入力が構造体の複合リテラルのキーの位置であれば、複合リテラルの型の式を返す
+// 入力例: "animal.Dog{Name: \"pochi\", A" は "animal.Dog" を返す
+func compositeLitTypeOf(text string) (string, bool) {
+	exprStart, ok := exprUnderCursor(text)
+	if !ok {
+		return "", false
+	}
+	// キーの位置は、開き括弧かカンマの直後の識別子になる
+	if expr := text[exprStart:]; expr != "" && !token.IsIdentifier(expr) {
+		return "", false
+	}
+	tokens := tokenize(text[:exprStart])
+	if len(tokens) == 0 {
+		return "", false
+	}
+	if last := tokens[len(tokens)-1].tok; last != token.LBRACE && last != token.COMMA {
+		return "", false
+	}
+	open := innermostOpenIndex(tokens, len(tokens))
+	if open < 0 || tokens[open].tok != token.LBRACE {
+		return "", false
+	}
+	typeStart := exprStartIndex(tokens, open)
+	// スライスやマップの複合リテラルの要素は、構造体のキーの位置ではない
+	if typeStart == open || typeStart > 0 && tokens[typeStart-1].tok == token.RBRACK {
+		return "", false
+	}
+	return text[tokens[typeStart].pos:tokens[open].pos], true
+}
@@ -0,0 +1,75 @@
+package completer
+
+import (
+	"testing"
+)
+
+func TestExprUnderCursor(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		expected   string
+		expectedOk bool
+	}{
+		{name: "selector", text: "dog.Ba", expected: "dog.Ba", expectedOk: true},
+		{name: "after assignment", text: "x := dog.", expected: "dog.", expectedOk: true},
+		{name: "function argument", text: "fmt.Println(dog.", expected: "dog.", expectedOk: true},
+		{name: "second argument", text: "animal.Compare(cat, dog.Na", expected: "dog.Na", expectedOk: true},
+		{name: "method chain with arguments", text: "fmt.Println(dog.Owner(a.b, c).Na", expected: "dog.Owner(a.b, c).Na", expectedOk: true},
+		{name: "binary expression", text: "a+dog.A", expected: "dog.A", expectedOk: true},
+		{name: "index expression", text: "ages[dog.N", expected: "dog.N", expectedOk: true},
+		{name: "indexed operand", text: "dogs[0].N", expected: "dogs[0].N", expectedOk: true},
+		{name: "composite literal field", text: "animal.Person{Email: dog.N", expected: "dog.N", expectedOk: true},
+		{name: "unary & operator", text: "p := &d", expected: "&d", expectedOk: true},
+		{name: "binary & operator", text: "a&d", expected: "d", expectedOk: true},
+		{name: "keyword", text: "for", expected: "for", expectedOk: true},
+		{name: "trailing space", text: "fmt.Println(dog, ", expected: "", expectedOk: true},
+		{name: "inside string literal", text: `fmt.Println("dog.`, expectedOk: false},
+		{name: "after string literal", text: `fmt.Println("dog"`, expectedOk: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, ok := exprUnderCursor(tt.text)
+			if ok != tt.expectedOk {
+				t.Fatalf("exprUnderCursor() ok = %v, want %v", ok, tt.expectedOk)
+			}
+			if !ok {
+				return
+			}
+			if got := tt.text[start:]; got != tt.expected {
+				t.Errorf("exprUnderCursor() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseCallInput(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		expected   callInput
+		expectedOk bool
+	}{
+		{name: "first argument", text: "animal.NewDog(", expected: callInput{callee: "animal.NewDog"}, expectedOk: true},
+		{name: "second argument", text: `animal.NewDog("a,b", o`, expected: callInput{callee: "animal.NewDog", argIndex: 1}, expectedOk: true},
+		{name: "method of method chain result", text: "dog.Owner().Rename(", expected: callInput{callee: "dog.Owner().Rename"}, expectedOk: true},
+		{name: "nested call", text: "fmt.Println(animal.NewDog(n", expected: callInput{callee: "animal.NewDog"}, expectedOk: true},
+		{name: "after nested call", text: "fmt.Println(animal.NewDog(n), ", expected: callInput{callee: "fmt.Println", argIndex: 1}, expectedOk: true},
+		{name: "composite literal in call", text: "fmt.Println(animal.Dog{", expectedOk: false},
+		{name: "parenthesized expression", text: "x := (a", expectedOk: false},
+		{name: "closed call", text: "animal.NewDog(n)", expectedOk: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseCallInput(tt.text)
+			if ok != tt.expectedOk {
+				t.Fatalf("parseCallInput() ok = %v, want %v", ok, tt.expectedOk)
+			}
+			if got != tt.expected {
+				t.Errorf("parseCallInput() = %+v, want %+v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package completer
+
+import (
+	"go/token"
+	"slices"
+	"strings"
+
+	"github.com/kakkky/go-prompt"
+
+	"github.com/kakkky/gonsole/declregistry"
+	"github.com/kakkky/gonsole/types"
+)
+
+// findFieldSuggestions は変数やメソッドチェーンの結果の構造体のフィールドを、型を説明に付けて補完する
+// 埋め込まれた構造体のフィールドも、昇格したフィールドとして補完する
+func (c *Completer) findFieldSuggestions(sb *suggestionBuilder) []prompt.Suggest {
+	suggestions := make([]prompt.Suggest, 0)
+	typ, lastSelectorPart, ok := c.resolveSelectorType(sb)
+	if !ok {
+		return suggestions
+	}
+	for _, field := range c.fieldsOf(typ) {
+		if sb.matches(string(field.Name), lastSelectorPart) && !c.isHidden(typ.TypePkgPath, string(field.Name)) {
+			suggestions = append(suggestions, sb.build(string(field.Name), suggestTypeField, field.TypeStr))
+		}
+	}
+	return suggestions
+}
+
+// findMethodSuggestionsFromFieldAccess はフィールドアクセスを含むセレクタ式の結果の型のメソッドを補完する
+func (c *Completer) findMethodSuggestionsFromFieldAccess(sb *suggestionBuilder) []prompt.Suggest {
+	suggestions := make([]prompt.Suggest, 0)
+	typ, lastSelectorPart, ok := c.resolveSelectorType(sb)
+	if !ok {
+		return suggestions
+	}
+	for _, methodSet := range c.candidates.Methods[typ.TypePkgPath] {
+		if sb.matches(string(methodSet.Name), lastSelectorPart) && !c.isHidden(typ.TypePkgPath, string(methodSet.Name)) && types.TypeName(methodSet.ReceiverTypeName) == typ.TypeName {
+			suggestions = append(suggestions, sb.build(string(methodSet.Name), suggestTypeMethod, methodSet.Description, "()"))
+		}
+	}
+	if len(suggestions) > 0 {
+		return suggestions
+	}
+	for _, interfaceSet := range c.candidates.Interfaces[typ.TypePkgPath] {
+		if typ.TypeName == types.TypeName(interfaceSet.Name) {
+			for i, method := range interfaceSet.Methods {
+				if sb.matches(string(method), lastSelectorPart) && !c.isHidden(typ.TypePkgPath, string(method)) {
+					suggestions = append(suggestions, sb.build(string(method), suggestTypeMethod, interfaceSet.Descriptions[i], "()"))
+				}
+			}
+		}
+	}
+	return suggestions
+}
+
+// hasFieldAccess はセレクタ式の途中に、呼び出しではない要素（フィールドやパッケージの変数）があるかを返す
+func hasFieldAccess(selectorPart string) bool {
+	selectorParts := strings.Split(selectorPart, ".")
+	return slices.ContainsFunc(selectorParts[:len(selectorParts)-1], func(selectorPart string) bool {
+		return !strings.Contains(selectorPart, "(")
+	})
+}
+
+// resolveSelectorType はセレクタ式の最後の要素より前までを評価した結果の型と、最後の要素の入力を返す
+// 入力例: "dog.BaseAnimal.A" は dog の BaseAnimal フィールドの型と "A" を返す
+// ベースは宣言された変数か、パッケージの関数・変数で、途中の要素はメソッドの呼び出しかフィールドアクセスになる
+func (c *Completer) resolveSelectorType(sb *suggestionBuilder) (returnSet, string, bool) {
+	selectorParts := strings.Split(sb.input.selectorPart, ".")
+	lastSelectorPart := selectorParts[len(selectorParts)-1]
+	selectorParts = selectorParts[:len(selectorParts)-1]
+
+	var typ returnSet
+	if decl, ok := c.lookupDecl(types.DeclName(sb.input.basePart)); ok {
+		typ = returnSet{TypeName: decl.TypeName, TypePkgPath: decl.TypePkgPath}
+	} else {
+		// パッケージを参照している場合は、最初の要素がパッケージの関数か変数になる
+		if len(selectorParts) == 0 {
+			return returnSet{}, "", false
+		}
+		pkgTyp, ok := c.resolvePkgMemberType(c.pkgPathsOf(sb.input.basePart), selectorParts[0])
+		if !ok {
+			return returnSet{}, "", false
+		}
+		typ = pkgTyp
+		selectorParts = selectorParts[1:]
+	}
+
+	for _, selectorPart := range selectorParts {
+		var ok bool
+		if idx := strings.Index(selectorPart, "("); idx >= 0 {
+			typ, ok = c.resolveMethodReturnType(typ, selectorPart[:idx])
+		} else {
+			typ, ok = c.resolveFieldType(typ, types.StructFieldName(selectorPart))
+		}
+		if !ok {
+			return returnSet{}, "", false
+		}
+	}
+	return typ, lastSelectorPart, true
+}
+
+// lookupDecl はセッション内で宣言された変数のうち、参照できるものを名前で探す
+func (c *Completer) lookupDecl(name types.DeclName) (declregistry.Decl, bool) {
+	for _, decl := range slices.Backward(c.declRegistry.Decls) {
+		if decl.Name == name && !decl.Shadowed {
+			return decl, true
+		}
+	}
+	return declregistry.Decl{}, false
+}
+
+// resolvePkgMemberType はパッケージの関数の呼び出し結果か、パッケージの変数の型を返す
+func (c *Completer) resolvePkgMemberType(pkgPaths []types.ImportPath, selectorPart string) (returnSet, bool) {
+	for _, pkgPath := range pkgPaths {
+		if idx := strings.Index(selectorPart, "("); idx >= 0 {
+			funcName := types.DeclName(selectorPart[:idx])
+			for _, funcSet := range c.candidates.Funcs[pkgPath] {
+				if funcSet.Name == funcName && len(funcSet.Returns) == 1 {
+					return funcSet.Returns[0], true
+				}
+			}
+			continue
+		}
+		for _, varSet := range c.candidates.Vars[pkgPath] {
+			if string(varSet.Name) == selectorPart {
+				return returnSet{TypeName: varSet.TypeName, TypePkgPath: varSet.TypePkgPath}, true
+			}
+		}
+	}
+	return returnSet{}, false
+}
+
+// resolveMethodReturnType は戻り値が1つのメソッドを呼び出した結果の型を返す
+func (c *Completer) resolveMethodReturnType(recvTyp returnSet, methodName string) (returnSet, bool) {
+	for _, methodSet := range c.candidates.Methods[recvTyp.TypePkgPath] {
+		if string(methodSet.Name) == methodName && types.TypeName(methodSet.ReceiverTypeName) == recvTyp.TypeName && len(methodSet.Returns) == 1 {
+			return methodSet.Returns[0], true
+		}
+	}
+	return returnSet{}, false
+}
+
+// resolveFieldType は構造体のフィールド（昇格したフィールドを含む）の型を返す
+func (c *Completer) resolveFieldType(structTyp returnSet, fieldName types.StructFieldName) (returnSet, bool) {
+	for _, field := range c.fieldsOf(structTyp) {
+		if field.Name == fieldName {
+			return returnSet{TypeName: field.TypeName, TypePkgPath: field.TypePkgPath}, true
+		}
+	}
+	return returnSet{}, false
+}
+
+// fieldsOf は構造体のフィールドを、埋め込まれた構造体から昇格したフィールドを含めて返す
+// 浅い位置のフィールドが同名の深い位置のフィールドを隠すので、埋め込みの浅い順にたどる
+func (c *Completer) fieldsOf(structTyp returnSet) []fieldSet {
+	var fields []fieldSet
+	visited := make(map[returnSet]bool)
+	current := []returnSet{structTyp}
+	for len(current) > 0 {
+		var next []returnSet
+		for _, typ := range current {
+			if visited[typ] {
+				continue
+			}
+			visited[typ] = true
+			structSet, ok := c.lookupStruct(typ)
+			if !ok {
+				continue
+			}
+			for _, field := range structSet.fieldSets() {
+				if slices.ContainsFunc(fields, func(f fieldSet) bool { return f.Name == field.Name }) {
+					continue
+				}
+				fields = append(fields, field)
+				if field.Embedded {
+					next = append(next, returnSet{TypeName: field.TypeName, TypePkgPath: field.TypePkgPath})
+				}
+			}
+		}
+		current = next
+	}
+	return fields
+}
+
+// lookupStruct は型名とパッケージ名から構造体の候補を探す
+func (c *Completer) lookupStruct(typ returnSet) (structSet, bool) {
+	for _, structSet := range c.candidates.Structs[typ.TypePkgPath] {
+		if types.TypeName(structSet.Name) == typ.TypeName {
+			return structSet, true
+		}
+	}
+	return structSet{}, false
+}
+
+// fieldSets はフィールドの候補を返す
+// フィールドの型の情報を持たない候補（型の情報を加える前に生成した標準パッケージの候補）は、フィールド名だけを返す
+func (s structSet) fieldSets() []fieldSet {
+	if len(s.FieldSets) > 0 || len(s.Fields) == 0 {
+		return s.FieldSets
+	}
+	fieldSets := make([]fieldSet, 0, len(s.Fields))
+	for _, field := range s.Fields {
+		fieldSets = append(fieldSets, fieldSet{Name: field})
+	}
+	return fieldSets
+}
+
+// findCompositeLitKeySuggestions は構造体の複合リテラルのキーを入力している場合に、構造体のフィールドを補完する
+// 入力例: "animal.Dog{Name: \"pochi\", A" は animal.Dog のフィールドを補完する
+func (c *Completer) findCompositeLitKeySuggestions(text string, sb *suggestionBuilder) []prompt.Suggest {
+	suggestions := make([]prompt.Suggest, 0)
+	if sb.prefixOperand == token.AND {
+		return suggestions
+	}
+	typeExpr, ok := compositeLitTypeOf(text)
+	if !ok {
+		return suggestions
+	}
+	typ, structSet, ok := c.lookupCompositeLitStruct(typeExpr)
+	if !ok {
+		return suggestions
+	}
+	// キーには昇格したフィールドを使えないので、構造体のフィールドだけを補完する
+	for _, field := range structSet.fieldSets() {
+		if sb.matches(string(field.Name), sb.input.text) && !c.isHidden(typ.TypePkgPath, string(field.Name)) {
+			suggestions = append(suggestions, sb.build(string(field.Name), suggestTypeField, field.TypeStr, ": "))
+		}
+	}
+	return suggestions
+}
+
+// lookupCompositeLitStruct は複合リテラルの型の式（例: animal.Dog, Counter）から構造体の候補を探す
+// パッケージを付けない型は、セッション内で宣言された型から探す
+func (c *Completer) lookupCompositeLitStruct(typeExpr string) (returnSet, structSet, bool) {
+	var typs []returnSet
+	if pkgName, typeName, found := strings.Cut(typeExpr, "."); found {
+		for _, pkgPath := range c.pkgPathsOf(pkgName) {
+			typs = append(typs, returnSet{TypeName: types.TypeName(typeName), TypePkgPath: pkgPath})
+		}
+	} else {
+		for _, topLevelDecl := range c.declRegistry.TopLevelDecls {
+			if string(topLevelDecl.Name) == typeExpr && topLevelDecl.ReceiverTypeName == "" {
+				typs = append(typs, returnSet{TypeName: types.TypeName(typeExpr), TypePkgPath: topLevelDecl.PkgPath})
+			}
+		}
+	}
+	for _, typ := range typs {
+		if structSet, ok := c.lookupStruct(typ); ok {
+			return typ, structSet, true
+		}
+	}
+	return returnSet{}, structSet{}, false
+}
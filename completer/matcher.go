@@ -0,0 +1,165 @@
+package completer
+
+import (
+	"cmp"
+	"fmt"
+	"go/token"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/kakkky/go-prompt"
+
+	"github.com/kakkky/gonsole/errs"
+)
+
+// MatchMode は補完候補と入力の照合方法を表す
+type MatchMode string
+
+const (
+	// MatchModeFuzzy は前方一致に加えて、入力の文字がキャメルケースやスネークケースの単語の先頭に一致する候補（例: nd は NewDog）も補完する
+	// 単語の途中に文字が散らばっているだけの候補（例: do に対する decodecounter）は、候補が多くなりすぎるので補完しない
+	MatchModeFuzzy MatchMode = "fuzzy"
+	// MatchModePrefix は入力で始まる候補だけを補完する
+	MatchModePrefix MatchMode = "prefix"
+)
+
+// ParseMatchMode は文字列をMatchModeに変換する
+func ParseMatchMode(mode string) (MatchMode, error) {
+	switch MatchMode(mode) {
+	case MatchModeFuzzy, MatchModePrefix:
+		return MatchMode(mode), nil
+	}
+	return "", errs.NewBadInputError(fmt.Sprintf("unknown completion matching %q (available: %s, %s)", mode, MatchModeFuzzy, MatchModePrefix))
+}
+
+// 一致の度合い。大きいほど入力によく一致している
+const (
+	matchNone = iota
+	matchCamelCase
+	matchPrefixIgnoreCase
+	matchPrefix
+)
+
+// matchQuality は補完候補が入力にどの程度一致するかを返す。一致しない場合はmatchNoneを返す
+// 前方一致でない照合は、大文字と小文字を区別しない
+func matchQuality(candidate string, query string, mode MatchMode) int {
+	if strings.HasPrefix(candidate, query) {
+		return matchPrefix
+	}
+	if mode != MatchModeFuzzy {
+		return matchNone
+	}
+	switch {
+	case strings.HasPrefix(strings.ToLower(candidate), strings.ToLower(query)):
+		return matchPrefixIgnoreCase
+	case matchesCamelCase(candidate, query):
+		return matchCamelCase
+	}
+	return matchNone
+}
+
+// matchesCamelCase は入力の各文字が、候補の単語の先頭か、直前に一致した文字の続きに一致するかを返す
+// 入力例: "nd" や "NeDo" は "NewDog" に、"hs" は "HTTPServer" に一致する
+func matchesCamelCase(candidate string, query string) bool {
+	var match func(ci, qi int, continued bool) bool
+	match = func(ci, qi int, continued bool) bool {
+		if qi == len(query) {
+			return true
+		}
+		for j := ci; j < len(candidate); j++ {
+			if !equalFoldByte(candidate[j], query[qi]) {
+				continue
+			}
+			if (isWordStart(candidate, j) || continued && j == ci) && match(j+1, qi+1, true) {
+				return true
+			}
+		}
+		return false
+	}
+	return match(0, 0, false)
+}
+
+// isWordStart は候補の位置が、キャメルケースやスネークケースの単語の先頭かを返す
+func isWordStart(s string, i int) bool {
+	if i == 0 {
+		return true
+	}
+	prev, cur := rune(s[i-1]), rune(s[i])
+	switch {
+	case prev == '_' && cur != '_':
+		return true
+	case unicode.IsUpper(cur) && !unicode.IsUpper(prev):
+		return true
+	case unicode.IsUpper(cur) && i+1 < len(s) && unicode.IsLower(rune(s[i+1])):
+		// HTTPServer の S のように、大文字が続いた後の単語の先頭
+		return true
+	}
+	return false
+}
+
+func equalFoldByte(a, b byte) bool {
+	return unicode.ToLower(rune(a)) == unicode.ToLower(rune(b))
+}
+
+// matches は補完候補が入力に一致するかを返す
+func (sb *suggestionBuilder) matches(candidate string, query string) bool {
+	return matchQuality(candidate, query, sb.matchMode) != matchNone
+}
+
+// suggestTypePriority は一致の度合いと最近の使用が同じ候補を並べる、候補の種類の優先順位
+var suggestTypePriority = []suggestType{
+	suggestTypeVariable,
+	suggestTypeField,
+	suggestTypeMethod,
+	suggestTypeFunction,
+	suggestTypeConstant,
+	suggestTypeStruct,
+	suggestTypeDefinedType,
+	suggestTypePackage,
+	suggestTypeKeyword,
+	suggestTypeBuiltin,
+}
+
+// rankSuggestions は補完候補を、入力との一致の度合い、セッションで最近使った順、候補の種類の順に並べ替える
+// 同じ順位の候補は、元の順序を保つ
+func (c *Completer) rankSuggestions(sb *suggestionBuilder, suggestions []prompt.Suggest, query string) []prompt.Suggest {
+	priorityOf := func(s prompt.Suggest) int {
+		idx := slices.Index(suggestTypePriority, sb.suggestTypes[s.Text])
+		if idx < 0 {
+			return len(suggestTypePriority)
+		}
+		return idx
+	}
+	slices.SortStableFunc(suggestions, func(a, b prompt.Suggest) int {
+		return cmp.Or(
+			cmp.Compare(matchQuality(b.DisplayText, query, sb.matchMode), matchQuality(a.DisplayText, query, sb.matchMode)),
+			cmp.Compare(c.lastUse(b.DisplayText), c.lastUse(a.DisplayText)),
+			cmp.Compare(priorityOf(a), priorityOf(b)),
+		)
+	})
+	return suggestions
+}
+
+// RecordUse は実行した入力で使われた識別子を、補完候補を並べる順に反映する
+func (c *Completer) RecordUse(input string) {
+	if c.recentUses == nil {
+		c.recentUses = make(map[string]int)
+	}
+	for _, t := range tokenize(input) {
+		if t.tok == token.IDENT {
+			c.useCount++
+			c.recentUses[input[t.pos:t.end]] = c.useCount
+		}
+	}
+}
+
+// lastUse は候補の識別子を最後に使った順番を返す。使っていない場合は0を返す
+// パッケージの要素（例: animal.NewDog）や&付きの変数は、識別子の部分で調べる
+func (c *Completer) lastUse(displayText string) int {
+	name := strings.TrimPrefix(displayText, and)
+	if idx := strings.LastIndex(name, "."); idx >= 0 {
+		name = name[idx+1:]
+	}
+	return c.recentUses[name]
+}
@@ -0,0 +1,118 @@
+package completer
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kakkky/go-prompt"
+	"github.com/kakkky/gonsole/declregistry"
+	"github.com/kakkky/gonsole/types"
+)
+
+func TestMatchQuality(t *testing.T) {
+	tests := []struct {
+		name      string
+		candidate string
+		query     string
+		mode      MatchMode
+		expected  int
+	}{
+		{name: "prefix", candidate: "NewDog", query: "New", mode: MatchModeFuzzy, expected: matchPrefix},
+		{name: "prefix ignoring case", candidate: "NewDog", query: "newd", mode: MatchModeFuzzy, expected: matchPrefixIgnoreCase},
+		{name: "camel case initials", candidate: "NewDog", query: "nd", mode: MatchModeFuzzy, expected: matchCamelCase},
+		{name: "camel case word prefixes", candidate: "NewDog", query: "NeDo", mode: MatchModeFuzzy, expected: matchCamelCase},
+		{name: "camel case after acronym", candidate: "HTTPServer", query: "hs", mode: MatchModeFuzzy, expected: matchCamelCase},
+		{name: "snake case", candidate: "O_RDONLY", query: "or", mode: MatchModeFuzzy, expected: matchCamelCase},
+		{name: "letters inside words are not matched", candidate: "NewDog", query: "ewg", mode: MatchModeFuzzy, expected: matchNone},
+		{name: "letters inside lowercase name are not matched", candidate: "decodecounter", query: "do", mode: MatchModeFuzzy, expected: matchNone},
+		{name: "letters across lowercase name are not matched", candidate: "buildinfo", query: "do", mode: MatchModeFuzzy, expected: matchNone},
+		{name: "not matched", candidate: "NewDog", query: "dn", mode: MatchModeFuzzy, expected: matchNone},
+		{name: "camel case in prefix mode", candidate: "NewDog", query: "nd", mode: MatchModePrefix, expected: matchNone},
+		{name: "prefix in prefix mode", candidate: "NewDog", query: "Ne", mode: MatchModePrefix, expected: matchPrefix},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchQuality(tt.candidate, tt.query, tt.mode); got != tt.expected {
+				t.Errorf("matchQuality(%q, %q) = %d, want %d", tt.candidate, tt.query, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCompleter_Complete_Ranking(t *testing.T) {
+	setupCandidates := &candidates{
+		Pkgs: []pkgSet{{Name: "animal", ImportPath: `"example.com/animal"`}},
+		Funcs: map[types.ImportPath][]funcSet{
+			`"example.com/animal"`: {
+				{Name: "Feed", Description: "Feed feeds"},
+				{Name: "NewDog", Description: "NewDog creates a dog"},
+				{Name: "Find", Description: "Find finds"},
+				{Name: "needDoctor", Description: "needDoctor checks"},
+			},
+		},
+		Consts: map[types.ImportPath][]constSet{
+			`"example.com/animal"`: {
+				{Name: "NameDefault", Description: "NameDefault is the default name"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		inputText string
+		mode      MatchMode
+		used      []string
+		expected  []string
+	}{
+		{
+			name:      "Fuzzy matches are ranked by match quality",
+			inputText: "animal.nd",
+			mode:      MatchModeFuzzy,
+			expected:  []string{"animal.NewDog()", "animal.NameDefault"},
+		},
+		{
+			name:      "Recently used candidates come first among same match quality",
+			inputText: "animal.F",
+			mode:      MatchModeFuzzy,
+			used:      []string{"animal.Find()", "animal.Feed()"},
+			expected:  []string{"animal.Feed()", "animal.Find()"},
+		},
+		{
+			name:      "Only prefix matches in prefix mode",
+			inputText: "animal.nd",
+			mode:      MatchModePrefix,
+			expected:  []string{},
+		},
+		{
+			name:      "Variables come before packages and keywords",
+			inputText: "f",
+			mode:      MatchModePrefix,
+			expected:  []string{"fido", "fallthrough", "for", "func", "false", "float32", "float64"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := declregistry.NewRegistry()
+			registry.Decls = []declregistry.Decl{{Name: "fido", TypeName: "Dog", TypePkgName: "animal", TypePkgPath: `"example.com/animal"`}}
+			completer := Completer{
+				candidates:        setupCandidates,
+				projectCandidates: setupCandidates,
+				declRegistry:      registry,
+				matchMode:         tt.mode,
+			}
+			for _, used := range tt.used {
+				completer.RecordUse(used)
+			}
+
+			got := make([]string, 0)
+			for _, s := range completer.Complete(prompt.Document{Text: tt.inputText}) {
+				got = append(got, s.Text)
+			}
+			if diff := cmp.Diff(tt.expected, got); diff != "" {
+				t.Errorf("Complete() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package completer
+
+import (
+	"go/token"
+	gotypes "go/types"
+	"slices"
+
+	"github.com/kakkky/go-prompt"
+)
+
+// goKeywords はGoのキーワード
+var goKeywords = func() []string {
+	var keywords []string
+	for tok := token.BREAK; tok <= token.VAR; tok++ {
+		if tok.IsKeyword() {
+			keywords = append(keywords, tok.String())
+		}
+	}
+	return keywords
+}()
+
+// findKeywordSuggestions はキーワードを補完する
+// 何も入力していない段階で候補が溢れないように、入力がある場合だけ補完する
+func findKeywordSuggestions(sb *suggestionBuilder) []prompt.Suggest {
+	suggestions := make([]prompt.Suggest, 0)
+	if sb.input.text == "" || sb.prefixOperand == token.AND {
+		return suggestions
+	}
+	for _, keyword := range goKeywords {
+		if sb.matches(keyword, sb.input.text) {
+			suggestions = append(suggestions, sb.build(keyword, suggestTypeKeyword, ""))
+		}
+	}
+	return suggestions
+}
+
+// findBuiltinSuggestions はlen・append・makeなどの組み込み関数と、組み込みの型・定数を補完する
+// 組み込み関数は関数と同じく、括弧を付けて補完する
+func findBuiltinSuggestions(sb *suggestionBuilder) []prompt.Suggest {
+	suggestions := make([]prompt.Suggest, 0)
+	if sb.input.text == "" || sb.prefixOperand == token.AND {
+		return suggestions
+	}
+	names := gotypes.Universe.Names()
+	slices.Sort(names)
+	for _, name := range names {
+		if !sb.matches(name, sb.input.text) {
+			continue
+		}
+		switch obj := gotypes.Universe.Lookup(name).(type) {
+		case *gotypes.Builtin:
+			suggestions = append(suggestions, sb.build(name, suggestTypeBuiltin, "function", "()"))
+		case *gotypes.TypeName:
+			suggestions = append(suggestions, sb.build(name, suggestTypeBuiltin, "type"))
+		case *gotypes.Const, *gotypes.Nil:
+			suggestions = append(suggestions, sb.build(name, suggestTypeBuiltin, obj.Type().String()))
+		}
+	}
+	return suggestions
+}
@@ -0,0 +1,190 @@
+package completer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kakkky/gonsole/types"
+	"golang.org/x/tools/go/packages"
+)
+
+// reloadCheckInterval はプロジェクトのコードの変更を確認する間隔
+// 補完は入力のたびに呼ばれるので、毎回ディレクトリを調べないように間隔をあける
+const reloadCheckInterval = time.Second
+
+// projectPkg はプロジェクト内のパッケージと、そのパッケージから作った候補
+// 候補はパッケージ名ごとにまとめて引くが、変更されたパッケージだけを作り直せるようにパッケージごとにも保持する
+type projectPkg struct {
+	importPath types.ImportPath
+	dir        string
+	// fingerprint は候補を作った時点のディレクトリ内のgoファイルの状態で、変更を検知するために使う
+	fingerprint uint64
+	candidates  *candidates
+}
+
+// newProjectPkgs は読み込んだパッケージごとに候補を作る
+func newProjectPkgs(pkgs []*packages.Package, unexportedPkgPath types.ImportPath) []*projectPkg {
+	projectPkgs := make([]*projectPkg, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		importPath := types.ImportPath(strconv.Quote(pkg.PkgPath))
+		includeUnexported := unexportedPkgPath != "" && importPath == unexportedPkgPath
+
+		c := newEmptyCandidates()
+		c.Pkgs = append(c.Pkgs, pkgSet{Name: types.PkgName(pkg.Name), ImportPath: importPath})
+		c.processScope(importPath, pkg.Types.Scope(), pkg.Syntax, includeUnexported)
+
+		// ディレクトリを読めない場合は0のままにして、次の確認で作り直させる
+		fingerprint, _ := computeFingerprint(pkg.Dir)
+		projectPkgs = append(projectPkgs, &projectPkg{
+			importPath:  importPath,
+			dir:         pkg.Dir,
+			fingerprint: fingerprint,
+			candidates:  c,
+		})
+	}
+	return projectPkgs
+}
+
+// computeFingerprint はディレクトリ内のgoファイルの名前・更新時刻・サイズからハッシュ値を計算する
+func computeFingerprint(dir string) (uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	hash := fnv.New64a()
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return 0, err
+		}
+		fmt.Fprintf(hash, "%s:%d:%d\n", entry.Name(), info.ModTime().UnixNano(), info.Size())
+	}
+	return hash.Sum64(), nil
+}
+
+// pkgReload はバックグラウンドで変更されたパッケージを読み込み直した結果
+type pkgReload struct {
+	// done は読み込みが終わると閉じられる
+	done chan struct{}
+	// projectPkgs はdoneが閉じられた後に参照する。読み込めなかった場合はnil
+	projectPkgs []*projectPkg
+}
+
+// Reload はプロジェクトのパッケージをすべて読み込み直して、補完候補を作り直す
+// 新しく追加されたパッケージは変更の確認では見つからないので、これで読み込む
+func (c *Completer) Reload() error {
+	projectPkgs, err := loadProjectPkgs(c.projectRootPath, c.unexportedPkgPath(), c.pkgIndex)
+	if err != nil {
+		return err
+	}
+	// バックグラウンドで読み込み中の結果は、これより古いので使わない
+	c.pendingReload = nil
+	c.projectPkgs = projectPkgs
+	c.rebuildCandidates()
+	c.lastReloadCheck = time.Now()
+	return nil
+}
+
+// reloadChangedPkgs はコードが変更されたパッケージだけを読み込み直して、補完候補に反映する
+// パッケージの読み込みは時間がかかるので、入力を妨げないようにバックグラウンドで行い、読み込み終わった後の補完から反映する
+// 編集途中でビルドできない場合は直前の候補を使い続け、次に変更された時に改めて読み込む
+func (c *Completer) reloadChangedPkgs() {
+	c.applyPendingReload()
+	if c.pendingReload != nil || time.Since(c.lastReloadCheck) < reloadCheckInterval {
+		return
+	}
+	c.lastReloadCheck = time.Now()
+
+	var changedDirs []string
+	projectPkgs := make([]*projectPkg, 0, len(c.projectPkgs))
+	for _, projectPkg := range c.projectPkgs {
+		fingerprint, err := computeFingerprint(projectPkg.dir)
+		if err != nil {
+			// ディレクトリごと削除されたパッケージは候補から除く
+			continue
+		}
+		if fingerprint != projectPkg.fingerprint {
+			projectPkg.fingerprint = fingerprint
+			changedDirs = append(changedDirs, projectPkg.dir)
+		}
+		projectPkgs = append(projectPkgs, projectPkg)
+	}
+	removed := len(projectPkgs) != len(c.projectPkgs)
+	c.projectPkgs = projectPkgs
+
+	if len(changedDirs) > 0 {
+		c.pendingReload = startPkgReload(c.projectRootPath, c.unexportedPkgPath(), changedDirs)
+	}
+	if removed {
+		c.rebuildCandidates()
+	}
+}
+
+// startPkgReload はバックグラウンドでパッケージを読み込み直し、パッケージごとの候補を作る
+// 読み込み中もCompleterは補完に使われるので、Completerの状態には触れない
+func startPkgReload(projectRootPath string, unexportedPkgPath types.ImportPath, dirs []string) *pkgReload {
+	reload := &pkgReload{done: make(chan struct{})}
+	go func() {
+		defer close(reload.done)
+		pkgs, err := loadProject(projectRootPath, dirs...)
+		if err != nil {
+			return
+		}
+		reload.projectPkgs = newProjectPkgs(pkgs, unexportedPkgPath)
+	}()
+	return reload
+}
+
+// applyPendingReload はバックグラウンドでの読み込みが終わっていれば、読み込み直したパッケージの候補を反映する
+func (c *Completer) applyPendingReload() {
+	if c.pendingReload == nil {
+		return
+	}
+	select {
+	case <-c.pendingReload.done:
+	default:
+		return
+	}
+	reloaded := c.pendingReload.projectPkgs
+	c.pendingReload = nil
+	if reloaded != nil {
+		c.replaceProjectPkgs(reloaded)
+		c.rebuildCandidates()
+	}
+}
+
+// replaceProjectPkgs は読み込み直したパッケージの候補で、同じパッケージの候補を置き換える
+func (c *Completer) replaceProjectPkgs(reloadedPkgs []*projectPkg) {
+	for _, reloaded := range reloadedPkgs {
+		idx := slices.IndexFunc(c.projectPkgs, func(projectPkg *projectPkg) bool {
+			return projectPkg.importPath == reloaded.importPath
+		})
+		if idx >= 0 {
+			c.projectPkgs[idx] = reloaded
+		}
+	}
+}
+
+// unexportedPkgPath は非公開の要素も候補に含めるパッケージ（対象パッケージ）のimportパスを返す
+func (c *Completer) unexportedPkgPath() types.ImportPath {
+	if c.targetPkg == nil {
+		return ""
+	}
+	return c.targetPkg.ImportPath
+}
+
+// rebuildCandidates はパッケージごとの候補から補完候補を作り直す
+// セッション内で宣言された関数・メソッド・型は、次のsyncTopLevelDeclsで加え直す
+func (c *Completer) rebuildCandidates() {
+	c.projectCandidates = mergeProjectPkgs(c.projectPkgs)
+	c.candidates = c.projectCandidates
+	c.topLevelDecls = nil
+}
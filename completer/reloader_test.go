@@ -0,0 +1,210 @@
+package completer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/kakkky/go-prompt"
+	"github.com/kakkky/gonsole/declregistry"
+)
+
+func TestCompleter_reloadChangedPkgs(t *testing.T) {
+	SkipStdPkgMergeMode = true
+	defer func() { SkipStdPkgMergeMode = false }()
+
+	tests := []struct {
+		name string
+		// edit は補完候補を作った後にプロジェクトのコードを書き換える
+		edit func(t *testing.T, dir string)
+		// elapsed は前回の確認から時間が経っているかどうか
+		elapsed   bool
+		inputText string
+		expected  []prompt.Suggest
+	}{
+		{
+			name: "changed package is reloaded",
+			edit: func(t *testing.T, dir string) {
+				writeProjectFile(t, dir, "greet/greet.go", "package greet\n\n// Hello says hello\nfunc Hello() string { return \"hello\" }\n\n// Goodbye says goodbye\nfunc Goodbye() string { return \"bye\" }\n")
+			},
+			elapsed:   true,
+			inputText: "greet.",
+			expected: []prompt.Suggest{
+				{Text: "greet.Goodbye()", DisplayText: "Goodbye", Description: "Function: Goodbye says goodbye\n"},
+				{Text: "greet.Hello()", DisplayText: "Hello", Description: "Function: Hello says hello\n"},
+			},
+		},
+		{
+			name: "other packages are kept",
+			edit: func(t *testing.T, dir string) {
+				writeProjectFile(t, dir, "greet/greet.go", "package greet\n\n// Hi says hi\nfunc Hi() string { return \"hi\" }\n")
+			},
+			elapsed:   true,
+			inputText: "calc.",
+			expected: []prompt.Suggest{
+				{Text: "calc.Add()", DisplayText: "Add", Description: "Function: Add adds two integers\n"},
+			},
+		},
+		{
+			name: "changes are not checked until interval passes",
+			edit: func(t *testing.T, dir string) {
+				writeProjectFile(t, dir, "greet/greet.go", "package greet\n\n// Hi says hi\nfunc Hi() string { return \"hi\" }\n")
+			},
+			elapsed:   false,
+			inputText: "greet.",
+			expected: []prompt.Suggest{
+				{Text: "greet.Hello()", DisplayText: "Hello", Description: "Function: Hello says hello\n"},
+			},
+		},
+		{
+			name: "previous candidates are kept while code cannot be built",
+			edit: func(t *testing.T, dir string) {
+				writeProjectFile(t, dir, "greet/greet.go", "package greet\n\nfunc Hello() string { return \n")
+			},
+			elapsed:   true,
+			inputText: "greet.",
+			expected: []prompt.Suggest{
+				{Text: "greet.Hello()", DisplayText: "Hello", Description: "Function: Hello says hello\n"},
+			},
+		},
+		{
+			name: "removed package is dropped",
+			edit: func(t *testing.T, dir string) {
+				if err := os.RemoveAll(filepath.Join(dir, "greet")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			elapsed:   true,
+			inputText: "gre",
+			expected:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := newReloadTestProject(t)
+			t.Chdir(dir)
+			sut, err := NewCompleter(declregistry.NewRegistry())
+			if err != nil {
+				t.Fatalf("NewCompleter() error = %v", err)
+			}
+
+			tt.edit(t, dir)
+			if tt.elapsed {
+				sut.lastReloadCheck = time.Now().Add(-reloadCheckInterval)
+			}
+			sut.Complete(prompt.Document{Text: tt.inputText})
+			// 読み込み直した結果は、バックグラウンドでの読み込みが終わった後の補完から反映される
+			waitPendingReload(sut)
+			got := sut.Complete(prompt.Document{Text: tt.inputText})
+
+			opts := []cmp.Option{
+				cmp.AllowUnexported(prompt.Suggest{}),
+				cmpopts.SortSlices(func(a, b prompt.Suggest) bool {
+					return a.Text < b.Text
+				}),
+			}
+			if diff := cmp.Diff(tt.expected, got, opts...); diff != "" {
+				t.Errorf("Complete() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCompleter_reloadChangedPkgs_inBackground(t *testing.T) {
+	SkipStdPkgMergeMode = true
+	defer func() { SkipStdPkgMergeMode = false }()
+
+	dir := newReloadTestProject(t)
+	t.Chdir(dir)
+	sut, err := NewCompleter(declregistry.NewRegistry())
+	if err != nil {
+		t.Fatalf("NewCompleter() error = %v", err)
+	}
+	writeProjectFile(t, dir, "greet/greet.go", "package greet\n\n// Hi says hi\nfunc Hi() string { return \"hi\" }\n")
+	sut.lastReloadCheck = time.Now().Add(-reloadCheckInterval)
+
+	// 読み込み中は、読み込みを待たずに直前の候補を返す
+	got := sut.Complete(prompt.Document{Text: "greet."})
+	expected := []prompt.Suggest{
+		{Text: "greet.Hello()", DisplayText: "Hello", Description: "Function: Hello says hello\n"},
+	}
+	if diff := cmp.Diff(expected, got, cmp.AllowUnexported(prompt.Suggest{})); diff != "" {
+		t.Errorf("Complete() while reloading mismatch (-want +got):\n%s", diff)
+	}
+	if sut.pendingReload == nil {
+		t.Fatal("expected changed package to be reloaded in background")
+	}
+
+	waitPendingReload(sut)
+	got = sut.Complete(prompt.Document{Text: "greet."})
+	expected = []prompt.Suggest{
+		{Text: "greet.Hi()", DisplayText: "Hi", Description: "Function: Hi says hi\n"},
+	}
+	if diff := cmp.Diff(expected, got, cmp.AllowUnexported(prompt.Suggest{})); diff != "" {
+		t.Errorf("Complete() after reloading mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCompleter_Reload(t *testing.T) {
+	SkipStdPkgMergeMode = true
+	defer func() { SkipStdPkgMergeMode = false }()
+
+	dir := newReloadTestProject(t)
+	t.Chdir(dir)
+	sut, err := NewCompleter(declregistry.NewRegistry())
+	if err != nil {
+		t.Fatalf("NewCompleter() error = %v", err)
+	}
+
+	// 追加されたパッケージは変更の確認では見つからないので、Reloadで読み込む
+	writeProjectFile(t, dir, "shout/shout.go", "package shout\n\n// Loud makes s loud\nfunc Loud(s string) string { return s + \"!\" }\n")
+	if err := sut.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	got := sut.Complete(prompt.Document{Text: "shout."})
+	expected := []prompt.Suggest{
+		{Text: "shout.Loud()", DisplayText: "Loud", Description: "Function: Loud makes s loud\n"},
+	}
+	if diff := cmp.Diff(expected, got, cmp.AllowUnexported(prompt.Suggest{})); diff != "" {
+		t.Errorf("Complete() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// waitPendingReload はバックグラウンドでの読み込みが終わるのを待つ
+func waitPendingReload(c *Completer) {
+	if c.pendingReload != nil {
+		<-c.pendingReload.done
+	}
+}
+
+// newReloadTestProject はgreetパッケージとcalcパッケージを持つプロジェクトを一時ディレクトリに作る
+func newReloadTestProject(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeProjectFile(t, dir, "go.mod", "module example.com/reloadtest\n\ngo 1.25\n")
+	writeProjectFile(t, dir, "greet/greet.go", "package greet\n\n// Hello says hello\nfunc Hello() string { return \"hello\" }\n")
+	writeProjectFile(t, dir, "calc/calc.go", "package calc\n\n// Add adds two integers\nfunc Add(a, b int) int { return a + b }\n")
+	return dir
+}
+
+// writeProjectFile はプロジェクトのファイルを書き込む
+// 書き込みの前後で更新時刻が変わらないことがあるので、更新時刻を進めておく
+func writeProjectFile(t *testing.T, dir string, name string, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -10,13 +10,18 @@ import (
 type suggestionBuilder struct {
 	prefixOperand token.Token
 	input         input
+	matchMode     MatchMode
+	// suggestTypes は生成した補完候補のテキストごとの種類で、候補を並べ替えるために使う
+	suggestTypes map[string]suggestType
 }
 
 type input struct {
-	raw          string // 元の入力全体
+	raw          string // 補完する式（オペランドを含む）
 	text         string //オペランド以降の入力全体
 	basePart     string //セレクタ式のベース部分
 	selectorPart string //セレクタ式のセレクタ部分
+	preceding    string // 補完する式より前の入力
+	wordStart    int    // go-promptが補完候補で置き換える、最後の空白以降の入力の開始位置
 }
 
 type suggestType int
@@ -30,30 +35,41 @@ const (
 	suggestTypeMethod
 	suggestTypeConstant
 	suggestTypeDefinedType
+	suggestTypeCommand
+	suggestTypeKeyword
+	suggestTypeBuiltin
+	suggestTypeField
+	suggestTypeParameter
 )
 
 var and = token.AND.String()
 
+// newSuggestionBuilder は入力の末尾にある式を補完対象とする
+// 入力例: "fmt.Println(dog." は "dog." を、"x := &d" は "&d" を補完する
 func newSuggestionBuilder(rawInput string) *suggestionBuilder {
-	// 変数宣言をしようとしている場合、"= "以降の部分を補完対象とする
-	if pos, found := findEqualAndSpacePos(rawInput); found {
-		startIdx := pos + 2 // "= "の長さは2なのでそれ以降
-		rawInput = rawInput[startIdx:]
+	exprStart, ok := exprUnderCursor(rawInput)
+	if !ok {
+		exprStart = len(rawInput)
 	}
+	expr := rawInput[exprStart:]
 
 	sb := &suggestionBuilder{
 		input: input{
-			raw:  rawInput,
-			text: rawInput,
+			raw:       expr,
+			text:      expr,
+			preceding: rawInput[:exprStart],
+			wordStart: strings.LastIndex(rawInput, " ") + 1,
 		},
 	}
 
 	switch {
-	case strings.HasPrefix(rawInput, and):
+	case strings.HasPrefix(expr, and):
 		sb.prefixOperand = token.AND
-		sb.input.text = strings.TrimPrefix(rawInput, and)
+		sb.input.text = strings.TrimPrefix(expr, and)
 	}
 
+	// 呼び出しの引数の中のドットは、セレクタとして扱わない
+	sb.input.text = collapseCallArgs(sb.input.text)
 	if strings.Contains(sb.input.text, ".") {
 		parts := strings.SplitN(sb.input.text, ".", 2)
 		sb.input.basePart = parts[0]
@@ -62,42 +78,43 @@ func newSuggestionBuilder(rawInput string) *suggestionBuilder {
 	return sb
 }
 
-// "= "の位置を探し、見つかったらその位置とtrueを返す
-func findEqualAndSpacePos(input string) (pos int, found bool) {
-	equalAndSpace := "= "
-	equalPos := strings.LastIndex(input, equalAndSpace)
-	if equalPos == -1 {
-		return -1, false
+func (sb *suggestionBuilder) build(candidate string, suggestType suggestType, desctiption string, appendSuggestText ...string) prompt.Suggest {
+	suggestion := prompt.Suggest{
+		Text:        sb.buildReplacingText(sb.buildSuggestText(candidate)) + strings.Join(appendSuggestText, ""),
+		DisplayText: candidate,
+		Description: sb.buildSuggestDescription(suggestType, desctiption),
 	}
-	return equalPos, true
+	sb.recordSuggestType(suggestion.Text, suggestType)
+	return suggestion
 }
 
-func (sb *suggestionBuilder) build(candidate string, suggestType suggestType, desctiption string, appendSuggestText ...string) prompt.Suggest {
-	return prompt.Suggest{
-		Text:        sb.buildSuggestText(candidate) + strings.Join(appendSuggestText, ""),
+// buildExpr は入力中の式全体を、補完候補の式（例: &dog, animal.DefaultName）で置き換える
+func (sb *suggestionBuilder) buildExpr(candidate string, suggestType suggestType, desctiption string, appendSuggestText ...string) prompt.Suggest {
+	suggestion := prompt.Suggest{
+		Text:        sb.buildReplacingText(candidate) + strings.Join(appendSuggestText, ""),
 		DisplayText: candidate,
 		Description: sb.buildSuggestDescription(suggestType, desctiption),
 	}
+	sb.recordSuggestType(suggestion.Text, suggestType)
+	return suggestion
 }
 
-func (sb *suggestionBuilder) buildSuggestText(candidateStr string) string {
-	// 最長一致する prefix を見つける
-	maxLen := min(len(sb.input.raw), len(candidateStr))
-	matchLen := 0
-
-	for i := 1; i <= maxLen; i++ {
-		if strings.HasSuffix(sb.input.raw, candidateStr[:i]) {
-			matchLen = i
-		}
+func (sb *suggestionBuilder) recordSuggestType(text string, typ suggestType) {
+	if sb.suggestTypes == nil {
+		sb.suggestTypes = make(map[string]suggestType)
 	}
+	sb.suggestTypes[text] = typ
+}
 
-	if matchLen > 0 {
-		// 一致部分を除去して candidateStr に置き換え
-		return strings.TrimSuffix(sb.input.raw, candidateStr[:matchLen]) + candidateStr
-	}
+// buildReplacingText は補完した式に前の入力をつなげて、go-promptが置き換える最後の空白以降の部分を返す
+func (sb *suggestionBuilder) buildReplacingText(exprText string) string {
+	return (sb.input.preceding + exprText)[sb.input.wordStart:]
+}
 
-	// 一致なしの場合
-	return sb.input.raw + candidateStr
+// buildSuggestText は入力中の式の最後の要素を、補完候補で置き換える
+// あいまいな照合では入力が候補の前方と一致するとは限らないので、入力した部分ごと置き換える
+func (sb *suggestionBuilder) buildSuggestText(candidateStr string) string {
+	return strings.TrimSuffix(sb.input.raw, sb.query()) + candidateStr
 }
 
 func (sb *suggestionBuilder) buildSuggestDescription(suggestType suggestType, description string) string {
@@ -121,11 +138,26 @@ func convertSuggestTypeToString(suggestType suggestType) string {
 		return "Constant"
 	case suggestTypeDefinedType:
 		return "DefinedType"
+	case suggestTypeCommand:
+		return "Command"
+	case suggestTypeKeyword:
+		return "Keyword"
+	case suggestTypeBuiltin:
+		return "Builtin"
+	case suggestTypeField:
+		return "Field"
+	case suggestTypeParameter:
+		return "Parameter"
 	default:
 		return "Unknown"
 	}
 }
 
+// query は補完候補と照合する入力で、セレクタ式では最後の要素になる
+func (sb *suggestionBuilder) query() string {
+	return sb.input.text[strings.LastIndex(sb.input.text, ".")+1:]
+}
+
 func (sb *suggestionBuilder) isSelector() bool {
 	return strings.Contains(sb.input.text, ".")
 }
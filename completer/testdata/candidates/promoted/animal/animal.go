@@ -0,0 +1,19 @@
+package animal
+
+import "github.com/kakkky/gonsole/completer/testdata/candidates/promoted/base"
+
+// Dog embeds Base and Speaker from another package
+type Dog struct {
+	*base.Base
+	base.Speaker
+}
+
+// Bark barks
+func (d Dog) Bark() {}
+
+// LoudSpeaker embeds Speaker
+type LoudSpeaker interface {
+	base.Speaker
+	// Shout shouts
+	Shout() string
+}
@@ -0,0 +1,17 @@
+package base
+
+// Base is embedded in animals
+type Base struct{}
+
+// Eat eats food
+func (b *Base) Eat() string {
+	return "eating"
+}
+
+func (b *Base) digest() {}
+
+// Speaker can speak
+type Speaker interface {
+	// Speak says something
+	Speak() string
+}
@@ -13,11 +13,12 @@ type MultiFieldStruct struct {
 
 // Base is used for embedding
 type Base struct {
-	ID int
+	ID int // ID identifies the entity
 }
 
 // Derived embeds Base
 type Derived struct {
+	// Base holds the common fields
 	Base
 	Name string
 }
@@ -0,0 +1,14 @@
+package unexported
+
+// Add adds two integers and returns the sum
+func Add(a, b int) int {
+	return add(a, b)
+}
+
+// add is the unexported implementation of Add
+func add(a, b int) int {
+	return a + b
+}
+
+// limit is an unexported constant
+const limit = 10
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+
+	"github.com/kakkky/gonsole/errs"
+	"github.com/kakkky/gonsole/types"
+)
+
+// DefaultFileName はgonsoleを起動したディレクトリから読み込む設定ファイルの名前
+const DefaultFileName = ".gonsole.json"
+
+// Config はプロジェクトごとのgonsoleの設定を表す
+type Config struct {
+	// ImportPaths はパッケージ名ごとに使うimportパス（例: {"utils": "example.com/app/plant/utils"}）
+	// 同名のパッケージが複数ある場合でも、ここで指定したパッケージ名は選択を求めずにimportする
+	ImportPaths map[types.PkgName]string `json:"importPaths"`
+	// Completion は補完の設定
+	Completion CompletionConfig `json:"completion"`
+	// Display は式の評価結果の表示の設定
+	Display DisplayConfig `json:"display"`
+	// Exec は入力の実行の設定
+	Exec ExecConfig `json:"exec"`
+}
+
+// CompletionConfig は補完の設定を表す
+type CompletionConfig struct {
+	// Matching は補完候補と入力の照合方法（"fuzzy" または "prefix"）。空の場合はfuzzyになる
+	Matching string `json:"matching"`
+}
+
+// DisplayConfig は式の評価結果の表示の設定を表す
+type DisplayConfig struct {
+	// Format は表示形式（"go"、"json" または "compact"）。空の場合はgoになる
+	Format string `json:"format"`
+}
+
+// ExecConfig は入力の実行の設定を表す
+type ExecConfig struct {
+	// Timeout は1回の実行にかけられる時間（例: "30s"、"off"）。空の場合は制限しない
+	Timeout string `json:"timeout"`
+}
+
+// Load は設定ファイルを読み込む。ファイルが存在しない場合は空の設定を返す
+func Load(fileName string) (*Config, error) {
+	data, err := os.ReadFile(fileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, errs.NewInternalError(fmt.Sprintf("failed to read config file %s", fileName)).Wrap(err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, errs.NewBadInputError(fmt.Sprintf("failed to parse config file %s", fileName)).Wrap(err)
+	}
+	for pkgName, importPath := range cfg.ImportPaths {
+		if pkgName == "" || importPath == "" {
+			return nil, errs.NewBadInputError(fmt.Sprintf("invalid import path %q for package %q in config file %s", importPath, pkgName, fileName))
+		}
+	}
+	return &cfg, nil
+}
+
+// ImportPathBindings はパッケージ名ごとに使うimportパスを、ソースコード上の記述（ダブルクォートで囲んだ形式）で返す
+func (c *Config) ImportPathBindings() map[types.PkgName]types.ImportPath {
+	bindings := make(map[types.PkgName]types.ImportPath, len(c.ImportPaths))
+	for pkgName, importPath := range c.ImportPaths {
+		bindings[pkgName] = types.ImportPath(strconv.Quote(importPath))
+	}
+	return bindings
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kakkky/gonsole/types"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name               string
+		fileName           string
+		expectedBindings   map[types.PkgName]types.ImportPath
+		expectedCompletion CompletionConfig
+		expectedDisplay    DisplayConfig
+		expectedExec       ExecConfig
+		expectedErr        bool
+	}{
+		{
+			name:     "load import paths",
+			fileName: "./testdata/valid.json",
+			expectedBindings: map[types.PkgName]types.ImportPath{
+				"utils": `"example.com/app/plant/utils"`,
+				"rand":  `"math/rand"`,
+			},
+			expectedCompletion: CompletionConfig{Matching: "prefix"},
+			expectedDisplay:    DisplayConfig{Format: "json"},
+			expectedExec:       ExecConfig{Timeout: "30s"},
+		},
+		{
+			name:             "file that does not exist",
+			fileName:         "./testdata/notfound.json",
+			expectedBindings: map[types.PkgName]types.ImportPath{},
+		},
+		{
+			name:        "broken json",
+			fileName:    "./testdata/broken.json",
+			expectedErr: true,
+		},
+		{
+			name:        "empty import path",
+			fileName:    "./testdata/empty_path.json",
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Load(tt.fileName)
+			if tt.expectedErr {
+				if err == nil {
+					t.Errorf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() returned an error: %v", err)
+			}
+			if diff := cmp.Diff(tt.expectedBindings, got.ImportPathBindings()); diff != "" {
+				t.Errorf("ImportPathBindings() mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.expectedCompletion, got.Completion); diff != "" {
+				t.Errorf("Completion mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.expectedDisplay, got.Display); diff != "" {
+				t.Errorf("Display mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.expectedExec, got.Exec); diff != "" {
+				t.Errorf("Exec mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -1,6 +1,11 @@
 package declregistry
 
-import "github.com/kakkky/gonsole/types"
+import (
+	"go/ast"
+	gotypes "go/types"
+
+	"github.com/kakkky/gonsole/types"
+)
 
 // Decl はReplセッション内で宣言された変数の情報を表す
 type Decl struct {
@@ -8,9 +13,62 @@ type Decl struct {
 	Pointered   bool
 	TypeName    types.TypeName
 	TypePkgName types.PkgName
+	// TypePkgPath は型が宣言されたパッケージのimportパスで、補完候補を引くために使う
+	TypePkgPath types.ImportPath
+	// TypeExpr はセッションのソースコード上で記述できる形式の型（例: *animal.Dog）
+	// 非公開の型を含むなど、記述できない場合は空になる
+	TypeExpr types.TypeName
+	// TypeImportPaths はTypeExprが参照しているパッケージのimportパス
+	TypeImportPaths []types.ImportPath
+	// MutatingMethods は呼び出すと変数の値を書き換えうるメソッド名で、:undoで取り消す文の影響を判定するために使う
+	// ポインタレシーバのメソッドと、中身を判定できないインターフェースのメソッドが該当する
+	MutatingMethods []string
+	// Shadowed は同名の変数が再宣言されたことで、セッションから参照できなくなった変数かどうか
+	// 値を引き継ぐために、Nameはセッションのソースコード上で付け替えられた名前になる
+	Shadowed bool
 }
 
 // IsPointered は宣言された変数がポインタ型かどうかを返す
 func (d Decl) IsPointered() bool {
 	return d.Pointered
 }
+
+// TypeStr は変数の型を表示用の文字列にする
+// ソースコード上で記述できない型は、パッケージ名と型名から組み立てる
+func (d Decl) TypeStr() string {
+	if d.TypeExpr != "" {
+		return string(d.TypeExpr)
+	}
+	typeStr := string(d.TypeName)
+	if d.TypePkgName != "" {
+		typeStr = string(d.TypePkgName) + "." + typeStr
+	}
+	if d.IsPointered() {
+		typeStr = "*" + typeStr
+	}
+	return typeStr
+}
+
+// TopLevelDecl はReplセッション内でトップレベルに宣言された関数・メソッド・型の情報を表す
+type TopLevelDecl struct {
+	Name types.DeclName
+	// PkgName はセッションが属するパッケージ名（-pkg指定時は対象パッケージ名）
+	PkgName types.PkgName
+	// PkgPath はセッションが属するパッケージのimportパス
+	PkgPath types.ImportPath
+	// ReceiverTypeName はメソッドのレシーバの型名で、関数と型の場合は空になる
+	ReceiverTypeName types.ReceiverTypeName
+	// Obj は型チェック済みのオブジェクトで、補完候補の生成に使う
+	Obj gotypes.Object
+	// Node は宣言のAST。型の場合はTypeSpecを含むGenDeclになる
+	Node ast.Decl
+}
+
+// Import はReplセッション内でimport文により宣言されたパッケージを表す
+type Import struct {
+	// Name はセッションのソースコード上でパッケージを参照する名前で、別名を付けた場合はその別名になる
+	Name types.PkgName
+	// PkgName はパッケージ自体の名前
+	PkgName    types.PkgName
+	ImportPath types.ImportPath
+}
@@ -2,7 +2,9 @@ package declregistry
 
 import (
 	"go/ast"
+	"go/token"
 	"slices"
+	"strconv"
 	"strings"
 
 	gotypes "go/types"
@@ -15,6 +17,12 @@ import (
 // DeclRegistry はReplセッション中に宣言された変数の情報を管理する
 type DeclRegistry struct {
 	Decls []Decl
+	// TopLevelDecls はReplセッション中にトップレベルに宣言された関数・メソッド・型
+	TopLevelDecls []TopLevelDecl
+	// Imports はReplセッション中にimport文で宣言されたパッケージ
+	Imports []Import
+	// ResultTypes は最後に評価した式の結果の型。複数の値を返す呼び出しでは、値ごとの型になる
+	ResultTypes []types.TypeName
 }
 
 // NewRegistry はDeclRegistryのインスタンスを生成する
@@ -24,29 +32,245 @@ func NewRegistry() *DeclRegistry {
 	}
 }
 
+// DisplayFuncName は式の評価結果を表示するランタイムの関数名
+// Executorは入力された式をこの関数の唯一の引数に包むので、その引数の型を評価した式の結果の型として記録する
+const DisplayFuncName = "gonsoleDisplay"
+
 // テストコードでRegisterの呼び出しをスキップするためのフラグ
 var SkipRegisterMode bool
 
 // Register は入力された最後の文を解析して、宣言された変数の情報をDeclRegistryに登録する
 func (dr *DeclRegistry) Register(tmpFileName string) error {
+	dr.ResultTypes = nil
 	// テストコードでの呼び出しをスキップするためのフラグ
 	// 見通しは悪いが、一旦これで対応
 	if SkipRegisterMode {
 		return nil
 	}
 
+	pkg, sessionFile, err := loadSessionFile(tmpFileName)
+	if err != nil {
+		return err
+	}
+	return dr.registerLastStmt(pkg, sessionFile, "main")
+}
+
+// RegisterInPackage は対象パッケージに組み込んだセッションのファイルを解析して、宣言された変数の情報をDeclRegistryに登録する
+// セッションのファイルは実際には対象パッケージのディレクトリに存在しないため、overlayとして読み込ませる
+func (dr *DeclRegistry) RegisterInPackage(sessionFileName string, sessionSrc []byte, sessionFuncName string) error {
+	dr.ResultTypes = nil
+	if SkipRegisterMode {
+		return nil
+	}
+
+	pkg, sessionFile, err := loadPkgSessionFile(sessionFileName, sessionSrc)
+	if err != nil {
+		return err
+	}
+	return dr.registerLastStmt(pkg, sessionFile, sessionFuncName)
+}
+
+// RegisterChecked は呼び出し側で型検査したセッションのファイルを解析して、宣言された変数の情報をDeclRegistryに登録する
+// 型検査の結果をそのまま使うので、パッケージを読み込み直さない
+func (dr *DeclRegistry) RegisterChecked(sessionFile *ast.File, sessionPkg *gotypes.Package, typesInfo *gotypes.Info) error {
+	dr.ResultTypes = nil
+	if SkipRegisterMode {
+		return nil
+	}
+
+	pkg := &packages.Package{Types: sessionPkg, TypesInfo: typesInfo}
+	return dr.registerLastStmt(pkg, sessionFile, "main")
+}
+
+// RegisterTopLevelDecls はセッションのファイルを解析して、トップレベルに宣言された関数・メソッド・型の情報を登録し直す
+func (dr *DeclRegistry) RegisterTopLevelDecls(tmpFileName string) error {
+	if SkipRegisterMode {
+		return nil
+	}
+
+	pkg, sessionFile, err := loadSessionFile(tmpFileName)
+	if err != nil {
+		return err
+	}
+	dr.registerTopLevelDecls(pkg, sessionFile, "main")
+	return nil
+}
+
+// RegisterTopLevelDeclsInPackage は対象パッケージに組み込んだセッションのファイルを解析して、トップレベルに宣言された関数・メソッド・型の情報を登録し直す
+func (dr *DeclRegistry) RegisterTopLevelDeclsInPackage(sessionFileName string, sessionSrc []byte, sessionFuncName string) error {
+	if SkipRegisterMode {
+		return nil
+	}
+
+	pkg, sessionFile, err := loadPkgSessionFile(sessionFileName, sessionSrc)
+	if err != nil {
+		return err
+	}
+	dr.registerTopLevelDecls(pkg, sessionFile, sessionFuncName)
+	return nil
+}
+
+// RegisterAll はセッションのファイルのすべての文とトップレベルの宣言を解析して、登録し直す
+// プロジェクトのコードが変わって、宣言済みの変数や関数の型が変わった場合に使う
+func (dr *DeclRegistry) RegisterAll(tmpFileName string) error {
+	if SkipRegisterMode {
+		return nil
+	}
+
+	pkg, sessionFile, err := loadSessionFile(tmpFileName)
+	if err != nil {
+		return err
+	}
+	return dr.registerAllStmts(pkg, sessionFile, "main")
+}
+
+// RegisterAllInPackage は対象パッケージに組み込んだセッションのファイルのすべての文とトップレベルの宣言を解析して、登録し直す
+func (dr *DeclRegistry) RegisterAllInPackage(sessionFileName string, sessionSrc []byte, sessionFuncName string) error {
+	if SkipRegisterMode {
+		return nil
+	}
+
+	pkg, sessionFile, err := loadPkgSessionFile(sessionFileName, sessionSrc)
+	if err != nil {
+		return err
+	}
+	return dr.registerAllStmts(pkg, sessionFile, sessionFuncName)
+}
+
+// loadSessionFile はセッションの一時ファイルを型情報付きで読み込む
+func loadSessionFile(tmpFileName string) (*packages.Package, *ast.File, error) {
 	cfg := &packages.Config{
-		Mode: packages.NeedName | packages.NeedTypes | packages.NeedTypesInfo | packages.NeedSyntax,
+		Mode: loadMode,
 		Dir:  "",
 	}
 
 	pkgs, err := packages.Load(cfg, tmpFileName)
 	if err != nil || len(pkgs) == 0 {
-		return errs.NewInternalError("failed to load package").Wrap(err)
+		return nil, nil, errs.NewInternalError("failed to load package").Wrap(err)
 	}
 
 	pkg := pkgs[0]
+	return pkg, pkg.Syntax[0], nil
+}
+
+// loadPkgSessionFile は対象パッケージに組み込んだセッションのファイルを、対象パッケージごと型情報付きで読み込む
+func loadPkgSessionFile(sessionFileName string, sessionSrc []byte) (*packages.Package, *ast.File, error) {
+	cfg := &packages.Config{
+		Mode:    loadMode | packages.NeedCompiledGoFiles,
+		Dir:     "",
+		Overlay: map[string][]byte{sessionFileName: sessionSrc},
+	}
+
+	pkgs, err := packages.Load(cfg, "file="+sessionFileName)
+	if err != nil || len(pkgs) == 0 {
+		return nil, nil, errs.NewInternalError("failed to load package").Wrap(err)
+	}
+
+	pkg := pkgs[0]
+	for i, compiledGoFile := range pkg.CompiledGoFiles {
+		if compiledGoFile == sessionFileName && i < len(pkg.Syntax) {
+			return pkg, pkg.Syntax[i], nil
+		}
+	}
+	return nil, nil, errs.NewInternalError("session file not found in target package")
+}
 
+const loadMode = packages.NeedName | packages.NeedImports | packages.NeedDeps | packages.NeedTypes | packages.NeedTypesInfo | packages.NeedSyntax
+
+// registerLastStmt はセッションの関数の最後の文を解析して、宣言された変数の情報を登録する
+func (dr *DeclRegistry) registerLastStmt(pkg *packages.Package, sessionFile *ast.File, sessionFuncName string) error {
+	stmts, err := sessionStmts(pkg, sessionFile, sessionFuncName)
+	if err != nil {
+		return err
+	}
+	if len(stmts) == 0 {
+		return nil
+	}
+	lastStmt := stmts[len(stmts)-1]
+	dr.registerResultTypes(lastStmt, pkg.TypesInfo, pkg.Types)
+	dr.registerStmt(lastStmt, pkg)
+	return nil
+}
+
+// registerResultTypes は式の評価結果を表示する文（`gonsoleDisplay(expr)`や`it := gonsoleDisplay(expr)`）から、評価した式の結果の型を記録する
+func (dr *DeclRegistry) registerResultTypes(stmt ast.Stmt, typesInfo *gotypes.Info, sessionPkg *gotypes.Package) {
+	var expr ast.Expr
+	switch stmtV := stmt.(type) {
+	case *ast.ExprStmt:
+		expr = stmtV.X
+	case *ast.AssignStmt:
+		if len(stmtV.Rhs) != 1 {
+			return
+		}
+		expr = stmtV.Rhs[0]
+	default:
+		return
+	}
+	callExpr, ok := expr.(*ast.CallExpr)
+	if !ok || len(callExpr.Args) != 1 {
+		return
+	}
+	if ident, ok := callExpr.Fun.(*ast.Ident); !ok || ident.Name != DisplayFuncName {
+		return
+	}
+	typ := typesInfo.TypeOf(callExpr.Args[0])
+	if typ == nil {
+		return
+	}
+	// 実行時に表示する値の型名と揃えるため、対象パッケージに組み込んだ場合は対象パッケージの型にもパッケージ名を付ける
+	qualifier := func(pkg *gotypes.Package) string {
+		if pkg == sessionPkg && pkg.Name() == "main" {
+			return ""
+		}
+		return pkg.Name()
+	}
+	tuple, ok := typ.(*gotypes.Tuple)
+	if !ok {
+		dr.ResultTypes = []types.TypeName{types.TypeName(gotypes.TypeString(typ, qualifier))}
+		return
+	}
+	for i := range tuple.Len() {
+		dr.ResultTypes = append(dr.ResultTypes, types.TypeName(gotypes.TypeString(tuple.At(i).Type(), qualifier)))
+	}
+}
+
+// registerAllStmts はセッションの関数のすべての文を解析して、宣言された変数の情報を登録し直す
+// 再宣言により名前を付け替えた変数は、付け替えた名前のまま登録し直す
+func (dr *DeclRegistry) registerAllStmts(pkg *packages.Package, sessionFile *ast.File, sessionFuncName string) error {
+	stmts, err := sessionStmts(pkg, sessionFile, sessionFuncName)
+	if err != nil {
+		return err
+	}
+	shadowedNames := make(map[types.DeclName]bool)
+	for _, decl := range dr.Decls {
+		if decl.Shadowed {
+			shadowedNames[decl.Name] = true
+		}
+	}
+	dr.Decls = []Decl{}
+	for _, stmt := range stmts {
+		dr.registerStmt(stmt, pkg)
+	}
+	for i, decl := range dr.Decls {
+		dr.Decls[i].Shadowed = shadowedNames[decl.Name]
+	}
+	dr.registerTopLevelDecls(pkg, sessionFile, sessionFuncName)
+	return nil
+}
+
+// registerStmt は文で宣言された変数の情報を登録する
+func (dr *DeclRegistry) registerStmt(stmt ast.Stmt, pkg *packages.Package) {
+	switch stmtV := stmt.(type) {
+	case *ast.AssignStmt:
+		dr.registerAssimentStmt(stmtV, pkg.TypesInfo, pkg.Types)
+	case *ast.DeclStmt:
+		dr.registerDeclStmt(stmtV, pkg.TypesInfo, pkg.Types)
+	}
+}
+
+// sessionStmts はセッションの関数の文から、変数を使用済みにするためのブランク代入を除いて返す
+// 型チェックのエラーがあれば、入力の誤りとして返す
+func sessionStmts(pkg *packages.Package, sessionFile *ast.File, sessionFuncName string) ([]ast.Stmt, error) {
 	pkg.Errors = slices.DeleteFunc(pkg.Errors, func(err packages.Error) bool {
 		switch {
 		case strings.Contains(err.Msg, "declared and not used"):
@@ -64,50 +288,40 @@ func (dr *DeclRegistry) Register(tmpFileName string) error {
 		for _, pkgErr := range pkg.Errors {
 			errMsgs = append(errMsgs, pkgErr.Msg)
 		}
-		return errs.NewBadInputError("failed to parse input: " + strings.Join(errMsgs, "; "))
+		return nil, errs.NewBadInputError("failed to parse input: " + strings.Join(errMsgs, "; "))
 	}
 
 	var mainFunc *ast.FuncDecl
-	for _, decl := range pkg.Syntax[0].Decls {
+	for _, decl := range sessionFile.Decls {
 		funcDecl, ok := decl.(*ast.FuncDecl)
-		if ok && funcDecl.Name.Name == "main" {
+		if ok && funcDecl.Name.Name == sessionFuncName {
 			mainFunc = funcDecl
 			break
 		}
 	}
 	if mainFunc == nil {
-		return errs.NewBadInputError("main function not found")
+		return nil, errs.NewBadInputError(sessionFuncName + " function not found")
 	}
 	mainFuncBodyList := mainFunc.Body.List
-	mainFuncBodyList = slices.DeleteFunc(mainFuncBodyList, func(stmt ast.Stmt) bool {
+	// `v, _ := f()`のように一部の値だけを捨てる宣言は、変数を宣言しているので残す
+	mainFuncBodyList = slices.DeleteFunc(slices.Clone(mainFuncBodyList), func(stmt ast.Stmt) bool {
 		assignStmt, ok := stmt.(*ast.AssignStmt)
 		if !ok {
 			return false
 		}
 		for _, stmtLHS := range assignStmt.Lhs {
 			lhsIdent, ok := stmtLHS.(*ast.Ident)
-			if !ok {
-				continue
-			}
-			if lhsIdent.Name == "_" {
-				return true
+			if !ok || lhsIdent.Name != "_" {
+				return false
 			}
 		}
-		return false
+		return true
 	})
 
-	lastStmt := mainFuncBodyList[len(mainFuncBodyList)-1]
-
-	switch lastStmtV := lastStmt.(type) {
-	case *ast.AssignStmt:
-		dr.registerAssimentStmt(lastStmtV, pkg.TypesInfo)
-	case *ast.DeclStmt:
-		dr.registerDeclStmt(lastStmtV, pkg.TypesInfo)
-	}
-	return nil
+	return mainFuncBodyList, nil
 }
 
-func (dr *DeclRegistry) registerAssimentStmt(assignmentStmt *ast.AssignStmt, typesInfo *gotypes.Info) {
+func (dr *DeclRegistry) registerAssimentStmt(assignmentStmt *ast.AssignStmt, typesInfo *gotypes.Info, sessionPkg *gotypes.Package) {
 	for _, stmtLHS := range assignmentStmt.Lhs {
 		lhsIdent, ok := stmtLHS.(*ast.Ident)
 		if !ok {
@@ -116,6 +330,7 @@ func (dr *DeclRegistry) registerAssimentStmt(assignmentStmt *ast.AssignStmt, typ
 		typ := typesInfo.TypeOf(stmtLHS)
 		var typeName types.TypeName
 		var typePkgName types.PkgName
+		var typePkgPath types.ImportPath
 		var pointered bool
 
 		switch typV := typ.(type) {
@@ -123,6 +338,7 @@ func (dr *DeclRegistry) registerAssimentStmt(assignmentStmt *ast.AssignStmt, typ
 			typeName = types.TypeName(typV.Obj().Name())
 			if typV.Obj().Pkg() != nil {
 				typePkgName = types.PkgName(typV.Obj().Pkg().Name())
+				typePkgPath = types.ImportPath(strconv.Quote(typV.Obj().Pkg().Path()))
 			}
 		case *gotypes.Pointer:
 			pointered = true
@@ -131,6 +347,7 @@ func (dr *DeclRegistry) registerAssimentStmt(assignmentStmt *ast.AssignStmt, typ
 				typeName = types.TypeName(pointeredTypV.Obj().Name())
 				if pointeredTypV.Obj().Pkg() != nil {
 					typePkgName = types.PkgName(pointeredTypV.Obj().Pkg().Name())
+					typePkgPath = types.ImportPath(strconv.Quote(pointeredTypV.Obj().Pkg().Path()))
 				}
 			default:
 				typeName = types.TypeName(pointeredTypV.String())
@@ -138,16 +355,21 @@ func (dr *DeclRegistry) registerAssimentStmt(assignmentStmt *ast.AssignStmt, typ
 		default:
 			typeName = types.TypeName(typ.String())
 		}
+		typeExpr, typeImportPaths := typeExprOf(typ, sessionPkg)
 		dr.register(Decl{
-			Name:        types.DeclName(lhsIdent.Name),
-			Pointered:   pointered,
-			TypeName:    typeName,
-			TypePkgName: typePkgName,
+			Name:            types.DeclName(lhsIdent.Name),
+			Pointered:       pointered,
+			TypeName:        typeName,
+			TypePkgName:     typePkgName,
+			TypePkgPath:     typePkgPath,
+			TypeExpr:        typeExpr,
+			TypeImportPaths: typeImportPaths,
+			MutatingMethods: mutatingMethodsOf(typ),
 		})
 	}
 }
 
-func (dr *DeclRegistry) registerDeclStmt(declStmt *ast.DeclStmt, typesInfo *gotypes.Info) {
+func (dr *DeclRegistry) registerDeclStmt(declStmt *ast.DeclStmt, typesInfo *gotypes.Info, sessionPkg *gotypes.Package) {
 	switch stmtDeclV := declStmt.Decl.(type) {
 	case *ast.GenDecl:
 		for _, stmtDeclSpec := range stmtDeclV.Specs {
@@ -157,6 +379,7 @@ func (dr *DeclRegistry) registerDeclStmt(declStmt *ast.DeclStmt, typesInfo *goty
 					typ := typesInfo.TypeOf(name)
 					var typeName types.TypeName
 					var typePkgName types.PkgName
+					var typePkgPath types.ImportPath
 					var pointered bool
 
 					switch typV := typ.(type) {
@@ -164,6 +387,7 @@ func (dr *DeclRegistry) registerDeclStmt(declStmt *ast.DeclStmt, typesInfo *goty
 						typeName = types.TypeName(typV.Obj().Name())
 						if typV.Obj().Pkg() != nil {
 							typePkgName = types.PkgName(typV.Obj().Pkg().Name())
+							typePkgPath = types.ImportPath(strconv.Quote(typV.Obj().Pkg().Path()))
 						}
 					case *gotypes.Pointer:
 						pointered = true
@@ -172,6 +396,7 @@ func (dr *DeclRegistry) registerDeclStmt(declStmt *ast.DeclStmt, typesInfo *goty
 							typeName = types.TypeName(pointeredTypV.Obj().Name())
 							if pointeredTypV.Obj().Pkg() != nil {
 								typePkgName = types.PkgName(pointeredTypV.Obj().Pkg().Name())
+								typePkgPath = types.ImportPath(strconv.Quote(pointeredTypV.Obj().Pkg().Path()))
 							}
 						default:
 							typeName = types.TypeName(pointeredTypV.String())
@@ -179,11 +404,16 @@ func (dr *DeclRegistry) registerDeclStmt(declStmt *ast.DeclStmt, typesInfo *goty
 					default:
 						typeName = types.TypeName(typ.String())
 					}
+					typeExpr, typeImportPaths := typeExprOf(typ, sessionPkg)
 					dr.register(Decl{
-						Name:        types.DeclName(name.Name),
-						Pointered:   pointered,
-						TypeName:    typeName,
-						TypePkgName: typePkgName,
+						Name:            types.DeclName(name.Name),
+						Pointered:       pointered,
+						TypeName:        typeName,
+						TypePkgName:     typePkgName,
+						TypePkgPath:     typePkgPath,
+						TypeExpr:        typeExpr,
+						TypeImportPaths: typeImportPaths,
+						MutatingMethods: mutatingMethodsOf(typ),
 					})
 				}
 			}
@@ -191,10 +421,233 @@ func (dr *DeclRegistry) registerDeclStmt(declStmt *ast.DeclStmt, typesInfo *goty
 	}
 }
 
+// mutatingMethodsOf は型の値を書き換えうるメソッド名を返す
+// 値レシーバのメソッドはコピーを受け取るので含めず、インターフェースは実装を判定できないのですべてのメソッドを含める
+func mutatingMethodsOf(typ gotypes.Type) []string {
+	if pointerTyp, ok := typ.(*gotypes.Pointer); ok {
+		typ = pointerTyp.Elem()
+	}
+	var methodNames []string
+	if interfaceTyp, ok := typ.Underlying().(*gotypes.Interface); ok {
+		for i := range interfaceTyp.NumMethods() {
+			methodNames = append(methodNames, interfaceTyp.Method(i).Name())
+		}
+		return methodNames
+	}
+	methodSet := gotypes.NewMethodSet(gotypes.NewPointer(typ))
+	for i := range methodSet.Len() {
+		methodObj, ok := methodSet.At(i).Obj().(*gotypes.Func)
+		if !ok {
+			continue
+		}
+		if _, ok := methodObj.Signature().Recv().Type().(*gotypes.Pointer); ok {
+			methodNames = append(methodNames, methodObj.Name())
+		}
+	}
+	return methodNames
+}
+
+// registerTopLevelDecls はセッションのファイルのトップレベルに宣言された関数・メソッド・型を登録し直す
+func (dr *DeclRegistry) registerTopLevelDecls(pkg *packages.Package, sessionFile *ast.File, sessionFuncName string) {
+	var topLevelDecls []TopLevelDecl
+	for _, decl := range sessionFile.Decls {
+		switch declV := decl.(type) {
+		case *ast.FuncDecl:
+			if declV.Recv == nil && declV.Name.Name == sessionFuncName {
+				continue
+			}
+			funcObj, ok := pkg.TypesInfo.Defs[declV.Name].(*gotypes.Func)
+			if !ok {
+				continue
+			}
+			topLevelDecls = append(topLevelDecls, TopLevelDecl{
+				Name:             types.DeclName(declV.Name.Name),
+				PkgName:          types.PkgName(pkg.Name),
+				PkgPath:          types.ImportPath(strconv.Quote(pkg.PkgPath)),
+				ReceiverTypeName: receiverTypeNameOf(funcObj),
+				Obj:              funcObj,
+				Node:             declV,
+			})
+		case *ast.GenDecl:
+			if declV.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range declV.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				typeObj := pkg.TypesInfo.Defs[typeSpec.Name]
+				if typeObj == nil {
+					continue
+				}
+				topLevelDecls = append(topLevelDecls, TopLevelDecl{
+					Name:    types.DeclName(typeSpec.Name.Name),
+					PkgName: types.PkgName(pkg.Name),
+					PkgPath: types.ImportPath(strconv.Quote(pkg.PkgPath)),
+					Obj:     typeObj,
+					Node:    declV,
+				})
+			}
+		}
+	}
+	dr.TopLevelDecls = topLevelDecls
+}
+
+// receiverTypeNameOf はメソッドのレシーバの型名を返す。関数の場合は空を返す
+func receiverTypeNameOf(funcObj *gotypes.Func) types.ReceiverTypeName {
+	recv := funcObj.Signature().Recv()
+	if recv == nil {
+		return ""
+	}
+	recvType := recv.Type()
+	if pointer, ok := recvType.(*gotypes.Pointer); ok {
+		recvType = pointer.Elem()
+	}
+	if named, ok := recvType.(*gotypes.Named); ok {
+		return types.ReceiverTypeName(named.Obj().Name())
+	}
+	return ""
+}
+
+// typeExprOf は型をセッションのソースコード上で記述できる形式に変換し、参照しているパッケージのimportパスとともに返す
+// 非公開の型を含む場合や、同名の別パッケージを参照している場合は記述できないため空を返す
+func typeExprOf(typ gotypes.Type, sessionPkg *gotypes.Package) (types.TypeName, []types.ImportPath) {
+	if !isReferableType(typ, sessionPkg, map[gotypes.Type]bool{}) {
+		return "", nil
+	}
+
+	var importPaths []types.ImportPath
+	pkgPathByName := make(map[string]string)
+	var conflicted bool
+	typeExpr := gotypes.TypeString(typ, func(pkg *gotypes.Package) string {
+		if pkg == sessionPkg {
+			return ""
+		}
+		if pkgPath, ok := pkgPathByName[pkg.Name()]; ok {
+			if pkgPath != pkg.Path() {
+				conflicted = true
+			}
+			return pkg.Name()
+		}
+		pkgPathByName[pkg.Name()] = pkg.Path()
+		importPaths = append(importPaths, types.ImportPath(`"`+pkg.Path()+`"`))
+		return pkg.Name()
+	})
+	if conflicted {
+		return "", nil
+	}
+	return types.TypeName(typeExpr), importPaths
+}
+
+// isReferableType は型がセッションのソースコードから参照できるかを返す
+func isReferableType(typ gotypes.Type, sessionPkg *gotypes.Package, visited map[gotypes.Type]bool) bool {
+	if visited[typ] {
+		return true
+	}
+	visited[typ] = true
+
+	switch typV := typ.(type) {
+	case *gotypes.Named:
+		obj := typV.Obj()
+		if obj.Pkg() != nil && obj.Pkg() != sessionPkg && !obj.Exported() {
+			return false
+		}
+		typeArgs := typV.TypeArgs()
+		for i := 0; i < typeArgs.Len(); i++ {
+			if !isReferableType(typeArgs.At(i), sessionPkg, visited) {
+				return false
+			}
+		}
+		return true
+	case *gotypes.Pointer:
+		return isReferableType(typV.Elem(), sessionPkg, visited)
+	case *gotypes.Slice:
+		return isReferableType(typV.Elem(), sessionPkg, visited)
+	case *gotypes.Array:
+		return isReferableType(typV.Elem(), sessionPkg, visited)
+	case *gotypes.Chan:
+		return isReferableType(typV.Elem(), sessionPkg, visited)
+	case *gotypes.Map:
+		return isReferableType(typV.Key(), sessionPkg, visited) && isReferableType(typV.Elem(), sessionPkg, visited)
+	case *gotypes.Basic:
+		// untyped nilなどは変数の型として記述できない
+		return typV.Info()&gotypes.IsUntyped == 0
+	case *gotypes.Struct:
+		for i := 0; i < typV.NumFields(); i++ {
+			field := typV.Field(i)
+			if !field.Exported() && field.Pkg() != sessionPkg {
+				return false
+			}
+			if !isReferableType(field.Type(), sessionPkg, visited) {
+				return false
+			}
+		}
+		return true
+	case *gotypes.Signature:
+		for _, tuple := range []*gotypes.Tuple{typV.Params(), typV.Results()} {
+			for i := 0; i < tuple.Len(); i++ {
+				if !isReferableType(tuple.At(i).Type(), sessionPkg, visited) {
+					return false
+				}
+			}
+		}
+		return true
+	case *gotypes.Interface:
+		for i := 0; i < typV.NumMethods(); i++ {
+			method := typV.Method(i)
+			if !method.Exported() && method.Pkg() != sessionPkg {
+				return false
+			}
+			if !isReferableType(method.Type(), sessionPkg, visited) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// register は宣言を登録する。同名の宣言がすでにあれば置き換える
 func (dr *DeclRegistry) register(decl Decl) {
+	for i, registered := range dr.Decls {
+		if registered.Name == decl.Name {
+			dr.Decls[i] = decl
+			return
+		}
+	}
 	dr.Decls = append(dr.Decls, decl)
 }
 
+// Shadow は再宣言により参照できなくなった変数を、付け替えられた名前で登録し直す
+func (dr *DeclRegistry) Shadow(name types.DeclName, shadowedName types.DeclName) {
+	for i, decl := range dr.Decls {
+		if decl.Name == name {
+			dr.Decls[i].Name = shadowedName
+			dr.Decls[i].Shadowed = true
+		}
+	}
+}
+
+// Unshadow はShadowで付け替えた変数を元の名前に戻す
+func (dr *DeclRegistry) Unshadow(shadowedName types.DeclName, name types.DeclName) {
+	for i, decl := range dr.Decls {
+		if decl.Name == shadowedName {
+			dr.Decls[i].Name = name
+			dr.Decls[i].Shadowed = false
+		}
+	}
+}
+
+// Unregister は指定された名前の宣言をDeclRegistryから削除する
+func (dr *DeclRegistry) Unregister(name types.DeclName) {
+	dr.Decls = slices.DeleteFunc(dr.Decls, func(decl Decl) bool {
+		return decl.Name == name
+	})
+}
+
+// Reset は登録したすべての宣言・import・式の評価結果の型を破棄して、生成した直後の状態に戻す
+func (dr *DeclRegistry) Reset() {
+	*dr = *NewRegistry()
+}
+
 // IsRegisteredDecl は指定された名前の宣言が登録されているかを返す
 func (dr *DeclRegistry) IsRegisteredDecl(name types.DeclName) bool {
 	for _, decl := range dr.Decls {
@@ -204,3 +657,34 @@ func (dr *DeclRegistry) IsRegisteredDecl(name types.DeclName) bool {
 	}
 	return false
 }
+
+// LookupDecl は登録済みの変数を名前で探す
+func (dr *DeclRegistry) LookupDecl(name types.DeclName) (Decl, bool) {
+	for _, decl := range dr.Decls {
+		if decl.Name == name {
+			return decl, true
+		}
+	}
+	return Decl{}, false
+}
+
+// RegisterImport はimport文で宣言されたパッケージを登録する。同じ名前で宣言済みであれば置き換える
+func (dr *DeclRegistry) RegisterImport(imp Import) {
+	for i, registered := range dr.Imports {
+		if registered.Name == imp.Name {
+			dr.Imports[i] = imp
+			return
+		}
+	}
+	dr.Imports = append(dr.Imports, imp)
+}
+
+// LookupImport はセッションのソースコード上でパッケージを参照する名前から、import文で宣言されたパッケージを探す
+func (dr *DeclRegistry) LookupImport(name types.PkgName) (Import, bool) {
+	for _, imp := range dr.Imports {
+		if imp.Name == name {
+			return imp, true
+		}
+	}
+	return Import{}, false
+}
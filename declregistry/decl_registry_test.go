@@ -1,9 +1,11 @@
 package declregistry
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/kakkky/gonsole/types"
 )
 
@@ -22,6 +24,26 @@ func TestDeclRegistry_Register(t *testing.T) {
 					Name:        "a",
 					TypeName:    "int",
 					TypePkgName: "",
+					TypeExpr:    "int",
+				},
+			},
+		},
+		{
+			name:                "redeclared variable replaces registered declaration",
+			existingTmpFileName: "./testdata/selector_expression_assignment/00000_gonsole_tmp.go",
+			existingDecls: []Decl{
+				{
+					Name:     "a",
+					TypeName: "string",
+					TypeExpr: "string",
+				},
+			},
+			expected: []Decl{
+				{
+					Name:        "a",
+					TypeName:    "int",
+					TypePkgName: "",
+					TypeExpr:    "int",
 				},
 			},
 		},
@@ -30,9 +52,12 @@ func TestDeclRegistry_Register(t *testing.T) {
 			existingTmpFileName: "./testdata/composite_literal_assignment/00000_gonsole_tmp.go",
 			expected: []Decl{
 				{
-					Name:        "s",
-					TypeName:    "Struct",
-					TypePkgName: "sample",
+					Name:            "s",
+					TypeName:        "Struct",
+					TypePkgName:     "sample",
+					TypePkgPath:     `"github.com/kakkky/gonsole/declregistry/testdata/composite_literal_assignment/sample"`,
+					TypeExpr:        "sample.Struct",
+					TypeImportPaths: []types.ImportPath{`"github.com/kakkky/gonsole/declregistry/testdata/composite_literal_assignment/sample"`},
 				},
 			},
 		},
@@ -41,10 +66,13 @@ func TestDeclRegistry_Register(t *testing.T) {
 			existingTmpFileName: "./testdata/pointer_to_struct_assignment/00000_gonsole_tmp.go",
 			expected: []Decl{
 				{
-					Name:        "p",
-					Pointered:   true,
-					TypeName:    "Struct",
-					TypePkgName: "sample",
+					Name:            "p",
+					Pointered:       true,
+					TypeName:        "Struct",
+					TypePkgName:     "sample",
+					TypePkgPath:     `"github.com/kakkky/gonsole/declregistry/testdata/pointer_to_struct_assignment/sample"`,
+					TypeExpr:        "*sample.Struct",
+					TypeImportPaths: []types.ImportPath{`"github.com/kakkky/gonsole/declregistry/testdata/pointer_to_struct_assignment/sample"`},
 				},
 			},
 		},
@@ -56,6 +84,7 @@ func TestDeclRegistry_Register(t *testing.T) {
 					Name:        "f",
 					TypeName:    "int",
 					TypePkgName: "",
+					TypeExpr:    "int",
 				},
 			},
 		},
@@ -67,11 +96,13 @@ func TestDeclRegistry_Register(t *testing.T) {
 					Name:        "a",
 					TypeName:    "int",
 					TypePkgName: "",
+					TypeExpr:    "int",
 				},
 				{
 					Name:        "b",
 					TypeName:    "string",
 					TypePkgName: "",
+					TypeExpr:    "string",
 				},
 			},
 		},
@@ -83,6 +114,7 @@ func TestDeclRegistry_Register(t *testing.T) {
 					Name:        "v",
 					TypeName:    "int",
 					TypePkgName: "",
+					TypeExpr:    "int",
 				},
 			},
 		},
@@ -91,9 +123,12 @@ func TestDeclRegistry_Register(t *testing.T) {
 			existingTmpFileName: "./testdata/var_declaration_with_composite_literal/00000_gonsole_tmp.go",
 			expected: []Decl{
 				{
-					Name:        "s",
-					TypeName:    "Struct",
-					TypePkgName: "sample",
+					Name:            "s",
+					TypeName:        "Struct",
+					TypePkgName:     "sample",
+					TypePkgPath:     `"github.com/kakkky/gonsole/declregistry/testdata/var_declaration_with_composite_literal/sample"`,
+					TypeExpr:        "sample.Struct",
+					TypeImportPaths: []types.ImportPath{`"github.com/kakkky/gonsole/declregistry/testdata/var_declaration_with_composite_literal/sample"`},
 				},
 			},
 		},
@@ -102,10 +137,13 @@ func TestDeclRegistry_Register(t *testing.T) {
 			existingTmpFileName: "./testdata/var_declaration_with_pointer_to_struct/00000_gonsole_tmp.go",
 			expected: []Decl{
 				{
-					Name:        "p",
-					Pointered:   true,
-					TypeName:    "Struct",
-					TypePkgName: "sample",
+					Name:            "p",
+					Pointered:       true,
+					TypeName:        "Struct",
+					TypePkgName:     "sample",
+					TypePkgPath:     `"github.com/kakkky/gonsole/declregistry/testdata/var_declaration_with_pointer_to_struct/sample"`,
+					TypeExpr:        "*sample.Struct",
+					TypeImportPaths: []types.ImportPath{`"github.com/kakkky/gonsole/declregistry/testdata/var_declaration_with_pointer_to_struct/sample"`},
 				},
 			},
 		},
@@ -117,6 +155,7 @@ func TestDeclRegistry_Register(t *testing.T) {
 					Name:        "f",
 					TypeName:    "int",
 					TypePkgName: "",
+					TypeExpr:    "int",
 				},
 			},
 		},
@@ -137,9 +176,12 @@ func TestDeclRegistry_Register(t *testing.T) {
 					TypePkgName: "sample",
 				},
 				{
-					Name:        "b",
-					TypeName:    "Struct",
-					TypePkgName: "sample",
+					Name:            "b",
+					TypeName:        "Struct",
+					TypePkgName:     "sample",
+					TypePkgPath:     `"github.com/kakkky/gonsole/declregistry/testdata/method_assignment/sample"`,
+					TypeExpr:        "sample.Struct",
+					TypeImportPaths: []types.ImportPath{`"github.com/kakkky/gonsole/declregistry/testdata/method_assignment/sample"`},
 				},
 			},
 		},
@@ -163,6 +205,7 @@ func TestDeclRegistry_Register(t *testing.T) {
 					Name:        "b",
 					TypeName:    "string",
 					TypePkgName: "",
+					TypeExpr:    "string",
 				},
 			},
 		},
@@ -186,6 +229,7 @@ func TestDeclRegistry_Register(t *testing.T) {
 					Name:        "b",
 					TypeName:    "string",
 					TypePkgName: "",
+					TypeExpr:    "string",
 				},
 			},
 		},
@@ -214,6 +258,112 @@ func TestDeclRegistry_Register(t *testing.T) {
 	}
 }
 
+func TestDeclRegistry_Register_resultTypes(t *testing.T) {
+	tests := []struct {
+		name                string
+		existingTmpFileName string
+		expected            []types.TypeName
+		expectedDeclNames   []types.DeclName
+	}{
+		{
+			name:                "single result expression",
+			existingTmpFileName: "./testdata/single_result_expression/00000_gonsole_tmp.go",
+			expected:            []types.TypeName{"*sample.Struct"},
+			expectedDeclNames:   []types.DeclName{"it"},
+		},
+		{
+			name:                "multiple results expression",
+			existingTmpFileName: "./testdata/multiple_results_expression/00000_gonsole_tmp.go",
+			expected:            []types.TypeName{"*sample.Struct", "error"},
+			expectedDeclNames:   []types.DeclName{"it"},
+		},
+		{
+			name:                "assignment does not have result types",
+			existingTmpFileName: "./testdata/selector_expression_assignment/00000_gonsole_tmp.go",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sut := NewRegistry()
+			sut.ResultTypes = []types.TypeName{"string"}
+
+			if err := sut.Register(tt.existingTmpFileName); err != nil {
+				t.Fatalf("Register() returned an error: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.expected, sut.ResultTypes); diff != "" {
+				t.Errorf("Register() result types mismatch (-want +got):\n%s", diff)
+			}
+			if tt.expectedDeclNames == nil {
+				return
+			}
+			// 評価結果を束縛した変数は、最初の値の型で登録される
+			var gotDeclNames []types.DeclName
+			for _, decl := range sut.Decls {
+				if decl.TypeName != "Struct" || !decl.Pointered {
+					t.Errorf("Register() registered %s with type %s, want *Struct", decl.Name, decl.TypeName)
+				}
+				gotDeclNames = append(gotDeclNames, decl.Name)
+			}
+			if diff := cmp.Diff(tt.expectedDeclNames, gotDeclNames); diff != "" {
+				t.Errorf("Register() decl names mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDeclRegistry_RegisterInPackage(t *testing.T) {
+	tests := []struct {
+		name       string
+		pkgDir     string
+		sessionSrc string
+		expected   []Decl
+	}{
+		{
+			name:   "unexported type in target package",
+			pkgDir: "./testdata/register_in_package/sample",
+			sessionSrc: `package sample
+
+func GonsoleSession() {
+	d := newDog()
+	_ = d
+}
+`,
+			expected: []Decl{
+				{
+					Name:        "d",
+					Pointered:   true,
+					TypeName:    "dog",
+					TypePkgName: "sample",
+					TypePkgPath: `"github.com/kakkky/gonsole/declregistry/testdata/register_in_package/sample"`,
+					TypeExpr:    "*dog",
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sut := NewRegistry()
+
+			pkgDir, err := filepath.Abs(tt.pkgDir)
+			if err != nil {
+				t.Fatalf("failed to get absolute path: %v", err)
+			}
+			sessionFileName := filepath.Join(pkgDir, "gonsole_session.go")
+
+			if err := sut.RegisterInPackage(sessionFileName, []byte(tt.sessionSrc), "GonsoleSession"); err != nil {
+				t.Fatalf("RegisterInPackage() returned an error: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.expected, sut.Decls); diff != "" {
+				t.Errorf("RegisterInPackage() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestRegistry_IsRegisteredDecl(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -293,3 +443,214 @@ func TestRegistry_IsRegisteredDecl(t *testing.T) {
 		})
 	}
 }
+
+func TestRegistry_Unregister(t *testing.T) {
+	tests := []struct {
+		name          string
+		existingDecls []Decl
+		removeName    string
+		expectedDecls []Decl
+	}{
+		{
+			name: "remove registered declaration",
+			existingDecls: []Decl{
+				{Name: "var1", TypeName: "int"},
+				{Name: "struct1", TypeName: "Struct", TypePkgName: "declregistry"},
+			},
+			removeName: "var1",
+			expectedDecls: []Decl{
+				{Name: "struct1", TypeName: "Struct", TypePkgName: "declregistry"},
+			},
+		},
+		{
+			name: "remove every declaration with the same name",
+			existingDecls: []Decl{
+				{Name: "var1", TypeName: "int"},
+				{Name: "var1", TypeName: "int"},
+			},
+			removeName:    "var1",
+			expectedDecls: []Decl{},
+		},
+		{
+			name: "unknown name is ignored",
+			existingDecls: []Decl{
+				{Name: "var1", TypeName: "int"},
+			},
+			removeName: "unknown",
+			expectedDecls: []Decl{
+				{Name: "var1", TypeName: "int"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dr := &DeclRegistry{
+				Decls: tt.existingDecls,
+			}
+
+			dr.Unregister(types.DeclName(tt.removeName))
+
+			if diff := cmp.Diff(tt.expectedDecls, dr.Decls); diff != "" {
+				t.Errorf("Unregister(%s) mismatch (-want +got):\n%s", tt.removeName, diff)
+			}
+		})
+	}
+}
+
+func TestRegistry_Shadow(t *testing.T) {
+	dr := &DeclRegistry{
+		Decls: []Decl{
+			{Name: "x", TypeName: "int", TypeExpr: "int"},
+			{Name: "y", TypeName: "string", TypeExpr: "string"},
+		},
+	}
+
+	dr.Shadow("x", "gonsoleShadowed1_x")
+	expectedShadowed := []Decl{
+		{Name: "gonsoleShadowed1_x", TypeName: "int", TypeExpr: "int", Shadowed: true},
+		{Name: "y", TypeName: "string", TypeExpr: "string"},
+	}
+	if diff := cmp.Diff(expectedShadowed, dr.Decls); diff != "" {
+		t.Errorf("Shadow() mismatch (-want +got):\n%s", diff)
+	}
+
+	dr.Unshadow("gonsoleShadowed1_x", "x")
+	expectedUnshadowed := []Decl{
+		{Name: "x", TypeName: "int", TypeExpr: "int"},
+		{Name: "y", TypeName: "string", TypeExpr: "string"},
+	}
+	if diff := cmp.Diff(expectedUnshadowed, dr.Decls); diff != "" {
+		t.Errorf("Unshadow() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRegistry_Reset(t *testing.T) {
+	dr := &DeclRegistry{
+		Decls:         []Decl{{Name: "x", TypeName: "int", TypeExpr: "int"}},
+		TopLevelDecls: []TopLevelDecl{{Name: "helper"}},
+		Imports:       []Import{{Name: "mrand", PkgName: "rand", ImportPath: `"math/rand"`}},
+		ResultTypes:   []types.TypeName{"int"},
+	}
+
+	dr.Reset()
+	if diff := cmp.Diff(NewRegistry(), dr); diff != "" {
+		t.Errorf("Reset() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDeclRegistry_RegisterTopLevelDecls(t *testing.T) {
+	tests := []struct {
+		name                string
+		existingTmpFileName string
+		existingTopLevel    []TopLevelDecl
+		expected            []TopLevelDecl
+	}{
+		{
+			name:                "functions, methods and types declared in session",
+			existingTmpFileName: "./testdata/top_level_decls/00000_gonsole_tmp.go",
+			expected: []TopLevelDecl{
+				{Name: "Counter", PkgName: "main", PkgPath: `"command-line-arguments"`},
+				{Name: "Inc", PkgName: "main", PkgPath: `"command-line-arguments"`, ReceiverTypeName: "Counter"},
+				{Name: "Celsius", PkgName: "main", PkgPath: `"command-line-arguments"`},
+				{Name: "Greeter", PkgName: "main", PkgPath: `"command-line-arguments"`},
+				{Name: "double", PkgName: "main", PkgPath: `"command-line-arguments"`},
+			},
+		},
+		{
+			name:                "previously registered declarations are replaced",
+			existingTmpFileName: "./testdata/selector_expression_assignment/00000_gonsole_tmp.go",
+			existingTopLevel: []TopLevelDecl{
+				{Name: "removed", PkgName: "main", PkgPath: `"command-line-arguments"`},
+			},
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sut := NewRegistry()
+			sut.TopLevelDecls = tt.existingTopLevel
+
+			if err := sut.RegisterTopLevelDecls(tt.existingTmpFileName); err != nil {
+				t.Fatalf("RegisterTopLevelDecls() returned an error: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.expected, sut.TopLevelDecls, cmpopts.IgnoreFields(TopLevelDecl{}, "Obj", "Node")); diff != "" {
+				t.Errorf("RegisterTopLevelDecls() mismatch (-want +got):\n%s", diff)
+			}
+			for _, topLevelDecl := range sut.TopLevelDecls {
+				if topLevelDecl.Obj == nil || topLevelDecl.Obj.Name() != string(topLevelDecl.Name) {
+					t.Errorf("object of %s is not set", topLevelDecl.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestDeclRegistry_RegisterAll(t *testing.T) {
+	sampleImportPath := types.ImportPath(`"github.com/kakkky/gonsole/declregistry/testdata/method_assignment/sample"`)
+	tests := []struct {
+		name                string
+		existingTmpFileName string
+		existingDecls       []Decl
+		expectedDecls       []Decl
+		expectedTopLevel    []TopLevelDecl
+	}{
+		{
+			name:                "every statement is registered again",
+			existingTmpFileName: "./testdata/method_assignment/00000_gonsole_tmp.go",
+			existingDecls: []Decl{
+				{Name: "a", TypeName: "Old", TypePkgName: "sample"},
+				{Name: "removed", TypeName: "int", TypeExpr: "int"},
+			},
+			expectedDecls: []Decl{
+				{Name: "a", TypeName: "Struct", TypePkgName: "sample", TypePkgPath: sampleImportPath, TypeExpr: "sample.Struct", TypeImportPaths: []types.ImportPath{sampleImportPath}},
+				{Name: "b", TypeName: "Struct", TypePkgName: "sample", TypePkgPath: sampleImportPath, TypeExpr: "sample.Struct", TypeImportPaths: []types.ImportPath{sampleImportPath}},
+			},
+		},
+		{
+			name:                "shadowed variable stays shadowed",
+			existingTmpFileName: "./testdata/method_assignment/00000_gonsole_tmp.go",
+			existingDecls: []Decl{
+				{Name: "a", TypeName: "Struct", TypePkgName: "sample", Shadowed: true},
+			},
+			expectedDecls: []Decl{
+				{Name: "a", TypeName: "Struct", TypePkgName: "sample", TypePkgPath: sampleImportPath, TypeExpr: "sample.Struct", TypeImportPaths: []types.ImportPath{sampleImportPath}, Shadowed: true},
+				{Name: "b", TypeName: "Struct", TypePkgName: "sample", TypePkgPath: sampleImportPath, TypeExpr: "sample.Struct", TypeImportPaths: []types.ImportPath{sampleImportPath}},
+			},
+		},
+		{
+			name:                "top level declarations are registered again",
+			existingTmpFileName: "./testdata/top_level_decls/00000_gonsole_tmp.go",
+			expectedDecls: []Decl{
+				{Name: "c", TypeName: "Counter", TypePkgName: "main", TypePkgPath: `"command-line-arguments"`, TypeExpr: "Counter", MutatingMethods: []string{"Inc"}},
+			},
+			expectedTopLevel: []TopLevelDecl{
+				{Name: "Counter", PkgName: "main", PkgPath: `"command-line-arguments"`},
+				{Name: "Inc", PkgName: "main", PkgPath: `"command-line-arguments"`, ReceiverTypeName: "Counter"},
+				{Name: "Celsius", PkgName: "main", PkgPath: `"command-line-arguments"`},
+				{Name: "Greeter", PkgName: "main", PkgPath: `"command-line-arguments"`},
+				{Name: "double", PkgName: "main", PkgPath: `"command-line-arguments"`},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sut := NewRegistry()
+			sut.Decls = tt.existingDecls
+
+			if err := sut.RegisterAll(tt.existingTmpFileName); err != nil {
+				t.Fatalf("RegisterAll() returned an error: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.expectedDecls, sut.Decls); diff != "" {
+				t.Errorf("registered declarations mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.expectedTopLevel, sut.TopLevelDecls, cmpopts.IgnoreFields(TopLevelDecl{}, "Obj", "Node")); diff != "" {
+				t.Errorf("registered top level declarations mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
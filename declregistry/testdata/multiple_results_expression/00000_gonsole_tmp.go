@@ -0,0 +1,10 @@
+package main
+
+import "github.com/kakkky/gonsole/declregistry/testdata/multiple_results_expression/sample"
+
+func main() {
+	it := gonsoleDisplay(sample.Load("a"))
+	_ = it
+}
+
+func gonsoleDisplay[T any](first T, rest ...interface{}) T { return first }
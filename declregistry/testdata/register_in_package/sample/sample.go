@@ -0,0 +1,9 @@
+package sample
+
+type dog struct {
+	name string
+}
+
+func newDog() *dog {
+	return &dog{name: "pochi"}
+}
@@ -0,0 +1,10 @@
+package main
+
+import "github.com/kakkky/gonsole/declregistry/testdata/single_result_expression/sample"
+
+func main() {
+	it := gonsoleDisplay(sample.New())
+	_ = it
+}
+
+func gonsoleDisplay[T any](first T, rest ...interface{}) T { return first }
@@ -0,0 +1,11 @@
+package sample
+
+type Struct struct{}
+
+func New() *Struct {
+	return &Struct{}
+}
+
+func Load(name string) (*Struct, error) {
+	return &Struct{}, nil
+}
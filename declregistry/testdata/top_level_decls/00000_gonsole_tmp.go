@@ -0,0 +1,26 @@
+package main
+
+type Counter struct {
+	Value int
+}
+
+func (c *Counter) Inc() int {
+	c.Value++
+	return c.Value
+}
+
+type (
+	Celsius float64
+	Greeter interface {
+		Greet() string
+	}
+)
+
+func double(n int) int {
+	return n * 2
+}
+
+func main() {
+	c := Counter{}
+	_ = c
+}
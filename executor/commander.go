@@ -1,21 +1,114 @@
 package executor
 
-import "os/exec"
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"time"
+
+	"github.com/kakkky/gonsole/errs"
+)
 
 //go:generate mockgen -package=executor -source=./commander.go -destination=./commander_mock.go
 type commander interface {
-	execGoRun(targetFile string) (cmdOut []byte, err error)
-	execGoListAll() (cmdOut []byte, err error)
+	execGoRun(ctx context.Context, timeout time.Duration, targetFile string, stdout io.Writer, stderr io.Writer) error
+	execGoRunWithOverlay(ctx context.Context, timeout time.Duration, targetFile string, overlayFile string, stdout io.Writer, stderr io.Writer) error
+	execGoBuild(targetFile string, outFile string) error
+	execGoBuildPlugin(ctx context.Context, targetFile string, outFile string) error
+	execGoListPkgName(importPath string) (cmdOut []byte, err error)
+	execGoListExport(importPaths []string) (cmdOut []byte, err error)
 }
 
+// cancelWaitDelay は実行を中断した後に、終了させたプログラムの出力が閉じられるのを待つ時間
+// プログラムが起動した別のプロセスが出力を開いたままでも、この時間が過ぎれば待つのをやめる
+const cancelWaitDelay = time.Second
+
 type defaultCommander struct{}
 
 func newDefaultCommander() *defaultCommander {
 	return &defaultCommander{}
 }
 
-func (dc *defaultCommander) execGoRun(targetFile string) (cmdOut []byte, err error) {
-	cmd := exec.Command("go", "run", targetFile)
+func (dc *defaultCommander) execGoRun(ctx context.Context, timeout time.Duration, targetFile string, stdout io.Writer, stderr io.Writer) error {
+	return dc.buildAndRun(ctx, timeout, []string{targetFile}, stdout, stderr)
+}
+
+func (dc *defaultCommander) execGoRunWithOverlay(ctx context.Context, timeout time.Duration, targetFile string, overlayFile string, stdout io.Writer, stderr io.Writer) error {
+	return dc.buildAndRun(ctx, timeout, []string{"-overlay=" + overlayFile, targetFile}, stdout, stderr)
+}
+
+// buildAndRun はプログラムをビルドしてから実行し、実行中の出力をstdoutとstderrに書き込む
+// コンパイルエラーをプログラム自体のエラー出力と区別できるように、`go run`ではなくビルドと実行を分ける
+// ビルドはctxが終了すると中断し、プログラムはそれに加えて実行を始めてからtimeoutを過ぎると終了させる
+func (dc *defaultCommander) buildAndRun(ctx context.Context, timeout time.Duration, buildArgs []string, stdout io.Writer, stderr io.Writer) error {
+	dir, err := os.MkdirTemp("", "gonsole-run-")
+	if err != nil {
+		return errs.NewInternalError("failed to create build directory").Wrap(err)
+	}
+	defer os.RemoveAll(dir)
+	binFile := filepath.Join(dir, "gonsole_session")
+	if runtime.GOOS == "windows" {
+		binFile += ".exe"
+	}
+
+	buildCmd := newCancelableCommand(ctx, "go", slices.Concat([]string{"build", "-o", binFile}, buildArgs)...)
+	if _, err := buildCmd.Output(); err != nil {
+		return err
+	}
+
+	runCtx, cancel := withRunTimeout(ctx, timeout)
+	defer cancel()
+	runCmd := newCancelableCommand(runCtx, binFile)
+	runCmd.Stdout = stdout
+	runCmd.Stderr = stderr
+	if err := runCmd.Run(); err != nil {
+		if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+			return runCtx.Err()
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return &programExitError{exitErr: exitErr}
+		}
+		return err
+	}
+	return nil
+}
+
+// programExitError はプログラムが正常に終了しなかったことを表す
+// エラー出力（パニックのスタックトレースなど）は実行中に書き出しているので、終了した状態だけを伝える
+type programExitError struct {
+	exitErr *exec.ExitError
+}
+
+func (e *programExitError) Error() string {
+	return "program exited with " + e.exitErr.Error()
+}
+
+func (dc *defaultCommander) execGoBuild(targetFile string, outFile string) error {
+	cmd := exec.Command("go", "build", "-o", outFile, targetFile)
+	if _, cmdErr := cmd.Output(); cmdErr != nil {
+		return cmdErr
+	}
+	return nil
+}
+
+// execGoBuildPlugin はファイルをプラグインとしてビルドする
+// 入力のたびにリンクし直すので、シンボル表とデバッグ情報を省いてリンクにかかる時間を減らす（パニックのスタックトレースは表示できる）
+func (dc *defaultCommander) execGoBuildPlugin(ctx context.Context, targetFile string, outFile string) error {
+	cmd := newCancelableCommand(ctx, "go", "build", "-buildmode=plugin", "-ldflags=-s -w", "-o", outFile, targetFile)
+	if _, cmdErr := cmd.Output(); cmdErr != nil {
+		return cmdErr
+	}
+	return nil
+}
+
+func (dc *defaultCommander) execGoListPkgName(importPath string) (cmdOut []byte, err error) {
+	cmd := exec.Command("go", "list", "-f", "{{.Name}}", importPath)
 	cmdOut, cmdErr := cmd.Output()
 	if cmdErr != nil {
 		return nil, cmdErr
@@ -23,11 +116,31 @@ func (dc *defaultCommander) execGoRun(targetFile string) (cmdOut []byte, err err
 	return cmdOut, nil
 }
 
-func (dc *defaultCommander) execGoListAll() (cmdOut []byte, err error) {
-	cmd := exec.Command("go", "list", "./...")
+// execGoListExport はパッケージをコンパイルし、importパスとエクスポートデータのファイルをタブで区切って1行ずつ出力する
+func (dc *defaultCommander) execGoListExport(importPaths []string) (cmdOut []byte, err error) {
+	cmd := exec.Command("go", slices.Concat([]string{"list", "-export", "-f", "{{.ImportPath}}\t{{.Export}}"}, importPaths)...)
 	cmdOut, cmdErr := cmd.Output()
 	if cmdErr != nil {
 		return nil, cmdErr
 	}
 	return cmdOut, nil
 }
+
+// newCancelableCommand はctxが終了した時に、コマンドが起動したプロセスごと終了させるコマンドを生成する
+func newCancelableCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return killProcessGroup(cmd)
+	}
+	cmd.WaitDelay = cancelWaitDelay
+	return cmd
+}
+
+// withRunTimeout はプログラムの実行にかけられる時間を制限したcontextを生成する。timeoutが0の場合は制限しない
+func withRunTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -9,7 +9,10 @@
 package executor
 
 import (
+	context "context"
+	io "io"
 	reflect "reflect"
+	time "time"
 
 	gomock "go.uber.org/mock/gomock"
 )
@@ -37,32 +40,88 @@ func (m *Mockcommander) EXPECT() *MockcommanderMockRecorder {
 	return m.recorder
 }
 
-// execGoListAll mocks base method.
-func (m *Mockcommander) execGoListAll() ([]byte, error) {
+// execGoBuild mocks base method.
+func (m *Mockcommander) execGoBuild(targetFile, outFile string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "execGoListAll")
+	ret := m.ctrl.Call(m, "execGoBuild", targetFile, outFile)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// execGoBuild indicates an expected call of execGoBuild.
+func (mr *MockcommanderMockRecorder) execGoBuild(targetFile, outFile any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "execGoBuild", reflect.TypeOf((*Mockcommander)(nil).execGoBuild), targetFile, outFile)
+}
+
+// execGoBuildPlugin mocks base method.
+func (m *Mockcommander) execGoBuildPlugin(ctx context.Context, targetFile, outFile string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "execGoBuildPlugin", ctx, targetFile, outFile)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// execGoBuildPlugin indicates an expected call of execGoBuildPlugin.
+func (mr *MockcommanderMockRecorder) execGoBuildPlugin(ctx, targetFile, outFile any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "execGoBuildPlugin", reflect.TypeOf((*Mockcommander)(nil).execGoBuildPlugin), ctx, targetFile, outFile)
+}
+
+// execGoListExport mocks base method.
+func (m *Mockcommander) execGoListExport(importPaths []string) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "execGoListExport", importPaths)
 	ret0, _ := ret[0].([]byte)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// execGoListAll indicates an expected call of execGoListAll.
-func (mr *MockcommanderMockRecorder) execGoListAll() *gomock.Call {
+// execGoListExport indicates an expected call of execGoListExport.
+func (mr *MockcommanderMockRecorder) execGoListExport(importPaths any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "execGoListAll", reflect.TypeOf((*Mockcommander)(nil).execGoListAll))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "execGoListExport", reflect.TypeOf((*Mockcommander)(nil).execGoListExport), importPaths)
 }
 
-// execGoRun mocks base method.
-func (m *Mockcommander) execGoRun(targetFile string) ([]byte, error) {
+// execGoListPkgName mocks base method.
+func (m *Mockcommander) execGoListPkgName(importPath string) ([]byte, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "execGoRun", targetFile)
+	ret := m.ctrl.Call(m, "execGoListPkgName", importPath)
 	ret0, _ := ret[0].([]byte)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
+// execGoListPkgName indicates an expected call of execGoListPkgName.
+func (mr *MockcommanderMockRecorder) execGoListPkgName(importPath any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "execGoListPkgName", reflect.TypeOf((*Mockcommander)(nil).execGoListPkgName), importPath)
+}
+
+// execGoRun mocks base method.
+func (m *Mockcommander) execGoRun(ctx context.Context, timeout time.Duration, targetFile string, stdout, stderr io.Writer) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "execGoRun", ctx, timeout, targetFile, stdout, stderr)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
 // execGoRun indicates an expected call of execGoRun.
-func (mr *MockcommanderMockRecorder) execGoRun(targetFile any) *gomock.Call {
+func (mr *MockcommanderMockRecorder) execGoRun(ctx, timeout, targetFile, stdout, stderr any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "execGoRun", reflect.TypeOf((*Mockcommander)(nil).execGoRun), ctx, timeout, targetFile, stdout, stderr)
+}
+
+// execGoRunWithOverlay mocks base method.
+func (m *Mockcommander) execGoRunWithOverlay(ctx context.Context, timeout time.Duration, targetFile, overlayFile string, stdout, stderr io.Writer) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "execGoRunWithOverlay", ctx, timeout, targetFile, overlayFile, stdout, stderr)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// execGoRunWithOverlay indicates an expected call of execGoRunWithOverlay.
+func (mr *MockcommanderMockRecorder) execGoRunWithOverlay(ctx, timeout, targetFile, overlayFile, stdout, stderr any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "execGoRun", reflect.TypeOf((*Mockcommander)(nil).execGoRun), targetFile)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "execGoRunWithOverlay", reflect.TypeOf((*Mockcommander)(nil).execGoRunWithOverlay), ctx, timeout, targetFile, overlayFile, stdout, stderr)
 }
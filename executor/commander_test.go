@@ -0,0 +1,89 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDefaultCommander_execGoRun(t *testing.T) {
+	tests := []struct {
+		name           string
+		src            string
+		timeout        time.Duration
+		expectedStdout string
+		expectedErr    error
+	}{
+		{
+			name: "program finishes within the timeout",
+			src: `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("hello")
+}
+`,
+			timeout:        time.Minute,
+			expectedStdout: "hello\n",
+		},
+		{
+			name: "program without timeout",
+			src: `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("hello")
+}
+`,
+			expectedStdout: "hello\n",
+		},
+		{
+			name: "program exceeding the timeout is killed",
+			src: `package main
+
+import (
+	"fmt"
+	"time"
+)
+
+func main() {
+	fmt.Println("started")
+	time.Sleep(time.Minute)
+}
+`,
+			timeout:        500 * time.Millisecond,
+			expectedStdout: "started\n",
+			expectedErr:    context.DeadlineExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srcFile := filepath.Join(t.TempDir(), "main.go")
+			if err := os.WriteFile(srcFile, []byte(tt.src), 0o644); err != nil {
+				t.Fatalf("failed to write source: %v", err)
+			}
+
+			var stdout, stderr bytes.Buffer
+			sut := newDefaultCommander()
+			err := sut.execGoRun(context.Background(), tt.timeout, srcFile, &stdout, &stderr)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Errorf("execGoRun() error = %v, want %v", err, tt.expectedErr)
+				}
+			} else if err != nil {
+				t.Fatalf("execGoRun() returned an error: %v\n%s", err, stderr.String())
+			}
+			if diff := cmp.Diff(tt.expectedStdout, stdout.String()); diff != "" {
+				t.Errorf("stdout mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
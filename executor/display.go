@@ -0,0 +1,283 @@
+package executor
+
+import (
+	"bytes"
+	// go:embedディレクティブ用
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/kakkky/gonsole/declregistry"
+	"github.com/kakkky/gonsole/errs"
+	"github.com/kakkky/gonsole/types"
+)
+
+//go:embed display_runtime.go.txt
+var displayRuntimeSrc []byte
+
+// displayFuncName は式の評価結果を表示するランタイムの関数名
+const displayFuncName = declregistry.DisplayFuncName
+
+// displayResultMarker はプログラム自体の出力と、式の評価結果を標準出力上で区切る
+// display_runtime.go.txtのgonsoleDisplayResultMarkerと一致させる必要がある
+const displayResultMarker = "\x00gonsole-result\x00"
+
+// DisplayFormat は式の評価結果の表示形式を表す
+type DisplayFormat string
+
+const (
+	// DisplayFormatGo は型名とフィールド名を付けて、入れ子の構造をインデントしたGoの構文に近い形式で表示する
+	DisplayFormatGo DisplayFormat = "go"
+	// DisplayFormatJSON はjsonタグに従って、インデントしたJSONで表示する
+	DisplayFormatJSON DisplayFormat = "json"
+	// DisplayFormatCompact はフィールド名を付けて1行で表示し、型から分かる入れ子の値の型名を省略する
+	DisplayFormatCompact DisplayFormat = "compact"
+)
+
+// ParseDisplayFormat は文字列をDisplayFormatに変換する
+func ParseDisplayFormat(format string) (DisplayFormat, error) {
+	switch DisplayFormat(format) {
+	case DisplayFormatGo, DisplayFormatJSON, DisplayFormatCompact:
+		return DisplayFormat(format), nil
+	}
+	return "", errs.NewBadInputError(fmt.Sprintf("unknown display format %q (available: %s, %s, %s)", format, DisplayFormatGo, DisplayFormatJSON, DisplayFormatCompact))
+}
+
+// DisplayFormat は式の評価結果の表示形式を返す
+func (e *Executor) DisplayFormat() DisplayFormat {
+	return e.displayFormat
+}
+
+// SetDisplayFormat は式の評価結果の表示形式を変更する。次に評価する式から反映される
+func (e *Executor) SetDisplayFormat(format DisplayFormat) {
+	e.displayFormat = format
+}
+
+// newDisplayCall は式の評価結果を表示する`gonsoleDisplay(expr)`の形の呼び出しを生成する
+func newDisplayCall(expr ast.Expr) *ast.CallExpr {
+	return &ast.CallExpr{
+		Fun:  ast.NewIdent(displayFuncName),
+		Args: []ast.Expr{expr},
+	}
+}
+
+// displayedExprOf は式が評価結果を表示する呼び出しであれば、表示する式を返す
+func displayedExprOf(expr ast.Expr) (ast.Expr, bool) {
+	callExpr, ok := expr.(*ast.CallExpr)
+	if !ok || len(callExpr.Args) != 1 {
+		return nil, false
+	}
+	ident, ok := callExpr.Fun.(*ast.Ident)
+	if !ok || ident.Name != displayFuncName {
+		return nil, false
+	}
+	return callExpr.Args[0], true
+}
+
+// endsWithDisplayStmt はセッションの最後の入力が、式の評価結果を表示する文かを返す
+func (e *Executor) endsWithDisplayStmt() bool {
+	_, ok := e.lastResultBinding()
+	return ok
+}
+
+// addDisplayRuntime は式の評価結果を表示するランタイムを、実行するソースに追加する
+// 実行するソースがsessionSrcそのものの場合は、sessionSrcを書き換えないように複製してから追加する
+func (e *Executor) addDisplayRuntime(runSrc *ast.File) (*ast.File, error) {
+	if runSrc == e.sessionSrc {
+		cloned, err := cloneFile(runSrc)
+		if err != nil {
+			return nil, err
+		}
+		runSrc = cloned
+	}
+	if err := addRuntime(runSrc, "display", displayRuntimeSrc, map[string]string{
+		"gonsoleDisplayFormat": string(e.displayFormat),
+	}); err != nil {
+		return nil, err
+	}
+	return runSrc, nil
+}
+
+// displayStubSrc は変数の登録に使う、表示のランタイムの関数のシグネチャだけを持つスタブ
+// 登録では評価結果の型が分かればよいので、ランタイムがimportするパッケージまで型検査しないようにする
+const displayStubSrc = `package main
+
+func gonsoleDisplay[T any](first T, rest ...interface{}) T {
+	return first
+}
+`
+
+// addDisplayStub はsessionSrcを書き換えずに、表示のランタイムのスタブを追加したソースを返す
+func (e *Executor) addDisplayStub(sessionSrc *ast.File) (*ast.File, error) {
+	registerSrc, err := cloneFile(sessionSrc)
+	if err != nil {
+		return nil, err
+	}
+	if err := addRuntime(registerSrc, "display stub", []byte(displayStubSrc), nil); err != nil {
+		return nil, err
+	}
+	return registerSrc, nil
+}
+
+// displayResult はランタイムから受け取る、式の評価結果の1つの値
+type displayResult struct {
+	// Type は値の動的な型で、nilのインターフェースでは空になる
+	Type  string        `json:"type,omitempty"`
+	Value string        `json:"value"`
+	Error *displayError `json:"error,omitempty"`
+}
+
+// displayError はnilではないerrorの値の詳細
+type displayError struct {
+	// Chain はerrors.Unwrapでたどったエラーの連鎖で、先頭は値そのもの
+	Chain []displayErrorLink `json:"chain"`
+	// Detail は%+vで書式化した結果で、スタックトレースなどError()にない情報を含む場合だけ設定される
+	Detail string `json:"detail,omitempty"`
+}
+
+type displayErrorLink struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// displayResultWriter はプログラムの標準出力を書き出しながら、式の評価結果を取り分ける
+// 評価結果の後に書かれた出力（評価後も動き続けるgoroutineの出力など）も、プログラム自体の出力として書き出す
+type displayResultWriter struct {
+	out io.Writer
+	// pending は区切りの一部かもしれないため、まだ書き出していない出力
+	pending []byte
+	// inResult は区切りの後の、評価結果を読み込んでいる途中かどうか
+	inResult bool
+	result   []byte
+	// rawResults は受け取った評価結果のJSONで、1行に1回の評価結果が書かれる
+	rawResults [][]byte
+}
+
+func newDisplayResultWriter(out io.Writer) *displayResultWriter {
+	return &displayResultWriter{out: out}
+}
+
+func (w *displayResultWriter) Write(p []byte) (int, error) {
+	data := slices.Concat(w.pending, p)
+	w.pending = nil
+	for len(data) > 0 {
+		if w.inResult {
+			idx := bytes.IndexByte(data, '\n')
+			if idx < 0 {
+				w.result = append(w.result, data...)
+				return len(p), nil
+			}
+			w.rawResults = append(w.rawResults, slices.Concat(w.result, data[:idx]))
+			w.result = nil
+			w.inResult = false
+			data = data[idx+1:]
+			continue
+		}
+		out, rest, found := splitAtMarker(data, displayResultMarker)
+		if len(out) > 0 {
+			if _, err := w.out.Write(out); err != nil {
+				return 0, err
+			}
+		}
+		if !found {
+			w.pending = rest
+			return len(p), nil
+		}
+		w.inResult = true
+		data = rest
+	}
+	return len(p), nil
+}
+
+// flush はプログラムの終了後に、区切りの一部と見分けられずに保留していた出力を書き出す
+func (w *displayResultWriter) flush() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	pending := w.pending
+	w.pending = nil
+	_, err := w.out.Write(pending)
+	return err
+}
+
+// displayResults は最後に受け取った式の評価結果を返す
+func (w *displayResultWriter) displayResults() ([]displayResult, error) {
+	if w.inResult {
+		return nil, errs.NewInternalError("failed to decode display results: output ended in the middle of results")
+	}
+	if len(w.rawResults) == 0 {
+		return nil, nil
+	}
+	var results []displayResult
+	if err := json.Unmarshal(w.rawResults[len(w.rawResults)-1], &results); err != nil {
+		return nil, errs.NewInternalError("failed to decode display results").Wrap(err)
+	}
+	return results, nil
+}
+
+const (
+	displayValueColor  = "\033[32m"
+	displayErrorColor  = "\033[31m"
+	displayDetailColor = "\033[90m"
+	displayColorReset  = "\033[0m"
+	displayIndent      = "    "
+)
+
+// formatDisplayResults は式の評価結果を、表示する文字列にする
+// 複数の値は位置と型を付けて1つずつ表示し、nilではないerrorは連鎖と詳細を付けて色を変えて表示する
+// 型は評価した式の型（resultTypes）を使い、分からない場合は値の動的な型を使う
+func formatDisplayResults(results []displayResult, resultTypes []types.TypeName) string {
+	var b strings.Builder
+	for i, result := range results {
+		typ := result.Type
+		if len(resultTypes) == len(results) {
+			typ = string(resultTypes[i])
+		}
+		var label string
+		switch {
+		case len(results) > 1 && typ != "":
+			label = fmt.Sprintf("[%d] %s: ", i, typ)
+		case len(results) > 1:
+			label = fmt.Sprintf("[%d] ", i)
+		case result.Error != nil:
+			label = typ + ": "
+		}
+		if result.Error == nil || len(result.Error.Chain) == 0 {
+			b.WriteString(displayValueColor + label + result.Value + displayColorReset + "\n")
+			continue
+		}
+		b.WriteString(formatDisplayError(label, result.Error))
+	}
+	return b.String()
+}
+
+// formatDisplayError はnilではないerrorの値を、errors.Unwrapでたどった連鎖と%+vの詳細を付けて表示する文字列にする
+func formatDisplayError(label string, displayErr *displayError) string {
+	var b strings.Builder
+	b.WriteString(displayErrorColor + label + displayErr.Chain[0].Message + displayColorReset + "\n")
+	for i, link := range displayErr.Chain {
+		prefix := displayIndent
+		if i > 0 {
+			prefix += "↳ "
+		}
+		b.WriteString(displayErrorColor + indentLines(prefix+link.Type+": "+link.Message, displayIndent) + displayColorReset + "\n")
+	}
+	if displayErr.Detail != "" {
+		b.WriteString(displayDetailColor + indentLines(displayIndent+strings.TrimSuffix(displayErr.Detail, "\n"), displayIndent) + displayColorReset + "\n")
+	}
+	return b.String()
+}
+
+// indentLines は2行目以降をインデントする
+func indentLines(text string, indent string) string {
+	return strings.ReplaceAll(text, "\n", "\n"+indent)
+}
+
+// printDisplayResults は式の評価結果を表示する
+func printDisplayResults(results []displayResult, resultTypes []types.TypeName) {
+	fmt.Printf("\n%s\n", formatDisplayResults(results, resultTypes))
+}
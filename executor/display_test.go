@@ -0,0 +1,552 @@
+package executor
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/kakkky/gonsole/types"
+)
+
+func TestParseDisplayFormat(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    string
+		expected  DisplayFormat
+		expectErr bool
+	}{
+		{name: "go", format: "go", expected: DisplayFormatGo},
+		{name: "json", format: "json", expected: DisplayFormatJSON},
+		{name: "compact", format: "compact", expected: DisplayFormatCompact},
+		{name: "unknown format", format: "yaml", expectErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDisplayFormat(tt.format)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ParseDisplayFormat() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if got != tt.expected {
+				t.Errorf("ParseDisplayFormat() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExecutor_addDisplayRuntime(t *testing.T) {
+	sessionSrc, err := parser.ParseFile(token.NewFileSet(), "", `package main
+
+import "example.com/animal"
+
+func main() {
+	it := gonsoleDisplay(animal.NewDog("Pochi", 3))
+	_ = it
+}
+`, 0)
+	if err != nil {
+		t.Fatalf("failed to parse session source: %v", err)
+	}
+	sut := &Executor{sessionSrc: sessionSrc, displayFormat: DisplayFormatJSON}
+
+	got, err := sut.addDisplayRuntime(sut.sessionSrc)
+	if err != nil {
+		t.Fatalf("addDisplayRuntime() returned an error: %v", err)
+	}
+
+	// sessionSrcには実行後も残るので、ランタイムを追加しない
+	if got == sut.sessionSrc || len(sut.sessionSrc.Decls) != 2 {
+		t.Errorf("addDisplayRuntime() modified sessionSrc")
+	}
+	var gotSrc bytes.Buffer
+	if err := format.Node(&gotSrc, token.NewFileSet(), got); err != nil {
+		t.Fatalf("failed to format generated source: %v", err)
+	}
+	for _, expected := range []string{`const gonsoleDisplayFormat = "json"`, "func gonsoleDisplay[T any](first T, rest ...interface{}) T", `gonsolereflect "reflect"`} {
+		if !strings.Contains(gotSrc.String(), expected) {
+			t.Errorf("generated source does not contain %q:\n%s", expected, gotSrc.String())
+		}
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "", gotSrc.Bytes(), 0); err != nil {
+		t.Errorf("generated source is invalid: %v\n%s", err, gotSrc.String())
+	}
+}
+
+func TestDisplayRuntime(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test that runs go run in short mode")
+	}
+
+	// 表示する値の型は、セッションで宣言した型と同じくmainパッケージで宣言する
+	const decls = `
+type BaseAnimal struct {
+	Name string
+	Age  int
+}
+
+type Dog struct {
+	BaseAnimal
+	Breed string
+	owner *Person
+}
+
+type Person struct {
+	Name string ` + "`json:\"name\"`" + `
+	Email string ` + "`json:\"email,omitempty\"`" + `
+	Tags []string ` + "`json:\"-\"`" + `
+}
+
+type Node struct {
+	Name string
+	Next *Node
+}
+
+func newCycle() *Node {
+	n := &Node{Name: "a"}
+	n.Next = n
+	return n
+}
+`
+	tests := []struct {
+		name     string
+		expr     string
+		format   DisplayFormat
+		expected string
+	}{
+		{
+			name:   "struct pointer in go format",
+			expr:   `&Dog{BaseAnimal: BaseAnimal{Name: "Pochi", Age: 3}, Breed: "Shiba"}`,
+			format: DisplayFormatGo,
+			expected: `&Dog{
+  BaseAnimal: BaseAnimal{
+    Name: "Pochi",
+    Age: 3,
+  },
+  Breed: "Shiba",
+  owner: (*Person)(nil),
+}`,
+		},
+		{
+			name:     "struct pointer in compact format",
+			expr:     `&Dog{BaseAnimal: BaseAnimal{Name: "Pochi", Age: 3}, Breed: "Shiba"}`,
+			format:   DisplayFormatCompact,
+			expected: `&Dog{BaseAnimal: {Name: "Pochi", Age: 3}, Breed: "Shiba", owner: nil}`,
+		},
+		{
+			name:   "struct pointer in json format",
+			expr:   `&Dog{BaseAnimal: BaseAnimal{Name: "Pochi", Age: 3}, Breed: "Shiba"}`,
+			format: DisplayFormatJSON,
+			expected: `{
+  "Name": "Pochi",
+  "Age": 3,
+  "Breed": "Shiba"
+}`,
+		},
+		{
+			name:   "json tags",
+			expr:   `[]Person{{Name: "Taro", Tags: []string{"admin"}}}`,
+			format: DisplayFormatJSON,
+			expected: `[
+  {
+    "name": "Taro"
+  }
+]`,
+		},
+		{
+			name:     "slice of basic values in one line",
+			expr:     `[]int{1, 2, 3}`,
+			format:   DisplayFormatGo,
+			expected: `[]int{1, 2, 3}`,
+		},
+		{
+			name:     "long slice is truncated",
+			expr:     `make([]int, 105)`,
+			format:   DisplayFormatGo,
+			expected: "[]int{" + strings.Repeat("0, ", 100) + "... (5 more)}",
+		},
+		{
+			name:   "map keys are sorted",
+			expr:   `map[string]int{"b": 2, "a": 1, "c": 3}`,
+			format: DisplayFormatGo,
+			expected: `map[string]int{
+  "a": 1,
+  "b": 2,
+  "c": 3,
+}`,
+		},
+		{
+			name:   "cycle is detected",
+			expr:   `newCycle()`,
+			format: DisplayFormatGo,
+			expected: `&Node{
+  Name: "a",
+  Next: <cycle *Node>,
+}`,
+		},
+		{
+			name:     "stringer",
+			expr:     `3 * time.Second`,
+			format:   DisplayFormatGo,
+			expected: `time.Duration(3s)`,
+		},
+		{
+			name:     "nil error",
+			expr:     `error(nil)`,
+			format:   DisplayFormatGo,
+			expected: `nil`,
+		},
+	}
+
+	var main strings.Builder
+	main.WriteString("package main\n\nimport \"time\"\n\nvar _ = time.Second\n" + decls + "\nfunc main() {\n")
+	for _, tt := range tests {
+		main.WriteString("\tgonsoleos.Stdout.WriteString(gonsoleFormatValue(gonsolereflect.ValueOf(" + tt.expr + "), \"" + string(tt.format) + "\") + \"\\n" + displayTestSep + "\\n\")\n")
+	}
+	main.WriteString("}\n")
+	got := runWithDisplayRuntime(t, main.String())
+
+	outputs := strings.Split(strings.TrimSuffix(got, "\n"+displayTestSep+"\n"), "\n"+displayTestSep+"\n")
+	if len(outputs) != len(tests) {
+		t.Fatalf("unexpected output:\n%s", got)
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.expected, outputs[i]); diff != "" {
+				t.Errorf("display mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDisplayRuntime_results(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test that runs go run in short mode")
+	}
+
+	// %+vでスタックトレースのような詳細を書き出すエラー
+	const decls = `
+type stackError struct {
+	msg string
+}
+
+func (e *stackError) Error() string {
+	return e.msg
+}
+
+func (e *stackError) Format(s fmt.State, verb rune) {
+	io.WriteString(s, e.msg)
+	if s.Flag('+') {
+		io.WriteString(s, "\nmain.load\n\t/app/main.go:10")
+	}
+}
+`
+	got := runWithDisplayRuntime(t, `package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+`+decls+`
+func main() {
+	fmt.Println("loading")
+	gonsoleDisplay(strconv.Atoi("42"))
+	gonsoleDisplay(fmt.Errorf("load config: %w", os.ErrNotExist))
+	gonsoleDisplay(&stackError{msg: "boom"})
+}
+`)
+
+	var out bytes.Buffer
+	w := newDisplayResultWriter(&out)
+	if _, err := w.Write([]byte(got)); err != nil {
+		t.Fatalf("Write() returned an error: %v", err)
+	}
+	if err := w.flush(); err != nil {
+		t.Fatalf("flush() returned an error: %v", err)
+	}
+	var results [][]displayResult
+	for _, rawResult := range w.rawResults {
+		var chunkResults []displayResult
+		if err := json.Unmarshal(rawResult, &chunkResults); err != nil {
+			t.Fatalf("failed to decode display results: %v", err)
+		}
+		results = append(results, chunkResults)
+	}
+
+	if diff := cmp.Diff("loading\n", out.String()); diff != "" {
+		t.Errorf("program output mismatch (-want +got):\n%s", diff)
+	}
+	expected := [][]displayResult{
+		{
+			{Type: "int", Value: "42"},
+			{Value: "nil"},
+		},
+		{
+			{
+				Type:  "*fmt.wrapError",
+				Value: "*fmt.wrapError(load config: file does not exist)",
+				Error: &displayError{
+					Chain: []displayErrorLink{
+						{Type: "*fmt.wrapError", Message: "load config: file does not exist"},
+						{Type: "*errors.errorString", Message: "file does not exist"},
+					},
+				},
+			},
+		},
+		{
+			{
+				Type:  "*stackError",
+				Value: "*stackError(boom)",
+				Error: &displayError{
+					Chain:  []displayErrorLink{{Type: "*stackError", Message: "boom"}},
+					Detail: "boom\nmain.load\n\t/app/main.go:10",
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(expected, results); diff != "" {
+		t.Errorf("display results mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDisplayResultWriter(t *testing.T) {
+	tests := []struct {
+		name            string
+		chunks          []string
+		expectedOut     string
+		expectedResults []displayResult
+		expectErr       bool
+	}{
+		{
+			name:        "output without results",
+			chunks:      []string{"hello\n"},
+			expectedOut: "hello\n",
+		},
+		{
+			name:            "output and results",
+			chunks:          []string{"hello\n" + displayResultMarker + `[{"type":"int","value":"1"}]` + "\n"},
+			expectedOut:     "hello\n",
+			expectedResults: []displayResult{{Type: "int", Value: "1"}},
+		},
+		{
+			name:            "output after results",
+			chunks:          []string{displayResultMarker + `[{"type":"int","value":"1"}]` + "\nbye\n"},
+			expectedOut:     "bye\n",
+			expectedResults: []displayResult{{Type: "int", Value: "1"}},
+		},
+		{
+			name: "marker and results split across writes",
+			chunks: []string{
+				"hello\n" + displayResultMarker[:3],
+				displayResultMarker[3:] + `[{"type":"int",`,
+				`"value":"1"}]` + "\nbye",
+			},
+			expectedOut:     "hello\nbye",
+			expectedResults: []displayResult{{Type: "int", Value: "1"}},
+		},
+		{
+			name:        "output ending with the start of the marker",
+			chunks:      []string{"hello\n" + displayResultMarker[:3]},
+			expectedOut: "hello\n" + displayResultMarker[:3],
+		},
+		{
+			name:            "only the last results are returned",
+			chunks:          []string{displayResultMarker + `[{"type":"int","value":"1"}]` + "\n" + displayResultMarker + `[{"type":"int","value":"2"}]` + "\n"},
+			expectedResults: []displayResult{{Type: "int", Value: "2"}},
+		},
+		{
+			name:        "broken results",
+			chunks:      []string{"hello\n" + displayResultMarker + `[{"type"`},
+			expectedOut: "hello\n",
+			expectErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			sut := newDisplayResultWriter(&out)
+			for _, chunk := range tt.chunks {
+				n, err := sut.Write([]byte(chunk))
+				if err != nil {
+					t.Fatalf("Write() returned an error: %v", err)
+				}
+				if n != len(chunk) {
+					t.Errorf("Write() = %d, want %d", n, len(chunk))
+				}
+			}
+			if err := sut.flush(); err != nil {
+				t.Fatalf("flush() returned an error: %v", err)
+			}
+			gotResults, err := sut.displayResults()
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("displayResults() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if diff := cmp.Diff(tt.expectedOut, out.String()); diff != "" {
+				t.Errorf("output mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.expectedResults, gotResults); diff != "" {
+				t.Errorf("results mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFormatDisplayResults(t *testing.T) {
+	const (
+		green = displayValueColor
+		red   = displayErrorColor
+		gray  = displayDetailColor
+		reset = displayColorReset
+	)
+	atoiErr := &displayError{
+		Chain: []displayErrorLink{
+			{Type: "*strconv.NumError", Message: `strconv.Atoi: parsing "x": invalid syntax`},
+			{Type: "*errors.errorString", Message: "invalid syntax"},
+		},
+	}
+	tests := []struct {
+		name        string
+		results     []displayResult
+		resultTypes []types.TypeName
+		expected    string
+	}{
+		{
+			name:     "single value",
+			results:  []displayResult{{Type: "int", Value: "42"}},
+			expected: green + "42" + reset + "\n",
+		},
+		{
+			name:        "multiple values are labelled with result types",
+			results:     []displayResult{{Type: "int", Value: "42"}, {Value: "nil"}},
+			resultTypes: []types.TypeName{"int", "error"},
+			expected: green + "[0] int: 42" + reset + "\n" +
+				green + "[1] error: nil" + reset + "\n",
+		},
+		{
+			name:    "multiple values are labelled with dynamic types without result types",
+			results: []displayResult{{Type: "int", Value: "42"}, {Value: "nil"}},
+			expected: green + "[0] int: 42" + reset + "\n" +
+				green + "[1] nil" + reset + "\n",
+		},
+		{
+			name:        "error in multiple values",
+			results:     []displayResult{{Type: "int", Value: "0"}, {Type: "*strconv.NumError", Value: "...", Error: atoiErr}},
+			resultTypes: []types.TypeName{"int", "error"},
+			expected: green + "[0] int: 0" + reset + "\n" +
+				red + `[1] error: strconv.Atoi: parsing "x": invalid syntax` + reset + "\n" +
+				red + `    *strconv.NumError: strconv.Atoi: parsing "x": invalid syntax` + reset + "\n" +
+				red + "    ↳ *errors.errorString: invalid syntax" + reset + "\n",
+		},
+		{
+			name: "single error with detail",
+			results: []displayResult{{Type: "*stackError", Value: "...", Error: &displayError{
+				Chain:  []displayErrorLink{{Type: "*stackError", Message: "boom"}},
+				Detail: "boom\nmain.load\n\t/app/main.go:10\n",
+			}}},
+			resultTypes: []types.TypeName{"error"},
+			expected: red + "error: boom" + reset + "\n" +
+				red + "    *stackError: boom" + reset + "\n" +
+				gray + "    boom\n    main.load\n    \t/app/main.go:10" + reset + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatDisplayResults(tt.results, tt.resultTypes)
+			if diff := cmp.Diff(tt.expected, got); diff != "" {
+				t.Errorf("formatDisplayResults() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+const displayTestSep = "----"
+
+// runWithDisplayRuntime は表示のランタイムを追加したプログラムを実行し、標準出力を返す
+func runWithDisplayRuntime(t *testing.T, src string) string {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "", src, 0)
+	if err != nil {
+		t.Fatalf("failed to parse test program: %v", err)
+	}
+	if err := addRuntime(file, "display", displayRuntimeSrc, nil); err != nil {
+		t.Fatalf("addRuntime() returned an error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, token.NewFileSet(), file); err != nil {
+		t.Fatalf("failed to format test program: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command("go", "run", path).CombinedOutput()
+	if err != nil {
+		t.Fatalf("failed to run test program: %v\n%s", err, out)
+	}
+	return string(out)
+}
+
+// assertDisplayRunSrc は式を評価するために実行するソースの、main関数とセッションのimportを検証する
+// 表示のランタイムがimportするパッケージは、別名で区別して除く
+func assertDisplayRunSrc(t *testing.T, runSrc *ast.File, expectedMainFunc string, expectedImports []string) {
+	t.Helper()
+	var gotMainFunc bytes.Buffer
+	if err := format.Node(&gotMainFunc, token.NewFileSet(), getMainFunc(runSrc)); err != nil {
+		t.Fatalf("failed to format main func: %v", err)
+	}
+	if diff := cmp.Diff(expectedMainFunc, gotMainFunc.String()); diff != "" {
+		t.Errorf("main func mismatch (-want +got):\n%s", diff)
+	}
+
+	var gotImports []string
+	for _, importSpec := range runSrc.Imports {
+		if importSpec.Name != nil && strings.HasPrefix(importSpec.Name.Name, "gonsole") {
+			continue
+		}
+		gotImports = append(gotImports, importSpec.Path.Value)
+	}
+	if diff := cmp.Diff(expectedImports, gotImports); diff != "" {
+		t.Errorf("imports mismatch (-want +got):\n%s", diff)
+	}
+	if !hasFuncDecl(runSrc, displayFuncName) {
+		t.Errorf("run source does not contain the display runtime")
+	}
+}
+
+func hasFuncDecl(file *ast.File, name string) bool {
+	for _, decl := range file.Decls {
+		if funcDecl, ok := decl.(*ast.FuncDecl); ok && funcDecl.Name.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// assertDisplayRegisterSrc は変数の登録に使うソースが、表示のランタイムの代わりにスタブを含むことを検証する
+func assertDisplayRegisterSrc(t *testing.T, registerSrc *ast.File) {
+	t.Helper()
+	for _, importSpec := range registerSrc.Imports {
+		if importSpec.Name != nil && strings.HasPrefix(importSpec.Name.Name, "gonsole") {
+			t.Errorf("register source should not import packages of the display runtime: %s", importSpec.Path.Value)
+		}
+	}
+	var hasStub bool
+	for _, decl := range registerSrc.Decls {
+		if funcDecl, ok := decl.(*ast.FuncDecl); ok && funcDecl.Name.Name == "gonsoleDisplay" {
+			hasStub = true
+		}
+	}
+	if !hasStub {
+		t.Errorf("register source should declare gonsoleDisplay")
+	}
+}
@@ -1,41 +1,217 @@
 package executor
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"go/ast"
 	"go/parser"
+	"go/scanner"
 	"go/token"
+	"io"
+	"maps"
+	"os"
 	"slices"
 
 	"os/exec"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/kakkky/gonsole/declregistry"
 	"github.com/kakkky/gonsole/errs"
+	"github.com/kakkky/gonsole/pkgindex"
+	"github.com/kakkky/gonsole/targetpkg"
 	"github.com/kakkky/gonsole/types"
 )
 
 // Executor はREPLセッション内でのコード実行を担う
 // go-promptのExecutorインターフェースを実装する
 type Executor struct {
-	declRegistry *declregistry.DeclRegistry
-	sessionSrc   *ast.File
+	declRegistry  *declregistry.DeclRegistry
+	sessionSrc    *ast.File
+	execMode      ExecMode
+	displayFormat DisplayFormat
+	// timeout は1回の実行にかけられる時間で、0の場合は制限しない
+	timeout       time.Duration
+	snapshotDir   string
+	targetPkg     *targetpkg.TargetPkg
+	pkgSessionDir string
+	// shadowCount は再宣言により名前を付け替えた変数の数で、付け替える名前を一意にするために使う
+	shadowCount int
+	// shadowedInSession はその1replセッション内で名前を付け替えた変数。実行に失敗した場合に元に戻すために使う
+	shadowedInSession []shadowedDecl
+	// topLevelDeclChanges はトップレベルに追加した関数・メソッド・型の宣言の履歴で、:undoで取り消すために使う
+	topLevelDeclChanges []topLevelDeclChange
+	// topLevelDeclChangedInSession はその1replセッション内でトップレベルに宣言を追加したかどうか
+	topLevelDeclChangedInSession bool
+	// inputCount はセッションに書き込んだ入力の数で、文と宣言のどちらが後に入力されたかを判定するために使う
+	inputCount int
+	// stmtInputSeqs はmain関数に書き込んだ入力文ごとの入力順
+	stmtInputSeqs map[ast.Stmt]int
+	// pkgIndex はプロジェクト内のパッケージの索引で、importパスの解決に使う
+	pkgIndex *pkgindex.Index
+	// initialImportPathBindings は生成時に指定された、パッケージ名ごとに使うimportパス
+	initialImportPathBindings map[types.PkgName]types.ImportPath
+	// reloadPending は:reloadでセッションを新しいコードに対して実行し直せておらず、次の入力の前に実行し直す必要があるかどうか
+	reloadPending bool
+	// workerChecker はワーカーモードで文を評価する前に、セッションを型検査する
+	workerChecker *workerChecker
 	filer
 	commander
 	importPathResolver
+	worker
+}
+
+// ExecMode はセッションの実行方式を表す
+type ExecMode string
+
+const (
+	// ExecModeReplay は入力のたびに、それまでの文を含むセッション全体を再実行する
+	ExecModeReplay ExecMode = "replay"
+	// ExecModeSnapshot は実行済みの文を再実行せず、変数の値をスナップショットから復元して新しい文だけを実行する
+	ExecModeSnapshot ExecMode = "snapshot"
+	// ExecModeWorker はセッション中に常駐するプロセスに新しい文だけを送って評価させ、変数の値をプロセス内に保持する
+	// 常駐プロセスが評価できない文だけを、プラグインとしてビルドして読み込ませる
+	ExecModeWorker ExecMode = "worker"
+)
+
+// ParseExecMode は文字列をExecModeに変換する
+func ParseExecMode(mode string) (ExecMode, error) {
+	switch ExecMode(mode) {
+	case ExecModeReplay, ExecModeSnapshot, ExecModeWorker:
+		return ExecMode(mode), nil
+	}
+	return "", errs.NewBadInputError(fmt.Sprintf("unknown exec mode %q (available: %s, %s, %s)", mode, ExecModeReplay, ExecModeSnapshot, ExecModeWorker))
+}
+
+// Option はExecutorの生成時に指定するオプション
+type Option func(*Executor)
+
+// WithExecMode はセッションの実行方式を指定する
+func WithExecMode(mode ExecMode) Option {
+	return func(e *Executor) {
+		e.execMode = mode
+	}
+}
+
+// WithDisplayFormat は式の評価結果の表示形式を指定する
+func WithDisplayFormat(format DisplayFormat) Option {
+	return func(e *Executor) {
+		e.displayFormat = format
+	}
+}
+
+// WithTimeout は1回の実行にかけられる時間を指定する。0の場合は制限しない
+func WithTimeout(timeout time.Duration) Option {
+	return func(e *Executor) {
+		e.timeout = timeout
+	}
+}
+
+// WithTargetPkg はセッションのコードを組み込む対象のパッケージを指定する
+// 対象パッケージの非公開の要素にアクセスできるようになる
+func WithTargetPkg(targetPkg *targetpkg.TargetPkg) Option {
+	return func(e *Executor) {
+		e.targetPkg = targetPkg
+	}
+}
+
+// WithImportPathBindings はパッケージ名ごとに使うimportパスを指定する
+// 同名のパッケージが複数ある場合でも、指定したパッケージ名は選択を求めずにimportする
+func WithImportPathBindings(bindings map[types.PkgName]types.ImportPath) Option {
+	return func(e *Executor) {
+		e.initialImportPathBindings = bindings
+	}
+}
+
+// WithPkgIndex はimportパスの解決に使うパッケージの索引を指定する
+// 補完候補の生成で読み込んだパッケージから作った索引を共有することで、パッケージの読み込みを一度で済ませる
+func WithPkgIndex(pkgIndex *pkgindex.Index) Option {
+	return func(e *Executor) {
+		e.pkgIndex = pkgIndex
+	}
 }
 
 // NewExecutor はExecutorのインスタンスを生成する
-func NewExecutor(declRegistry *declregistry.DeclRegistry) (*Executor, error) {
+func NewExecutor(declRegistry *declregistry.DeclRegistry, opts ...Option) (*Executor, error) {
 	commander := newDefaultCommander()
-	return &Executor{
-		declRegistry:       declRegistry,
-		sessionSrc:         initSessionSrc(),
-		filer:              newDefaultFiler(),
-		commander:          commander,
-		importPathResolver: newDefaultImportPathResolver(commander),
-	}, nil
+	e := &Executor{
+		declRegistry:  declRegistry,
+		sessionSrc:    initSessionSrc(),
+		execMode:      ExecModeReplay,
+		displayFormat: DisplayFormatGo,
+		filer:         newDefaultFiler(),
+		commander:     commander,
+		worker:        newDefaultWorker(commander),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	if e.pkgIndex == nil {
+		e.pkgIndex = pkgindex.New(".")
+	}
+	e.importPathResolver = newDefaultImportPathResolver(e.pkgIndex)
+	// 設定ファイルで指定されたimportパスも、`:bind`と同じくパッケージ名と一致するかを確かめてから使う
+	for _, pkgName := range slices.Sorted(maps.Keys(e.initialImportPathBindings)) {
+		if err := e.BindImportPath(pkgName, e.initialImportPathBindings[pkgName]); err != nil {
+			return nil, errs.NewBadInputError(fmt.Sprintf("invalid import path for package %s in config", pkgName)).Wrap(err)
+		}
+	}
+
+	if e.targetPkg != nil {
+		// 対象パッケージを変えたプラグインは同じプロセスに読み込めないので、ワーカーモードは使えない
+		// 対象パッケージの型は非公開フィールドを持つことが多く、スナップショットに保存できないので、リプレイモードで代替する
+		if e.execMode == ExecModeWorker {
+			errs.HandleError(errs.NewBadInputError("worker mode cannot be used with a target package, falling back to replay mode (snapshot mode cannot save values with unexported fields, which are common in the target package)"))
+			e.execMode = ExecModeReplay
+		}
+		pkgSessionDir, err := e.newPkgSessionDir()
+		if err != nil {
+			return nil, err
+		}
+		e.pkgSessionDir = pkgSessionDir
+	}
+	if e.execMode == ExecModeWorker {
+		if err := e.launchWorker(); err != nil {
+			// プラグインをサポートしない環境などではワーカーを起動できないので、デフォルトのリプレイモードで代替する
+			errs.HandleError(errs.NewInternalError("failed to start worker, falling back to replay mode").Wrap(err))
+			if err := e.stopWorker(); err != nil {
+				errs.HandleError(err)
+			}
+			e.execMode = ExecModeReplay
+		}
+	}
+	if e.execMode == ExecModeSnapshot {
+		snapshotDir, err := newSnapshotDir()
+		if err != nil {
+			return nil, err
+		}
+		e.snapshotDir = snapshotDir
+	}
+	return e, nil
+}
+
+// Close はセッションで使用したリソースを解放する
+func (e *Executor) Close() error {
+	if e.execMode == ExecModeWorker {
+		if err := e.stopWorker(); err != nil {
+			return err
+		}
+	}
+	if e.pkgSessionDir != "" {
+		if err := os.RemoveAll(e.pkgSessionDir); err != nil {
+			return errs.NewInternalError("failed to remove package session directory").Wrap(err)
+		}
+	}
+	if e.snapshotDir == "" {
+		return nil
+	}
+	if err := os.RemoveAll(e.snapshotDir); err != nil {
+		return errs.NewInternalError("failed to remove snapshot directory").Wrap(err)
+	}
+	return nil
 }
 
 // ====================以下にメソッドを定義する======================
@@ -55,12 +231,35 @@ func (e *Executor) Execute(input string) {
 		return
 	}
 
+	// import宣言は実行するものがないので、パッケージを登録するだけにする
+	if importDecl, ok := parseImportDecl(input); ok {
+		if err := e.declareImports(importDecl); err != nil {
+			errs.HandleError(err)
+		}
+		return
+	}
+
+	// 変数の値や型の情報が変更後のコードと合っていないまま、新しい文を実行しないようにする
+	if e.reloadPending {
+		if err := e.Reload(); err != nil {
+			errs.HandleError(err)
+			return
+		}
+	}
+
+	// 実行済みの文の数を控えておく（スナップショットモード・ワーカーモードで再実行しない文を判定するため）
+	executedStmtCount := len(getMainFunc(e.sessionSrc).Body.List)
+
 	// 入力文をセッションに書き込む
 	if err := e.writeInSessionSrc(input); err != nil {
 		errs.HandleError(err)
 		return
 	}
-	defer clearImportPathAddedInSession()
+	defer clearImportsAddedInSession()
+	defer func() {
+		e.shadowedInSession = nil
+		e.topLevelDeclChangedInSession = false
+	}()
 
 	// 一時ファイルを作成
 	tmpFile, tmpFileName, cleanup, err := e.createTmpFile()
@@ -76,20 +275,96 @@ func (e *Executor) Execute(input string) {
 
 	fset := token.NewFileSet()
 
-	// 一時ファイルにflushする
-	if err := e.flush(e.sessionSrc, tmpFile, fset); err != nil {
+	var runSrc *ast.File
+	var workerChecked *workerCheckedSession
+	var workerEval *workerEvalRequest
+	switch e.execMode {
+	case ExecModeReplay:
+		runSrc, err = e.buildReplaySessionSrc(executedStmtCount)
+	case ExecModeSnapshot:
+		runSrc, err = e.buildSnapshotSessionSrc(executedStmtCount)
+	case ExecModeWorker:
+		// ワーカーが評価できる文はビルドせずに送り、評価できない文だけをプラグインとしてビルドする
+		workerChecked, workerEval = e.prepareWorkerEval(executedStmtCount)
+		if workerEval == nil {
+			runSrc, err = e.buildWorkerPluginSrc(executedStmtCount)
+		}
+	}
+	// 式の評価結果は、値の構造を表示するランタイムで表示する
+	if err == nil && runSrc != nil && e.endsWithDisplayStmt() {
+		runSrc, err = e.addDisplayRuntime(runSrc)
+	}
+	if err != nil {
 		errs.HandleError(err)
+		if err := e.cleanErrElmFromSessionSrc(); err != nil {
+			errs.HandleError(err)
+		}
 		return
 	}
 
+	// 対象パッケージが指定されている場合は、セッションを対象パッケージのファイルとして書き込み、一時ファイルはそれを呼び出すだけにする
+	if e.targetPkg != nil {
+		if err := e.writePkgSessionFile(runSrc); err != nil {
+			errs.HandleError(err)
+			return
+		}
+		runSrc, err = e.pkgSessionMainSrc()
+		if err != nil {
+			errs.HandleError(err)
+			return
+		}
+	}
+
+	// 一時ファイルにflushする
+	if runSrc != nil {
+		if err := e.flush(runSrc, tmpFile, fset); err != nil {
+			errs.HandleError(err)
+			return
+		}
+	}
+
+	// スナップショットに保存できない変数を宣言した入力は取り消すので、実行前のスナップショットを取っておく
+	var prevSnapshot []byte
+	if e.execMode == ExecModeSnapshot {
+		prevSnapshot, err = readSnapshotFile(e.snapshotPath())
+		if err != nil {
+			errs.HandleError(err)
+			return
+		}
+	}
+
 	// 一時ファイルを実行する
-	cmdOut, cmdErr := e.execGoRun(tmpFileName)
+	// 実行中にCtrl+Cが押されるか、実行にかけられる時間を過ぎた場合は、実行中のプログラムを終了させて失敗した場合と同じく文を取り消す
+	ctx, stop := e.newExecContext()
+	defer stop()
+	// プログラムの出力は届いた順に表示し、式の評価結果は取り分けておく
+	output := newCmdOutput(os.Stdout)
+	var cmdErr error
+	if workerEval != nil {
+		cmdErr = e.evalInWorkerOrPlugin(ctx, workerEval, executedStmtCount, tmpFile, tmpFileName, fset, output.stdout, output.stderr)
+	} else {
+		cmdErr = e.execTmpFile(ctx, tmpFileName, output.stdout, output.stderr)
+	}
+	if err := output.finish(); err != nil {
+		errs.HandleError(errs.NewInternalError("failed to write program output").Wrap(err))
+	}
 	if cmdErr != nil {
-		// 実行時のエラー出力を整形して表示する
-		cmdErrMsg := string(cmdErr.(*exec.ExitError).Stderr)
-
-		formatted := formatCmdErrMsg(cmdErrMsg)
-		errs.HandleError(errs.NewBadInputError(formatted))
+		workerExited := errors.Is(cmdErr, errWorkerExited)
+		cmdErr = e.canceledExecErr(ctx, cmdErr)
+		var programExitErr *programExitError
+		var exitErr *exec.ExitError
+		if errors.As(cmdErr, &programExitErr) {
+			// プログラムのエラー出力は実行中に表示しているので、終了した状態だけを表示する
+			errs.HandleError(errs.NewBadInputError(programExitErr.Error()))
+		} else if errors.As(cmdErr, &exitErr) {
+			// 実行時のエラー出力を整形して表示する
+			cmdErrMsg := string(exitErr.Stderr)
+
+			formatted := formatCmdErrMsg(cmdErrMsg)
+			errs.HandleError(errs.NewBadInputError(formatted))
+		} else {
+			errs.HandleError(cmdErr)
+		}
 
 		// エラー行を削除する
 		if err := e.cleanErrElmFromSessionSrc(); err != nil {
@@ -100,31 +375,133 @@ func (e *Executor) Execute(input string) {
 			errs.HandleError(err)
 		}
 
+		if workerExited {
+			if err := e.restartWorker(tmpFile, tmpFileName, fset); err != nil {
+				errs.HandleError(err)
+			}
+		}
+
 		return
 	}
 
-	// 実行結果を表示する
-	if len(cmdOut) > 0 {
-		printCmdOutput(cmdOut)
+	// 式の評価結果はプログラム自体の出力と分けて受け取り、登録の際に式の型が分かってから表示する
+	results, err := output.stdout.displayResults()
+	if err != nil {
+		errs.HandleError(err)
+	}
+	var resultDropped bool
+	if len(results) > 0 {
+		defer func() {
+			printDisplayResults(results, e.declRegistry.ResultTypes)
+			if resultDropped {
+				printUnsavedResult()
+			}
+		}()
 	}
 
-	// sessionSrcから式呼び出しを削除する（式呼び出しは実行結果の表示のためだけに追加しているため、実行後は削除する）
-	e.cleanCallExprFromSessionSrc()
+	// 式の評価結果の型を解析できるように、登録には表示のランタイムのスタブを含めたsessionSrcを使う
+	registerSrc := e.sessionSrc
+	endsWithDisplayStmt := e.endsWithDisplayStmt()
+	if endsWithDisplayStmt {
+		registerSrc, err = e.addDisplayStub(e.sessionSrc)
+		if err != nil {
+			errs.HandleError(err)
+			return
+		}
+	}
+
+	// ワーカーモードでは一時ファイルにプラグインのソースが書かれているので、変数の登録のためにsessionSrcを書き込み直す
+	// スナップショットや表示のランタイムは、importするパッケージまで型検査すると登録に時間がかかるので、sessionSrcを書き込み直す
+	// トップレベルの宣言の登録では、スナップショットのランタイムなどを宣言と区別できないのでsessionSrcを書き込み直す
+	if e.execMode != ExecModeReplay || endsWithDisplayStmt || e.topLevelDeclChangedInSession {
+		if err := e.flush(registerSrc, tmpFile, fset); err != nil {
+			errs.HandleError(err)
+			return
+		}
+	}
+
+	// 対象パッケージが指定されている場合は、対象パッケージの一部として解析する必要があるので変換しておく
+	var pkgSessionSrc []byte
+	if e.targetPkg != nil {
+		pkgSessionSrc, err = e.formatPkgSessionSrc(registerSrc)
+		if err != nil {
+			errs.HandleError(err)
+			return
+		}
+	}
+
+	// トップレベルの宣言の場合は、関数・メソッド・型の情報を登録し直す
+	if e.topLevelDeclChangedInSession {
+		if e.targetPkg != nil {
+			err = e.declRegistry.RegisterTopLevelDeclsInPackage(e.pkgSessionFilePath(), pkgSessionSrc, pkgSessionFuncName)
+		} else {
+			err = e.declRegistry.RegisterTopLevelDecls(tmpFileName)
+		}
+		if err != nil {
+			errs.HandleError(err)
+		}
+		return
+	}
 
 	// 変数エントリに登録する
-	if err := e.declRegistry.Register(tmpFileName); err != nil {
+	// ワーカーモードで型検査したセッションは、パッケージを読み込み直さずに型検査の結果で登録する
+	if e.targetPkg != nil {
+		err = e.declRegistry.RegisterInPackage(e.pkgSessionFilePath(), pkgSessionSrc, pkgSessionFuncName)
+	} else if workerChecked != nil {
+		err = e.declRegistry.RegisterChecked(workerChecked.file, workerChecked.pkg, workerChecked.info)
+	} else {
+		err = e.declRegistry.Register(tmpFileName)
+	}
+	if err != nil {
 		errs.HandleError(err)
-		return
+	}
+
+	// スナップショットから復元できない変数は、宣言した文を入力のたびに再実行すると副作用が繰り返されるので、入力を取り消す
+	if e.execMode == ExecModeSnapshot {
+		newStmts := getMainFunc(e.sessionSrc).Body.List[executedStmtCount:]
+		if unsaved := e.unsavedDeclNames(newStmts); len(unsaved) > 0 {
+			errs.HandleError(unsavedDeclsError(unsaved))
+			if err := e.undoUnsavedInput(newStmts, prevSnapshot); err != nil {
+				errs.HandleError(err)
+			}
+			return
+		}
+	}
+
+	// 式の評価結果を表示する呼び出しは、登録で評価結果の型が分かったら外して、評価結果の変数の宣言として残す
+	e.finishResultBinding(len(e.declRegistry.ResultTypes))
+	if e.execMode == ExecModeSnapshot && endsWithDisplayStmt {
+		resultDropped = e.dropUnsavedResult()
+	}
+}
+
+// execTmpFile は実行方式に応じて一時ファイルを実行する
+// ctxが終了した場合や、プログラムの実行を始めてから実行にかけられる時間を過ぎた場合は、実行中のプログラムを終了させる
+// プログラムの標準出力と標準エラー出力は、実行中にstdoutとstderrに書き込まれる
+func (e *Executor) execTmpFile(ctx context.Context, tmpFileName string, stdout io.Writer, stderr io.Writer) error {
+	switch {
+	case e.execMode == ExecModeWorker:
+		return e.execInWorker(ctx, e.timeout, tmpFileName, stdout, stderr)
+	case e.targetPkg != nil:
+		return e.execGoRunWithOverlay(ctx, e.timeout, tmpFileName, e.overlayFilePath(), stdout, stderr)
+	default:
+		return e.execGoRun(ctx, e.timeout, tmpFileName, stdout, stderr)
 	}
 }
 
 func (e *Executor) writeInSessionSrc(input string) error {
+	// 関数・メソッド・型の宣言はmain関数の中に書けないので、トップレベルに追加する
+	if topLevelDecl, ok := parseTopLevelDecl(input); ok {
+		return e.appendTopLevelDeclToSessionSrc(topLevelDecl)
+	}
+
 	inputStmtAst, err := parseInput(input)
 	if err != nil {
 		return err
 	}
 
 	mainFunc := getMainFunc(e.sessionSrc)
+	inputStmtIdx := len(mainFunc.Body.List)
 	switch inputStmtV := inputStmtAst.(type) {
 	case *ast.ExprStmt:
 		if err := e.appendExprStmtToMainFuncBody(inputStmtV, mainFunc); err != nil {
@@ -138,74 +515,37 @@ func (e *Executor) writeInSessionSrc(input string) error {
 		if err := e.appendDeclStmtToMainFuncBody(inputStmtV, mainFunc); err != nil {
 			return err
 		}
+	case *ast.IncDecStmt, *ast.SendStmt, *ast.GoStmt, *ast.DeferStmt,
+		*ast.IfStmt, *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt,
+		*ast.LabeledStmt, *ast.BlockStmt:
+		// 制御構文などは、中で宣言された変数のスコープがその文に閉じるのでそのまま追加する
+		if err := e.addImportPathsOfNode(inputStmtV); err != nil {
+			return err
+		}
+		mainFunc.Body.List = append(mainFunc.Body.List, inputStmtV)
 	default:
 		return errs.NewBadInputError("unsupported statement type")
 	}
+	e.recordStmtInputSeq(mainFunc.Body.List[inputStmtIdx])
 	return nil
 }
 
 func (e *Executor) appendExprStmtToMainFuncBody(exprStmt *ast.ExprStmt, mainFunc *ast.FuncDecl) error {
-	switch exprStmtV := exprStmt.X.(type) {
-	case *ast.SelectorExpr:
-		selectorBase := extractSelectorBaseFromExpr(exprStmtV)
-		if !e.declRegistry.IsRegisteredDecl(types.DeclName(selectorBase)) {
-			if err := e.addImportPath(types.PkgName(selectorBase)); err != nil {
-				return err
-			}
-		}
-		exprStmt = &ast.ExprStmt{
-			X: &ast.CallExpr{
-				// AST的には表現が不正確になるがこちらの方がシンプルに書けるのでIdentに押し込める
-				Fun:  ast.NewIdent("fmt.Println"),
-				Args: []ast.Expr{exprStmtV},
-			},
-		}
-	case *ast.Ident:
-		exprStmt = &ast.ExprStmt{
-			X: &ast.CallExpr{
-				// AST的には表現が不正確になるがこちらの方がシンプルに書けるのでIdentに押し込める
-				Fun:  ast.NewIdent("fmt.Println"),
-				Args: []ast.Expr{exprStmtV},
-			},
-		}
-
-	case *ast.CallExpr:
-		selectorBase := extractSelectorBaseFromExpr(exprStmtV)
-		if !e.declRegistry.IsRegisteredDecl(types.DeclName(selectorBase)) {
-			if err := e.addImportPath(types.PkgName(selectorBase)); err != nil {
-				return err
-			}
-		}
-		exprStmt = &ast.ExprStmt{
-			X: &ast.CallExpr{
-				// AST的には表現が不正確になるがこちらの方がシンプルに書けるのでIdentに押し込める
-				Fun:  ast.NewIdent("fmt.Println"),
-				Args: []ast.Expr{exprStmtV},
-			},
-		}
+	switch exprStmt.X.(type) {
+	case *ast.SelectorExpr, *ast.Ident, *ast.CallExpr:
 	default:
 		return errs.NewBadInputError("unsupported expression type")
 	}
-	if err := e.addImportPath(types.PkgName("fmt")); err != nil {
-		return err
-	}
-	mainFunc.Body.List = append(mainFunc.Body.List, exprStmt)
-	return nil
+	// 式の評価結果は表示したうえで、次の入力から参照できるように変数に束縛する
+	return e.appendAssignStmtToMainFuncBody(newResultBindingStmt(exprStmt.X), mainFunc)
 }
 
 func (e *Executor) appendAssignStmtToMainFuncBody(assignStmt *ast.AssignStmt, mainFunc *ast.FuncDecl) error {
-	assignStmtRHS := assignStmt.Rhs[0]
-	switch assignStmtRHS.(type) {
-	case *ast.BasicLit:
-		// 右辺が基本リテラルの場合は特に何もしない
-	default:
-		selectorBase := extractSelectorBaseFromExpr(assignStmtRHS)
-		if !e.declRegistry.IsRegisteredDecl(types.DeclName(selectorBase)) {
-			if err := e.addImportPath(types.PkgName(selectorBase)); err != nil {
-				return err
-			}
-		}
-
+	if err := e.addImportPathsOfNode(assignStmt); err != nil {
+		return err
+	}
+	if assignStmt.Tok == token.DEFINE {
+		e.shadowRedeclaredNames(mainFunc, assignStmt, declNamesOfStmt(assignStmt))
 	}
 	mainFunc.Body.List = append(mainFunc.Body.List, assignStmt)
 	if assignStmt.Tok == token.DEFINE {
@@ -218,103 +558,133 @@ func (e *Executor) appendAssignStmtToMainFuncBody(assignStmt *ast.AssignStmt, ma
 }
 
 func (e *Executor) appendDeclStmtToMainFuncBody(declStmt *ast.DeclStmt, mainFunc *ast.FuncDecl) error {
-	declStmtRHS := declStmt.Decl.(*ast.GenDecl).Specs[0].(*ast.ValueSpec).Values[0]
-	switch declStmtRHS.(type) {
-	case *ast.BasicLit:
-		// 右辺が基本リテラルの場合は特に何もしない
-	default:
-		selectorBase := extractSelectorBaseFromExpr(declStmtRHS)
-		if !e.declRegistry.IsRegisteredDecl(types.DeclName(selectorBase)) {
-			if err := e.addImportPath(types.PkgName(selectorBase)); err != nil {
-				return err
-			}
-		}
+	if err := e.addImportPathsOfNode(declStmt); err != nil {
+		return err
 	}
+	e.shadowRedeclaredNames(mainFunc, declStmt, declaredNamesOfStmt(declStmt))
 	mainFunc.Body.List = append(mainFunc.Body.List, declStmt)
-	for _, name := range declStmt.Decl.(*ast.GenDecl).Specs[0].(*ast.ValueSpec).Names {
-		declName := types.DeclName(name.Name)
-		mainFunc.Body.List = append(mainFunc.Body.List, blankAssignStmt(declName))
+	// var (...)のようなまとめた宣言では、すべての変数が宣言される
+	for _, spec := range declStmt.Decl.(*ast.GenDecl).Specs {
+		for _, name := range spec.(*ast.ValueSpec).Names {
+			declName := types.DeclName(name.Name)
+			mainFunc.Body.List = append(mainFunc.Body.List, blankAssignStmt(declName))
+		}
 	}
 	return nil
 }
 
-// cleanErrLineFromSessionSrcでエラー時に追加していたimportPathを削除するために使う
-// その1replセッション内ごとに一つだけ保持
-var importPathAddedInSession types.ImportPath
-
-func (e *Executor) addImportPath(pkgName types.PkgName) error {
-	importPath, err := e.resolve(pkgName)
-	if err != nil {
-		return err
-	}
+// addedImport は入力文のために追加したimport
+type addedImport struct {
+	pkgName    types.PkgName
+	importPath types.ImportPath
+}
 
-	for _, importSpec := range e.sessionSrc.Imports {
-		if importSpec.Path.Value == string(importPath) {
-			return nil
+// cleanErrLineFromSessionSrcでエラー時に追加していたimportPathを削除するために使う
+// その1replセッション内で追加したものを保持
+var importsAddedInSession []addedImport
+
+// addImportPathsOfNode はノード内でパッケージとして参照されている識別子のimportを追加する
+// セッションで宣言された変数・関数・型や、ノードの中で宣言された識別子はパッケージではないので対象外にする
+func (e *Executor) addImportPathsOfNode(node ast.Node) error {
+	localNames := localNamesOfNode(node)
+	var pkgNames []types.PkgName
+	ast.Inspect(node, func(node ast.Node) bool {
+		selectorExpr, ok := node.(*ast.SelectorExpr)
+		if !ok {
+			return true
 		}
-	}
-
-	// fmtパッケージは式の場合に設定されるのが確定しているので、importPathAddedInSessionには設定しない。
-	if importPath != `"fmt"` {
-		importPathAddedInSession = importPath
-	}
+		ident, ok := selectorExpr.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		pkgName := types.PkgName(ident.Name)
+		if localNames[ident.Name] || e.declRegistry.IsRegisteredDecl(types.DeclName(ident.Name)) || e.isTopLevelDeclName(ident.Name) || slices.Contains(pkgNames, pkgName) {
+			return true
+		}
+		pkgNames = append(pkgNames, pkgName)
+		return true
+	})
 
-	newImportSpec := &ast.ImportSpec{
-		Path: &ast.BasicLit{
-			Kind:  token.STRING,
-			Value: string(importPath),
-		},
+	for _, pkgName := range pkgNames {
+		if err := e.addImportPath(pkgName); err != nil {
+			return err
+		}
 	}
-	e.sessionSrc.Imports = append(e.sessionSrc.Imports, newImportSpec)
+	return nil
+}
 
-	// DeclsにGenDecl(import)があればそこに追加、なければ新規作成
-	var importDecl *ast.GenDecl
-	for _, decl := range e.sessionSrc.Decls {
-		if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.IMPORT {
-			importDecl = genDecl
-			break
+// localNamesOfNode はノードの中で宣言されている識別子の名前を返す
+func localNamesOfNode(node ast.Node) map[string]bool {
+	names := make(map[string]bool)
+	addIdents := func(exprs ...ast.Expr) {
+		for _, expr := range exprs {
+			if ident, ok := expr.(*ast.Ident); ok {
+				names[ident.Name] = true
+			}
 		}
 	}
-	if importDecl != nil {
-		importDecl.Specs = append(importDecl.Specs, newImportSpec)
-	} else {
-		importDecl = &ast.GenDecl{
-			Tok:   token.IMPORT,
-			Specs: []ast.Spec{newImportSpec},
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch nodeV := node.(type) {
+		case *ast.AssignStmt:
+			if nodeV.Tok == token.DEFINE {
+				addIdents(nodeV.Lhs...)
+			}
+		case *ast.RangeStmt:
+			if nodeV.Tok == token.DEFINE {
+				addIdents(nodeV.Key, nodeV.Value)
+			}
+		case *ast.ValueSpec:
+			for _, name := range nodeV.Names {
+				names[name.Name] = true
+			}
+		case *ast.TypeSpec:
+			names[nodeV.Name.Name] = true
+		case *ast.Field:
+			for _, name := range nodeV.Names {
+				names[name.Name] = true
+			}
 		}
-		e.sessionSrc.Decls = append([]ast.Decl{importDecl}, e.sessionSrc.Decls...)
-	}
-	return nil
+		return true
+	})
+	return names
 }
 
-func extractSelectorBaseFromExpr(expr ast.Expr) string {
-	switch exprV := expr.(type) {
-	case *ast.SelectorExpr:
-		return extractSelectorBaseFromExpr(exprV.X)
-	case *ast.CompositeLit:
-		if sel, ok := exprV.Type.(*ast.SelectorExpr); ok {
-			return extractSelectorBaseFromExpr(sel.X)
+func (e *Executor) addImportPath(pkgName types.PkgName) error {
+	var importPath types.ImportPath
+	if declaredImport, ok := e.declRegistry.LookupImport(pkgName); ok {
+		// import文で宣言されたパッケージは、宣言されたimportパスで確定させる
+		importPath = declaredImport.ImportPath
+	} else if e.targetPkg != nil && pkgName == e.targetPkg.Name {
+		// 対象パッケージは候補から選ばせずに確定させる
+		importPath = e.targetPkg.ImportPath
+	} else {
+		resolved, err := e.resolve(pkgName)
+		if err != nil {
+			return err
 		}
-	case *ast.UnaryExpr:
-		if comp, ok := exprV.X.(*ast.CompositeLit); ok {
-			if sel, ok := comp.Type.(*ast.SelectorExpr); ok {
-				return extractSelectorBaseFromExpr(sel.X)
-			}
+		importPath = resolved
+	}
+
+	newImportSpec := newImportSpec(pkgName, importPath)
+	for _, importSpec := range e.sessionSrc.Imports {
+		if importSpec.Path.Value == string(importPath) && importName(importSpec) == string(pkgName) {
+			return nil
 		}
-	case *ast.CallExpr:
-		return extractSelectorBaseFromExpr(exprV.Fun)
-	case *ast.Ident:
-		return exprV.Name
 	}
-	return ""
+
+	importsAddedInSession = append(importsAddedInSession, addedImport{pkgName: pkgName, importPath: importPath})
+
+	addImportSpec(e.sessionSrc, newImportSpec)
+	return nil
 }
 
 func formatCmdErrMsg(cmdErrMsg string) string {
 	cmdErrLines := strings.Split(cmdErrMsg, "\n")
 	var formattedCmdErrLines []string
 
-	cmdVirtualPkgPattern := regexp.MustCompile(`^# command-line-arguments$`)
-	tmpFilePathPattern := regexp.MustCompile(`\./?\d+_gonsole_tmp\.go:\d+:\d+:\s*`)
+	// 対象パッケージが指定されている場合は、仮想パッケージの代わりに対象パッケージのパスが出力される
+	cmdVirtualPkgPattern := regexp.MustCompile(`^# \S+$`)
+	tmpFilePathPattern := regexp.MustCompile(`(\./?\d+_gonsole_tmp|\S*gonsole_session)\.go:\d+:\d+:\s*`)
 	var cmdErrCount int
 	for _, cmdErrLine := range cmdErrLines {
 		// 仮想パッケージに関するエラー行はスキップ
@@ -336,136 +706,78 @@ func formatCmdErrMsg(cmdErrMsg string) string {
 	return fmt.Sprintf("\n%d errors found\n\n%s\n\n", cmdErrCount, formattedCmdErrLine)
 }
 
-func (e *Executor) cleanCallExprFromSessionSrc() {
+func (e *Executor) cleanErrElmFromSessionSrc() error {
 	mainFunc := getMainFunc(e.sessionSrc)
-	body := mainFunc.Body.List
-	lastExprStmt, ok := body[len(body)-1].(*ast.ExprStmt)
-	if !ok {
-		return
-	}
 
-	// 式呼び出しはfmt.Printlnが確実に使われている
-	fmtFunc, ok := lastExprStmt.X.(*ast.CallExpr).Fun.(*ast.Ident)
-	if !ok || fmtFunc.Name != "fmt.Println" {
-		return
+	switch {
+	case e.topLevelDeclChangedInSession:
+		// 最後の入力で追加したトップレベルの宣言を取り消す
+		e.revertLastTopLevelDeclChange()
+		e.topLevelDeclChangedInSession = false
+	default:
+		// 最後の入力で追加した文（宣言文とそれに続くブランク代入）を削除する
+		stmtGroups := groupSessionStmts(mainFunc.Body.List)
+		if len(stmtGroups) > 0 {
+			mainFunc.Body.List = slices.Concat(stmtGroups[:len(stmtGroups)-1]...)
+		}
+		if mainFunc.Body.List == nil {
+			mainFunc.Body.List = []ast.Stmt{}
+		}
 	}
 
-	fmtFuncArgExpr := lastExprStmt.X.(*ast.CallExpr).Args[0]
-
-	switch fmtFuncArgExpr.(type) {
-	case *ast.CallExpr, *ast.SelectorExpr:
-		// 該当packageを利用している宣言がなければpackage importを削除する
-		selectorBase := extractSelectorBaseFromExpr(fmtFuncArgExpr)
-		if !e.declRegistry.IsRegisteredDecl(types.DeclName(selectorBase)) {
-			// 該当packageを利用している宣言がなければpackage importを削除する
-			var isUsed bool
-			for _, decl := range e.declRegistry.Decls {
-				if decl.TypePkgName == types.PkgName(selectorBase) {
-					isUsed = true
-					break
-				}
-			}
+	e.removeImportsAddedInSession()
 
-			if !isUsed {
-				e.sessionSrc.Imports = slices.DeleteFunc(e.sessionSrc.Imports, func(importSpec *ast.ImportSpec) bool {
-					return importSpec.Path.Value == string(importPathAddedInSession)
-				})
-
-				for _, decl := range e.sessionSrc.Decls {
-					if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.IMPORT {
-						genDecl.Specs = slices.DeleteFunc(genDecl.Specs, func(spec ast.Spec) bool {
-							importSpec := spec.(*ast.ImportSpec)
-							return importSpec.Path.Value == string(importPathAddedInSession)
-						})
-						break
-					}
-				}
-			}
+	// 再宣言のために名前を付け替えた変数を元に戻す
+	e.unshadowDecls()
+
+	return nil
+}
+
+// removeImportsAddedInSession はその1replセッション内で追加したimportを削除する
+// 登録済みの変数の型が属するパッケージのimportは残す
+func (e *Executor) removeImportsAddedInSession() {
+	for _, added := range importsAddedInSession {
+		if e.isImportUsed(added.pkgName) {
+			continue
 		}
+		e.removeImport(added.pkgName, added.importPath)
 	}
+}
 
-	var isUsedFmt bool
+// isImportUsed はセッションの文やトップレベルの宣言、登録済みの変数の型でパッケージが使われているかを返す
+func (e *Executor) isImportUsed(pkgName types.PkgName) bool {
 	for _, decl := range e.declRegistry.Decls {
-		if decl.TypePkgName == types.PkgName("fmt") {
-			isUsedFmt = true
-			break
+		if decl.TypePkgName == pkgName {
+			return true
 		}
 	}
-	if !isUsedFmt {
-		// fmt importを削除する
-		e.sessionSrc.Imports = slices.DeleteFunc(e.sessionSrc.Imports, func(importSpec *ast.ImportSpec) bool {
-			return importSpec.Path.Value == `"fmt"`
-		})
-		for _, decl := range e.sessionSrc.Decls {
-			if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.IMPORT {
-				genDecl.Specs = slices.DeleteFunc(genDecl.Specs, func(spec ast.Spec) bool {
-					importSpec := spec.(*ast.ImportSpec)
-					return importSpec.Path.Value == `"fmt"`
-				})
-				break
+	var isUsed bool
+	ast.Inspect(e.sessionSrc, func(node ast.Node) bool {
+		if selectorExpr, ok := node.(*ast.SelectorExpr); ok {
+			if ident, ok := selectorExpr.X.(*ast.Ident); ok && ident.Name == string(pkgName) {
+				isUsed = true
 			}
 		}
-	}
-
-	mainFunc.Body.List = body[:len(body)-1]
+		return !isUsed
+	})
+	return isUsed
 }
 
-func (e *Executor) cleanErrElmFromSessionSrc() error {
-	mainFunc := getMainFunc(e.sessionSrc)
-	cleanMainFuncBody := []ast.Stmt{}
-
-	// 最後の要素を取得
-	lastElm := mainFunc.Body.List[len(mainFunc.Body.List)-1]
-
-	var selectorBase string
-	switch lastElmV := lastElm.(type) {
-	case *ast.AssignStmt:
-		// 最後の要素がブランク代入の場合、ブランク代入とその前の宣言文を削除する
-		if ident, ok := lastElmV.Lhs[0].(*ast.Ident); ok && ident.Name == "_" {
-			// 最後から２番目の要素が宣言文なので、そこからselectorBaseを抽出する
-			prevElm := mainFunc.Body.List[len(mainFunc.Body.List)-2]
-			switch prevElmV := prevElm.(type) {
-			case *ast.AssignStmt:
-				selectorBase = extractSelectorBaseFromExpr(prevElmV.Rhs[0])
-			case *ast.DeclStmt:
-				selectorBase = extractSelectorBaseFromExpr(prevElmV.Decl.(*ast.GenDecl).Specs[0].(*ast.ValueSpec).Values[0])
-			}
-			cleanMainFuncBody = mainFunc.Body.List[:len(mainFunc.Body.List)-2]
-		}
-	case *ast.ExprStmt:
-		selectorBase = extractSelectorBaseFromExpr(lastElmV.X)
-		cleanMainFuncBody = mainFunc.Body.List[:len(mainFunc.Body.List)-1]
+// removeImport はパッケージを指定した名前で参照しているimportを削除する
+// 同じパッケージを別名でもimportしている場合があるので、importパスだけでなく名前も一致するものを削除する
+func (e *Executor) removeImport(pkgName types.PkgName, importPath types.ImportPath) {
+	isTarget := func(importSpec *ast.ImportSpec) bool {
+		return importSpec.Path.Value == string(importPath) && importName(importSpec) == string(pkgName)
 	}
-
-	mainFunc.Body.List = cleanMainFuncBody
-
-	if !e.declRegistry.IsRegisteredDecl(types.DeclName(selectorBase)) {
-		// 該当packageを利用している宣言がなければpackage importを削除する
-		var isUsed bool
-		for _, decl := range e.declRegistry.Decls {
-			if decl.TypePkgName == types.PkgName(selectorBase) {
-				isUsed = true
-				break
-			}
-		}
-		if !isUsed {
-			e.sessionSrc.Imports = slices.DeleteFunc(e.sessionSrc.Imports, func(importSpec *ast.ImportSpec) bool {
-				return importSpec.Path.Value == string(importPathAddedInSession)
+	e.sessionSrc.Imports = slices.DeleteFunc(e.sessionSrc.Imports, isTarget)
+	for _, decl := range e.sessionSrc.Decls {
+		if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.IMPORT {
+			genDecl.Specs = slices.DeleteFunc(genDecl.Specs, func(spec ast.Spec) bool {
+				return isTarget(spec.(*ast.ImportSpec))
 			})
-
-			for _, decl := range e.sessionSrc.Decls {
-				if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.IMPORT {
-					genDecl.Specs = slices.DeleteFunc(genDecl.Specs, func(spec ast.Spec) bool {
-						importSpec := spec.(*ast.ImportSpec)
-						return importSpec.Path.Value == string(importPathAddedInSession)
-					})
-					break
-				}
-			}
+			break
 		}
 	}
-
-	return nil
 }
 
 // ================以下に関数を定義する======================
@@ -492,8 +804,7 @@ func initSessionSrc() *ast.File {
 func parseInput(input string) (ast.Stmt, error) {
 	// 入力値をmain関数でラップしてparseする
 	fset := token.NewFileSet()
-	wrappedInput := "package main\nfunc main() {\n" + input + "\n}"
-	wrappedInputAst, err := parser.ParseFile(fset, "", wrappedInput, parser.AllErrors)
+	wrappedInputAst, err := parser.ParseFile(fset, "", wrapInput(input), parser.AllErrors)
 	if err != nil {
 		return nil, errs.NewBadInputError("invalid input syntax")
 	}
@@ -507,6 +818,43 @@ func parseInput(input string) (ast.Stmt, error) {
 	return inputStmtAst, nil
 }
 
+// inputStartLine はwrapInputでラップしたソースにおいて、入力値が始まる行番号
+const inputStartLine = 3
+
+func wrapInput(input string) string {
+	return "package main\nfunc main() {\n" + input + "\n}"
+}
+
+// IsIncompleteInput は入力値が文や宣言として完結しておらず、続きの行を必要としているかどうかを返す
+// 括弧が閉じていない場合や、演算子で終わっている場合などが該当する
+func IsIncompleteInput(input string) bool {
+	// 関数・メソッド・型の宣言はトップレベルに置くので、トップレベルとしてもパースしてみる
+	// 入力値の後ろに宣言を続けることで、閉じていない宣言のエラーが入力値より後ろの行で起きるようにする
+	return isIncompleteWrappedInput(wrapInput(input), inputStartLine, input) ||
+		isIncompleteWrappedInput(wrapTopLevelInput(input)+"\nvar _ = 0", topLevelInputStartLine, input)
+}
+
+func isIncompleteWrappedInput(wrappedInput string, startLine int, input string) bool {
+	fset := token.NewFileSet()
+	_, err := parser.ParseFile(fset, "", wrappedInput, parser.AllErrors)
+	var errList scanner.ErrorList
+	if !errors.As(err, &errList) || len(errList) == 0 {
+		return false
+	}
+	firstErr := errList[0]
+	// 複数行にまたがる生文字列リテラルは、閉じられるまで入力値の行でエラーになる
+	if strings.HasPrefix(firstErr.Msg, "raw string literal not terminated") {
+		return true
+	}
+	// 閉じ括弧が多すぎる場合は、ラップしたmain関数が途中で閉じられたことになるので、続きの行では解消しない
+	if strings.HasPrefix(firstErr.Msg, "expected declaration") {
+		return false
+	}
+	// 最初のエラーが入力値の後ろ(ラップした閉じ括弧やファイル終端)にあるなら、入力値自体は途中まで正しく書けている
+	inputEndLine := startLine + strings.Count(input, "\n")
+	return firstErr.Pos.Line > inputEndLine
+}
+
 func blankAssignStmt(name types.DeclName) *ast.AssignStmt {
 	blankAssign := ast.AssignStmt{
 		Lhs: []ast.Expr{&ast.Ident{Name: "_"}},
@@ -516,14 +864,6 @@ func blankAssignStmt(name types.DeclName) *ast.AssignStmt {
 	return &blankAssign
 }
 
-func printCmdOutput(cmdOut []byte) {
-	cmdOutText := string(cmdOut)
-
-	const greenColor = "\033[32m"
-	const colorReset = "\033[0m"
-	fmt.Printf("\n%s%s%s\n", greenColor, cmdOutText, colorReset)
-}
-
 func getMainFunc(file *ast.File) *ast.FuncDecl {
 	for _, decl := range file.Decls {
 		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Name.Name == "main" {
@@ -533,6 +873,6 @@ func getMainFunc(file *ast.File) *ast.FuncDecl {
 	return nil
 }
 
-func clearImportPathAddedInSession() {
-	importPathAddedInSession = ""
+func clearImportsAddedInSession() {
+	importsAddedInSession = nil
 }
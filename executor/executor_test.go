@@ -2,11 +2,15 @@ package executor
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"go/ast"
 	"go/token"
+	"io"
 	"os"
 	"os/exec"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -16,6 +20,11 @@ import (
 	gomock "go.uber.org/mock/gomock"
 )
 
+// ast.BasicLit.ValueEndはGoのバージョンによって存在しないため、フィールド名で無視する
+var ignoreValueEnd = cmp.FilterPath(func(p cmp.Path) bool {
+	return p.Last().String() == ".ValueEnd"
+}, cmp.Ignore())
+
 // MEMO: session srcのastが期待通りに組み立てられているかまでがExecutorの責務なので、実行結果やファイル生成はここでは検証しない。
 func TestExecutor_Execute(t *testing.T) {
 	tests := []struct {
@@ -23,6 +32,7 @@ func TestExecutor_Execute(t *testing.T) {
 		input              string
 		setupDeclRegistry  func(*declregistry.DeclRegistry) // 必要に応じてDeclRegistryの初期状態をセットアップする
 		setupMocks         func(*Mockfiler, *Mockcommander, *MockimportPathResolver)
+		execMode           ExecMode
 		expectedSessionSrc *ast.File
 	}{
 		{
@@ -69,8 +79,85 @@ func TestExecutor_Execute(t *testing.T) {
 				mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1) // 呼ばれていることが確認できればいいのでgomock.Any()で対応
 
 				// commander
-				mockCommander.EXPECT().execGoRun("test.go").Return([]byte{}, nil).Times(1)
+				mockCommander.EXPECT().execGoRun(gomock.Any(), gomock.Any(), "test.go", gomock.Any(), gomock.Any()).Return(nil).Times(1)
+			},
+			expectedSessionSrc: &ast.File{
+				Name: &ast.Ident{Name: "main"},
+				Decls: []ast.Decl{
+					&ast.FuncDecl{
+						Name: &ast.Ident{Name: "main"},
+						Type: &ast.FuncType{
+							Params:  &ast.FieldList{List: nil},
+							Results: nil,
+						},
+						Body: &ast.BlockStmt{
+							List: []ast.Stmt{
+								&ast.DeclStmt{
+									Decl: &ast.GenDecl{
+										Tok: token.VAR,
+										Specs: []ast.Spec{
+											&ast.ValueSpec{
+												Names: []*ast.Ident{
+													{Name: "x"},
+												},
+												Values: []ast.Expr{
+													&ast.BasicLit{
+														Kind:  token.INT,
+														Value: "10",
+													},
+												},
+											},
+										},
+									},
+								},
+								&ast.AssignStmt{
+									Lhs: []ast.Expr{&ast.Ident{Name: "_"}},
+									Tok: token.ASSIGN,
+									Rhs: []ast.Expr{&ast.Ident{Name: "x"}},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:  "define variable in snapshot mode",
+			input: "var x = 10",
+			setupDeclRegistry: func(declRegistry *declregistry.DeclRegistry) {
+				// 初期状態のセットアップが不要な場合は空の関数を指定
+			},
+			setupMocks: func(mockFiler *Mockfiler, mockCommander *Mockcommander, mockImportPathResolver *MockimportPathResolver) {
+				// filer
+				mockFiler.EXPECT().createTmpFile().DoAndReturn(func() (tmpFile *os.File, tmpFileName string, cleanup func(), err error) {
+					r, w, _ := os.Pipe()
+					return w, "test.go", func() {
+						if err := r.Close(); err != nil {
+							t.Fatalf("failed to close pipe reader: %v", err)
+						}
+					}, nil
+				}).Times(1)
+				gomock.InOrder(
+					// スナップショットのランタイムを含めて実行する
+					mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(runSrc *ast.File, targetFile *os.File, fset *token.FileSet) error {
+						if len(runSrc.Decls) <= 1 {
+							t.Errorf("expected snapshot runtime in run source")
+						}
+						return nil
+					}).Times(1),
+					// 変数の登録には、ランタイムを含まないsessionSrcを書き込み直す
+					mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(registerSrc *ast.File, targetFile *os.File, fset *token.FileSet) error {
+						if len(registerSrc.Decls) != 1 {
+							t.Errorf("expected only main func in register source, got %d decls", len(registerSrc.Decls))
+						}
+						return nil
+					}).Times(1),
+				)
+
+				// commander
+				mockCommander.EXPECT().execGoRun(gomock.Any(), gomock.Any(), "test.go", gomock.Any(), gomock.Any()).Return(nil).Times(1)
 			},
+			execMode: ExecModeSnapshot,
 			expectedSessionSrc: &ast.File{
 				Name: &ast.Ident{Name: "main"},
 				Decls: []ast.Decl{
@@ -130,7 +217,7 @@ func TestExecutor_Execute(t *testing.T) {
 				mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1) // 呼ばれていることが確認できればいいのでgomock.Any()で対応
 
 				// commander
-				mockCommander.EXPECT().execGoRun("test.go").Return([]byte{}, nil).Times(1)
+				mockCommander.EXPECT().execGoRun(gomock.Any(), gomock.Any(), "test.go", gomock.Any(), gomock.Any()).Return(nil).Times(1)
 
 				// importPathResolver
 				mockImportPathResolver.EXPECT().resolve(types.PkgName("pkg")).Return(types.ImportPath(`"github.com/test/pkg"`), nil).Times(1)
@@ -213,7 +300,7 @@ func TestExecutor_Execute(t *testing.T) {
 				mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1) // 呼ばれていることが確認できればいいのでgomock.Any()で対応
 
 				// commander
-				mockCommander.EXPECT().execGoRun("test.go").Return([]byte{}, nil).Times(1)
+				mockCommander.EXPECT().execGoRun(gomock.Any(), gomock.Any(), "test.go", gomock.Any(), gomock.Any()).Return(nil).Times(1)
 
 				// importPathResolver
 				mockImportPathResolver.EXPECT().resolve(types.PkgName("pkg")).Return(types.ImportPath(`"github.com/test/pkg"`), nil).Times(1)
@@ -299,7 +386,7 @@ func TestExecutor_Execute(t *testing.T) {
 				mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1) // 呼ばれていることが確認できればいいのでgomock.Any()で対応
 
 				// commander
-				mockCommander.EXPECT().execGoRun("test.go").Return([]byte{}, nil).Times(1)
+				mockCommander.EXPECT().execGoRun(gomock.Any(), gomock.Any(), "test.go", gomock.Any(), gomock.Any()).Return(nil).Times(1)
 
 				// importPathResolver
 				mockImportPathResolver.EXPECT().resolve(types.PkgName("pkg")).Return(types.ImportPath(`"github.com/test/pkg"`), nil).Times(1)
@@ -395,7 +482,7 @@ func TestExecutor_Execute(t *testing.T) {
 				mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1) // 呼ばれていることが確認できればいいのでgomock.Any()で対応
 
 				// commander
-				mockCommander.EXPECT().execGoRun("test.go").Return([]byte{}, nil).Times(1)
+				mockCommander.EXPECT().execGoRun(gomock.Any(), gomock.Any(), "test.go", gomock.Any(), gomock.Any()).Return(nil).Times(1)
 			},
 			expectedSessionSrc: &ast.File{
 				Name: &ast.Ident{Name: "main"},
@@ -461,7 +548,7 @@ func TestExecutor_Execute(t *testing.T) {
 				mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1) // 呼ばれていることが確認できればいいのでgomock.Any()で対応
 
 				// commander
-				mockCommander.EXPECT().execGoRun("test.go").Return([]byte{}, nil).Times(1)
+				mockCommander.EXPECT().execGoRun(gomock.Any(), gomock.Any(), "test.go", gomock.Any(), gomock.Any()).Return(nil).Times(1)
 			},
 			expectedSessionSrc: &ast.File{
 				Name: &ast.Ident{Name: "main"},
@@ -535,7 +622,7 @@ func TestExecutor_Execute(t *testing.T) {
 				mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1) // 呼ばれていることが確認できればいいのでgomock.Any()で対応
 
 				// commander
-				mockCommander.EXPECT().execGoRun("test.go").Return([]byte{}, nil).Times(1)
+				mockCommander.EXPECT().execGoRun(gomock.Any(), gomock.Any(), "test.go", gomock.Any(), gomock.Any()).Return(nil).Times(1)
 
 			},
 			expectedSessionSrc: &ast.File{
@@ -605,7 +692,7 @@ func TestExecutor_Execute(t *testing.T) {
 				mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1) // 呼ばれていることが確認できればいいのでgomock.Any()で対応
 
 				// commander
-				mockCommander.EXPECT().execGoRun("test.go").Return([]byte{}, nil).Times(1)
+				mockCommander.EXPECT().execGoRun(gomock.Any(), gomock.Any(), "test.go", gomock.Any(), gomock.Any()).Return(nil).Times(1)
 
 				// importPathResolver
 				mockImportPathResolver.EXPECT().resolve(types.PkgName("pkg")).Return(types.ImportPath(`"github.com/test/pkg"`), nil).Times(1)
@@ -694,7 +781,7 @@ func TestExecutor_Execute(t *testing.T) {
 				mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1) // 呼ばれていることが確認できればいいのでgomock.Any()で対応
 
 				// commander
-				mockCommander.EXPECT().execGoRun("test.go").Return([]byte{}, nil).Times(1)
+				mockCommander.EXPECT().execGoRun(gomock.Any(), gomock.Any(), "test.go", gomock.Any(), gomock.Any()).Return(nil).Times(1)
 
 				// importPathResolver
 				mockImportPathResolver.EXPECT().resolve(types.PkgName("pkg")).Return(types.ImportPath(`"github.com/test/pkg"`), nil).Times(1)
@@ -786,7 +873,7 @@ func TestExecutor_Execute(t *testing.T) {
 				mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1) // 呼ばれていることが確認できればいいのでgomock.Any()で対応
 
 				// commander
-				mockCommander.EXPECT().execGoRun("test.go").Return([]byte{}, nil).Times(1)
+				mockCommander.EXPECT().execGoRun(gomock.Any(), gomock.Any(), "test.go", gomock.Any(), gomock.Any()).Return(nil).Times(1)
 
 				// importPathResolver
 				mockImportPathResolver.EXPECT().resolve(types.PkgName("pkg")).Return(types.ImportPath(`"github.com/test/pkg"`), nil).Times(1)
@@ -861,7 +948,7 @@ func TestExecutor_Execute(t *testing.T) {
 				mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1) // 呼ばれていることが確認できればいいのでgomock.Any()で対応
 
 				// commander
-				mockCommander.EXPECT().execGoRun("test.go").Return([]byte{}, nil).Times(1)
+				mockCommander.EXPECT().execGoRun(gomock.Any(), gomock.Any(), "test.go", gomock.Any(), gomock.Any()).Return(nil).Times(1)
 			},
 			expectedSessionSrc: &ast.File{
 				Name: &ast.Ident{Name: "main"},
@@ -914,89 +1001,27 @@ func TestExecutor_Execute(t *testing.T) {
 
 				gomock.InOrder(
 					// 関数呼び出しを追加してflushする時
-					mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(sessionSrcAddedCallExpr *ast.File, targetFile *os.File, fset *token.FileSet) error {
-						// この時のsessionSrcの状態を確認する
-						// この途中経過の状態をテストするやり方が微妙なので、要改善
-						expectedSessionSrc := &ast.File{
-							Name: &ast.Ident{Name: "main"},
-							Decls: []ast.Decl{
-								&ast.GenDecl{
-									Tok: token.IMPORT,
-									Specs: []ast.Spec{
-										&ast.ImportSpec{
-											Path: &ast.BasicLit{
-												Kind:  token.STRING,
-												Value: `"github.com/test/pkg"`,
-											},
-										},
-										&ast.ImportSpec{
-											Path: &ast.BasicLit{
-												Kind:  token.STRING,
-												Value: `"fmt"`,
-											},
-										},
-									},
-								},
-								&ast.FuncDecl{
-									Name: &ast.Ident{Name: "main"},
-									Type: &ast.FuncType{
-										Params:  &ast.FieldList{List: nil},
-										Results: nil,
-									},
-									Body: &ast.BlockStmt{
-										List: []ast.Stmt{
-											&ast.ExprStmt{
-												X: &ast.CallExpr{
-													Fun: &ast.Ident{Name: "fmt.Println"},
-													Args: []ast.Expr{&ast.CallExpr{
-														Fun: &ast.SelectorExpr{
-															X:   &ast.Ident{Name: "pkg"},
-															Sel: &ast.Ident{Name: "Function"},
-														},
-														Args: nil,
-													}},
-												},
-											},
-										},
-									},
-								},
-							},
-							Imports: []*ast.ImportSpec{
-								{
-									Path: &ast.BasicLit{
-										Kind:  token.STRING,
-										Value: `"github.com/test/pkg"`,
-									},
-								},
-								{
-									Path: &ast.BasicLit{
-										Kind:  token.STRING,
-										Value: `"fmt"`,
-									},
-								},
-							},
-						}
-
-						cmpOpts := []cmp.Option{
-							cmpopts.IgnoreFields(ast.Ident{}, "Obj", "NamePos"),
-							cmpopts.IgnoreFields(ast.CallExpr{}, "Lparen", "Rparen"),
-						}
-
-						if diff := cmp.Diff(expectedSessionSrc, sessionSrcAddedCallExpr, cmpOpts...); diff != "" {
-							t.Errorf("mismatch (-want +got):\n%s", diff)
-						}
-
+					mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(runSrc *ast.File, targetFile *os.File, fset *token.FileSet) error {
+						// 式は評価結果を表示するランタイムの呼び出しで囲まれて評価結果の変数に束縛され、ランタイムを含めて実行される
+						assertDisplayRunSrc(t, runSrc, `func main() {
+	it := gonsoleDisplay(pkg.Function())
+	_ = it
+}`, []string{`"github.com/test/pkg"`})
+						return nil
+					}).Times(1),
+					// 変数の登録には、表示のランタイムの代わりにスタブを含めたsessionSrcを書き込み直す
+					mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(registerSrc *ast.File, targetFile *os.File, fset *token.FileSet) error {
+						assertDisplayRegisterSrc(t, registerSrc)
 						return nil
 					}).Times(1),
 				)
 
 				// commander
-				mockCommander.EXPECT().execGoRun("test.go").Return([]byte{}, nil).Times(1)
+				mockCommander.EXPECT().execGoRun(gomock.Any(), gomock.Any(), "test.go", gomock.Any(), gomock.Any()).Return(nil).Times(1)
 
 				// importPathResolver
 				gomock.InOrder(
 					mockImportPathResolver.EXPECT().resolve(types.PkgName("pkg")).Return(types.ImportPath(`"github.com/test/pkg"`), nil).Times(1),
-					mockImportPathResolver.EXPECT().resolve(types.PkgName("fmt")).Return(types.ImportPath(`"fmt"`), nil).Times(1),
 				)
 			},
 			expectedSessionSrc: &ast.File{
@@ -1042,89 +1067,27 @@ func TestExecutor_Execute(t *testing.T) {
 				}).Times(1)
 				gomock.InOrder(
 					// 関数呼び出しを追加してflushする時
-					mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(sessionSrcAddedCallExpr *ast.File, targetFile *os.File, fset *token.FileSet) error {
-						// この時のsessionSrcの状態を確認する
-						// この途中経過の状態をテストするやり方が微妙なので、要改善
-						expectedSessionSrc := &ast.File{
-							Name: &ast.Ident{Name: "main"},
-							Decls: []ast.Decl{
-								&ast.GenDecl{
-									Tok: token.IMPORT,
-									Specs: []ast.Spec{
-										&ast.ImportSpec{
-											Path: &ast.BasicLit{
-												Kind:  token.STRING,
-												Value: `"github.com/test/pkg"`,
-											},
-										},
-										&ast.ImportSpec{
-											Path: &ast.BasicLit{
-												Kind:  token.STRING,
-												Value: `"fmt"`,
-											},
-										},
-									},
-								},
-								&ast.FuncDecl{
-									Name: &ast.Ident{Name: "main"},
-									Type: &ast.FuncType{
-										Params:  &ast.FieldList{List: nil},
-										Results: nil,
-									},
-									Body: &ast.BlockStmt{
-										List: []ast.Stmt{
-											&ast.ExprStmt{
-												X: &ast.CallExpr{
-													Fun: &ast.Ident{Name: "fmt.Println"},
-													Args: []ast.Expr{&ast.CallExpr{
-														Fun: &ast.SelectorExpr{
-															X:   &ast.Ident{Name: "pkg"},
-															Sel: &ast.Ident{Name: "Function"},
-														},
-														Args: nil,
-													}},
-												},
-											},
-										},
-									},
-								},
-							},
-							Imports: []*ast.ImportSpec{
-								{
-									Path: &ast.BasicLit{
-										Kind:  token.STRING,
-										Value: `"github.com/test/pkg"`,
-									},
-								},
-								{
-									Path: &ast.BasicLit{
-										Kind:  token.STRING,
-										Value: `"fmt"`,
-									},
-								},
-							},
-						}
-
-						cmpOpts := []cmp.Option{
-							cmpopts.IgnoreFields(ast.Ident{}, "Obj", "NamePos"),
-							cmpopts.IgnoreFields(ast.CallExpr{}, "Lparen", "Rparen"),
-						}
-
-						if diff := cmp.Diff(expectedSessionSrc, sessionSrcAddedCallExpr, cmpOpts...); diff != "" {
-							t.Errorf("mismatch (-want +got):\n%s", diff)
-						}
-
+					mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(runSrc *ast.File, targetFile *os.File, fset *token.FileSet) error {
+						// 式は評価結果を表示するランタイムの呼び出しで囲まれて評価結果の変数に束縛され、ランタイムを含めて実行される
+						assertDisplayRunSrc(t, runSrc, `func main() {
+	it := gonsoleDisplay(pkg.Function())
+	_ = it
+}`, []string{`"github.com/test/pkg"`})
+						return nil
+					}).Times(1),
+					// 変数の登録には、表示のランタイムの代わりにスタブを含めたsessionSrcを書き込み直す
+					mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(registerSrc *ast.File, targetFile *os.File, fset *token.FileSet) error {
+						assertDisplayRegisterSrc(t, registerSrc)
 						return nil
 					}).Times(1),
 				)
 
 				// commander
-				mockCommander.EXPECT().execGoRun("test.go").Return([]byte{}, nil).Times(1)
+				mockCommander.EXPECT().execGoRun(gomock.Any(), gomock.Any(), "test.go", gomock.Any(), gomock.Any()).Return(nil).Times(1)
 
 				// importPathResolver
 				gomock.InOrder(
 					mockImportPathResolver.EXPECT().resolve(types.PkgName("pkg")).Return(types.ImportPath(`"github.com/test/pkg"`), nil).Times(1),
-					mockImportPathResolver.EXPECT().resolve(types.PkgName("fmt")).Return(types.ImportPath(`"fmt"`), nil).Times(1),
 				)
 			},
 			// 実際は"var x = pkg.Variable"のASTも含まれるが、ここでは省略
@@ -1185,86 +1148,31 @@ func TestExecutor_Execute(t *testing.T) {
 				}).Times(1)
 				gomock.InOrder(
 					// 関数呼び出しを追加してflushする時
-					mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(sessionSrcAddedCallExpr *ast.File, targetFile *os.File, fset *token.FileSet) error {
-						// この時のsessionSrcの状態を確認する
-						// この途中経過の状態をテストするやり方が微妙なので、要改善
-						//
+					mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(runSrc *ast.File, targetFile *os.File, fset *token.FileSet) error {
+						// 式は評価結果を表示するランタイムの呼び出しで囲まれて評価結果の変数に束縛され、ランタイムを含めて実行される
 						// 実際には、"var obj = pkg.NewObject()""に関連するASTも含まれるが、ここでは省略
-						expectedSessionSrc := &ast.File{
-							Name: &ast.Ident{Name: "main"},
-							Decls: []ast.Decl{
-								&ast.GenDecl{
-									Tok: token.IMPORT,
-									Specs: []ast.Spec{
-										&ast.ImportSpec{
-											Path: &ast.BasicLit{
-												Kind:  token.STRING,
-												Value: `"fmt"`,
-											},
-										},
-									},
-								},
-								&ast.FuncDecl{
-									Name: &ast.Ident{Name: "main"},
-									Type: &ast.FuncType{
-										Params:  &ast.FieldList{List: nil},
-										Results: nil,
-									},
-									Body: &ast.BlockStmt{
-										List: []ast.Stmt{
-											&ast.ExprStmt{
-												X: &ast.CallExpr{
-													Fun: &ast.Ident{Name: "fmt.Println"},
-													Args: []ast.Expr{&ast.CallExpr{
-														Fun: &ast.SelectorExpr{
-															X:   &ast.Ident{Name: "obj"},
-															Sel: &ast.Ident{Name: "Method"},
-														},
-														Args: nil,
-													}},
-												},
-											},
-										},
-									},
-								},
-							},
-							Imports: []*ast.ImportSpec{
-								{
-									Path: &ast.BasicLit{
-										Kind:  token.STRING,
-										Value: `"fmt"`,
-									},
-								},
-							},
-						}
-
-						cmpOpts := []cmp.Option{
-							cmpopts.IgnoreFields(ast.Ident{}, "Obj", "NamePos"),
-							cmpopts.IgnoreFields(ast.CallExpr{}, "Lparen", "Rparen"),
-						}
-
-						if diff := cmp.Diff(expectedSessionSrc, sessionSrcAddedCallExpr, cmpOpts...); diff != "" {
-							t.Errorf("mismatch (-want +got):\n%s", diff)
-						}
-
+						assertDisplayRunSrc(t, runSrc, `func main() {
+	it := gonsoleDisplay(obj.Method())
+	_ = it
+}`, nil)
+						return nil
+					}).Times(1),
+					// 変数の登録には、表示のランタイムの代わりにスタブを含めたsessionSrcを書き込み直す
+					mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(registerSrc *ast.File, targetFile *os.File, fset *token.FileSet) error {
+						assertDisplayRegisterSrc(t, registerSrc)
 						return nil
 					}).Times(1),
 				)
 
 				// commander
-				mockCommander.EXPECT().execGoRun("test.go").Return([]byte{}, nil).Times(1)
+				mockCommander.EXPECT().execGoRun(gomock.Any(), gomock.Any(), "test.go", gomock.Any(), gomock.Any()).Return(nil).Times(1)
 
 				// importPathResolver
-				mockImportPathResolver.EXPECT().resolve(types.PkgName("fmt")).Return(types.ImportPath(`"fmt"`), nil).Times(1)
 			},
 			// 実際は"var obj = pkg.NewObject()"に関連するASTも含まれるが、ここでは省略
 			expectedSessionSrc: &ast.File{
 				Name: &ast.Ident{Name: "main"},
 				Decls: []ast.Decl{
-					&ast.GenDecl{
-						Tok:   token.IMPORT,
-						Specs: []ast.Spec{},
-					},
 					&ast.FuncDecl{
 						Name: &ast.Ident{Name: "main"},
 						Type: &ast.FuncType{
@@ -1276,7 +1184,6 @@ func TestExecutor_Execute(t *testing.T) {
 						},
 					},
 				},
-				Imports: []*ast.ImportSpec{},
 			},
 		},
 		{
@@ -1301,92 +1208,31 @@ func TestExecutor_Execute(t *testing.T) {
 				}).Times(1)
 				gomock.InOrder(
 					// 関数呼び出しを追加してflushする時
-					mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(sessionSrcAddedCallExpr *ast.File, targetFile *os.File, fset *token.FileSet) error {
-						// この時のsessionSrcの状態を確認する
-						// この途中経過の状態をテストするやり方が微妙なので、要改善
-						//
+					mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(runSrc *ast.File, targetFile *os.File, fset *token.FileSet) error {
+						// 式は評価結果を表示するランタイムの呼び出しで囲まれて評価結果の変数に束縛され、ランタイムを含めて実行される
 						// 実際には、"var obj = pkg.NewObject()""に関連するASTも含まれるが、ここでは省略
-						expectedSessionSrc := &ast.File{
-							Name: &ast.Ident{Name: "main"},
-							Decls: []ast.Decl{
-								&ast.GenDecl{
-									Tok: token.IMPORT,
-									Specs: []ast.Spec{
-										&ast.ImportSpec{
-											Path: &ast.BasicLit{
-												Kind:  token.STRING,
-												Value: `"fmt"`,
-											},
-										},
-									},
-								},
-								&ast.FuncDecl{
-									Name: &ast.Ident{Name: "main"},
-									Type: &ast.FuncType{
-										Params:  &ast.FieldList{List: nil},
-										Results: nil,
-									},
-									Body: &ast.BlockStmt{
-										List: []ast.Stmt{
-											&ast.ExprStmt{
-												X: &ast.CallExpr{
-													Fun: &ast.Ident{Name: "fmt.Println"},
-													Args: []ast.Expr{&ast.CallExpr{
-														Fun: &ast.SelectorExpr{
-															X: &ast.CallExpr{
-																Fun: &ast.SelectorExpr{
-																	X:   &ast.Ident{Name: "obj"},
-																	Sel: &ast.Ident{Name: "Method1"},
-																},
-																Args: nil,
-															},
-															Sel: &ast.Ident{Name: "Method2"},
-														},
-														Args: nil,
-													}},
-												},
-											},
-										},
-									},
-								},
-							},
-							Imports: []*ast.ImportSpec{
-								{
-									Path: &ast.BasicLit{
-										Kind:  token.STRING,
-										Value: `"fmt"`,
-									},
-								},
-							},
-						}
-
-						cmpOpts := []cmp.Option{
-							cmpopts.IgnoreFields(ast.Ident{}, "Obj", "NamePos"),
-							cmpopts.IgnoreFields(ast.CallExpr{}, "Lparen", "Rparen"),
-						}
-
-						if diff := cmp.Diff(expectedSessionSrc, sessionSrcAddedCallExpr, cmpOpts...); diff != "" {
-							t.Errorf("mismatch (-want +got):\n%s", diff)
-						}
-
+						assertDisplayRunSrc(t, runSrc, `func main() {
+	it := gonsoleDisplay(obj.Method1().Method2())
+	_ = it
+}`, nil)
+						return nil
+					}).Times(1),
+					// 変数の登録には、表示のランタイムの代わりにスタブを含めたsessionSrcを書き込み直す
+					mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(registerSrc *ast.File, targetFile *os.File, fset *token.FileSet) error {
+						assertDisplayRegisterSrc(t, registerSrc)
 						return nil
 					}).Times(1),
 				)
 
 				// commander
-				mockCommander.EXPECT().execGoRun("test.go").Return([]byte{}, nil).Times(1)
+				mockCommander.EXPECT().execGoRun(gomock.Any(), gomock.Any(), "test.go", gomock.Any(), gomock.Any()).Return(nil).Times(1)
 
 				// importPathResolver
-				mockImportPathResolver.EXPECT().resolve(types.PkgName("fmt")).Return(types.ImportPath(`"fmt"`), nil).Times(1)
 			},
 			// 実際は"var obj = pkg.NewObject()"に関連するASTも含まれるが、ここでは省略
 			expectedSessionSrc: &ast.File{
 				Name: &ast.Ident{Name: "main"},
 				Decls: []ast.Decl{
-					&ast.GenDecl{
-						Tok:   token.IMPORT,
-						Specs: []ast.Spec{},
-					},
 					&ast.FuncDecl{
 						Name: &ast.Ident{Name: "main"},
 						Type: &ast.FuncType{
@@ -1398,7 +1244,6 @@ func TestExecutor_Execute(t *testing.T) {
 						},
 					},
 				},
-				Imports: []*ast.ImportSpec{},
 			},
 		},
 		{
@@ -1423,79 +1268,29 @@ func TestExecutor_Execute(t *testing.T) {
 				}).Times(1)
 				gomock.InOrder(
 					// 関数呼び出しを追加してflushする時
-					mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(sessionSrcAddedCallExpr *ast.File, targetFile *os.File, fset *token.FileSet) error {
-						// この時のsessionSrcの状態を確認する
-						// この途中経過の状態をテストするやり方が微妙なので、要改善
-						//
+					mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(runSrc *ast.File, targetFile *os.File, fset *token.FileSet) error {
+						// 式は評価結果を表示するランタイムの呼び出しで囲まれて評価結果の変数に束縛され、ランタイムを含めて実行される
 						// 実際には、"var x = 10""に関連するASTも含まれるが、ここでは省略
-						expectedSessionSrc := &ast.File{
-							Name: &ast.Ident{Name: "main"},
-							Decls: []ast.Decl{
-								&ast.GenDecl{
-									Tok: token.IMPORT,
-									Specs: []ast.Spec{
-										&ast.ImportSpec{
-											Path: &ast.BasicLit{
-												Kind:  token.STRING,
-												Value: `"fmt"`,
-											},
-										}},
-								},
-								&ast.FuncDecl{
-									Name: &ast.Ident{Name: "main"},
-									Type: &ast.FuncType{
-										Params:  &ast.FieldList{List: nil},
-										Results: nil,
-									},
-									Body: &ast.BlockStmt{
-										List: []ast.Stmt{
-											&ast.ExprStmt{
-												X: &ast.CallExpr{
-													Fun: &ast.Ident{Name: "fmt.Println"},
-													Args: []ast.Expr{
-														&ast.Ident{Name: "x"},
-													},
-												},
-											},
-										},
-									},
-								},
-							},
-							Imports: []*ast.ImportSpec{
-								{
-									Path: &ast.BasicLit{
-										Kind:  token.STRING,
-										Value: `"fmt"`,
-									},
-								},
-							},
-						}
-
-						cmpOpts := []cmp.Option{
-							cmpopts.IgnoreFields(ast.Ident{}, "Obj", "NamePos"),
-							cmpopts.IgnoreFields(ast.CallExpr{}, "Lparen", "Rparen"),
-						}
-
-						if diff := cmp.Diff(expectedSessionSrc, sessionSrcAddedCallExpr, cmpOpts...); diff != "" {
-							t.Errorf("mismatch (-want +got):\n%s", diff)
-						}
-
+						assertDisplayRunSrc(t, runSrc, `func main() {
+	it := gonsoleDisplay(x)
+	_ = it
+}`, nil)
+						return nil
+					}).Times(1),
+					// 変数の登録には、表示のランタイムの代わりにスタブを含めたsessionSrcを書き込み直す
+					mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(registerSrc *ast.File, targetFile *os.File, fset *token.FileSet) error {
+						assertDisplayRegisterSrc(t, registerSrc)
 						return nil
 					}).Times(1),
 				)
 
 				// commander
-				mockCommander.EXPECT().execGoRun("test.go").Return([]byte{}, nil).Times(1)
-				mockImportPathResolver.EXPECT().resolve(types.PkgName("fmt")).Return(types.ImportPath(`"fmt"`), nil).Times(1)
+				mockCommander.EXPECT().execGoRun(gomock.Any(), gomock.Any(), "test.go", gomock.Any(), gomock.Any()).Return(nil).Times(1)
 			},
 			// 実際は"var x = 10"のASTも含まれるが、ここでは省略
 			expectedSessionSrc: &ast.File{
 				Name: &ast.Ident{Name: "main"},
 				Decls: []ast.Decl{
-					&ast.GenDecl{
-						Tok:   token.IMPORT,
-						Specs: []ast.Spec{},
-					},
 					&ast.FuncDecl{
 						Name: &ast.Ident{Name: "main"},
 						Type: &ast.FuncType{
@@ -1507,7 +1302,6 @@ func TestExecutor_Execute(t *testing.T) {
 						},
 					},
 				},
-				Imports: []*ast.ImportSpec{},
 			},
 		},
 	}
@@ -1520,10 +1314,19 @@ func TestExecutor_Execute(t *testing.T) {
 			// テストではRegisterをスキップ
 			declregistry.SkipRegisterMode = true
 
-			sut, err := NewExecutor(registry)
+			var opts []Option
+			if tt.execMode != "" {
+				opts = append(opts, WithExecMode(tt.execMode))
+			}
+			sut, err := NewExecutor(registry, opts...)
 			if err != nil {
 				t.Fatalf("failed to create Executor: %v", err)
 			}
+			defer func() {
+				if err := sut.Close(); err != nil {
+					t.Errorf("failed to close Executor: %v", err)
+				}
+			}()
 
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
@@ -1544,6 +1347,7 @@ func TestExecutor_Execute(t *testing.T) {
 				cmpopts.IgnoreFields(ast.GenDecl{}, "TokPos", "Lparen", "Rparen"),
 				cmpopts.IgnoreFields(ast.CallExpr{}, "Lparen", "Rparen"),
 				cmpopts.IgnoreFields(ast.BasicLit{}, "ValuePos"),
+				ignoreValueEnd,
 				cmpopts.IgnoreFields(ast.UnaryExpr{}, "OpPos"),
 				cmpopts.IgnoreFields(ast.CompositeLit{}, "Lbrace", "Rbrace"),
 				cmpopts.IgnoreFields(ast.KeyValueExpr{}, "Colon"),
@@ -1564,6 +1368,7 @@ func TestExecutor_Execute_Error(t *testing.T) {
 		input              string
 		setupDeclRegistry  func(*declregistry.DeclRegistry)
 		setupMocks         func(*Mockfiler, *Mockcommander, *MockimportPathResolver)
+		timeout            time.Duration
 		expectedSessionSrc *ast.File
 		expectedErrMsg     string
 	}{
@@ -1607,9 +1412,9 @@ func TestExecutor_Execute_Error(t *testing.T) {
 				mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(2) // 呼ばれていることが確認できればいいのでgomock.Any()で対応
 
 				// commander
-				mockCommander.EXPECT().execGoRun("1769312920_gonsole_tmp.go").DoAndReturn(func(filename string) ([]byte, error) {
+				mockCommander.EXPECT().execGoRun(gomock.Any(), gomock.Any(), "1769312920_gonsole_tmp.go", gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, _ time.Duration, filename string, stdout, stderr io.Writer) error {
 					errMsg := "# command-line-arguments\n./1769312920_gonsole_tmp.go:3:2: undefined: x"
-					return []byte{}, &exec.ExitError{Stderr: []byte(errMsg)}
+					return &exec.ExitError{Stderr: []byte(errMsg)}
 				}).Times(1)
 			},
 			expectedSessionSrc: &ast.File{
@@ -1629,6 +1434,102 @@ func TestExecutor_Execute_Error(t *testing.T) {
 			},
 			expectedErrMsg: "\n\x1b[31m[BAD INPUT ERROR]\n \n1 errors found\n\nundefined: x\n\n\x1b[0m\n\n",
 		},
+		{
+			name:              "clean err element of sessionSrc when execution times out",
+			input:             "x := 1",
+			setupDeclRegistry: func(dr *declregistry.DeclRegistry) {},
+			setupMocks: func(mockFiler *Mockfiler, mockCommander *Mockcommander, mockImportPathResolver *MockimportPathResolver) {
+				// filer
+				mockFiler.EXPECT().createTmpFile().DoAndReturn(func() (tmpFile *os.File, tmpFileName string, cleanup func(), err error) {
+					r, w, _ := os.Pipe()
+					return w, "1769312920_gonsole_tmp.go", func() {
+						if err := r.Close(); err != nil {
+							t.Errorf("failed to close pipe: %v", err)
+						}
+					}, nil
+				}).Times(1)
+				mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(2) // 呼ばれていることが確認できればいいのでgomock.Any()で対応
+
+				// commander
+				// 終わらないプログラムは、実行を始めてから実行にかけられる時間を過ぎると終了させられる
+				mockCommander.EXPECT().execGoRun(gomock.Any(), 10*time.Millisecond, "1769312920_gonsole_tmp.go", gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, timeout time.Duration, filename string, stdout, stderr io.Writer) error {
+					// ビルドにかかる時間は実行にかけられる時間に含めない
+					if _, ok := ctx.Deadline(); ok {
+						return errors.New("build context has a deadline")
+					}
+					runCtx, cancel := withRunTimeout(ctx, timeout)
+					defer cancel()
+					<-runCtx.Done()
+					return runCtx.Err()
+				}).Times(1)
+			},
+			timeout: 10 * time.Millisecond,
+			expectedSessionSrc: &ast.File{
+				Name: &ast.Ident{Name: "main"},
+				Decls: []ast.Decl{
+					&ast.FuncDecl{
+						Name: &ast.Ident{Name: "main"},
+						Type: &ast.FuncType{
+							Params:  &ast.FieldList{List: nil},
+							Results: nil,
+						},
+						Body: &ast.BlockStmt{
+							List: []ast.Stmt{},
+						},
+					},
+				},
+			},
+			expectedErrMsg: "\n\x1b[31m[BAD INPUT ERROR]\n timed out after 10ms; the statement was discarded\x1b[0m\n\n",
+		},
+		{
+			name:              "clean err element of sessionSrc when program exits with error",
+			input:             `x := 1`,
+			setupDeclRegistry: func(dr *declregistry.DeclRegistry) {},
+			setupMocks: func(mockFiler *Mockfiler, mockCommander *Mockcommander, mockImportPathResolver *MockimportPathResolver) {
+				// filer
+				mockFiler.EXPECT().createTmpFile().DoAndReturn(func() (tmpFile *os.File, tmpFileName string, cleanup func(), err error) {
+					r, w, _ := os.Pipe()
+					return w, "1769312920_gonsole_tmp.go", func() {
+						if err := r.Close(); err != nil {
+							t.Errorf("failed to close pipe: %v", err)
+						}
+					}, nil
+				}).Times(1)
+				mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(2) // 呼ばれていることが確認できればいいのでgomock.Any()で対応
+
+				// commander
+				// プログラムの出力は実行中に書き出され、終了した状態だけがエラーとして表示される
+				mockCommander.EXPECT().execGoRun(gomock.Any(), gomock.Any(), "1769312920_gonsole_tmp.go", gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, _ time.Duration, filename string, stdout, stderr io.Writer) error {
+					if _, err := io.WriteString(stdout, "loading\n"); err != nil {
+						t.Errorf("failed to write stdout: %v", err)
+					}
+					if _, err := io.WriteString(stderr, "panic: boom\n"); err != nil {
+						t.Errorf("failed to write stderr: %v", err)
+					}
+					var exitErr *exec.ExitError
+					if !errors.As(exec.Command("go", "gonsole-unknown-command").Run(), &exitErr) {
+						t.Fatal("failed to get exit error")
+					}
+					return &programExitError{exitErr: exitErr}
+				}).Times(1)
+			},
+			expectedSessionSrc: &ast.File{
+				Name: &ast.Ident{Name: "main"},
+				Decls: []ast.Decl{
+					&ast.FuncDecl{
+						Name: &ast.Ident{Name: "main"},
+						Type: &ast.FuncType{
+							Params:  &ast.FieldList{List: nil},
+							Results: nil,
+						},
+						Body: &ast.BlockStmt{
+							List: []ast.Stmt{},
+						},
+					},
+				},
+			},
+			expectedErrMsg: "\n\x1b[32mloading\n\x1b[0m\x1b[33mpanic: boom\n\x1b[0m\n\n\x1b[31m[BAD INPUT ERROR]\n program exited with exit status 2\x1b[0m\n\n",
+		},
 		{
 			name:  "when commander returns error, clean err element of sessionSrc but import remains if other declarations use it",
 			input: "x := pkg.Variable", // x is already defined
@@ -1652,9 +1553,9 @@ func TestExecutor_Execute_Error(t *testing.T) {
 				mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(2) // 呼ばれていることが確認できればいいのでgomock.Any()で対応
 
 				// commander
-				mockCommander.EXPECT().execGoRun("1769312920_gonsole_tmp.go").DoAndReturn(func(filename string) ([]byte, error) {
+				mockCommander.EXPECT().execGoRun(gomock.Any(), gomock.Any(), "1769312920_gonsole_tmp.go", gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, _ time.Duration, filename string, stdout, stderr io.Writer) error {
 					errMsg := "# command-line-arguments\n./1769312920_gonsole_tmp.go:8:4: no new variables on left side of :="
-					return []byte{}, &exec.ExitError{Stderr: []byte(errMsg)}
+					return &exec.ExitError{Stderr: []byte(errMsg)}
 				}).Times(1)
 
 				// importPathResolver
@@ -1720,9 +1621,9 @@ func TestExecutor_Execute_Error(t *testing.T) {
 				mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(2) // 呼ばれていることが確認できればいいのでgomock.Any()で対応
 
 				// commander
-				mockCommander.EXPECT().execGoRun("1769312920_gonsole_tmp.go").DoAndReturn(func(filename string) ([]byte, error) {
+				mockCommander.EXPECT().execGoRun(gomock.Any(), gomock.Any(), "1769312920_gonsole_tmp.go", gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, _ time.Duration, filename string, stdout, stderr io.Writer) error {
 					errMsg := "# command-line-arguments\n./1769312920_gonsole_tmp.go:8:4: no new variables on left side of :="
-					return []byte{}, &exec.ExitError{Stderr: []byte(errMsg)}
+					return &exec.ExitError{Stderr: []byte(errMsg)}
 				}).Times(1)
 
 				// importPathResolver
@@ -1755,7 +1656,7 @@ func TestExecutor_Execute_Error(t *testing.T) {
 			registry := declregistry.NewRegistry()
 			declregistry.SkipRegisterMode = true
 
-			sut, err := NewExecutor(registry)
+			sut, err := NewExecutor(registry, WithTimeout(tt.timeout))
 			if err != nil {
 				t.Fatalf("failed to create Executor: %v", err)
 			}
@@ -1786,8 +1687,8 @@ func TestExecutor_Execute_Error(t *testing.T) {
 
 			sut.Execute(tt.input)
 
-			if importPathAddedInSession != "" {
-				t.Fatalf("importPathAddedInSession should be empty, but got %q", importPathAddedInSession)
+			if len(importsAddedInSession) != 0 {
+				t.Fatalf("importsAddedInSession should be empty, but got %v", importsAddedInSession)
 			}
 
 			// パイプを閉じて出力を読み取る
@@ -1814,6 +1715,7 @@ func TestExecutor_Execute_Error(t *testing.T) {
 				cmpopts.IgnoreFields(ast.GenDecl{}, "TokPos", "Lparen", "Rparen"),
 				cmpopts.IgnoreFields(ast.CallExpr{}, "Lparen", "Rparen"),
 				cmpopts.IgnoreFields(ast.BasicLit{}, "ValuePos"),
+				ignoreValueEnd,
 				cmpopts.IgnoreFields(ast.UnaryExpr{}, "OpPos"),
 				cmpopts.IgnoreFields(ast.CompositeLit{}, "Lbrace", "Rbrace"),
 				cmpopts.IgnoreFields(ast.KeyValueExpr{}, "Colon"),
@@ -1827,3 +1729,218 @@ func TestExecutor_Execute_Error(t *testing.T) {
 		})
 	}
 }
+
+func TestExecutor_writeInSessionSrc_ControlFlow(t *testing.T) {
+	tests := []struct {
+		name             string
+		input            string
+		decls            []declregistry.Decl
+		resolvedPkgNames []types.PkgName
+		expectedSrc      string
+		expectedErrMsg   string
+	}{
+		{
+			name:  "for statement with package reference",
+			input: "for i := 0; i < 3; i++ { x += utils.Twice(i) }",
+			decls: []declregistry.Decl{
+				{Name: "x", TypeName: "int", TypeExpr: "int"},
+			},
+			resolvedPkgNames: []types.PkgName{"utils"},
+			expectedSrc: `package main
+
+import "example.com/app/utils"
+
+func main() {
+	for i := 0; i < 3; i++ {
+		x += utils.Twice(i)
+	}
+}
+`,
+		},
+		{
+			name:  "variables declared inside statement are not packages",
+			input: "for _, d := range dogs { fmt.Println(d.Bark()) }",
+			decls: []declregistry.Decl{
+				{Name: "dogs", TypeName: "[]*animal.Dog", TypeExpr: "[]*animal.Dog"},
+			},
+			resolvedPkgNames: []types.PkgName{"fmt"},
+			expectedSrc: `package main
+
+import "fmt"
+
+func main() {
+	for _, d := range dogs {
+		fmt.Println(d.Bark())
+	}
+}
+`,
+		},
+		{
+			name:  "increment statement",
+			input: "x++",
+			decls: []declregistry.Decl{
+				{Name: "x", TypeName: "int", TypeExpr: "int"},
+			},
+			expectedSrc: `package main
+
+func main() {
+	x++
+}
+`,
+		},
+		{
+			name:  "assignment from binary expression",
+			input: "y := x + strings.Count(s, \"a\")",
+			decls: []declregistry.Decl{
+				{Name: "x", TypeName: "int", TypeExpr: "int"},
+				{Name: "s", TypeName: "string", TypeExpr: "string"},
+			},
+			resolvedPkgNames: []types.PkgName{"strings"},
+			expectedSrc: `package main
+
+import "strings"
+
+func main() {
+	y := x + strings.Count(s, "a")
+	_ = y
+}
+`,
+		},
+		{
+			name:           "return statement is unsupported",
+			input:          "return",
+			expectedErrMsg: "unsupported statement type",
+		},
+	}
+
+	importPaths := map[types.PkgName]types.ImportPath{
+		"utils":   `"example.com/app/utils"`,
+		"fmt":     `"fmt"`,
+		"strings": `"strings"`,
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockImportPathResolver := NewMockimportPathResolver(ctrl)
+			for _, pkgName := range tt.resolvedPkgNames {
+				mockImportPathResolver.EXPECT().resolve(pkgName).Return(importPaths[pkgName], nil).Times(1)
+			}
+			defer clearImportsAddedInSession()
+
+			registry := declregistry.NewRegistry()
+			registry.Decls = append(registry.Decls, tt.decls...)
+			sut := &Executor{
+				declRegistry:       registry,
+				sessionSrc:         initSessionSrc(),
+				importPathResolver: mockImportPathResolver,
+			}
+
+			err := sut.writeInSessionSrc(tt.input)
+			if tt.expectedErrMsg != "" {
+				if err == nil || err.Error() != tt.expectedErrMsg {
+					t.Errorf("expected error %q, got %v", tt.expectedErrMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("writeInSessionSrc() returned an error: %v", err)
+			}
+
+			got, err := sut.Source()
+			if err != nil {
+				t.Fatalf("Source() returned an error: %v", err)
+			}
+			if diff := cmp.Diff(tt.expectedSrc, got); diff != "" {
+				t.Errorf("session source mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestIsIncompleteInput(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected bool
+	}{
+		{
+			name:     "complete statement",
+			input:    "x := 1 + 2",
+			expected: false,
+		},
+		{
+			name:     "complete statement across lines",
+			input:    "x := []int{\n1,\n2,\n}",
+			expected: false,
+		},
+		{
+			name:     "unclosed brace",
+			input:    "for i := 0; i < 3; i++ {",
+			expected: true,
+		},
+		{
+			name:     "unclosed composite literal with fields",
+			input:    "d := animal.Dog{\nName: \"Pochi\",",
+			expected: true,
+		},
+		{
+			name:     "unclosed parenthesis",
+			input:    "fmt.Println(1,",
+			expected: true,
+		},
+		{
+			name:     "trailing binary operator",
+			input:    "x := 1 +",
+			expected: true,
+		},
+		{
+			name:     "unclosed function declaration",
+			input:    "func double(n int) int {",
+			expected: true,
+		},
+		{
+			name:     "unclosed type declaration",
+			input:    "type Counter struct {\nValue int",
+			expected: true,
+		},
+		{
+			name:     "complete method declaration",
+			input:    "func (c *Counter) Inc() {\nc.Value++\n}",
+			expected: false,
+		},
+		{
+			name:     "else without following block",
+			input:    "if x > 0 {\n} else",
+			expected: true,
+		},
+		{
+			name:     "unterminated raw string literal",
+			input:    "s := `line1",
+			expected: true,
+		},
+		{
+			name:     "syntax error inside input",
+			input:    "x := )",
+			expected: false,
+		},
+		{
+			name:     "too many closing braces",
+			input:    "x := 1 }",
+			expected: false,
+		},
+		{
+			name:     "empty input",
+			input:    "",
+			expected: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := IsIncompleteInput(tt.input)
+			if got != tt.expected {
+				t.Errorf("IsIncompleteInput(%q) = %v, want %v", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
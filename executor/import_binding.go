@@ -0,0 +1,38 @@
+package executor
+
+import (
+	"fmt"
+
+	"github.com/kakkky/gonsole/errs"
+	"github.com/kakkky/gonsole/types"
+)
+
+// BindImportPath はパッケージ名に対して使うimportパスを確定させる
+// セッションですでに別のimportパスのパッケージをその名前でimportしている場合は、変更できない
+func (e *Executor) BindImportPath(pkgName types.PkgName, importPath types.ImportPath) error {
+	actualPkgName, err := e.lookupPkgName(importPath)
+	if err != nil {
+		return err
+	}
+	if actualPkgName != pkgName {
+		return errs.NewBadInputError(fmt.Sprintf("package %s is named %s, not %s", importPath, actualPkgName, pkgName))
+	}
+	for _, importSpec := range e.sessionSrc.Imports {
+		if importName(importSpec) == string(pkgName) && importSpec.Path.Value != string(importPath) {
+			return errs.NewBadInputError(fmt.Sprintf("%s is already imported from %s in the session", pkgName, importSpec.Path.Value))
+		}
+	}
+	e.bind(pkgName, importPath)
+	return nil
+}
+
+// UnbindImportPath はパッケージ名に対して確定させたimportパスを取り消す
+// 次にそのパッケージ名を参照した時に、改めて候補から選択することになる
+func (e *Executor) UnbindImportPath(pkgName types.PkgName) {
+	e.unbind(pkgName)
+}
+
+// ImportPathBindings はパッケージ名ごとに確定させたimportパスを返す
+func (e *Executor) ImportPathBindings() map[types.PkgName]types.ImportPath {
+	return e.bindings()
+}
@@ -0,0 +1,154 @@
+package executor
+
+import (
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kakkky/gonsole/declregistry"
+	"github.com/kakkky/gonsole/pkgindex"
+	"github.com/kakkky/gonsole/types"
+	"go.uber.org/mock/gomock"
+)
+
+func TestExecutor_BindImportPath(t *testing.T) {
+	tests := []struct {
+		name             string
+		sessionSrc       string
+		pkgName          types.PkgName
+		importPath       types.ImportPath
+		goListPkgName    string
+		expectedBindings map[types.PkgName]types.ImportPath
+		expectedErrMsg   string
+	}{
+		{
+			name:          "bind import path",
+			sessionSrc:    "package main\n\nfunc main() {\n}\n",
+			pkgName:       "utils",
+			importPath:    `"example.com/app/plant/utils"`,
+			goListPkgName: "utils",
+			expectedBindings: map[types.PkgName]types.ImportPath{
+				"utils": `"example.com/app/plant/utils"`,
+			},
+		},
+		{
+			name:           "package name does not match",
+			sessionSrc:     "package main\n\nfunc main() {\n}\n",
+			pkgName:        "utils",
+			importPath:     `"strings"`,
+			goListPkgName:  "strings",
+			expectedErrMsg: `package "strings" is named strings, not utils`,
+		},
+		{
+			name: "package name is already imported from another path",
+			sessionSrc: `package main
+
+import "example.com/app/animal/utils"
+
+func main() {
+	s := utils.FormatAnimalName("Pochi")
+	_ = s
+}
+`,
+			pkgName:        "utils",
+			importPath:     `"example.com/app/plant/utils"`,
+			goListPkgName:  "utils",
+			expectedErrMsg: `utils is already imported from "example.com/app/animal/utils" in the session`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockCommander := NewMockcommander(ctrl)
+			mockCommander.EXPECT().execGoListPkgName(gomock.Any()).Return([]byte(tt.goListPkgName+"\n"), nil).Times(1)
+
+			sessionSrc, err := parser.ParseFile(token.NewFileSet(), "", tt.sessionSrc, 0)
+			if err != nil {
+				t.Fatalf("failed to parse session source: %v", err)
+			}
+			sut := &Executor{
+				sessionSrc:         sessionSrc,
+				commander:          mockCommander,
+				importPathResolver: newDefaultImportPathResolver(pkgindex.New(t.TempDir())),
+			}
+
+			err = sut.BindImportPath(tt.pkgName, tt.importPath)
+			if tt.expectedErrMsg != "" {
+				if err == nil || err.Error() != tt.expectedErrMsg {
+					t.Errorf("expected error %q, got %v", tt.expectedErrMsg, err)
+				}
+				if len(sut.ImportPathBindings()) != 0 {
+					t.Errorf("expected no bindings, got %v", sut.ImportPathBindings())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BindImportPath() returned an error: %v", err)
+			}
+			if diff := cmp.Diff(tt.expectedBindings, sut.ImportPathBindings()); diff != "" {
+				t.Errorf("ImportPathBindings() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewExecutor_WithImportPathBindings(t *testing.T) {
+	tests := []struct {
+		name             string
+		bindings         map[types.PkgName]types.ImportPath
+		expectedBindings map[types.PkgName]types.ImportPath
+		expectedErrMsg   string
+	}{
+		{
+			name: "bindings matching package names are used",
+			bindings: map[types.PkgName]types.ImportPath{
+				"strings": `"strings"`,
+				"rand":    `"math/rand/v2"`,
+			},
+			expectedBindings: map[types.PkgName]types.ImportPath{
+				"strings": `"strings"`,
+				"rand":    `"math/rand/v2"`,
+			},
+		},
+		{
+			name: "binding to package with another name is rejected",
+			bindings: map[types.PkgName]types.ImportPath{
+				"utils": `"strings"`,
+			},
+			expectedErrMsg: `invalid import path for package utils in config: package "strings" is named strings, not utils`,
+		},
+		{
+			name: "binding to missing package is rejected",
+			bindings: map[types.PkgName]types.ImportPath{
+				"missing": `"example.com/gonsole/missing"`,
+			},
+			expectedErrMsg: `invalid import path for package missing in config: package "example.com/gonsole/missing" is not found`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sut, err := NewExecutor(declregistry.NewRegistry(), WithImportPathBindings(tt.bindings), WithPkgIndex(pkgindex.New(t.TempDir())))
+			if tt.expectedErrMsg != "" {
+				if err == nil || err.Error() != tt.expectedErrMsg {
+					t.Errorf("expected error %q, got %v", tt.expectedErrMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewExecutor() returned an error: %v", err)
+			}
+			defer func() {
+				if err := sut.Close(); err != nil {
+					t.Errorf("failed to close Executor: %v", err)
+				}
+			}()
+			if diff := cmp.Diff(tt.expectedBindings, sut.ImportPathBindings()); diff != "" {
+				t.Errorf("ImportPathBindings() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package executor
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/kakkky/gonsole/declregistry"
+	"github.com/kakkky/gonsole/errs"
+	"github.com/kakkky/gonsole/types"
+)
+
+// parseImportDecl は入力値がimport宣言であればパースして返す
+func parseImportDecl(input string) (*ast.GenDecl, bool) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", wrapTopLevelInput(input), 0)
+	if err != nil || len(file.Decls) != 1 {
+		return nil, false
+	}
+	genDecl, ok := file.Decls[0].(*ast.GenDecl)
+	if !ok || genDecl.Tok != token.IMPORT {
+		return nil, false
+	}
+	return genDecl, true
+}
+
+// declareImports はimport宣言で指定されたパッケージを、セッションで参照する名前とともに登録する
+// 使われていないimportはビルドエラーになるので、セッションへの追加はパッケージが参照されるまで遅らせる
+// ブランクimportは参照されることがないので、そのままセッションに追加する
+func (e *Executor) declareImports(importDecl *ast.GenDecl) error {
+	var imports []declregistry.Import
+	for _, spec := range importDecl.Specs {
+		importSpec := spec.(*ast.ImportSpec)
+		if importSpec.Name != nil && importSpec.Name.Name == "." {
+			return errs.NewBadInputError("dot imports are not supported in the console")
+		}
+		importPath := types.ImportPath(importSpec.Path.Value)
+		pkgName, err := e.lookupPkgName(importPath)
+		if err != nil {
+			return err
+		}
+		name := pkgName
+		if importSpec.Name != nil {
+			name = types.PkgName(importSpec.Name.Name)
+		}
+		imports = append(imports, declregistry.Import{Name: name, PkgName: pkgName, ImportPath: importPath})
+	}
+
+	for _, imp := range imports {
+		if imp.Name == "_" {
+			addImportSpec(e.sessionSrc, newImportSpec(imp.Name, imp.ImportPath))
+			continue
+		}
+		e.declRegistry.RegisterImport(imp)
+	}
+	return nil
+}
+
+// lookupPkgName はimportパスが指すパッケージの名前を返す
+// パッケージ名はimportパスの末尾と一致するとは限らないので(例: gopkg.in/yaml.v3)、go listで調べる
+func (e *Executor) lookupPkgName(importPath types.ImportPath) (types.PkgName, error) {
+	unquoted, err := strconv.Unquote(string(importPath))
+	if err != nil {
+		return "", errs.NewBadInputError(fmt.Sprintf("invalid import path %s", importPath))
+	}
+	cmdOut, err := e.execGoListPkgName(unquoted)
+	if err != nil {
+		return "", errs.NewBadInputError(fmt.Sprintf("package %s is not found", importPath))
+	}
+	return types.PkgName(strings.TrimSpace(string(cmdOut))), nil
+}
+
+// newImportSpec はパッケージを指定した名前で参照するimportを生成する
+// 名前がimportパスの末尾と同じであれば、名前は省略する
+func newImportSpec(name types.PkgName, importPath types.ImportPath) *ast.ImportSpec {
+	importSpec := &ast.ImportSpec{
+		Path: &ast.BasicLit{
+			Kind:  token.STRING,
+			Value: string(importPath),
+		},
+	}
+	unquoted, err := strconv.Unquote(string(importPath))
+	if err != nil || types.PkgName(path.Base(unquoted)) != name {
+		importSpec.Name = ast.NewIdent(string(name))
+	}
+	return importSpec
+}
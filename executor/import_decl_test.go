@@ -0,0 +1,194 @@
+package executor
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kakkky/gonsole/declregistry"
+	"github.com/kakkky/gonsole/types"
+	"go.uber.org/mock/gomock"
+)
+
+func TestExecutor_declareImports(t *testing.T) {
+	tests := []struct {
+		name            string
+		input           string
+		pkgNames        map[string]string
+		expectedImports []declregistry.Import
+		expectedSrc     string
+		expectedErrMsg  string
+	}{
+		{
+			name:     "import without alias",
+			input:    `import "math/rand"`,
+			pkgNames: map[string]string{"math/rand": "rand"},
+			expectedImports: []declregistry.Import{
+				{Name: "rand", PkgName: "rand", ImportPath: `"math/rand"`},
+			},
+			expectedSrc: "package main\n\nfunc main() {\n}\n",
+		},
+		{
+			name:     "grouped imports with alias",
+			input:    "import (\nmrand \"math/rand\"\n\"gopkg.in/yaml.v3\"\n)",
+			pkgNames: map[string]string{"math/rand": "rand", "gopkg.in/yaml.v3": "yaml"},
+			expectedImports: []declregistry.Import{
+				{Name: "mrand", PkgName: "rand", ImportPath: `"math/rand"`},
+				{Name: "yaml", PkgName: "yaml", ImportPath: `"gopkg.in/yaml.v3"`},
+			},
+			expectedSrc: "package main\n\nfunc main() {\n}\n",
+		},
+		{
+			name:            "blank import is added to session",
+			input:           `import _ "embed"`,
+			pkgNames:        map[string]string{"embed": "embed"},
+			expectedImports: nil,
+			expectedSrc:     "package main\n\nimport _ \"embed\"\n\nfunc main() {\n}\n",
+		},
+		{
+			name:           "dot import is not supported",
+			input:          `import . "strings"`,
+			expectedErrMsg: "dot imports are not supported in the console",
+		},
+		{
+			name:           "package not found",
+			input:          `import "example.com/notfound"`,
+			pkgNames:       map[string]string{},
+			expectedErrMsg: `package "example.com/notfound" is not found`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockCommander := NewMockcommander(ctrl)
+			mockCommander.EXPECT().execGoListPkgName(gomock.Any()).DoAndReturn(func(importPath string) ([]byte, error) {
+				pkgName, ok := tt.pkgNames[importPath]
+				if !ok {
+					return nil, errors.New("exit status 1")
+				}
+				return []byte(pkgName + "\n"), nil
+			}).AnyTimes()
+
+			registry := declregistry.NewRegistry()
+			sut := &Executor{
+				declRegistry: registry,
+				sessionSrc:   initSessionSrc(),
+				commander:    mockCommander,
+			}
+
+			importDecl, ok := parseImportDecl(tt.input)
+			if !ok {
+				t.Fatalf("parseImportDecl(%q) did not parse import declaration", tt.input)
+			}
+			err := sut.declareImports(importDecl)
+			if tt.expectedErrMsg != "" {
+				if err == nil || err.Error() != tt.expectedErrMsg {
+					t.Errorf("expected error %q, got %v", tt.expectedErrMsg, err)
+				}
+				if len(registry.Imports) != 0 {
+					t.Errorf("expected no imports to be registered, got %v", registry.Imports)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("declareImports() returned an error: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.expectedImports, registry.Imports); diff != "" {
+				t.Errorf("registered imports mismatch (-want +got):\n%s", diff)
+			}
+			got, err := sut.Source()
+			if err != nil {
+				t.Fatalf("Source() returned an error: %v", err)
+			}
+			if diff := cmp.Diff(tt.expectedSrc, got); diff != "" {
+				t.Errorf("session source mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExecutor_writeInSessionSrc_DeclaredImport(t *testing.T) {
+	tests := []struct {
+		name             string
+		input            string
+		resolvedPkgNames []types.PkgName
+		expectedSrc      string
+	}{
+		{
+			name:  "alias is used without resolving",
+			input: "n := mrand.Intn(10)",
+			expectedSrc: `package main
+
+import mrand "math/rand"
+
+func main() {
+	n := mrand.Intn(10)
+	_ = n
+}
+`,
+		},
+		{
+			name:  "package name different from import path",
+			input: `b, err := yaml.Marshal("a")`,
+			expectedSrc: `package main
+
+import yaml "gopkg.in/yaml.v3"
+
+func main() {
+	b, err := yaml.Marshal("a")
+	_ = b
+	_ = err
+}
+`,
+		},
+		{
+			name:             "undeclared package is resolved as before",
+			input:            "r := rand.Intn(10)",
+			resolvedPkgNames: []types.PkgName{"rand"},
+			expectedSrc: `package main
+
+import "crypto/rand"
+
+func main() {
+	r := rand.Intn(10)
+	_ = r
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockImportPathResolver := NewMockimportPathResolver(ctrl)
+			for _, pkgName := range tt.resolvedPkgNames {
+				mockImportPathResolver.EXPECT().resolve(pkgName).Return(types.ImportPath(`"crypto/rand"`), nil).Times(1)
+			}
+			defer clearImportsAddedInSession()
+
+			registry := declregistry.NewRegistry()
+			registry.RegisterImport(declregistry.Import{Name: "mrand", PkgName: "rand", ImportPath: `"math/rand"`})
+			registry.RegisterImport(declregistry.Import{Name: "yaml", PkgName: "yaml", ImportPath: `"gopkg.in/yaml.v3"`})
+			sut := &Executor{
+				declRegistry:       registry,
+				sessionSrc:         initSessionSrc(),
+				importPathResolver: mockImportPathResolver,
+			}
+
+			if err := sut.writeInSessionSrc(tt.input); err != nil {
+				t.Fatalf("writeInSessionSrc() returned an error: %v", err)
+			}
+			got, err := sut.Source()
+			if err != nil {
+				t.Fatalf("Source() returned an error: %v", err)
+			}
+			if diff := cmp.Diff(tt.expectedSrc, got); diff != "" {
+				t.Errorf("session source mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
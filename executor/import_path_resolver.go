@@ -2,65 +2,82 @@ package executor
 
 import (
 	"fmt"
-	"path"
+	"maps"
 	"slices"
-	"strings"
 
 	"github.com/kakkky/go-prompt"
 	"github.com/kakkky/gonsole/errs"
+	"github.com/kakkky/gonsole/pkgindex"
 	"github.com/kakkky/gonsole/types"
 )
 
 //go:generate mockgen -package=executor -source=./import_path_resolver.go -destination=./import_path_resolver_mock.go
 type importPathResolver interface {
 	resolve(pkgName types.PkgName) (importPath types.ImportPath, err error)
+	bind(pkgName types.PkgName, importPath types.ImportPath)
+	unbind(pkgName types.PkgName)
+	bindings() map[types.PkgName]types.ImportPath
 }
 
 type defaultImportPathResolver struct {
-	commander
+	pkgIndex *pkgindex.Index
+	// boundImportPaths はパッケージ名ごとに確定させたimportパス
+	// 候補から選択したものや設定ファイルで指定されたものを保持し、セッション中は選択を求めないようにする
+	boundImportPaths map[types.PkgName]types.ImportPath
 }
 
-func newDefaultImportPathResolver(cmd commander) *defaultImportPathResolver {
+func newDefaultImportPathResolver(pkgIndex *pkgindex.Index) *defaultImportPathResolver {
 	return &defaultImportPathResolver{
-		commander: cmd,
+		pkgIndex:         pkgIndex,
+		boundImportPaths: make(map[types.PkgName]types.ImportPath),
 	}
 }
 
 func (dipr *defaultImportPathResolver) resolve(pkgName types.PkgName) (types.ImportPath, error) {
+	if importPath, ok := dipr.boundImportPaths[pkgName]; ok {
+		return importPath, nil
+	}
+
 	var importPathCandidates []types.ImportPath
 
 	if stdpkgImportPaths, ok := stdPkgImportPathMap[pkgName]; ok {
 		importPathCandidates = append(importPathCandidates, stdpkgImportPaths...)
 	}
 
-	cmdOut, err := dipr.execGoListAll()
+	projectImportPaths, err := dipr.pkgIndex.ImportPathsOf(pkgName)
 	if err != nil {
 		return "", errs.NewInternalError("failed to resolve import path").Wrap(err)
 	}
-
-	allImportPaths := strings.Split(string(cmdOut), "\n")
-	for _, importPath := range allImportPaths {
-		if importPath == "" {
-			continue
-		}
-		if types.PkgName(path.Base(importPath)) == pkgName {
-			quoted := fmt.Sprintf(`"%s"`, importPath)
-			importPathCandidates = append(importPathCandidates, types.ImportPath(quoted))
-		}
-	}
+	importPathCandidates = append(importPathCandidates, projectImportPaths...)
 
 	if len(importPathCandidates) == 1 {
 		return importPathCandidates[0], nil
 	}
 
-	// 複数候補がある場合はユーザーに選択させる
+	// 複数候補がある場合はユーザーに選択させ、選択したものはセッション中に覚えておく
 	selectedImportPath, err := selectImportPathRepl(importPathCandidates)
 	if err != nil {
 		return "", err
 	}
+	dipr.bind(pkgName, selectedImportPath)
 	return selectedImportPath, nil
 }
 
+// bind はパッケージ名に対して使うimportパスを確定させる
+func (dipr *defaultImportPathResolver) bind(pkgName types.PkgName, importPath types.ImportPath) {
+	dipr.boundImportPaths[pkgName] = importPath
+}
+
+// unbind はパッケージ名に対して確定させたimportパスを取り消す。次に参照した時に改めて解決する
+func (dipr *defaultImportPathResolver) unbind(pkgName types.PkgName) {
+	delete(dipr.boundImportPaths, pkgName)
+}
+
+// bindings はパッケージ名ごとに確定させたimportパスを返す
+func (dipr *defaultImportPathResolver) bindings() map[types.PkgName]types.ImportPath {
+	return maps.Clone(dipr.boundImportPaths)
+}
+
 func selectImportPathRepl(importPathCandidates []types.ImportPath) (types.ImportPath, error) {
 	toBlue := func(s string) string {
 		colorBlue := "\033[94m"
@@ -38,6 +38,32 @@ func (m *MockimportPathResolver) EXPECT() *MockimportPathResolverMockRecorder {
 	return m.recorder
 }
 
+// bind mocks base method.
+func (m *MockimportPathResolver) bind(pkgName types.PkgName, importPath types.ImportPath) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "bind", pkgName, importPath)
+}
+
+// bind indicates an expected call of bind.
+func (mr *MockimportPathResolverMockRecorder) bind(pkgName, importPath any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "bind", reflect.TypeOf((*MockimportPathResolver)(nil).bind), pkgName, importPath)
+}
+
+// bindings mocks base method.
+func (m *MockimportPathResolver) bindings() map[types.PkgName]types.ImportPath {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "bindings")
+	ret0, _ := ret[0].(map[types.PkgName]types.ImportPath)
+	return ret0
+}
+
+// bindings indicates an expected call of bindings.
+func (mr *MockimportPathResolverMockRecorder) bindings() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "bindings", reflect.TypeOf((*MockimportPathResolver)(nil).bindings))
+}
+
 // resolve mocks base method.
 func (m *MockimportPathResolver) resolve(pkgName types.PkgName) (types.ImportPath, error) {
 	m.ctrl.T.Helper()
@@ -52,3 +78,15 @@ func (mr *MockimportPathResolverMockRecorder) resolve(pkgName any) *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "resolve", reflect.TypeOf((*MockimportPathResolver)(nil).resolve), pkgName)
 }
+
+// unbind mocks base method.
+func (m *MockimportPathResolver) unbind(pkgName types.PkgName) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "unbind", pkgName)
+}
+
+// unbind indicates an expected call of unbind.
+func (mr *MockimportPathResolverMockRecorder) unbind(pkgName any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "unbind", reflect.TypeOf((*MockimportPathResolver)(nil).unbind), pkgName)
+}
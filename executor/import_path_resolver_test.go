@@ -0,0 +1,94 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kakkky/gonsole/pkgindex"
+	"github.com/kakkky/gonsole/types"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestDefaultImportPathResolver_resolve(t *testing.T) {
+	tests := []struct {
+		name             string
+		pkgName          types.PkgName
+		boundImportPaths map[types.PkgName]types.ImportPath
+		expected         types.ImportPath
+	}{
+		{
+			name:     "single candidate in project",
+			pkgName:  "animal",
+			expected: `"example.com/app/animal"`,
+		},
+		{
+			name:    "bound import path is used without looking up candidates",
+			pkgName: "utils",
+			boundImportPaths: map[types.PkgName]types.ImportPath{
+				"utils": `"example.com/app/plant/utils"`,
+			},
+			expected: `"example.com/app/plant/utils"`,
+		},
+		{
+			name:    "bound import path takes precedence over standard packages",
+			pkgName: "rand",
+			boundImportPaths: map[types.PkgName]types.ImportPath{
+				"rand": `"math/rand"`,
+			},
+			expected: `"math/rand"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pkgIndex := newPkgIndexForTest(t)
+			sut := newDefaultImportPathResolver(pkgIndex)
+			for pkgName, importPath := range tt.boundImportPaths {
+				sut.bind(pkgName, importPath)
+			}
+
+			got, err := sut.resolve(tt.pkgName)
+			if err != nil {
+				t.Fatalf("resolve() returned an error: %v", err)
+			}
+			if diff := cmp.Diff(tt.expected, got); diff != "" {
+				t.Errorf("resolve() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDefaultImportPathResolver_unbind(t *testing.T) {
+	sut := newDefaultImportPathResolver(newPkgIndexForTest(t))
+	sut.bind("animal", `"example.com/other/animal"`)
+	sut.unbind("animal")
+
+	// 取り消した後は改めて解決する
+	got, err := sut.resolve("animal")
+	if err != nil {
+		t.Fatalf("resolve() returned an error: %v", err)
+	}
+	if diff := cmp.Diff(types.ImportPath(`"example.com/app/animal"`), got); diff != "" {
+		t.Errorf("resolve() mismatch (-want +got):\n%s", diff)
+	}
+	if len(sut.bindings()) != 0 {
+		t.Errorf("expected no bindings, got %v", sut.bindings())
+	}
+}
+
+// newPkgIndexForTest はサンプルプロジェクトのパッケージを登録した索引を生成する
+// 索引の対象ディレクトリは変更されないので、索引が作り直されることはない
+func newPkgIndexForTest(t *testing.T) *pkgindex.Index {
+	t.Helper()
+	pkgIndex := pkgindex.New(t.TempDir())
+	err := pkgIndex.Set([]*packages.Package{
+		{Name: "main", PkgPath: "example.com/app"},
+		{Name: "animal", PkgPath: "example.com/app/animal"},
+		{Name: "utils", PkgPath: "example.com/app/animal/utils"},
+		{Name: "utils", PkgPath: "example.com/app/plant/utils"},
+	})
+	if err != nil {
+		t.Fatalf("failed to set packages: %v", err)
+	}
+	return pkgIndex
+}
@@ -0,0 +1,54 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/kakkky/gonsole/errs"
+)
+
+// ParseTimeout は文字列を1回の実行にかけられる時間に変換する
+// "0"や"off"は制限しないことを表す
+func ParseTimeout(timeout string) (time.Duration, error) {
+	if timeout == "off" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(timeout)
+	if err != nil || d < 0 {
+		return 0, errs.NewBadInputError(fmt.Sprintf("invalid timeout %q (e.g. 30s, 1m, off)", timeout))
+	}
+	return d, nil
+}
+
+// Timeout は1回の実行にかけられる時間を返す。0の場合は制限しない
+func (e *Executor) Timeout() time.Duration {
+	return e.timeout
+}
+
+// SetTimeout は1回の実行にかけられる時間を変更する。次の実行から反映される
+func (e *Executor) SetTimeout(timeout time.Duration) {
+	e.timeout = timeout
+}
+
+// newExecContext は実行中にCtrl+Cが押されると終了するcontextを生成する
+// 実行中の端末はCtrl+Cをシグナルとして送るので、その間だけgonsole自体が終了しないように受け取る
+// 実行にかけられる時間は、ビルドを含めないようにプログラムの実行を始めた時点から数える
+func (e *Executor) newExecContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt)
+}
+
+// canceledExecErr は実行が中断された場合に、中断された理由を表すエラーを返す
+// 中断されていなければ、実行時のエラーをそのまま返す
+func (e *Executor) canceledExecErr(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return errs.NewBadInputError(fmt.Sprintf("timed out after %s; the statement was discarded", e.timeout))
+	case errors.Is(ctx.Err(), context.Canceled):
+		return errs.NewBadInputError("interrupted; the statement was discarded")
+	}
+	return err
+}
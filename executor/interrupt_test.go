@@ -0,0 +1,33 @@
+package executor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		name      string
+		timeout   string
+		expected  time.Duration
+		expectErr bool
+	}{
+		{name: "seconds", timeout: "30s", expected: 30 * time.Second},
+		{name: "minutes", timeout: "1m30s", expected: 90 * time.Second},
+		{name: "zero disables timeout", timeout: "0", expected: 0},
+		{name: "off disables timeout", timeout: "off", expected: 0},
+		{name: "without unit", timeout: "30", expectErr: true},
+		{name: "negative", timeout: "-1s", expectErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTimeout(tt.timeout)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ParseTimeout() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if got != tt.expected {
+				t.Errorf("ParseTimeout() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
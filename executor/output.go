@@ -0,0 +1,97 @@
+package executor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	stdoutColor      = "\033[32m"
+	stderrColor      = "\033[33m"
+	outputColorReset = "\033[0m"
+)
+
+// cmdOutput は実行中のプログラムの出力を、届いた順に端末へ書き出す
+// 標準出力と標準エラー出力は色を変えて区別し、標準出力に含まれる式の評価結果は表示せずに取り分けておく
+type cmdOutput struct {
+	mu       sync.Mutex
+	w        io.Writer
+	wrote    bool
+	lastByte byte
+	stdout   *displayResultWriter
+	stderr   io.Writer
+}
+
+func newCmdOutput(w io.Writer) *cmdOutput {
+	o := &cmdOutput{w: w}
+	o.stdout = newDisplayResultWriter(&coloredWriter{output: o, color: stdoutColor})
+	o.stderr = &coloredWriter{output: o, color: stderrColor}
+	return o
+}
+
+// coloredWriter は書き込まれた出力を、色を付けてcmdOutputに書き出す
+type coloredWriter struct {
+	output *cmdOutput
+	color  string
+}
+
+func (cw *coloredWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := cw.output.write(cw.color, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// write は標準出力と標準エラー出力から同時に書き込まれても、出力が混ざらないように書き出す
+func (o *cmdOutput) write(color string, p []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	// 最初の出力の前に空行を入れて、入力した行と区切る
+	var prefix string
+	if !o.wrote {
+		prefix = "\n"
+	}
+	if _, err := fmt.Fprint(o.w, prefix+color+string(p)+outputColorReset); err != nil {
+		return err
+	}
+	o.wrote = true
+	o.lastByte = p[len(p)-1]
+	return nil
+}
+
+// finish はプログラムの終了後に、保留していた出力を書き出して、出力の後に空行を入れる
+func (o *cmdOutput) finish() error {
+	if err := o.stdout.flush(); err != nil {
+		return err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.wrote {
+		return nil
+	}
+	suffix := "\n"
+	if o.lastByte != '\n' {
+		suffix = "\n\n"
+	}
+	_, err := fmt.Fprint(o.w, suffix)
+	return err
+}
+
+// splitAtMarker は出力を区切りの前と後に分ける
+// 区切りが見つからない場合は、末尾の区切りの先頭と一致する部分を、続きを受け取るまで保留するためにrestとして返す
+func splitAtMarker(data []byte, marker string) (out []byte, rest []byte, found bool) {
+	if idx := bytes.Index(data, []byte(marker)); idx >= 0 {
+		return data[:idx], data[idx+len(marker):], true
+	}
+	for n := min(len(marker)-1, len(data)); n > 0; n-- {
+		if bytes.HasSuffix(data, []byte(marker[:n])) {
+			return data[:len(data)-n], data[len(data)-n:], false
+		}
+	}
+	return data, nil, false
+}
@@ -0,0 +1,159 @@
+package executor
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCmdOutput(t *testing.T) {
+	const (
+		green = stdoutColor
+		amber = stderrColor
+		reset = outputColorReset
+	)
+	tests := []struct {
+		name     string
+		write    func(o *cmdOutput) error
+		expected string
+	}{
+		{
+			name:     "no output",
+			write:    func(o *cmdOutput) error { return nil },
+			expected: "",
+		},
+		{
+			name: "stdout and stderr are colored in the order they arrive",
+			write: func(o *cmdOutput) error {
+				if _, err := io.WriteString(o.stdout, "loading\n"); err != nil {
+					return err
+				}
+				if _, err := io.WriteString(o.stderr, "warning\n"); err != nil {
+					return err
+				}
+				_, err := io.WriteString(o.stdout, "done\n")
+				return err
+			},
+			expected: "\n" + green + "loading\n" + reset + amber + "warning\n" + reset + green + "done\n" + reset + "\n",
+		},
+		{
+			name: "output without trailing newline",
+			write: func(o *cmdOutput) error {
+				_, err := io.WriteString(o.stdout, "hello")
+				return err
+			},
+			expected: "\n" + green + "hello" + reset + "\n\n",
+		},
+		{
+			name: "results are not written",
+			write: func(o *cmdOutput) error {
+				_, err := io.WriteString(o.stdout, "hello\n"+displayResultMarker+`[{"type":"int","value":"1"}]`+"\n")
+				return err
+			},
+			expected: "\n" + green + "hello\n" + reset + "\n",
+		},
+		{
+			name: "only results",
+			write: func(o *cmdOutput) error {
+				_, err := io.WriteString(o.stdout, displayResultMarker+`[{"type":"int","value":"1"}]`+"\n")
+				return err
+			},
+			expected: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			sut := newCmdOutput(&out)
+			if err := tt.write(sut); err != nil {
+				t.Fatalf("failed to write output: %v", err)
+			}
+			if err := sut.finish(); err != nil {
+				t.Fatalf("finish() returned an error: %v", err)
+			}
+			if diff := cmp.Diff(tt.expected, out.String()); diff != "" {
+				t.Errorf("output mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSplitAtMarker(t *testing.T) {
+	const marker = "\x00mark\x00"
+	tests := []struct {
+		name          string
+		data          string
+		expectedOut   string
+		expectedRest  string
+		expectedFound bool
+	}{
+		{
+			name:        "no marker",
+			data:        "hello\n",
+			expectedOut: "hello\n",
+		},
+		{
+			name:          "marker",
+			data:          "hello" + marker + "bye",
+			expectedOut:   "hello",
+			expectedRest:  "bye",
+			expectedFound: true,
+		},
+		{
+			name:         "start of marker is held back",
+			data:         "hello\x00ma",
+			expectedOut:  "hello",
+			expectedRest: "\x00ma",
+		},
+		{
+			name:        "data which does not continue to marker",
+			data:        "hello\x00mx",
+			expectedOut: "hello\x00mx",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotOut, gotRest, gotFound := splitAtMarker([]byte(tt.data), marker)
+			if diff := cmp.Diff(tt.expectedOut, string(gotOut)); diff != "" {
+				t.Errorf("out mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.expectedRest, string(gotRest)); diff != "" {
+				t.Errorf("rest mismatch (-want +got):\n%s", diff)
+			}
+			if gotFound != tt.expectedFound {
+				t.Errorf("found = %v, want %v", gotFound, tt.expectedFound)
+			}
+		})
+	}
+}
+
+func TestForwardWorkerOutputs(t *testing.T) {
+	// 区切りが読み込みの途中で分かれても、文ごとの出力を順に書き出す
+	stdout := io.MultiReader(
+		strings.NewReader("first\n"+workerDoneMarker[:4]),
+		strings.NewReader(workerDoneMarker[4:]+"second"),
+		strings.NewReader("\n"+workerDoneMarker+"after exit"),
+	)
+	var out bytes.Buffer
+	done := make(chan struct{}, 1)
+	finished := make(chan struct{})
+	go func() {
+		forwardWorkerOutputs(stdout, &out, done)
+		close(finished)
+	}()
+
+	var doneCount int
+	for range done {
+		doneCount++
+	}
+	<-finished
+	if doneCount != 2 {
+		t.Errorf("done count = %d, want 2", doneCount)
+	}
+	if diff := cmp.Diff("first\nsecond\nafter exit", out.String()); diff != "" {
+		t.Errorf("output mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,143 @@
+package executor
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/kakkky/gonsole/errs"
+	"github.com/kakkky/gonsole/types"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+const (
+	// pkgSessionFileName は対象パッケージに組み込むセッションのファイル名
+	pkgSessionFileName = "gonsole_session.go"
+	// pkgSessionFuncName は対象パッケージに組み込むセッションの関数名
+	pkgSessionFuncName = "GonsoleSession"
+	overlayFileName    = "overlay.json"
+)
+
+// newPkgSessionDir は対象パッケージに組み込むセッションのファイルと、それを対象パッケージに差し込むoverlayの設定を置くディレクトリを作成する
+func (e *Executor) newPkgSessionDir() (string, error) {
+	dir, err := os.MkdirTemp("", "gonsole-pkg-session-")
+	if err != nil {
+		return "", errs.NewInternalError("failed to create package session directory").Wrap(err)
+	}
+
+	overlay := struct {
+		Replace map[string]string
+	}{
+		Replace: map[string]string{
+			e.pkgSessionFilePath(): filepath.Join(dir, pkgSessionFileName),
+		},
+	}
+	overlayJSON, err := json.Marshal(overlay)
+	if err != nil {
+		return "", errs.NewInternalError("failed to encode overlay").Wrap(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, overlayFileName), overlayJSON, 0o644); err != nil {
+		return "", errs.NewInternalError("failed to write overlay").Wrap(err)
+	}
+	return dir, nil
+}
+
+// pkgSessionFilePath は対象パッケージのディレクトリ上でのセッションのファイルのパスを返す
+// 実際にはこのパスにファイルは作らず、overlayで差し込む
+func (e *Executor) pkgSessionFilePath() string {
+	return filepath.Join(e.targetPkg.Dir, pkgSessionFileName)
+}
+
+func (e *Executor) overlayFilePath() string {
+	return filepath.Join(e.pkgSessionDir, overlayFileName)
+}
+
+// writePkgSessionFile はセッションを対象パッケージのファイルに変換して書き込む
+func (e *Executor) writePkgSessionFile(src *ast.File) error {
+	pkgSessionSrc, err := e.formatPkgSessionSrc(src)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(e.pkgSessionDir, pkgSessionFileName), pkgSessionSrc, 0o644); err != nil {
+		return errs.NewInternalError("failed to write package session file").Wrap(err)
+	}
+	return nil
+}
+
+func (e *Executor) formatPkgSessionSrc(src *ast.File) ([]byte, error) {
+	pkgSessionSrc, err := e.buildPkgSessionSrc(src)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, token.NewFileSet(), pkgSessionSrc); err != nil {
+		return nil, errs.NewInternalError("failed to format AST node").Wrap(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// buildPkgSessionSrc はmainパッケージのセッションを、対象パッケージに属するファイルに変換する
+// main関数はGonsoleSession関数になり、対象パッケージ自身への参照はパッケージ名を外して直接参照する形になる
+func (e *Executor) buildPkgSessionSrc(src *ast.File) (*ast.File, error) {
+	pkgSessionSrc, err := cloneFile(src)
+	if err != nil {
+		return nil, err
+	}
+	pkgSessionSrc.Name = ast.NewIdent(string(e.targetPkg.Name))
+	if mainFunc := getMainFunc(pkgSessionSrc); mainFunc != nil {
+		mainFunc.Name = ast.NewIdent(pkgSessionFuncName)
+	}
+
+	targetImportName := string(e.targetPkg.Name)
+	for _, importSpec := range pkgSessionSrc.Imports {
+		if importSpec.Path.Value == string(e.targetPkg.ImportPath) {
+			targetImportName = importName(importSpec)
+		}
+	}
+	astutil.Apply(pkgSessionSrc, func(cursor *astutil.Cursor) bool {
+		selectorExpr, ok := cursor.Node().(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		ident, ok := selectorExpr.X.(*ast.Ident)
+		if ok && ident.Name == targetImportName && !e.declRegistry.IsRegisteredDecl(types.DeclName(ident.Name)) {
+			cursor.Replace(selectorExpr.Sel)
+		}
+		return true
+	}, nil)
+
+	// 対象パッケージは自分自身をimportできない
+	isTargetImport := func(importSpec *ast.ImportSpec) bool {
+		return importSpec.Path.Value == string(e.targetPkg.ImportPath)
+	}
+	pkgSessionSrc.Imports = slices.DeleteFunc(pkgSessionSrc.Imports, isTargetImport)
+	pkgSessionSrc.Decls = slices.DeleteFunc(pkgSessionSrc.Decls, func(decl ast.Decl) bool {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.IMPORT {
+			return false
+		}
+		genDecl.Specs = slices.DeleteFunc(genDecl.Specs, func(spec ast.Spec) bool {
+			return isTargetImport(spec.(*ast.ImportSpec))
+		})
+		return len(genDecl.Specs) == 0
+	})
+	return pkgSessionSrc, nil
+}
+
+// pkgSessionMainSrc は対象パッケージに組み込んだセッションを呼び出すだけのmainパッケージのソースを返す
+func (e *Executor) pkgSessionMainSrc() (*ast.File, error) {
+	src := "package main\n\n" +
+		"import gonsoletarget " + string(e.targetPkg.ImportPath) + "\n\n" +
+		"func main() {\n\tgonsoletarget." + pkgSessionFuncName + "()\n}\n"
+	mainSrc, err := parser.ParseFile(token.NewFileSet(), "", src, 0)
+	if err != nil {
+		return nil, errs.NewInternalError("failed to parse package session main source").Wrap(err)
+	}
+	return mainSrc, nil
+}
@@ -0,0 +1,105 @@
+package executor
+
+import (
+	"bytes"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kakkky/gonsole/declregistry"
+	"github.com/kakkky/gonsole/targetpkg"
+)
+
+func TestExecutor_buildPkgSessionSrc(t *testing.T) {
+	tests := []struct {
+		name        string
+		sessionSrc  string
+		decls       []declregistry.Decl
+		expectedSrc string
+	}{
+		{
+			name: "references to target package are unqualified",
+			sessionSrc: `package main
+
+import (
+	"example.com/app/animal"
+	"fmt"
+)
+
+func main() {
+	c := animal.counter{n: 2}
+	_ = c
+	fmt.Println(animal.secret())
+}
+`,
+			expectedSrc: `package animal
+
+import (
+	"fmt"
+)
+
+func GonsoleSession() {
+	c := counter{n: 2}
+	_ = c
+	fmt.Println(secret())
+}
+`,
+		},
+		{
+			name: "other packages are kept",
+			sessionSrc: `package main
+
+import "example.com/app/utils"
+
+func main() {
+	x := utils.Twice(2)
+	_ = x
+}
+`,
+			expectedSrc: `package animal
+
+import "example.com/app/utils"
+
+func GonsoleSession() {
+	x := utils.Twice(2)
+	_ = x
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionSrc, err := parser.ParseFile(token.NewFileSet(), "", tt.sessionSrc, 0)
+			if err != nil {
+				t.Fatalf("failed to parse session source: %v", err)
+			}
+			registry := declregistry.NewRegistry()
+			registry.Decls = append(registry.Decls, tt.decls...)
+			sut := &Executor{
+				declRegistry: registry,
+				sessionSrc:   sessionSrc,
+				targetPkg: &targetpkg.TargetPkg{
+					Name:       "animal",
+					ImportPath: `"example.com/app/animal"`,
+					Dir:        "/app/animal",
+				},
+			}
+
+			got, err := sut.buildPkgSessionSrc(sessionSrc)
+			if err != nil {
+				t.Fatalf("buildPkgSessionSrc() returned an error: %v", err)
+			}
+
+			var gotSrc bytes.Buffer
+			if err := format.Node(&gotSrc, token.NewFileSet(), got); err != nil {
+				t.Fatalf("failed to format generated source: %v", err)
+			}
+			if diff := cmp.Diff(tt.expectedSrc, gotSrc.String()); diff != "" {
+				t.Errorf("package session source mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
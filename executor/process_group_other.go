@@ -0,0 +1,13 @@
+//go:build !unix
+
+package executor
+
+import "os/exec"
+
+// setProcessGroup はプロセスグループをサポートしない環境では何もしない
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup はプロセスグループをサポートしない環境では、コマンドのプロセスだけを終了させる
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
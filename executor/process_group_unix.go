@@ -0,0 +1,20 @@
+//go:build unix
+
+package executor
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup はコマンドを新しいプロセスグループで起動するようにする
+// 端末でCtrl+Cを押した時のシグナルがgonsoleにだけ届き、実行中のプログラムには届かないようにする
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessGroup はコマンドのプロセスグループを終了させる
+// `go run`から起動されたプログラムのように、コマンドが起動した子プロセスもまとめて終了させる
+func killProcessGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
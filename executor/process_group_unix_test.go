@@ -0,0 +1,61 @@
+//go:build unix
+
+package executor
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestNewCancelableCommand(t *testing.T) {
+	// 子プロセスが起動した孫プロセスが標準出力を開いたままにするので、
+	// プロセスグループごと終了させた場合にだけ、標準出力が閉じられる
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	defer r.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sut := newCancelableCommand(ctx, "sh", "-c", "sleep 60 & echo started; wait")
+	sut.Stdout = w
+	if err := sut.Start(); err != nil {
+		t.Fatalf("failed to start command: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close pipe: %v", err)
+	}
+
+	stdout := bufio.NewReader(r)
+	line, err := stdout.ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if line != "started\n" {
+		t.Fatalf("output = %q, want %q", line, "started\n")
+	}
+
+	cancel()
+	if err := sut.Wait(); err == nil {
+		t.Errorf("Wait() returned nil, want an error for the killed command")
+	}
+
+	closed := make(chan error, 1)
+	go func() {
+		_, err := io.ReadAll(stdout)
+		closed <- err
+	}()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("failed to read output: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Errorf("grandchild process is still running after the command was canceled")
+	}
+}
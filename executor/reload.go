@@ -0,0 +1,111 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/token"
+	"io"
+	"os/exec"
+
+	"github.com/kakkky/gonsole/errs"
+)
+
+// Reload はプロジェクトのコードが変わった後に、セッションの文を新しいコードに対して実行し直す
+// 変数の値と型の情報は実行し直した結果で置き換わる。実行結果の出力は表示しない
+// 新しいコードでセッションを実行できない場合はエラーを返し、次の入力を実行する前に改めて実行し直す
+func (e *Executor) Reload() error {
+	// 途中で失敗した場合は、変数の値や型の情報が変更後のコードと合わないまま残る
+	e.reloadPending = true
+	// ワーカーは変更前のコードのパッケージをリンクしているので、起動し直してからすべての文を実行し直す
+	// 一時ファイルがリンクするパッケージの読み込みに混ざらないように、一時ファイルを作る前に起動する
+	if e.execMode == ExecModeWorker {
+		if err := e.relaunchWorker(); err != nil {
+			return err
+		}
+	}
+	tmpFile, tmpFileName, cleanup, err := e.createTmpFile()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	defer func() {
+		if err := tmpFile.Close(); err != nil {
+			errs.HandleError(err)
+		}
+	}()
+	fset := token.NewFileSet()
+
+	runSrc := e.sessionSrc
+	switch e.execMode {
+	case ExecModeSnapshot:
+		// 保存済みの値は変更前のコードで作られたものなので復元せずに、すべての文を実行し直して保存し直す
+		runSrc, err = e.buildSnapshotSessionSrc(0)
+	case ExecModeWorker:
+		runSrc, err = e.buildWorkerPluginSrc(0)
+	}
+	if err != nil {
+		return err
+	}
+
+	if e.targetPkg != nil {
+		if err := e.writePkgSessionFile(runSrc); err != nil {
+			return err
+		}
+		runSrc, err = e.pkgSessionMainSrc()
+		if err != nil {
+			return err
+		}
+	}
+	if err := e.flush(runSrc, tmpFile, fset); err != nil {
+		return err
+	}
+	ctx, stop := e.newExecContext()
+	defer stop()
+	// 再実行による出力は表示せず、失敗した場合に原因として示すためにエラー出力だけを残す
+	var stderr bytes.Buffer
+	if err := e.execTmpFile(ctx, tmpFileName, io.Discard, &stderr); err != nil {
+		if ctx.Err() != nil {
+			return errs.NewBadInputError("reloading the session was interrupted").Wrap(ctx.Err())
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return errs.NewBadInputError(fmt.Sprintf("reloading the session timed out after %s", e.timeout)).Wrap(err)
+		}
+		return reloadErr(err, stderr.Bytes())
+	}
+
+	// 変数や関数の型が変わっている可能性があるので、すべての宣言を登録し直す
+	if e.targetPkg != nil {
+		pkgSessionSrc, err := e.formatPkgSessionSrc(e.sessionSrc)
+		if err != nil {
+			return err
+		}
+		err = e.declRegistry.RegisterAllInPackage(e.pkgSessionFilePath(), pkgSessionSrc, pkgSessionFuncName)
+		if err != nil {
+			return err
+		}
+	} else {
+		if err := e.flush(e.sessionSrc, tmpFile, fset); err != nil {
+			return err
+		}
+		if err := e.declRegistry.RegisterAll(tmpFileName); err != nil {
+			return err
+		}
+	}
+	e.reloadPending = false
+	return nil
+}
+
+// reloadErr はセッションを実行し直せなかった原因を、コンパイルエラーやプログラムのエラー出力を含めて返す
+func reloadErr(err error, stderr []byte) error {
+	var programExitErr *programExitError
+	if errors.As(err, &programExitErr) {
+		return errs.NewBadInputError(fmt.Sprintf("failed to reload the session: %s\n\n%s", programExitErr, stderr))
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return errs.NewBadInputError("failed to reload the session" + formatCmdErrMsg(string(exitErr.Stderr)))
+	}
+	return errs.NewInternalError("failed to reload the session").Wrap(err)
+}
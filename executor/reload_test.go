@@ -0,0 +1,117 @@
+package executor
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kakkky/gonsole/declregistry"
+	"go.uber.org/mock/gomock"
+)
+
+func TestExecutor_Reload(t *testing.T) {
+	tests := []struct {
+		name                  string
+		cmdErr                error
+		expectedErrMsg        string
+		expectedReloadPending bool
+	}{
+		{
+			name: "session is rerun against changed code",
+		},
+		{
+			name:                  "compile error keeps reload pending",
+			cmdErr:                &exec.ExitError{Stderr: []byte("# command-line-arguments\n./1769312920_gonsole_tmp.go:4:7: undefined: greet.Hello")},
+			expectedErrMsg:        "failed to reload the session\n1 errors found\n\nundefined: greet.Hello\n\n",
+			expectedReloadPending: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			declregistry.SkipRegisterMode = true
+			defer func() { declregistry.SkipRegisterMode = false }()
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockFiler := NewMockfiler(ctrl)
+			mockFiler.EXPECT().createTmpFile().DoAndReturn(func() (tmpFile *os.File, tmpFileName string, cleanup func(), err error) {
+				r, w, _ := os.Pipe()
+				return w, "test.go", func() {
+					if err := r.Close(); err != nil {
+						t.Fatalf("failed to close pipe reader: %v", err)
+					}
+				}, nil
+			}).Times(1)
+			mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+			mockCommander := NewMockcommander(ctrl)
+			mockCommander.EXPECT().execGoRun(gomock.Any(), gomock.Any(), "test.go", gomock.Any(), gomock.Any()).Return(tt.cmdErr).Times(1)
+
+			sut := &Executor{
+				declRegistry: declregistry.NewRegistry(),
+				sessionSrc:   initSessionSrc(),
+				execMode:     ExecModeReplay,
+				filer:        mockFiler,
+				commander:    mockCommander,
+			}
+
+			err := sut.Reload()
+			if tt.expectedErrMsg != "" {
+				if err == nil {
+					t.Fatalf("expected error %q, got nil", tt.expectedErrMsg)
+				}
+				if diff := cmp.Diff(tt.expectedErrMsg, err.Error()); diff != "" {
+					t.Errorf("error message mismatch (-want +got):\n%s", diff)
+				}
+			} else if err != nil {
+				t.Fatalf("Reload() returned an error: %v", err)
+			}
+			if sut.reloadPending != tt.expectedReloadPending {
+				t.Errorf("expected reloadPending %v, got %v", tt.expectedReloadPending, sut.reloadPending)
+			}
+		})
+	}
+}
+
+func TestExecutor_Execute_ReloadPending(t *testing.T) {
+	declregistry.SkipRegisterMode = true
+	defer func() { declregistry.SkipRegisterMode = false }()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockFiler := NewMockfiler(ctrl)
+	mockFiler.EXPECT().createTmpFile().DoAndReturn(func() (tmpFile *os.File, tmpFileName string, cleanup func(), err error) {
+		r, w, _ := os.Pipe()
+		return w, "test.go", func() {
+			if err := r.Close(); err != nil {
+				t.Fatalf("failed to close pipe reader: %v", err)
+			}
+		}, nil
+	}).Times(1)
+	mockFiler.EXPECT().flush(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	mockCommander := NewMockcommander(ctrl)
+	// 実行し直せない間は、入力された文を実行しない
+	mockCommander.EXPECT().execGoRun(gomock.Any(), gomock.Any(), "test.go", gomock.Any(), gomock.Any()).Return(&exec.ExitError{Stderr: []byte("undefined: greet.Hello")}).Times(1)
+
+	sut := &Executor{
+		declRegistry:  declregistry.NewRegistry(),
+		sessionSrc:    initSessionSrc(),
+		execMode:      ExecModeReplay,
+		reloadPending: true,
+		filer:         mockFiler,
+		commander:     mockCommander,
+	}
+	sut.Execute("x := 1")
+
+	got, err := sut.Source()
+	if err != nil {
+		t.Fatalf("Source() returned an error: %v", err)
+	}
+	if diff := cmp.Diff("package main\n\nfunc main() {\n}\n", got); diff != "" {
+		t.Errorf("session source mismatch (-want +got):\n%s", diff)
+	}
+	if !sut.reloadPending {
+		t.Error("expected reload to stay pending")
+	}
+}
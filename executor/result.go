@@ -0,0 +1,176 @@
+package executor
+
+import (
+	"go/ast"
+	"go/token"
+	"regexp"
+	"slices"
+
+	"github.com/kakkky/gonsole/errs"
+	"github.com/kakkky/gonsole/types"
+)
+
+// resultDeclName は式の評価結果を束縛する変数名
+// 式を入力するたびに再宣言され、それまでの評価結果は参照されていれば別名に付け替えて残す
+const resultDeclName types.DeclName = "it"
+
+// shadowedResultDeclNamePattern は再宣言により付け替えた、それまでの評価結果の変数名
+var shadowedResultDeclNamePattern = regexp.MustCompile(`^` + shadowedDeclPrefix + `\d+_` + string(resultDeclName) + `$`)
+
+// newResultBindingStmt は式の評価結果を表示して、itに束縛する`it := gonsoleDisplay(expr)`の形の文を生成する
+func newResultBindingStmt(expr ast.Expr) *ast.AssignStmt {
+	return &ast.AssignStmt{
+		Lhs: []ast.Expr{ast.NewIdent(string(resultDeclName))},
+		Tok: token.DEFINE,
+		Rhs: []ast.Expr{newDisplayCall(expr)},
+	}
+}
+
+// lastResultBinding はセッションの最後の入力が、式の評価結果を表示して束縛する文であれば、その文を返す
+func (e *Executor) lastResultBinding() (*ast.AssignStmt, bool) {
+	stmtGroups := groupSessionStmts(getMainFunc(e.sessionSrc).Body.List)
+	if len(stmtGroups) == 0 {
+		return nil, false
+	}
+	assignStmt, ok := stmtGroups[len(stmtGroups)-1][0].(*ast.AssignStmt)
+	if !ok || len(assignStmt.Rhs) != 1 {
+		return nil, false
+	}
+	if _, ok := displayedExprOf(assignStmt.Rhs[0]); !ok {
+		return nil, false
+	}
+	return assignStmt, true
+}
+
+// finishResultBinding は式の実行後に、評価結果を表示する呼び出しを外して、評価結果の変数の宣言としてセッションに残す
+// 複数の値を返す呼び出しでは、最初の値だけを束縛する（例: `it, _ := strconv.Atoi("1")`）
+// 評価結果の値の数が分からない場合（変数の登録に失敗した場合）は、宣言ごと取り消す
+func (e *Executor) finishResultBinding(resultCount int) {
+	bindingStmt, ok := e.lastResultBinding()
+	if !ok {
+		return
+	}
+	if resultCount == 0 {
+		if err := e.cleanErrElmFromSessionSrc(); err != nil {
+			errs.HandleError(err)
+		}
+		return
+	}
+	expr, _ := displayedExprOf(bindingStmt.Rhs[0])
+	bindingStmt.Rhs = []ast.Expr{expr}
+	for range resultCount - 1 {
+		bindingStmt.Lhs = append(bindingStmt.Lhs, ast.NewIdent("_"))
+	}
+	e.dropUnreferencedShadowedResults()
+}
+
+// dropUnreferencedShadowedResults は再宣言により付け替えた、それまでの評価結果の変数が参照されていなければ、宣言した文ごとセッションから削除する
+// 式を入力するたびに評価結果の変数が積み重なり、値を保持し続けたり再実行されたりしないようにする
+func (e *Executor) dropUnreferencedShadowedResults() {
+	stmtGroups := groupSessionStmts(getMainFunc(e.sessionSrc).Body.List)
+	removed := unreferencedResultGroups(stmtGroups, func(i int, declName types.DeclName) bool {
+		return shadowedResultDeclNamePattern.MatchString(string(declName))
+	})
+	if len(removed) == 0 {
+		return
+	}
+	var keptGroups, removedGroups [][]ast.Stmt
+	for i, stmtGroup := range stmtGroups {
+		if removed[i] {
+			removedGroups = append(removedGroups, stmtGroup)
+			continue
+		}
+		keptGroups = append(keptGroups, stmtGroup)
+	}
+	if _, err := e.removeStmtGroups(keptGroups, removedGroups); err != nil {
+		errs.HandleError(err)
+	}
+}
+
+// buildReplaySessionSrc はsessionSrcから、リプレイモードで実行するためのソースを組み立てる
+// 後の文から参照されていない評価結果の変数は、再実行しても値が使われないので宣言を省く
+func (e *Executor) buildReplaySessionSrc(executedStmtCount int) (*ast.File, error) {
+	skipped := unreferencedResultStmts(getMainFunc(e.sessionSrc).Body.List, executedStmtCount)
+	if len(skipped) == 0 {
+		return e.sessionSrc, nil
+	}
+	replaySrc, err := cloneFile(e.sessionSrc)
+	if err != nil {
+		return nil, err
+	}
+	mainFunc := getMainFunc(replaySrc)
+	skippedInReplaySrc := unreferencedResultStmts(mainFunc.Body.List, executedStmtCount)
+	mainFunc.Body.List = slices.DeleteFunc(mainFunc.Body.List, func(stmt ast.Stmt) bool {
+		return skippedInReplaySrc[stmt]
+	})
+	removeUnusedImports(replaySrc)
+	return replaySrc, nil
+}
+
+// unreferencedResultStmts は実行済みの文のうち、後の文から参照されていない評価結果の変数の宣言と、そのブランク代入を返す
+func unreferencedResultStmts(stmts []ast.Stmt, executedStmtCount int) map[ast.Stmt]bool {
+	stmtGroups := groupSessionStmts(stmts)
+	executedGroupCount := 0
+	for stmtIdx := 0; executedGroupCount < len(stmtGroups) && stmtIdx < executedStmtCount; executedGroupCount++ {
+		stmtIdx += len(stmtGroups[executedGroupCount])
+	}
+	skipped := make(map[ast.Stmt]bool)
+	for i := range unreferencedResultGroups(stmtGroups, func(i int, declName types.DeclName) bool {
+		return i < executedGroupCount && isResultDeclName(declName)
+	}) {
+		for _, stmt := range stmtGroups[i] {
+			skipped[stmt] = true
+		}
+	}
+	return skipped
+}
+
+// unreferencedResultGroups は評価結果の変数だけを宣言する文のグループのうち、対象になるもので、残る後の文から参照されていないものの位置を返す
+// 後ろから判定することで、取り除く評価結果の変数からしか参照されていない評価結果の変数もまとめて取り除く
+func unreferencedResultGroups(stmtGroups [][]ast.Stmt, isTarget func(i int, declName types.DeclName) bool) map[int]bool {
+	unreferenced := make(map[int]bool)
+	for i := len(stmtGroups) - 1; i >= 0; i-- {
+		declNames := declaredNamesOfStmt(stmtGroups[i][0])
+		if len(declNames) != 1 || !isTarget(i, declNames[0]) {
+			continue
+		}
+		isReferenced := false
+		for j := i + 1; j < len(stmtGroups) && !isReferenced; j++ {
+			if unreferenced[j] {
+				continue
+			}
+			isReferenced = slices.ContainsFunc(stmtGroups[j], func(stmt ast.Stmt) bool {
+				return referencesName(stmt, declNames[0])
+			})
+		}
+		if !isReferenced {
+			unreferenced[i] = true
+		}
+	}
+	return unreferenced
+}
+
+// isResultDeclName は変数名が評価結果の変数（再宣言により付け替えたものを含む）かを返す
+func isResultDeclName(name types.DeclName) bool {
+	return name == resultDeclName || shadowedResultDeclNamePattern.MatchString(string(name))
+}
+
+// referencesName はノード内で変数として識別子を参照しているかを返す
+// セレクタ部分は変数ではないので対象外にする
+func referencesName(node ast.Node, name types.DeclName) bool {
+	var found bool
+	ast.Inspect(node, func(node ast.Node) bool {
+		if found {
+			return false
+		}
+		switch nodeV := node.(type) {
+		case *ast.SelectorExpr:
+			found = referencesName(nodeV.X, name)
+			return false
+		case *ast.Ident:
+			found = nodeV.Name == string(name)
+		}
+		return true
+	})
+	return found
+}
@@ -0,0 +1,367 @@
+package executor
+
+import (
+	"bytes"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kakkky/gonsole/declregistry"
+)
+
+func TestExecutor_finishResultBinding(t *testing.T) {
+	tests := []struct {
+		name          string
+		sessionSrc    string
+		decls         []declregistry.Decl
+		shadowed      []shadowedDecl
+		resultCount   int
+		expectedSrc   string
+		expectedDecls []declregistry.Decl
+	}{
+		{
+			name: "single result is bound to it",
+			sessionSrc: `package main
+
+import "strings"
+
+func main() {
+	it := gonsoleDisplay(strings.ToUpper("a"))
+	_ = it
+}
+`,
+			decls: []declregistry.Decl{
+				{Name: "it", TypeName: "string", TypeExpr: "string"},
+			},
+			resultCount: 1,
+			expectedSrc: `package main
+
+import "strings"
+
+func main() {
+	it := strings.ToUpper("a")
+	_ = it
+}
+`,
+			expectedDecls: []declregistry.Decl{
+				{Name: "it", TypeName: "string", TypeExpr: "string"},
+			},
+		},
+		{
+			name: "only the first of multiple results is bound to it",
+			sessionSrc: `package main
+
+import "strconv"
+
+func main() {
+	it := gonsoleDisplay(strconv.Atoi("1"))
+	_ = it
+}
+`,
+			decls: []declregistry.Decl{
+				{Name: "it", TypeName: "int", TypeExpr: "int"},
+			},
+			resultCount: 2,
+			expectedSrc: `package main
+
+import "strconv"
+
+func main() {
+	it, _ := strconv.Atoi("1")
+	_ = it
+}
+`,
+			expectedDecls: []declregistry.Decl{
+				{Name: "it", TypeName: "int", TypeExpr: "int"},
+			},
+		},
+		{
+			name: "binding is removed when result count is unknown",
+			sessionSrc: `package main
+
+func main() {
+	x := 1
+	_ = x
+	it := gonsoleDisplay(x + 1)
+	_ = it
+}
+`,
+			decls: []declregistry.Decl{
+				{Name: "x", TypeName: "int", TypeExpr: "int"},
+			},
+			resultCount: 0,
+			expectedSrc: `package main
+
+func main() {
+	x := 1
+	_ = x
+}
+`,
+			expectedDecls: []declregistry.Decl{
+				{Name: "x", TypeName: "int", TypeExpr: "int"},
+			},
+		},
+		{
+			name: "unreferenced previous result is dropped",
+			sessionSrc: `package main
+
+func main() {
+	gonsoleShadowed1_it := 1
+	_ = gonsoleShadowed1_it
+	it := gonsoleDisplay(2)
+	_ = it
+}
+`,
+			decls: []declregistry.Decl{
+				{Name: "gonsoleShadowed1_it", TypeName: "int", TypeExpr: "int", Shadowed: true},
+				{Name: "it", TypeName: "int", TypeExpr: "int"},
+			},
+			shadowed:    []shadowedDecl{{name: "it", shadowedName: "gonsoleShadowed1_it"}},
+			resultCount: 1,
+			expectedSrc: `package main
+
+func main() {
+	it := 2
+	_ = it
+}
+`,
+			expectedDecls: []declregistry.Decl{
+				{Name: "it", TypeName: "int", TypeExpr: "int"},
+			},
+		},
+		{
+			name: "previous result referenced by the new result is kept",
+			sessionSrc: `package main
+
+func main() {
+	gonsoleShadowed1_it := 1
+	_ = gonsoleShadowed1_it
+	it := gonsoleDisplay(gonsoleShadowed1_it + 1)
+	_ = it
+}
+`,
+			decls: []declregistry.Decl{
+				{Name: "gonsoleShadowed1_it", TypeName: "int", TypeExpr: "int", Shadowed: true},
+				{Name: "it", TypeName: "int", TypeExpr: "int"},
+			},
+			shadowed:    []shadowedDecl{{name: "it", shadowedName: "gonsoleShadowed1_it"}},
+			resultCount: 1,
+			expectedSrc: `package main
+
+func main() {
+	gonsoleShadowed1_it := 1
+	_ = gonsoleShadowed1_it
+	it := gonsoleShadowed1_it + 1
+	_ = it
+}
+`,
+			expectedDecls: []declregistry.Decl{
+				{Name: "gonsoleShadowed1_it", TypeName: "int", TypeExpr: "int", Shadowed: true},
+				{Name: "it", TypeName: "int", TypeExpr: "int"},
+			},
+		},
+		{
+			name: "previous results referenced only by dropped results are dropped together",
+			sessionSrc: `package main
+
+func main() {
+	gonsoleShadowed1_it := 1
+	_ = gonsoleShadowed1_it
+	gonsoleShadowed2_it := gonsoleShadowed1_it + 1
+	_ = gonsoleShadowed2_it
+	x := 1
+	_ = x
+	it := gonsoleDisplay(x)
+	_ = it
+}
+`,
+			decls: []declregistry.Decl{
+				{Name: "gonsoleShadowed1_it", TypeName: "int", TypeExpr: "int", Shadowed: true},
+				{Name: "gonsoleShadowed2_it", TypeName: "int", TypeExpr: "int", Shadowed: true},
+				{Name: "x", TypeName: "int", TypeExpr: "int"},
+				{Name: "it", TypeName: "int", TypeExpr: "int"},
+			},
+			shadowed:    []shadowedDecl{{name: "it", shadowedName: "gonsoleShadowed2_it"}},
+			resultCount: 1,
+			expectedSrc: `package main
+
+func main() {
+	x := 1
+	_ = x
+	it := x
+	_ = it
+}
+`,
+			expectedDecls: []declregistry.Decl{
+				{Name: "x", TypeName: "int", TypeExpr: "int"},
+				{Name: "it", TypeName: "int", TypeExpr: "int"},
+			},
+		},
+		{
+			name: "input which is not an expression is left as is",
+			sessionSrc: `package main
+
+func main() {
+	x := 1
+	_ = x
+}
+`,
+			decls: []declregistry.Decl{
+				{Name: "x", TypeName: "int", TypeExpr: "int"},
+			},
+			resultCount: 1,
+			expectedSrc: `package main
+
+func main() {
+	x := 1
+	_ = x
+}
+`,
+			expectedDecls: []declregistry.Decl{
+				{Name: "x", TypeName: "int", TypeExpr: "int"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionSrc, err := parser.ParseFile(token.NewFileSet(), "", tt.sessionSrc, 0)
+			if err != nil {
+				t.Fatalf("failed to parse session source: %v", err)
+			}
+			registry := declregistry.NewRegistry()
+			registry.Decls = append(registry.Decls, tt.decls...)
+			sut := &Executor{
+				declRegistry:      registry,
+				sessionSrc:        sessionSrc,
+				shadowedInSession: tt.shadowed,
+			}
+
+			sut.finishResultBinding(tt.resultCount)
+
+			var gotSrc bytes.Buffer
+			if err := format.Node(&gotSrc, token.NewFileSet(), sut.sessionSrc); err != nil {
+				t.Fatalf("failed to format session source: %v", err)
+			}
+			if diff := cmp.Diff(tt.expectedSrc, gotSrc.String()); diff != "" {
+				t.Errorf("session source mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.expectedDecls, registry.Decls); diff != "" {
+				t.Errorf("decls mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExecutor_buildReplaySessionSrc(t *testing.T) {
+	tests := []struct {
+		name              string
+		sessionSrc        string
+		executedStmtCount int
+		expectedSrc       string
+	}{
+		{
+			name: "executed result which is not referenced is skipped",
+			sessionSrc: `package main
+
+import "strings"
+
+func main() {
+	gonsoleShadowed1_it := strings.ToUpper("a")
+	_ = gonsoleShadowed1_it
+	x := 1
+	_ = x
+	it := gonsoleDisplay(x)
+	_ = it
+}
+`,
+			executedStmtCount: 4,
+			expectedSrc: `package main
+
+func main() {
+	x := 1
+	_ = x
+	it := gonsoleDisplay(x)
+	_ = it
+}
+`,
+		},
+		{
+			name: "executed result referenced by later statements is kept",
+			sessionSrc: `package main
+
+import "strings"
+
+func main() {
+	it := strings.ToUpper("a")
+	_ = it
+	s := it + "b"
+	_ = s
+}
+`,
+			executedStmtCount: 2,
+			expectedSrc: `package main
+
+import "strings"
+
+func main() {
+	it := strings.ToUpper("a")
+	_ = it
+	s := it + "b"
+	_ = s
+}
+`,
+		},
+		{
+			name: "result which is not executed yet is kept",
+			sessionSrc: `package main
+
+func main() {
+	it := gonsoleDisplay(1)
+	_ = it
+}
+`,
+			executedStmtCount: 0,
+			expectedSrc: `package main
+
+func main() {
+	it := gonsoleDisplay(1)
+	_ = it
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionSrc, err := parser.ParseFile(token.NewFileSet(), "", tt.sessionSrc, 0)
+			if err != nil {
+				t.Fatalf("failed to parse session source: %v", err)
+			}
+			sut := &Executor{sessionSrc: sessionSrc}
+
+			got, err := sut.buildReplaySessionSrc(tt.executedStmtCount)
+			if err != nil {
+				t.Fatalf("buildReplaySessionSrc() returned an error: %v", err)
+			}
+
+			var gotSrc bytes.Buffer
+			if err := format.Node(&gotSrc, token.NewFileSet(), got); err != nil {
+				t.Fatalf("failed to format replay source: %v", err)
+			}
+			if diff := cmp.Diff(tt.expectedSrc, gotSrc.String()); diff != "" {
+				t.Errorf("replay source mismatch (-want +got):\n%s", diff)
+			}
+			// sessionSrc自体は書き換えない
+			var sessionSrcAfter bytes.Buffer
+			if err := format.Node(&sessionSrcAfter, token.NewFileSet(), sut.sessionSrc); err != nil {
+				t.Fatalf("failed to format session source: %v", err)
+			}
+			if diff := cmp.Diff(tt.sessionSrc, sessionSrcAfter.String()); diff != "" {
+				t.Errorf("session source was modified (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package executor
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io/fs"
+	"os"
+	"slices"
+
+	"github.com/kakkky/gonsole/errs"
+	"github.com/kakkky/gonsole/types"
+)
+
+// Undo は最後に実行した文をセッションから取り消す
+// 文で宣言した変数の登録も削除し、使われなくなったimportを削除する
+// 最後の入力が関数・メソッド・型の宣言だった場合は、その宣言を取り消す
+func (e *Executor) Undo() error {
+	stmtGroups := groupSessionStmts(getMainFunc(e.sessionSrc).Body.List)
+	if e.isLastInputTopLevelDecl(stmtGroups) {
+		e.revertLastTopLevelDeclChange()
+		removeUnusedImports(e.sessionSrc)
+		return nil
+	}
+	if len(stmtGroups) == 0 {
+		return errs.NewBadInputError("nothing to undo")
+	}
+	_, err := e.removeStmtGroups(stmtGroups[:len(stmtGroups)-1], stmtGroups[len(stmtGroups)-1:])
+	return err
+}
+
+// Drop は指定した変数を宣言した文と、その変数に依存するすべての文をセッションから削除する
+// 削除した文で宣言されていた変数名を返す
+func (e *Executor) Drop(name types.DeclName) ([]types.DeclName, error) {
+	if !e.declRegistry.IsRegisteredDecl(name) {
+		return nil, errs.NewBadInputError(fmt.Sprintf("%s is not declared", name))
+	}
+
+	// 削除する変数を参照する文で宣言された変数も、連鎖的に削除する
+	droppedNames := map[types.DeclName]bool{name: true}
+	var keptGroups, removedGroups [][]ast.Stmt
+	for _, stmtGroup := range groupSessionStmts(getMainFunc(e.sessionSrc).Body.List) {
+		stmt := stmtGroup[0]
+		isDependent := slices.ContainsFunc(declaredNamesOfStmt(stmt), func(declName types.DeclName) bool {
+			return droppedNames[declName]
+		}) || slices.ContainsFunc(e.referencedDeclNames(stmt), func(declName types.DeclName) bool {
+			return droppedNames[declName]
+		})
+		if !isDependent {
+			keptGroups = append(keptGroups, stmtGroup)
+			continue
+		}
+		removedGroups = append(removedGroups, stmtGroup)
+		for _, declName := range declaredNamesOfStmt(stmt) {
+			droppedNames[declName] = true
+		}
+	}
+	return e.removeStmtGroups(keptGroups, removedGroups)
+}
+
+// removeStmtGroups はsessionSrcの文をkeptGroupsだけにし、removedGroupsで宣言されていた変数の登録を削除する
+// スナップショットやワーカーが保持している値も、削除した文の影響が残らないように破棄する
+func (e *Executor) removeStmtGroups(keptGroups, removedGroups [][]ast.Stmt) ([]types.DeclName, error) {
+	mainFunc := getMainFunc(e.sessionSrc)
+	mainFunc.Body.List = slices.Concat(keptGroups...)
+	if mainFunc.Body.List == nil {
+		mainFunc.Body.List = []ast.Stmt{}
+	}
+	removeUnusedImports(e.sessionSrc)
+
+	stillDeclared := make(map[types.DeclName]bool)
+	for _, stmtGroup := range keptGroups {
+		for _, declName := range declaredNamesOfStmt(stmtGroup[0]) {
+			stillDeclared[declName] = true
+		}
+	}
+	var droppedNames, modifiedNames []types.DeclName
+	for _, stmtGroup := range removedGroups {
+		for _, declName := range declaredNamesOfStmt(stmtGroup[0]) {
+			if !stillDeclared[declName] && !slices.Contains(droppedNames, declName) {
+				droppedNames = append(droppedNames, declName)
+			}
+		}
+		// 削除した文で値を書き換えていた変数は、保持している値が削除後のセッションと食い違う
+		for _, declName := range e.modifiedNamesOfStmt(stmtGroup[0]) {
+			if stillDeclared[declName] && !slices.Contains(modifiedNames, declName) {
+				modifiedNames = append(modifiedNames, declName)
+			}
+		}
+	}
+	for _, declName := range droppedNames {
+		e.declRegistry.Unregister(declName)
+	}
+
+	switch e.execMode {
+	case ExecModeSnapshot:
+		// 値を破棄した変数は、次の実行時に宣言した文から再実行される
+		if err := deleteSnapshotKeys(e.snapshotPath(), slices.Concat(droppedNames, modifiedNames)); err != nil {
+			return nil, err
+		}
+	case ExecModeWorker:
+		if len(modifiedNames) > 0 {
+			if err := e.restartWorkerWithSessionSrc(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return droppedNames, nil
+}
+
+// restartWorkerWithSessionSrc はワーカーを起動し直し、現在のsessionSrcの文を実行して変数の値を復元する
+func (e *Executor) restartWorkerWithSessionSrc() error {
+	// 一時ファイルがリンクするパッケージの読み込みに混ざらないように、一時ファイルを作る前に起動する
+	if err := e.relaunchWorker(); err != nil {
+		return err
+	}
+	tmpFile, tmpFileName, cleanup, err := e.createTmpFile()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	defer func() {
+		if err := tmpFile.Close(); err != nil {
+			errs.HandleError(err)
+		}
+	}()
+	return e.restoreWorker(tmpFile, tmpFileName, token.NewFileSet())
+}
+
+// groupSessionStmts はsessionSrcの文を、入力ごとのまとまり（文とそれに続くブランク代入）に分ける
+func groupSessionStmts(stmts []ast.Stmt) [][]ast.Stmt {
+	var stmtGroups [][]ast.Stmt
+	for _, stmt := range stmts {
+		if len(stmtGroups) > 0 && isBlankAssignOf(stmt, declaredNamesOfStmt(stmtGroups[len(stmtGroups)-1][0])) {
+			stmtGroups[len(stmtGroups)-1] = append(stmtGroups[len(stmtGroups)-1], stmt)
+			continue
+		}
+		stmtGroups = append(stmtGroups, []ast.Stmt{stmt})
+	}
+	return stmtGroups
+}
+
+// isBlankAssignOf は文が宣言された変数のいずれかに対するブランク代入かを返す
+func isBlankAssignOf(stmt ast.Stmt, declNames []types.DeclName) bool {
+	if !isBlankAssignStmt(stmt) {
+		return false
+	}
+	ident, ok := stmt.(*ast.AssignStmt).Rhs[0].(*ast.Ident)
+	return ok && slices.Contains(declNames, types.DeclName(ident.Name))
+}
+
+// declaredNamesOfStmt は文で宣言される変数名と定数名を返す
+func declaredNamesOfStmt(stmt ast.Stmt) []types.DeclName {
+	if isConstDeclStmt(stmt) {
+		return constNamesOfStmt(stmt)
+	}
+	return declNamesOfStmt(stmt)
+}
+
+// modifiedNamesOfStmt は宣言以外の文で値を書き換えられる可能性のある変数名を返す
+// 代入やインクリメントの左辺の変数、アドレスを取った変数、値を書き換えうるメソッドを呼び出した変数が該当する
+// `fmt.Println(dog)`や値レシーバのメソッド呼び出しのように、値を読むだけの参照は含めない
+func (e *Executor) modifiedNamesOfStmt(stmt ast.Stmt) []types.DeclName {
+	var names []types.DeclName
+	addRootDeclName := func(expr ast.Expr) {
+		if name, ok := e.rootDeclNameOf(expr); ok && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	ast.Inspect(stmt, func(node ast.Node) bool {
+		switch nodeV := node.(type) {
+		case *ast.AssignStmt:
+			// `x := 1`は新しい変数の宣言なので、既存の変数を書き換えない
+			if nodeV.Tok == token.DEFINE {
+				return true
+			}
+			// `dog.Age = 3`や`m["k"]++`のように、左辺の変数のフィールドや要素を書き換える場合も含める
+			for _, lhs := range nodeV.Lhs {
+				addRootDeclName(lhs)
+			}
+		case *ast.IncDecStmt:
+			addRootDeclName(nodeV.X)
+		case *ast.RangeStmt:
+			if nodeV.Tok == token.ASSIGN {
+				for _, expr := range []ast.Expr{nodeV.Key, nodeV.Value} {
+					if expr != nil {
+						addRootDeclName(expr)
+					}
+				}
+			}
+		case *ast.UnaryExpr:
+			// アドレスを取った変数は、ポインタを通して書き換えられうる
+			if nodeV.Op == token.AND {
+				addRootDeclName(nodeV.X)
+			}
+		case *ast.CallExpr:
+			if name, ok := e.mutatedReceiverOf(nodeV); ok && !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+		return true
+	})
+	return names
+}
+
+// mutatedReceiverOf はメソッド呼び出しが、レシーバの変数の値を書き換えうる場合にその変数名を返す
+// `dog.Owner.Rename()`のようにフィールドや要素をレシーバにする場合は、その型を判定できないので書き換えうるものとする
+func (e *Executor) mutatedReceiverOf(callExpr *ast.CallExpr) (types.DeclName, bool) {
+	selectorExpr, ok := ast.Unparen(callExpr.Fun).(*ast.SelectorExpr)
+	if !ok {
+		return "", false
+	}
+	name, ok := e.rootDeclNameOf(selectorExpr.X)
+	if !ok {
+		return "", false
+	}
+	if _, ok := ast.Unparen(selectorExpr.X).(*ast.Ident); !ok {
+		return name, true
+	}
+	decl, _ := e.declRegistry.LookupDecl(name)
+	return name, slices.Contains(decl.MutatingMethods, selectorExpr.Sel.Name)
+}
+
+// rootDeclNameOf は`dog.Owner.Name`や`m["k"]`、`*p`のような式が値を参照している、セッションの変数名を返す
+// 関数呼び出しの結果などを参照している場合は、変数の値そのものではないので返さない
+func (e *Executor) rootDeclNameOf(expr ast.Expr) (types.DeclName, bool) {
+	for {
+		switch exprV := expr.(type) {
+		case *ast.Ident:
+			name := types.DeclName(exprV.Name)
+			return name, e.declRegistry.IsRegisteredDecl(name)
+		case *ast.ParenExpr:
+			expr = exprV.X
+		case *ast.SelectorExpr:
+			expr = exprV.X
+		case *ast.IndexExpr:
+			expr = exprV.X
+		case *ast.IndexListExpr:
+			expr = exprV.X
+		case *ast.SliceExpr:
+			expr = exprV.X
+		case *ast.StarExpr:
+			expr = exprV.X
+		default:
+			return "", false
+		}
+	}
+}
+
+// deleteSnapshotKeys はスナップショットから指定した変数の値を削除する
+func deleteSnapshotKeys(snapshotPath string, names []types.DeclName) error {
+	if len(names) == 0 {
+		return nil
+	}
+	data, err := os.ReadFile(snapshotPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return errs.NewInternalError("failed to read snapshot").Wrap(err)
+	}
+
+	var snapshot map[string][]byte
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&snapshot); err != nil {
+		return errs.NewInternalError("failed to decode snapshot").Wrap(err)
+	}
+	for _, name := range names {
+		delete(snapshot, snapshotKey(name))
+	}
+
+	f, err := os.Create(snapshotPath)
+	if err != nil {
+		return errs.NewInternalError("failed to write snapshot").Wrap(err)
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			errs.HandleError(err)
+		}
+	}()
+	if err := gob.NewEncoder(f).Encode(snapshot); err != nil {
+		return errs.NewInternalError("failed to encode snapshot").Wrap(err)
+	}
+	return nil
+}
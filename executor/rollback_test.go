@@ -0,0 +1,322 @@
+package executor
+
+import (
+	"bytes"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kakkky/gonsole/declregistry"
+	"github.com/kakkky/gonsole/types"
+)
+
+func TestExecutor_Undo(t *testing.T) {
+	tests := []struct {
+		name               string
+		sessionSrc         string
+		decls              []declregistry.Decl
+		expectedSrc        string
+		expectedDecls      []declregistry.Decl
+		expectedErrMessage string
+	}{
+		{
+			name: "last declaration and unused import are removed",
+			sessionSrc: `package main
+
+import "example.com/app/animal"
+
+func main() {
+	x := 1
+	_ = x
+	dog := animal.NewDog("Pochi", 3)
+	_ = dog
+}
+`,
+			decls: []declregistry.Decl{
+				{Name: "x", TypeName: "int", TypeExpr: "int"},
+				{Name: "dog", Pointered: true, TypeName: "Dog", TypePkgName: "animal", TypeExpr: "*animal.Dog"},
+			},
+			expectedSrc: `package main
+
+func main() {
+	x := 1
+	_ = x
+}
+`,
+			expectedDecls: []declregistry.Decl{
+				{Name: "x", TypeName: "int", TypeExpr: "int"},
+			},
+		},
+		{
+			name: "assignment keeps the variable registered",
+			sessionSrc: `package main
+
+func main() {
+	x := 1
+	_ = x
+	x = 2
+}
+`,
+			decls: []declregistry.Decl{
+				{Name: "x", TypeName: "int", TypeExpr: "int"},
+			},
+			expectedSrc: `package main
+
+func main() {
+	x := 1
+	_ = x
+}
+`,
+			expectedDecls: []declregistry.Decl{
+				{Name: "x", TypeName: "int", TypeExpr: "int"},
+			},
+		},
+		{
+			name: "empty session is an error",
+			sessionSrc: `package main
+
+func main() {
+}
+`,
+			expectedErrMessage: "nothing to undo",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionSrc, err := parser.ParseFile(token.NewFileSet(), "", tt.sessionSrc, 0)
+			if err != nil {
+				t.Fatalf("failed to parse session source: %v", err)
+			}
+			registry := declregistry.NewRegistry()
+			registry.Decls = append(registry.Decls, tt.decls...)
+			sut := &Executor{
+				declRegistry: registry,
+				sessionSrc:   sessionSrc,
+				execMode:     ExecModeReplay,
+			}
+
+			err = sut.Undo()
+			if tt.expectedErrMessage != "" {
+				if err == nil || err.Error() != tt.expectedErrMessage {
+					t.Errorf("expected error %q, got %v", tt.expectedErrMessage, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Undo() returned an error: %v", err)
+			}
+
+			var gotSrc bytes.Buffer
+			if err := format.Node(&gotSrc, token.NewFileSet(), sut.sessionSrc); err != nil {
+				t.Fatalf("failed to format session source: %v", err)
+			}
+			if diff := cmp.Diff(tt.expectedSrc, gotSrc.String()); diff != "" {
+				t.Errorf("session source mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.expectedDecls, registry.Decls); diff != "" {
+				t.Errorf("decls mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExecutor_Drop(t *testing.T) {
+	tests := []struct {
+		name                 string
+		sessionSrc           string
+		decls                []declregistry.Decl
+		dropName             types.DeclName
+		expectedDroppedNames []types.DeclName
+		expectedSrc          string
+		expectedDecls        []declregistry.Decl
+		expectedErrMessage   string
+	}{
+		{
+			name: "dependent statements are removed together",
+			sessionSrc: `package main
+
+import "example.com/app/animal"
+
+func main() {
+	dog := animal.NewDog("Pochi", 3)
+	_ = dog
+	x := 1
+	_ = x
+	name := dog.Name()
+	_ = name
+	greeting := "hello " + name
+	_ = greeting
+}
+`,
+			decls: []declregistry.Decl{
+				{Name: "dog", Pointered: true, TypeName: "Dog", TypePkgName: "animal", TypeExpr: "*animal.Dog"},
+				{Name: "x", TypeName: "int", TypeExpr: "int"},
+				{Name: "name", TypeName: "string", TypeExpr: "string"},
+				{Name: "greeting", TypeName: "string", TypeExpr: "string"},
+			},
+			dropName:             "dog",
+			expectedDroppedNames: []types.DeclName{"dog", "name", "greeting"},
+			expectedSrc: `package main
+
+func main() {
+	x := 1
+	_ = x
+}
+`,
+			expectedDecls: []declregistry.Decl{
+				{Name: "x", TypeName: "int", TypeExpr: "int"},
+			},
+		},
+		{
+			name: "assignment using the variable is removed",
+			sessionSrc: `package main
+
+func main() {
+	x := 1
+	_ = x
+	y := 2
+	_ = y
+	x = y
+}
+`,
+			decls: []declregistry.Decl{
+				{Name: "x", TypeName: "int", TypeExpr: "int"},
+				{Name: "y", TypeName: "int", TypeExpr: "int"},
+			},
+			dropName:             "y",
+			expectedDroppedNames: []types.DeclName{"y"},
+			expectedSrc: `package main
+
+func main() {
+	x := 1
+	_ = x
+}
+`,
+			expectedDecls: []declregistry.Decl{
+				{Name: "x", TypeName: "int", TypeExpr: "int"},
+			},
+		},
+		{
+			name: "undeclared variable is an error",
+			sessionSrc: `package main
+
+func main() {
+}
+`,
+			dropName:           "x",
+			expectedErrMessage: "x is not declared",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionSrc, err := parser.ParseFile(token.NewFileSet(), "", tt.sessionSrc, 0)
+			if err != nil {
+				t.Fatalf("failed to parse session source: %v", err)
+			}
+			registry := declregistry.NewRegistry()
+			registry.Decls = append(registry.Decls, tt.decls...)
+			sut := &Executor{
+				declRegistry: registry,
+				sessionSrc:   sessionSrc,
+				execMode:     ExecModeReplay,
+			}
+
+			got, err := sut.Drop(tt.dropName)
+			if tt.expectedErrMessage != "" {
+				if err == nil || err.Error() != tt.expectedErrMessage {
+					t.Errorf("expected error %q, got %v", tt.expectedErrMessage, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Drop() returned an error: %v", err)
+			}
+			if diff := cmp.Diff(tt.expectedDroppedNames, got); diff != "" {
+				t.Errorf("dropped names mismatch (-want +got):\n%s", diff)
+			}
+
+			var gotSrc bytes.Buffer
+			if err := format.Node(&gotSrc, token.NewFileSet(), sut.sessionSrc); err != nil {
+				t.Fatalf("failed to format session source: %v", err)
+			}
+			if diff := cmp.Diff(tt.expectedSrc, gotSrc.String()); diff != "" {
+				t.Errorf("session source mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.expectedDecls, registry.Decls); diff != "" {
+				t.Errorf("decls mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExecutor_modifiedNamesOfStmt(t *testing.T) {
+	decls := []declregistry.Decl{
+		{Name: "dog", Pointered: true, TypeName: "Dog", TypePkgName: "animal", TypeExpr: "*animal.Dog", MutatingMethods: []string{"Rename"}},
+		{Name: "n", TypeName: "int", TypeExpr: "int"},
+		{Name: "m", TypeName: "map[string]int", TypeExpr: "map[string]int"},
+	}
+	tests := []struct {
+		name     string
+		stmt     string
+		expected []types.DeclName
+	}{
+		{
+			name: "passing a variable to a function does not modify it",
+			stmt: `fmt.Println(dog, n)`,
+		},
+		{
+			name: "method with value receiver does not modify the receiver",
+			stmt: `dog.Bark()`,
+		},
+		{
+			name:     "method with pointer receiver modifies the receiver",
+			stmt:     `dog.Rename("Taro")`,
+			expected: []types.DeclName{"dog"},
+		},
+		{
+			name:     "method of field is assumed to modify the variable",
+			stmt:     `dog.Owner.Rename("Taro")`,
+			expected: []types.DeclName{"dog"},
+		},
+		{
+			name:     "taking the address modifies the variable",
+			stmt:     `reset(&n)`,
+			expected: []types.DeclName{"n"},
+		},
+		{
+			name:     "assignment to an element modifies the variable",
+			stmt:     `m["k"] = n`,
+			expected: []types.DeclName{"m"},
+		},
+		{
+			name:     "increment in a block modifies the variable",
+			stmt:     `if n > 0 { fmt.Println(dog); n++ }`,
+			expected: []types.DeclName{"n"},
+		},
+		{
+			name: "new variable declared in a block does not modify variables",
+			stmt: `for i := 0; i < n; i++ { fmt.Println(i) }`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionSrc, err := parser.ParseFile(token.NewFileSet(), "", "package main\n\nfunc main() {\n"+tt.stmt+"\n}\n", 0)
+			if err != nil {
+				t.Fatalf("failed to parse session source: %v", err)
+			}
+			registry := declregistry.NewRegistry()
+			registry.Decls = append(registry.Decls, decls...)
+			sut := &Executor{declRegistry: registry}
+
+			got := sut.modifiedNamesOfStmt(getMainFunc(sessionSrc).Body.List[0])
+			if diff := cmp.Diff(tt.expected, got); diff != "" {
+				t.Errorf("modifiedNamesOfStmt() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
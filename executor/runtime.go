@@ -0,0 +1,46 @@
+package executor
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+
+	"github.com/kakkky/gonsole/errs"
+)
+
+// addRuntime は一時ファイルに埋め込むランタイムの宣言とimportを、実行するソースに追加する
+// constValuesに指定した定数は、ランタイムの既定値の代わりに指定した文字列を値にする
+func addRuntime(file *ast.File, runtimeName string, runtimeSrc []byte, constValues map[string]string) error {
+	parsed, err := parser.ParseFile(token.NewFileSet(), "", runtimeSrc, 0)
+	if err != nil {
+		return errs.NewInternalError("failed to parse " + runtimeName + " runtime").Wrap(err)
+	}
+
+	for _, decl := range parsed.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+		switch genDecl.Tok {
+		case token.IMPORT:
+			for _, spec := range genDecl.Specs {
+				addImportSpec(file, spec.(*ast.ImportSpec))
+			}
+		case token.CONST:
+			for _, spec := range genDecl.Specs {
+				valueSpec := spec.(*ast.ValueSpec)
+				if value, ok := constValues[valueSpec.Names[0].Name]; ok {
+					valueSpec.Values = []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(value)}}
+				}
+			}
+		}
+	}
+	for _, decl := range parsed.Decls {
+		if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.IMPORT {
+			continue
+		}
+		file.Decls = append(file.Decls, decl)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package executor
+
+import (
+	"bytes"
+	"errors"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"io/fs"
+	"os"
+	"slices"
+
+	"github.com/kakkky/gonsole/errs"
+)
+
+// Source はセッションのソースコードを整形して返す
+func (e *Executor) Source() (string, error) {
+	var buf bytes.Buffer
+	if err := format.Node(&buf, token.NewFileSet(), e.sessionSrc); err != nil {
+		return "", errs.NewInternalError("failed to format AST node").Wrap(err)
+	}
+	return buf.String(), nil
+}
+
+// Imports はセッションでimportしているパッケージを、import宣言での記述（例: mrand "math/rand"）で返す
+// import文で宣言したもののまだ参照されていないパッケージも含む
+func (e *Executor) Imports() []string {
+	imports := make([]string, 0, len(e.sessionSrc.Imports))
+	for _, importSpec := range e.sessionSrc.Imports {
+		imports = append(imports, importSpecStr(importSpec))
+	}
+	for _, declaredImport := range e.declRegistry.Imports {
+		importSpec := newImportSpec(declaredImport.Name, declaredImport.ImportPath)
+		if !slices.Contains(imports, importSpecStr(importSpec)) {
+			imports = append(imports, importSpecStr(importSpec))
+		}
+	}
+	return imports
+}
+
+func importSpecStr(importSpec *ast.ImportSpec) string {
+	if importSpec.Name != nil {
+		return importSpec.Name.Name + " " + importSpec.Path.Value
+	}
+	return importSpec.Path.Value
+}
+
+// Reset はセッションを初期状態に戻す
+// 宣言した変数・関数・型やimport文で宣言したパッケージはすべて破棄され、スナップショットやワーカーが保持している値も消える
+// 変数の付け替えの番号や実行し直しの予定など、セッションごとの状態もすべて初期化する
+func (e *Executor) Reset() error {
+	e.sessionSrc = initSessionSrc()
+	e.declRegistry.Reset()
+	e.shadowCount = 0
+	e.shadowedInSession = nil
+	e.topLevelDeclChanges = nil
+	e.topLevelDeclChangedInSession = false
+	e.inputCount = 0
+	e.stmtInputSeqs = nil
+	e.reloadPending = false
+
+	switch e.execMode {
+	case ExecModeSnapshot:
+		if err := os.Remove(e.snapshotPath()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return errs.NewInternalError("failed to remove snapshot").Wrap(err)
+		}
+	case ExecModeWorker:
+		if err := e.relaunchWorker(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
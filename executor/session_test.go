@@ -0,0 +1,133 @@
+package executor
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kakkky/gonsole/declregistry"
+	"github.com/kakkky/gonsole/types"
+)
+
+const sessionSrcForTest = `package main
+
+import (
+	"example.com/app/animal"
+	"fmt"
+)
+
+func main() {
+	dog := animal.NewDog("Pochi", 3)
+	_ = dog
+	fmt.Println(dog.Bark())
+}
+`
+
+func TestExecutor_Source(t *testing.T) {
+	sessionSrc, err := parser.ParseFile(token.NewFileSet(), "", sessionSrcForTest, 0)
+	if err != nil {
+		t.Fatalf("failed to parse session source: %v", err)
+	}
+	sut := &Executor{sessionSrc: sessionSrc}
+
+	got, err := sut.Source()
+	if err != nil {
+		t.Fatalf("Source() returned an error: %v", err)
+	}
+	if diff := cmp.Diff(sessionSrcForTest, got); diff != "" {
+		t.Errorf("Source() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestExecutor_Imports(t *testing.T) {
+	sessionSrc, err := parser.ParseFile(token.NewFileSet(), "", sessionSrcForTest, 0)
+	if err != nil {
+		t.Fatalf("failed to parse session source: %v", err)
+	}
+	registry := declregistry.NewRegistry()
+	registry.RegisterImport(declregistry.Import{Name: "mrand", PkgName: "rand", ImportPath: `"math/rand"`})
+	registry.RegisterImport(declregistry.Import{Name: "animal", PkgName: "animal", ImportPath: `"example.com/app/animal"`})
+	sut := &Executor{declRegistry: registry, sessionSrc: sessionSrc}
+
+	// import文で宣言したものの、まだ参照されていないパッケージも含む
+	expected := []string{`"example.com/app/animal"`, `"fmt"`, `mrand "math/rand"`}
+	if diff := cmp.Diff(expected, sut.Imports()); diff != "" {
+		t.Errorf("Imports() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestExecutor_Reset(t *testing.T) {
+	sessionSrc, err := parser.ParseFile(token.NewFileSet(), "", sessionSrcForTest, 0)
+	if err != nil {
+		t.Fatalf("failed to parse session source: %v", err)
+	}
+	registry := declregistry.NewRegistry()
+	registry.Decls = append(registry.Decls, declregistry.Decl{Name: "dog", Pointered: true, TypeName: "Dog", TypePkgName: "animal"})
+	registry.RegisterImport(declregistry.Import{Name: "mrand", PkgName: "rand", ImportPath: `"math/rand"`})
+	registry.ResultTypes = []types.TypeName{"*animal.Dog"}
+	sut := &Executor{
+		declRegistry:                 registry,
+		sessionSrc:                   sessionSrc,
+		execMode:                     ExecModeReplay,
+		shadowCount:                  3,
+		shadowedInSession:            []shadowedDecl{{name: "dog", shadowedName: "gonsoleShadowed3_dog"}},
+		topLevelDeclChangedInSession: true,
+		inputCount:                   5,
+		reloadPending:                true,
+	}
+
+	if err := sut.Reset(); err != nil {
+		t.Fatalf("Reset() returned an error: %v", err)
+	}
+
+	got, err := sut.Source()
+	if err != nil {
+		t.Fatalf("Source() returned an error: %v", err)
+	}
+	if diff := cmp.Diff("package main\n\nfunc main() {\n}\n", got); diff != "" {
+		t.Errorf("session source mismatch after Reset() (-want +got):\n%s", diff)
+	}
+	if len(registry.Decls) != 0 {
+		t.Errorf("expected no decls after Reset(), got %v", registry.Decls)
+	}
+	if len(registry.Imports) != 0 {
+		t.Errorf("expected no imports after Reset(), got %v", registry.Imports)
+	}
+	if len(registry.ResultTypes) != 0 {
+		t.Errorf("expected no result types after Reset(), got %v", registry.ResultTypes)
+	}
+	if sut.reloadPending || sut.topLevelDeclChangedInSession || sut.inputCount != 0 || len(sut.shadowedInSession) != 0 {
+		t.Errorf("expected session state to be cleared after Reset(), got reloadPending=%v topLevelDeclChangedInSession=%v inputCount=%d shadowedInSession=%v",
+			sut.reloadPending, sut.topLevelDeclChangedInSession, sut.inputCount, sut.shadowedInSession)
+	}
+
+	// リセット後に宣言した変数を再宣言すると、付け替える名前の番号は1から振り直される
+	mainFunc := getMainFunc(sut.sessionSrc)
+	declStmt := &ast.AssignStmt{
+		Lhs: []ast.Expr{ast.NewIdent("dog")},
+		Tok: token.DEFINE,
+		Rhs: []ast.Expr{&ast.BasicLit{Kind: token.INT, Value: "1"}},
+	}
+	mainFunc.Body.List = append(mainFunc.Body.List, declStmt)
+	registry.Decls = append(registry.Decls, declregistry.Decl{Name: "dog", TypeName: "int"})
+	redeclStmt := &ast.AssignStmt{
+		Lhs: []ast.Expr{ast.NewIdent("dog")},
+		Tok: token.DEFINE,
+		Rhs: []ast.Expr{&ast.BinaryExpr{X: ast.NewIdent("dog"), Op: token.ADD, Y: &ast.BasicLit{Kind: token.INT, Value: "1"}}},
+	}
+	sut.shadowRedeclaredNames(mainFunc, redeclStmt, []types.DeclName{"dog"})
+
+	expectedDecls := []declregistry.Decl{{Name: "gonsoleShadowed1_dog", TypeName: "int", Shadowed: true}}
+	if diff := cmp.Diff(expectedDecls, registry.Decls); diff != "" {
+		t.Errorf("decls mismatch after redeclaration (-want +got):\n%s", diff)
+	}
+	got, err = sut.Source()
+	if err != nil {
+		t.Fatalf("Source() returned an error: %v", err)
+	}
+	if diff := cmp.Diff("package main\n\nfunc main() {\n\tgonsoleShadowed1_dog := 1\n}\n", got); diff != "" {
+		t.Errorf("session source mismatch after redeclaration (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,114 @@
+package executor
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"slices"
+	"strconv"
+
+	"github.com/kakkky/gonsole/types"
+)
+
+// shadowedDeclPrefix は再宣言により参照できなくなった変数に付け替える名前の接頭辞
+const shadowedDeclPrefix = "gonsoleShadowed"
+
+// shadowedDecl は再宣言により名前を付け替えた変数を表す
+type shadowedDecl struct {
+	name         types.DeclName
+	shadowedName types.DeclName
+}
+
+// shadowRedeclaredNames は入力文で再宣言される変数を、それまでのセッション上で別名に付け替える
+// 新しい宣言が元の名前を使えるようになり、入力文の右辺やそれまでの文は古い変数を参照し続ける
+func (e *Executor) shadowRedeclaredNames(mainFunc *ast.FuncDecl, stmt ast.Stmt, declNames []types.DeclName) {
+	for _, name := range declNames {
+		if !e.declRegistry.IsRegisteredDecl(name) {
+			continue
+		}
+		e.shadowCount++
+		shadowedName := types.DeclName(fmt.Sprintf("%s%d_%s", shadowedDeclPrefix, e.shadowCount, name))
+		for _, bodyStmt := range mainFunc.Body.List {
+			renameIdent(bodyStmt, name, shadowedName)
+		}
+		switch stmtV := stmt.(type) {
+		case *ast.AssignStmt:
+			for _, rhs := range stmtV.Rhs {
+				renameIdent(rhs, name, shadowedName)
+			}
+		case *ast.DeclStmt:
+			for _, spec := range stmtV.Decl.(*ast.GenDecl).Specs {
+				for _, value := range spec.(*ast.ValueSpec).Values {
+					renameIdent(value, name, shadowedName)
+				}
+			}
+		}
+		e.declRegistry.Shadow(name, shadowedName)
+		e.shadowedInSession = append(e.shadowedInSession, shadowedDecl{name: name, shadowedName: shadowedName})
+	}
+}
+
+// unshadowDecls は入力文の実行に失敗した場合に、付け替えた変数を元の名前に戻す
+func (e *Executor) unshadowDecls() {
+	mainFunc := getMainFunc(e.sessionSrc)
+	for _, shadowed := range slices.Backward(e.shadowedInSession) {
+		for _, bodyStmt := range mainFunc.Body.List {
+			renameIdent(bodyStmt, shadowed.shadowedName, shadowed.name)
+		}
+		e.declRegistry.Unshadow(shadowed.shadowedName, shadowed.name)
+	}
+	e.shadowedInSession = nil
+}
+
+// shadowedValueCopyStmts は付け替えた変数に、元の名前で保持されている値を引き継ぐ`m["shadowed"] = m["name"]`の形の文を生成する
+func shadowedValueCopyStmts(mapName string, shadowedDecls []shadowedDecl, shouldCopy func(shadowedDecl) bool) []ast.Stmt {
+	var stmts []ast.Stmt
+	for _, shadowed := range shadowedDecls {
+		if !shouldCopy(shadowed) {
+			continue
+		}
+		stmts = append(stmts, &ast.AssignStmt{
+			Lhs: []ast.Expr{mapIndexExpr(mapName, string(shadowed.shadowedName))},
+			Tok: token.ASSIGN,
+			Rhs: []ast.Expr{mapIndexExpr(mapName, string(shadowed.name))},
+		})
+	}
+	return stmts
+}
+
+func mapIndexExpr(mapName string, key string) ast.Expr {
+	return &ast.IndexExpr{
+		X:     ast.NewIdent(mapName),
+		Index: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(key)},
+	}
+}
+
+// renameIdent はノード内で変数として使われている識別子の名前を付け替える
+// セレクタ部分や構造体リテラルのフィールド名は変数ではないので対象外にする
+func renameIdent(node ast.Node, from types.DeclName, to types.DeclName) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch nodeV := node.(type) {
+		case *ast.SelectorExpr:
+			renameIdent(nodeV.X, from, to)
+			return false
+		case *ast.CompositeLit:
+			if nodeV.Type != nil {
+				renameIdent(nodeV.Type, from, to)
+			}
+			_, isMap := nodeV.Type.(*ast.MapType)
+			for _, elt := range nodeV.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok && !isMap {
+					renameIdent(kv.Value, from, to)
+					continue
+				}
+				renameIdent(elt, from, to)
+			}
+			return false
+		case *ast.Ident:
+			if nodeV.Name == string(from) {
+				nodeV.Name = string(to)
+			}
+		}
+		return true
+	})
+}
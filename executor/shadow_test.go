@@ -0,0 +1,139 @@
+package executor
+
+import (
+	"bytes"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kakkky/gonsole/declregistry"
+)
+
+func TestExecutor_writeInSessionSrc_Redeclaration(t *testing.T) {
+	tests := []struct {
+		name          string
+		sessionSrc    string
+		decls         []declregistry.Decl
+		input         string
+		expectedSrc   string
+		expectedDecls []declregistry.Decl
+	}{
+		{
+			name: "redeclared variable is shadowed and referenced from new declaration",
+			sessionSrc: `package main
+
+func main() {
+	x := 1
+	_ = x
+	y := x + 1
+	_ = y
+}
+`,
+			decls: []declregistry.Decl{
+				{Name: "x", TypeName: "int", TypeExpr: "int"},
+				{Name: "y", TypeName: "int", TypeExpr: "int"},
+			},
+			input: `x := "hello"`,
+			expectedSrc: `package main
+
+func main() {
+	gonsoleShadowed1_x := 1
+	_ = gonsoleShadowed1_x
+	y := gonsoleShadowed1_x + 1
+	_ = y
+	x := "hello"
+	_ = x
+}
+`,
+			expectedDecls: []declregistry.Decl{
+				{Name: "gonsoleShadowed1_x", TypeName: "int", TypeExpr: "int", Shadowed: true},
+				{Name: "y", TypeName: "int", TypeExpr: "int"},
+			},
+		},
+		{
+			name: "struct field names and selectors are not renamed",
+			sessionSrc: `package main
+
+func main() {
+	n := 1
+	_ = n
+	c := counter{n: n}
+	_ = c
+	m := map[int]int{n: c.n}
+	_ = m
+}
+`,
+			decls: []declregistry.Decl{
+				{Name: "n", TypeName: "int", TypeExpr: "int"},
+				{Name: "c", TypeName: "counter"},
+				{Name: "m", TypeName: "map[int]int", TypeExpr: "map[int]int"},
+			},
+			input: `var n = 2`,
+			expectedSrc: `package main
+
+func main() {
+	gonsoleShadowed1_n := 1
+	_ = gonsoleShadowed1_n
+	c := counter{n: gonsoleShadowed1_n}
+	_ = c
+	m := map[int]int{gonsoleShadowed1_n: c.n}
+	_ = m
+	var n = 2
+	_ = n
+}
+`,
+			expectedDecls: []declregistry.Decl{
+				{Name: "gonsoleShadowed1_n", TypeName: "int", TypeExpr: "int", Shadowed: true},
+				{Name: "c", TypeName: "counter"},
+				{Name: "m", TypeName: "map[int]int", TypeExpr: "map[int]int"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionSrc, err := parser.ParseFile(token.NewFileSet(), "", tt.sessionSrc, 0)
+			if err != nil {
+				t.Fatalf("failed to parse session source: %v", err)
+			}
+			registry := declregistry.NewRegistry()
+			registry.Decls = append(registry.Decls, tt.decls...)
+			sut := &Executor{
+				declRegistry: registry,
+				sessionSrc:   sessionSrc,
+			}
+
+			if err := sut.writeInSessionSrc(tt.input); err != nil {
+				t.Fatalf("writeInSessionSrc() returned an error: %v", err)
+			}
+
+			var gotSrc bytes.Buffer
+			if err := format.Node(&gotSrc, token.NewFileSet(), sut.sessionSrc); err != nil {
+				t.Fatalf("failed to format session source: %v", err)
+			}
+			if diff := cmp.Diff(tt.expectedSrc, gotSrc.String()); diff != "" {
+				t.Errorf("session source mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.expectedDecls, registry.Decls); diff != "" {
+				t.Errorf("decls mismatch (-want +got):\n%s", diff)
+			}
+
+			// 実行に失敗した場合は元に戻る
+			if err := sut.cleanErrElmFromSessionSrc(); err != nil {
+				t.Fatalf("cleanErrElmFromSessionSrc() returned an error: %v", err)
+			}
+			var revertedSrc bytes.Buffer
+			if err := format.Node(&revertedSrc, token.NewFileSet(), sut.sessionSrc); err != nil {
+				t.Fatalf("failed to format session source: %v", err)
+			}
+			if diff := cmp.Diff(tt.sessionSrc, revertedSrc.String()); diff != "" {
+				t.Errorf("reverted session source mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.decls, registry.Decls); diff != "" {
+				t.Errorf("reverted decls mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,585 @@
+package executor
+
+import (
+	"bytes"
+	// go:embedディレクティブ用
+	_ "embed"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	gotypes "go/types"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kakkky/gonsole/errs"
+	"github.com/kakkky/gonsole/types"
+)
+
+//go:embed snapshot_runtime.go.txt
+var snapshotRuntimeSrc []byte
+
+const snapshotFileName = "snapshot.gob"
+
+// restorableDecl はスナップショットから復元できる変数を表す
+type restorableDecl struct {
+	typeExpr ast.Expr
+}
+
+// newSnapshotDir はスナップショットを保存するディレクトリを作成する
+func newSnapshotDir() (string, error) {
+	dir, err := os.MkdirTemp("", "gonsole-snapshot-")
+	if err != nil {
+		return "", errs.NewInternalError("failed to create snapshot directory").Wrap(err)
+	}
+	return dir, nil
+}
+
+// loadSnapshotKeys はスナップショットに保存されている変数のキーを返す
+// スナップショットがまだ存在しない場合は空を返す
+func loadSnapshotKeys(snapshotPath string) map[string]bool {
+	keys := make(map[string]bool)
+	f, err := os.Open(snapshotPath)
+	if err != nil {
+		return keys
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			errs.HandleError(err)
+		}
+	}()
+
+	var snapshot map[string][]byte
+	if err := gob.NewDecoder(f).Decode(&snapshot); err != nil {
+		return keys
+	}
+	for key := range snapshot {
+		keys[key] = true
+	}
+	return keys
+}
+
+// buildSnapshotSessionSrc はsessionSrcから、スナップショットモードで実行するためのソースを組み立てる
+// 実行済みの文は再実行せず、スナップショットから値を復元する文に置き換える
+// :undoなどで値を破棄した変数がある場合は、その変数に関わる文だけを再実行して値を作り直す
+// 値を保存できない変数を宣言した入力は実行後に取り消すので、再実行の対象にはならない
+func (e *Executor) buildSnapshotSessionSrc(executedStmtCount int) (*ast.File, error) {
+	snapshotSrc, err := cloneFile(e.sessionSrc)
+	if err != nil {
+		return nil, err
+	}
+	snapshotKeys := loadSnapshotKeys(e.snapshotPath())
+
+	mainFunc := getMainFunc(snapshotSrc)
+	restorable := make(map[types.DeclName]restorableDecl)
+	// 再宣言により名前を付け替えた変数の値は、スナップショットではまだ元の名前で保存されている
+	savedKeyOf := func(name types.DeclName) string {
+		for _, shadowed := range e.shadowedInSession {
+			if shadowed.shadowedName == name {
+				return snapshotKey(shadowed.name)
+			}
+		}
+		return snapshotKey(name)
+	}
+	for _, decl := range e.declRegistry.Decls {
+		if decl.TypeExpr == "" || !snapshotKeys[savedKeyOf(decl.Name)] {
+			continue
+		}
+		typeExpr, err := parser.ParseExpr(string(decl.TypeExpr))
+		if err != nil {
+			continue
+		}
+		if !addTypeImportPaths(snapshotSrc, decl.TypeImportPaths) {
+			continue
+		}
+		restorable[decl.Name] = restorableDecl{typeExpr: typeExpr}
+	}
+
+	// 復元できない評価結果の変数は、後の文から参照されていなければ再実行しない
+	var skipped map[ast.Stmt]bool
+	if _, ok := restorable[resultDeclName]; !ok {
+		skipped = unreferencedResultStmts(mainFunc.Body.List, executedStmtCount)
+	}
+
+	var body []ast.Stmt
+	for i, stmt := range mainFunc.Body.List {
+		if skipped[stmt] {
+			continue
+		}
+		declNames := declNamesOfStmt(stmt)
+		if i >= executedStmtCount {
+			if err := e.checkSnapshotAlias(stmt); err != nil {
+				return nil, err
+			}
+			body = append(body, stmt)
+			body = append(body, trackStmts(declNames)...)
+			continue
+		}
+
+		switch {
+		case isBlankAssignStmt(stmt), isConstDeclStmt(stmt):
+			// 定数はスナップショットに保存できないので、宣言は常に残す
+			body = append(body, stmt)
+		case len(declNames) > 0 && allRestorable(declNames, restorable):
+			body = append(body, restoreStmts(declNames, restorable)...)
+		case len(declNames) > 0:
+			// 復元できない変数を宣言している文は再実行する
+			body = append(body, stmt)
+			body = append(body, trackStmts(declNames)...)
+		case allRestorable(e.referencedDeclNames(stmt), restorable):
+			// 参照している変数が全て復元できるなら、その結果もスナップショットに含まれているので再実行しない
+		default:
+			body = append(body, stmt)
+		}
+	}
+	copyStmts := shadowedValueCopyStmts("gonsoleSnapshot", e.shadowedInSession, func(shadowed shadowedDecl) bool {
+		return snapshotKeys[snapshotKey(shadowed.name)]
+	})
+	mainFunc.Body.List = slices.Concat([]ast.Stmt{
+		&ast.DeferStmt{Call: &ast.CallExpr{Fun: ast.NewIdent("gonsoleSaveSnapshot")}},
+	}, copyStmts, body)
+
+	removeUnusedImports(snapshotSrc)
+	if err := e.addSnapshotRuntime(snapshotSrc); err != nil {
+		return nil, err
+	}
+	return snapshotSrc, nil
+}
+
+// unsavedDeclNames は新しく実行した文で宣言した変数のうち、スナップショットから復元できない変数を返す
+// 値を保存できなかった変数や、型をソースコードに書けない変数が該当する
+func (e *Executor) unsavedDeclNames(newStmts []ast.Stmt) []types.DeclName {
+	snapshotKeys := loadSnapshotKeys(e.snapshotPath())
+	var unsaved []types.DeclName
+	for _, stmt := range newStmts {
+		for _, name := range declNamesOfStmt(stmt) {
+			// 評価結果の変数は、入力を取り消さずに変数として残さないだけにするので対象外とする
+			if name == resultDeclName {
+				continue
+			}
+			if !e.isSnapshotRestorable(name, snapshotKeys) {
+				unsaved = append(unsaved, name)
+			}
+		}
+	}
+	return unsaved
+}
+
+// isSnapshotRestorable は登録済みの変数の値を、スナップショットから復元できるかを返す
+// 登録できなかった変数は、値を保持できるかを判定できないので復元できるものとする
+func (e *Executor) isSnapshotRestorable(name types.DeclName, snapshotKeys map[string]bool) bool {
+	decl, ok := e.declRegistry.LookupDecl(name)
+	if !ok {
+		return true
+	}
+	return snapshotKeys[snapshotKey(name)] && decl.TypeExpr != ""
+}
+
+// unsavedDeclsError はスナップショットに保存できない変数を宣言した入力を取り消す理由を表すエラーを返す
+func unsavedDeclsError(names []types.DeclName) error {
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		quoted = append(quoted, strconv.Quote(string(name)))
+	}
+	return errs.NewBadInputError(fmt.Sprintf("%s cannot be saved to the snapshot (e.g. it has unexported fields, or holds a function, channel or interface), so the input is undone instead of being re-run on every input; use -exec=replay or -exec=worker to keep such values",
+		strings.Join(quoted, ", ")))
+}
+
+// undoUnsavedInput はスナップショットに保存できない変数を宣言した入力を、実行しなかった状態に戻す
+// 同じ入力で書き換えた他の変数の値も戻すように、スナップショットは実行前のものに書き戻す
+func (e *Executor) undoUnsavedInput(newStmts []ast.Stmt, prevSnapshot []byte) error {
+	for _, stmt := range newStmts {
+		for _, name := range declNamesOfStmt(stmt) {
+			e.declRegistry.Unregister(name)
+		}
+	}
+	if err := e.cleanErrElmFromSessionSrc(); err != nil {
+		return err
+	}
+	return writeSnapshotFile(e.snapshotPath(), prevSnapshot)
+}
+
+// dropUnsavedResult は最後に評価した式の結果をスナップショットから復元できない場合に、評価結果の変数をセッションから取り除く
+// 残しておくと、評価結果の変数を参照するたびに式が再実行されてしまう
+// `dog`や`&d`のように変数と値を共有する結果も、復元すると共有が切れるので取り除く（変数自体を使えばよいので知らせない）
+// 値を保存できずに取り除いた場合はtrueを返す
+func (e *Executor) dropUnsavedResult() bool {
+	stmtGroups := groupSessionStmts(getMainFunc(e.sessionSrc).Body.List)
+	if len(stmtGroups) == 0 {
+		return false
+	}
+	bindingStmt, ok := stmtGroups[len(stmtGroups)-1][0].(*ast.AssignStmt)
+	if !ok || !slices.Equal(declNamesOfStmt(bindingStmt), []types.DeclName{resultDeclName}) {
+		return false
+	}
+	_, aliased := e.aliasSourceOf(bindingStmt.Rhs[0])
+	unsaved := !e.isSnapshotRestorable(resultDeclName, loadSnapshotKeys(e.snapshotPath()))
+	if !aliased && !unsaved {
+		return false
+	}
+	mainFunc := getMainFunc(e.sessionSrc)
+	mainFunc.Body.List = slices.Concat(stmtGroups[:len(stmtGroups)-1]...)
+	if mainFunc.Body.List == nil {
+		mainFunc.Body.List = []ast.Stmt{}
+	}
+	e.declRegistry.Unregister(resultDeclName)
+	e.removeImportsAddedInSession()
+	return unsaved
+}
+
+// printUnsavedResult は評価結果をスナップショットから復元できないので、評価結果の変数として残さなかったことを知らせる
+func printUnsavedResult() {
+	fmt.Printf("%snote: the result cannot be saved to the snapshot, so it is not kept as %q%s\n\n",
+		displayDetailColor, resultDeclName, displayColorReset)
+}
+
+// checkSnapshotAlias は文が他の変数と値を共有する変数を作る場合に、エラーを返す
+// スナップショットから復元した値はそれぞれ別のコピーになり、`p := &d`の`p`と`d`の共有が切れるため
+func (e *Executor) checkSnapshotAlias(stmt ast.Stmt) error {
+	var lhsExprs, rhsExprs []ast.Expr
+	switch stmtV := stmt.(type) {
+	case *ast.AssignStmt:
+		lhsExprs, rhsExprs = stmtV.Lhs, stmtV.Rhs
+	case *ast.DeclStmt:
+		genDecl, ok := stmtV.Decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.VAR {
+			return nil
+		}
+		for _, spec := range genDecl.Specs {
+			valueSpec := spec.(*ast.ValueSpec)
+			for _, name := range valueSpec.Names {
+				lhsExprs = append(lhsExprs, name)
+			}
+			rhsExprs = append(rhsExprs, valueSpec.Values...)
+		}
+	default:
+		return nil
+	}
+	// 多値を返す関数呼び出しの結果は、関数の中まで判定できないので対象外とする
+	if len(lhsExprs) != len(rhsExprs) {
+		return nil
+	}
+	for i, rhs := range rhsExprs {
+		lhsName := gotypes.ExprString(lhsExprs[i])
+		// 評価結果の変数は、入力を取り消さずに変数として残さないだけにするので対象外とする
+		if lhsName == "_" || lhsName == string(resultDeclName) {
+			continue
+		}
+		if sourceName, ok := e.aliasSourceOf(rhs); ok {
+			return errs.NewBadInputError(fmt.Sprintf("%q would share its value with %q, but they are restored from the snapshot as separate copies; use -exec=replay or -exec=worker to keep shared values",
+				lhsName, sourceName))
+		}
+	}
+	return nil
+}
+
+// aliasSourceOf は式の値が、セッションの変数と値を共有する場合にその変数名を返す
+// `&d`や`&d.Owner`のようにアドレスを取る場合と、ポインタ・マップ・スライスの変数をそのまま使う場合が該当する
+// 関数呼び出しの結果は、関数の中まで判定できないので対象外とする
+func (e *Executor) aliasSourceOf(expr ast.Expr) (types.DeclName, bool) {
+	switch exprV := ast.Unparen(expr).(type) {
+	case *ast.UnaryExpr:
+		if exprV.Op != token.AND {
+			return "", false
+		}
+		if name, ok := e.rootDeclNameOf(exprV.X); ok {
+			return name, true
+		}
+		return e.aliasSourceOf(exprV.X)
+	case *ast.Ident:
+		decl, ok := e.declRegistry.LookupDecl(types.DeclName(exprV.Name))
+		if !ok {
+			return "", false
+		}
+		typeName := string(decl.TypeName)
+		return decl.Name, decl.IsPointered() || strings.HasPrefix(typeName, "map[") || strings.HasPrefix(typeName, "[]")
+	case *ast.CompositeLit:
+		for _, elt := range exprV.Elts {
+			if keyValueExpr, ok := elt.(*ast.KeyValueExpr); ok {
+				elt = keyValueExpr.Value
+			}
+			if name, ok := e.aliasSourceOf(elt); ok {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// readSnapshotFile は入力を取り消す際に書き戻せるように、実行前のスナップショットを読み込む
+// スナップショットがまだ存在しない場合はnilを返す
+func readSnapshotFile(snapshotPath string) ([]byte, error) {
+	data, err := os.ReadFile(snapshotPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errs.NewInternalError("failed to read snapshot").Wrap(err)
+	}
+	return data, nil
+}
+
+// writeSnapshotFile はreadSnapshotFileで読み込んだスナップショットを書き戻す
+// 実行前にスナップショットが存在しなかった場合は、実行で作られたスナップショットを削除する
+func writeSnapshotFile(snapshotPath string, data []byte) error {
+	if data == nil {
+		if err := os.Remove(snapshotPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return errs.NewInternalError("failed to remove snapshot").Wrap(err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(snapshotPath, data, 0o600); err != nil {
+		return errs.NewInternalError("failed to write snapshot").Wrap(err)
+	}
+	return nil
+}
+
+// addSnapshotRuntime はスナップショットの保存・復元に使うランタイムを追加する
+func (e *Executor) addSnapshotRuntime(file *ast.File) error {
+	return addRuntime(file, "snapshot", snapshotRuntimeSrc, map[string]string{
+		"gonsoleSnapshotPath": e.snapshotPath(),
+	})
+}
+
+func (e *Executor) snapshotPath() string {
+	return filepath.Join(e.snapshotDir, snapshotFileName)
+}
+
+// snapshotKey はスナップショット内で変数を識別するキーを返す
+func snapshotKey(name types.DeclName) string {
+	return string(name)
+}
+
+// cloneFile はsessionSrcを書き換えずに済むよう、ソースコードを経由してASTを複製する
+func cloneFile(file *ast.File) (*ast.File, error) {
+	var buf bytes.Buffer
+	if err := format.Node(&buf, token.NewFileSet(), file); err != nil {
+		return nil, errs.NewInternalError("failed to format AST node").Wrap(err)
+	}
+	cloned, err := parser.ParseFile(token.NewFileSet(), "", buf.Bytes(), 0)
+	if err != nil {
+		return nil, errs.NewInternalError("failed to parse session source").Wrap(err)
+	}
+	return cloned, nil
+}
+
+// declNamesOfStmt は文で宣言される変数名を返す
+func declNamesOfStmt(stmt ast.Stmt) []types.DeclName {
+	var declNames []types.DeclName
+	switch stmtV := stmt.(type) {
+	case *ast.AssignStmt:
+		if stmtV.Tok != token.DEFINE {
+			return nil
+		}
+		for _, lhs := range stmtV.Lhs {
+			if ident, ok := lhs.(*ast.Ident); ok && ident.Name != "_" {
+				declNames = append(declNames, types.DeclName(ident.Name))
+			}
+		}
+	case *ast.DeclStmt:
+		genDecl, ok := stmtV.Decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.VAR {
+			return nil
+		}
+		for _, spec := range genDecl.Specs {
+			for _, name := range spec.(*ast.ValueSpec).Names {
+				if name.Name != "_" {
+					declNames = append(declNames, types.DeclName(name.Name))
+				}
+			}
+		}
+	}
+	return declNames
+}
+
+// referencedDeclNames は文の中で参照されている、セッションで宣言された変数名を返す
+func (e *Executor) referencedDeclNames(stmt ast.Stmt) []types.DeclName {
+	var names []types.DeclName
+	ast.Inspect(stmt, func(node ast.Node) bool {
+		switch nodeV := node.(type) {
+		case *ast.SelectorExpr:
+			// セレクタ部分は変数ではないので、ベース部分だけを見る
+			ast.Inspect(nodeV.X, func(node ast.Node) bool {
+				if ident, ok := node.(*ast.Ident); ok && e.declRegistry.IsRegisteredDecl(types.DeclName(ident.Name)) {
+					names = append(names, types.DeclName(ident.Name))
+				}
+				return true
+			})
+			return false
+		case *ast.Ident:
+			if e.declRegistry.IsRegisteredDecl(types.DeclName(nodeV.Name)) {
+				names = append(names, types.DeclName(nodeV.Name))
+			}
+		}
+		return true
+	})
+	return names
+}
+
+func isBlankAssignStmt(stmt ast.Stmt) bool {
+	assignStmt, ok := stmt.(*ast.AssignStmt)
+	if !ok || assignStmt.Tok != token.ASSIGN || len(assignStmt.Lhs) != 1 {
+		return false
+	}
+	ident, ok := assignStmt.Lhs[0].(*ast.Ident)
+	return ok && ident.Name == "_"
+}
+
+func allRestorable(names []types.DeclName, restorable map[types.DeclName]restorableDecl) bool {
+	for _, name := range names {
+		if _, ok := restorable[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func restoreStmts(declNames []types.DeclName, restorable map[types.DeclName]restorableDecl) []ast.Stmt {
+	var stmts []ast.Stmt
+	for _, name := range declNames {
+		stmts = append(stmts,
+			&ast.DeclStmt{
+				Decl: &ast.GenDecl{
+					Tok: token.VAR,
+					Specs: []ast.Spec{
+						&ast.ValueSpec{
+							Names: []*ast.Ident{ast.NewIdent(string(name))},
+							Type:  restorable[name].typeExpr,
+						},
+					},
+				},
+			},
+			snapshotCallStmt("gonsoleRestore", name),
+		)
+	}
+	return stmts
+}
+
+func trackStmts(declNames []types.DeclName) []ast.Stmt {
+	var stmts []ast.Stmt
+	for _, name := range declNames {
+		stmts = append(stmts, snapshotCallStmt("gonsoleTrack", name))
+	}
+	return stmts
+}
+
+// snapshotCallStmt は`_ = fn("key", &name)`の形の文を生成する
+// ブランク代入の形にしておくことで、DeclRegistryの登録対象から外れる
+func snapshotCallStmt(fn string, name types.DeclName) ast.Stmt {
+	return &ast.AssignStmt{
+		Lhs: []ast.Expr{ast.NewIdent("_")},
+		Tok: token.ASSIGN,
+		Rhs: []ast.Expr{
+			&ast.CallExpr{
+				Fun: ast.NewIdent(fn),
+				Args: []ast.Expr{
+					&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(snapshotKey(name))},
+					&ast.UnaryExpr{Op: token.AND, X: ast.NewIdent(string(name))},
+				},
+			},
+		},
+	}
+}
+
+// addTypeImportPaths は復元する変数の型が参照しているパッケージのimportを追加する
+// 同名の別パッケージがすでにimportされている場合は型を記述できないのでfalseを返す
+func addTypeImportPaths(file *ast.File, importPaths []types.ImportPath) bool {
+	var newImportSpecs []*ast.ImportSpec
+	for _, importPath := range importPaths {
+		newImportSpec := &ast.ImportSpec{
+			Path: &ast.BasicLit{Kind: token.STRING, Value: string(importPath)},
+		}
+		for _, importSpec := range file.Imports {
+			if importSpec.Path.Value != newImportSpec.Path.Value && importName(importSpec) == importName(newImportSpec) {
+				return false
+			}
+		}
+		newImportSpecs = append(newImportSpecs, newImportSpec)
+	}
+	for _, newImportSpec := range newImportSpecs {
+		addImportSpec(file, newImportSpec)
+	}
+	return true
+}
+
+// addImportSpec はimport宣言を追加する。同じimportがすでにあれば何もしない
+func addImportSpec(file *ast.File, newImportSpec *ast.ImportSpec) {
+	for _, importSpec := range file.Imports {
+		if importSpec.Path.Value == newImportSpec.Path.Value && importSpec.Name.String() == newImportSpec.Name.String() {
+			return
+		}
+	}
+	file.Imports = append(file.Imports, newImportSpec)
+
+	for _, decl := range file.Decls {
+		if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.IMPORT {
+			genDecl.Specs = append(genDecl.Specs, newImportSpec)
+			return
+		}
+	}
+	file.Decls = append([]ast.Decl{&ast.GenDecl{Tok: token.IMPORT, Specs: []ast.Spec{newImportSpec}}}, file.Decls...)
+}
+
+// removeUnusedImports は参照されていないimportを削除する
+// 文を復元処理に置き換えると、その文でしか使っていなかったパッケージが未使用になるため
+func removeUnusedImports(file *ast.File) {
+	usedNames := make(map[string]bool)
+	ast.Inspect(file, func(node ast.Node) bool {
+		if selectorExpr, ok := node.(*ast.SelectorExpr); ok {
+			if ident, ok := selectorExpr.X.(*ast.Ident); ok {
+				usedNames[ident.Name] = true
+			}
+		}
+		return true
+	})
+
+	isUnused := func(importSpec *ast.ImportSpec) bool {
+		name := importName(importSpec)
+		return name != "_" && name != "." && !usedNames[name]
+	}
+	var usedImports []*ast.ImportSpec
+	for _, importSpec := range file.Imports {
+		if !isUnused(importSpec) {
+			usedImports = append(usedImports, importSpec)
+		}
+	}
+	file.Imports = usedImports
+	var decls []ast.Decl
+	for _, decl := range file.Decls {
+		if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.IMPORT {
+			var usedSpecs []ast.Spec
+			for _, spec := range genDecl.Specs {
+				if !isUnused(spec.(*ast.ImportSpec)) {
+					usedSpecs = append(usedSpecs, spec)
+				}
+			}
+			// 空のimport宣言は残さない
+			if len(usedSpecs) == 0 {
+				continue
+			}
+			genDecl.Specs = usedSpecs
+		}
+		decls = append(decls, decl)
+	}
+	file.Decls = decls
+}
+
+// importName はソースコード上でパッケージを参照する名前を返す
+func importName(importSpec *ast.ImportSpec) string {
+	if importSpec.Name != nil {
+		return importSpec.Name.Name
+	}
+	importPath, err := strconv.Unquote(importSpec.Path.Value)
+	if err != nil {
+		importPath = importSpec.Path.Value
+	}
+	return path.Base(importPath)
+}
@@ -0,0 +1,515 @@
+package executor
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kakkky/gonsole/declregistry"
+	"github.com/kakkky/gonsole/types"
+)
+
+func TestExecutor_buildSnapshotSessionSrc(t *testing.T) {
+	tests := []struct {
+		name              string
+		sessionSrc        string
+		executedStmtCount int
+		decls             []declregistry.Decl
+		snapshotKeys      []string
+		expectedMainFunc  string
+		expectedImports   []string
+	}{
+		{
+			name: "new statement is tracked",
+			sessionSrc: `package main
+
+func main() {
+	x := 1
+	_ = x
+}
+`,
+			executedStmtCount: 0,
+			expectedMainFunc: `func main() {
+	defer gonsoleSaveSnapshot()
+	x := 1
+	_ = gonsoleTrack("x", &x)
+	_ = x
+}`,
+			expectedImports: []string{`"bytes"`, `"encoding/gob"`, `"os"`, `"reflect"`},
+		},
+		{
+			name: "executed statement is restored from snapshot",
+			sessionSrc: `package main
+
+import (
+	"example.com/animal"
+	"fmt"
+)
+
+func main() {
+	dog := animal.NewDog("Pochi", 3)
+	_ = dog
+	fmt.Println(dog.Bark())
+}
+`,
+			executedStmtCount: 2,
+			decls: []declregistry.Decl{
+				{Name: "dog", Pointered: true, TypeName: "Dog", TypePkgName: "animal", TypeExpr: "*animal.Dog"},
+			},
+			snapshotKeys: []string{"dog"},
+			expectedMainFunc: `func main() {
+	defer gonsoleSaveSnapshot()
+	var dog *animal.Dog
+	_ = gonsoleRestore("dog", &dog)
+	_ = dog
+	fmt.Println(dog.Bark())
+}`,
+			expectedImports: []string{`"example.com/animal"`, `"fmt"`, `"bytes"`, `"encoding/gob"`, `"os"`, `"reflect"`},
+		},
+		{
+			name: "import used only by restored statement is removed and type import is added",
+			sessionSrc: `package main
+
+import "example.com/shop"
+
+func main() {
+	order := shop.NewOrder()
+	_ = order
+	x := 1
+	_ = x
+}
+`,
+			executedStmtCount: 2,
+			decls: []declregistry.Decl{
+				{Name: "order", TypeName: "Order", TypePkgName: "model", TypeExpr: "model.Order", TypeImportPaths: []types.ImportPath{`"example.com/model"`}},
+			},
+			snapshotKeys: []string{"order"},
+			expectedMainFunc: `func main() {
+	defer gonsoleSaveSnapshot()
+	var order model.Order
+	_ = gonsoleRestore("order", &order)
+	_ = order
+	x := 1
+	_ = gonsoleTrack("x", &x)
+	_ = x
+}`,
+			expectedImports: []string{`"example.com/model"`, `"bytes"`, `"encoding/gob"`, `"os"`, `"reflect"`},
+		},
+		{
+			name: "executed statement not in snapshot is replayed",
+			sessionSrc: `package main
+
+import "strings"
+
+func main() {
+	f := strings.ToUpper
+	_ = f
+	x := f("a")
+	_ = x
+}
+`,
+			executedStmtCount: 2,
+			decls: []declregistry.Decl{
+				{Name: "f", TypeName: "func(s string) string", TypeExpr: "func(s string) string"},
+			},
+			expectedMainFunc: `func main() {
+	defer gonsoleSaveSnapshot()
+	f := strings.ToUpper
+	_ = gonsoleTrack("f", &f)
+	_ = f
+	x := f("a")
+	_ = gonsoleTrack("x", &x)
+	_ = x
+}`,
+			expectedImports: []string{`"strings"`, `"bytes"`, `"encoding/gob"`, `"os"`, `"reflect"`},
+		},
+		{
+			name: "executed const declaration is kept",
+			sessionSrc: `package main
+
+func main() {
+	const c = 5
+	_ = c
+	x := c
+	_ = x
+}
+`,
+			executedStmtCount: 2,
+			decls: []declregistry.Decl{
+				{Name: "c", TypeName: "int", TypeExpr: "int"},
+			},
+			expectedMainFunc: `func main() {
+	defer gonsoleSaveSnapshot()
+	const c = 5
+	_ = c
+	x := c
+	_ = gonsoleTrack("x", &x)
+	_ = x
+}`,
+			expectedImports: []string{`"bytes"`, `"encoding/gob"`, `"os"`, `"reflect"`},
+		},
+		{
+			name: "executed assignment to restorable variable is not replayed",
+			sessionSrc: `package main
+
+func main() {
+	x := 1
+	_ = x
+	x = 10
+	y := x
+	_ = y
+}
+`,
+			executedStmtCount: 3,
+			decls: []declregistry.Decl{
+				{Name: "x", TypeName: "int", TypeExpr: "int"},
+			},
+			snapshotKeys: []string{"x"},
+			expectedMainFunc: `func main() {
+	defer gonsoleSaveSnapshot()
+	var x int
+	_ = gonsoleRestore("x", &x)
+	_ = x
+	y := x
+	_ = gonsoleTrack("y", &y)
+	_ = y
+}`,
+			expectedImports: []string{`"bytes"`, `"encoding/gob"`, `"os"`, `"reflect"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionSrc, err := parser.ParseFile(token.NewFileSet(), "", tt.sessionSrc, 0)
+			if err != nil {
+				t.Fatalf("failed to parse session source: %v", err)
+			}
+			registry := declregistry.NewRegistry()
+			registry.Decls = append(registry.Decls, tt.decls...)
+
+			sut, err := NewExecutor(registry, WithExecMode(ExecModeSnapshot))
+			if err != nil {
+				t.Fatalf("failed to create Executor: %v", err)
+			}
+			defer func() {
+				if err := sut.Close(); err != nil {
+					t.Errorf("failed to close Executor: %v", err)
+				}
+			}()
+			sut.sessionSrc = sessionSrc
+			writeSnapshotKeys(t, sut.snapshotPath(), tt.snapshotKeys)
+
+			got, err := sut.buildSnapshotSessionSrc(tt.executedStmtCount)
+			if err != nil {
+				t.Fatalf("buildSnapshotSessionSrc() returned an error: %v", err)
+			}
+
+			var gotMainFunc bytes.Buffer
+			if err := format.Node(&gotMainFunc, token.NewFileSet(), getMainFunc(got)); err != nil {
+				t.Fatalf("failed to format main func: %v", err)
+			}
+			if diff := cmp.Diff(tt.expectedMainFunc, gotMainFunc.String()); diff != "" {
+				t.Errorf("main func mismatch (-want +got):\n%s", diff)
+			}
+
+			var gotImports []string
+			for _, importSpec := range got.Imports {
+				gotImports = append(gotImports, importSpec.Path.Value)
+			}
+			if diff := cmp.Diff(tt.expectedImports, gotImports); diff != "" {
+				t.Errorf("imports mismatch (-want +got):\n%s", diff)
+			}
+
+			// 生成されたソースはスナップショットのランタイムを含めて構文として正しい必要がある
+			var gotSrc bytes.Buffer
+			if err := format.Node(&gotSrc, token.NewFileSet(), got); err != nil {
+				t.Fatalf("failed to format generated source: %v", err)
+			}
+			if _, err := parser.ParseFile(token.NewFileSet(), "", gotSrc.Bytes(), 0); err != nil {
+				t.Errorf("generated source is invalid: %v\n%s", err, gotSrc.String())
+			}
+		})
+	}
+}
+
+func writeSnapshotKeys(t *testing.T, snapshotPath string, keys []string) {
+	t.Helper()
+	if len(keys) == 0 {
+		return
+	}
+	snapshot := make(map[string][]byte)
+	for _, key := range keys {
+		snapshot[key] = []byte{}
+	}
+	if err := os.MkdirAll(filepath.Dir(snapshotPath), 0o755); err != nil {
+		t.Fatalf("failed to create snapshot directory: %v", err)
+	}
+	f, err := os.Create(snapshotPath)
+	if err != nil {
+		t.Fatalf("failed to create snapshot: %v", err)
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			t.Errorf("failed to close snapshot: %v", err)
+		}
+	}()
+	if err := gob.NewEncoder(f).Encode(snapshot); err != nil {
+		t.Fatalf("failed to encode snapshot: %v", err)
+	}
+}
+
+func TestSnapshotRuntime(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test that runs go run in short mode")
+	}
+
+	snapshotPath := filepath.Join(t.TempDir(), snapshotFileName)
+	file, err := parser.ParseFile(token.NewFileSet(), "", `package main
+
+type Dog struct {
+	Name string
+	Age  int
+}
+
+// Cat は非公開フィールドを持つので、スナップショットに保存できない
+type Cat struct {
+	name string
+	fed  int
+}
+
+func main() {
+	defer gonsoleSaveSnapshot()
+	dog := &Dog{Name: "Pochi", Age: 3}
+	_ = gonsoleTrack("dog", &dog)
+	cat := &Cat{name: "Tama"}
+	_ = gonsoleTrack("cat", &cat)
+	n := 1
+	_ = gonsoleTrack("n", &n)
+}
+`, 0)
+	if err != nil {
+		t.Fatalf("failed to parse test program: %v", err)
+	}
+	if err := addRuntime(file, "snapshot", snapshotRuntimeSrc, map[string]string{"gonsoleSnapshotPath": snapshotPath}); err != nil {
+		t.Fatalf("addRuntime() returned an error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, token.NewFileSet(), file); err != nil {
+		t.Fatalf("failed to format test program: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("go", "run", path).CombinedOutput(); err != nil {
+		t.Fatalf("failed to run test program: %v\n%s", err, out)
+	}
+
+	expected := map[string]bool{"dog": true, "n": true}
+	if diff := cmp.Diff(expected, loadSnapshotKeys(snapshotPath)); diff != "" {
+		t.Errorf("snapshot keys mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestExecutor_unsavedDeclNames(t *testing.T) {
+	tests := []struct {
+		name         string
+		newStmts     string
+		decls        []declregistry.Decl
+		snapshotKeys []string
+		expected     []types.DeclName
+	}{
+		{
+			name:     "saved variables are not reported",
+			newStmts: `dog := animal.NewDog("Pochi", 3); n := 1`,
+			decls: []declregistry.Decl{
+				{Name: "dog", TypeName: "Dog", TypeExpr: "*animal.Dog"},
+				{Name: "n", TypeName: "int", TypeExpr: "int"},
+			},
+			snapshotKeys: []string{"dog", "n"},
+		},
+		{
+			name:     "variable of a type with unexported fields is reported",
+			newStmts: `cat := animal.NewCat("Tama"); n := 1`,
+			decls: []declregistry.Decl{
+				{Name: "cat", TypeName: "Cat", TypeExpr: "*animal.Cat"},
+				{Name: "n", TypeName: "int", TypeExpr: "int"},
+			},
+			snapshotKeys: []string{"n"},
+			expected:     []types.DeclName{"cat"},
+		},
+		{
+			name:     "variable whose type cannot be written in source is reported",
+			newStmts: `s := animal.NewSecret()`,
+			decls: []declregistry.Decl{
+				{Name: "s", TypeName: "secret"},
+			},
+			snapshotKeys: []string{"s"},
+			expected:     []types.DeclName{"s"},
+		},
+		{
+			name:     "variable that is not registered is not reported",
+			newStmts: `n := broken()`,
+		},
+		{
+			name:     "result variable is not reported",
+			newStmts: `it := gonsoleDisplay(animal.NewCat("Tama"))`,
+			decls: []declregistry.Decl{
+				{Name: "it", TypeName: "Cat", TypeExpr: "*animal.Cat"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionSrc, err := parser.ParseFile(token.NewFileSet(), "", "package main\n\nfunc main() {\n"+tt.newStmts+"\n}\n", 0)
+			if err != nil {
+				t.Fatalf("failed to parse session source: %v", err)
+			}
+			registry := declregistry.NewRegistry()
+			registry.Decls = append(registry.Decls, tt.decls...)
+			sut := &Executor{
+				declRegistry: registry,
+				snapshotDir:  t.TempDir(),
+			}
+			writeSnapshotKeys(t, sut.snapshotPath(), tt.snapshotKeys)
+
+			got := sut.unsavedDeclNames(getMainFunc(sessionSrc).Body.List)
+			if diff := cmp.Diff(tt.expected, got); diff != "" {
+				t.Errorf("unsaved decl names mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExecutor_checkSnapshotAlias(t *testing.T) {
+	decls := []declregistry.Decl{
+		{Name: "d", TypeName: "Dog", TypePkgName: "animal", TypeExpr: "animal.Dog"},
+		{Name: "dog", Pointered: true, TypeName: "Dog", TypePkgName: "animal", TypeExpr: "*animal.Dog"},
+		{Name: "m", TypeName: "map[string]int", TypeExpr: "map[string]int"},
+		{Name: "n", TypeName: "int", TypeExpr: "int"},
+	}
+	tests := []struct {
+		name               string
+		stmt               string
+		expectedErrMessage string
+	}{
+		{
+			name:               "taking the address of a variable is an error",
+			stmt:               `p := &d`,
+			expectedErrMessage: `"p" would share its value with "d", but they are restored from the snapshot as separate copies; use -exec=replay or -exec=worker to keep shared values`,
+		},
+		{
+			name:               "taking the address of a field in a composite literal is an error",
+			stmt:               `var o = &animal.Owner{Dog: &d.Child}`,
+			expectedErrMessage: `"o" would share its value with "d", but they are restored from the snapshot as separate copies; use -exec=replay or -exec=worker to keep shared values`,
+		},
+		{
+			name:               "copying a pointer variable is an error",
+			stmt:               `dog2 := dog`,
+			expectedErrMessage: `"dog2" would share its value with "dog", but they are restored from the snapshot as separate copies; use -exec=replay or -exec=worker to keep shared values`,
+		},
+		{
+			name:               "assigning a map variable is an error",
+			stmt:               `m2 = m`,
+			expectedErrMessage: `"m2" would share its value with "m", but they are restored from the snapshot as separate copies; use -exec=replay or -exec=worker to keep shared values`,
+		},
+		{
+			name: "copying a value variable is allowed",
+			stmt: `d2, n2 := d, n`,
+		},
+		{
+			name: "passing the address to a function is allowed",
+			stmt: `ok := feed(&d)`,
+		},
+		{
+			name: "result variable is allowed",
+			stmt: `it := dog`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionSrc, err := parser.ParseFile(token.NewFileSet(), "", "package main\n\nfunc main() {\n"+tt.stmt+"\n}\n", 0)
+			if err != nil {
+				t.Fatalf("failed to parse session source: %v", err)
+			}
+			registry := declregistry.NewRegistry()
+			registry.Decls = append(registry.Decls, decls...)
+			sut := &Executor{declRegistry: registry}
+
+			err = sut.checkSnapshotAlias(getMainFunc(sessionSrc).Body.List[0])
+			if tt.expectedErrMessage == "" {
+				if err != nil {
+					t.Errorf("checkSnapshotAlias() returned an error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.expectedErrMessage {
+				t.Errorf("expected error %q, got %v", tt.expectedErrMessage, err)
+			}
+		})
+	}
+}
+
+func TestExecutor_Execute_SnapshotUnsavedValue(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test that runs go run in short mode")
+	}
+
+	// newCounterが呼ばれるたびに1行追記されるので、宣言した文が再実行されると行が増える
+	callLogPath := filepath.Join(t.TempDir(), "calls.log")
+	t.Chdir(t.TempDir())
+	skipRegisterMode := declregistry.SkipRegisterMode
+	declregistry.SkipRegisterMode = false
+	defer func() {
+		declregistry.SkipRegisterMode = skipRegisterMode
+	}()
+
+	registry := declregistry.NewRegistry()
+	sut, err := NewExecutor(registry, WithExecMode(ExecModeSnapshot))
+	if err != nil {
+		t.Fatalf("failed to create Executor: %v", err)
+	}
+	defer func() {
+		if err := sut.Close(); err != nil {
+			t.Errorf("failed to close Executor: %v", err)
+		}
+	}()
+
+	for _, input := range []string{
+		`import "os"`,
+		// 非公開フィールドを持つので、スナップショットに保存できない
+		`type counter struct { calls int }`,
+		fmt.Sprintf(`func newCounter() *counter { f, _ := os.OpenFile(%q, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644); f.WriteString("called\n"); f.Close(); return &counter{} }`, callLogPath),
+		`c := newCounter()`,
+		`n := 1`,
+		`newCounter()`,
+		`m := n + 1`,
+	} {
+		sut.Execute(input)
+	}
+
+	callLog, err := os.ReadFile(callLogPath)
+	if err != nil {
+		t.Fatalf("failed to read call log: %v", err)
+	}
+	if diff := cmp.Diff("called\ncalled\n", string(callLog)); diff != "" {
+		t.Errorf("newCounter() calls mismatch (-want +got):\n%s", diff)
+	}
+	var gotNames []types.DeclName
+	for _, decl := range registry.Decls {
+		gotNames = append(gotNames, decl.Name)
+	}
+	if diff := cmp.Diff([]types.DeclName{"n", "m"}, gotNames); diff != "" {
+		t.Errorf("registered variables mismatch (-want +got):\n%s", diff)
+	}
+}
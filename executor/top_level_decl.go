@@ -0,0 +1,182 @@
+package executor
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"slices"
+
+	"github.com/kakkky/gonsole/declregistry"
+	"github.com/kakkky/gonsole/errs"
+)
+
+// topLevelDeclChange はセッションのトップレベルに関数・メソッド・型の宣言を追加した記録
+// :undoや実行に失敗した場合に、追加する前の状態に戻すために使う
+type topLevelDeclChange struct {
+	decl ast.Decl
+	// replaced は同名の宣言を置き換えた場合の、置き換える前の宣言
+	replaced ast.Decl
+	// registered は追加する前にDeclRegistryに登録されていた関数・メソッド・型
+	registered []declregistry.TopLevelDecl
+	// inputSeq は文の入力と比べて、どちらが後に入力されたかを判定するための入力順
+	inputSeq int
+}
+
+// topLevelInputStartLine はトップレベルの宣言としてパースするソースにおいて、入力値が始まる行番号
+const topLevelInputStartLine = 2
+
+func wrapTopLevelInput(input string) string {
+	return "package main\n" + input
+}
+
+// parseTopLevelDecl は入力値が関数・メソッド・型の宣言であれば、トップレベルの宣言としてパースして返す
+// 変数・定数の宣言は、値をスナップショットやワーカーに保持できるようにmain関数の中に置くので対象外にする
+func parseTopLevelDecl(input string) (ast.Decl, bool) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", wrapTopLevelInput(input), 0)
+	if err != nil || len(file.Decls) != 1 {
+		return nil, false
+	}
+	switch declV := file.Decls[0].(type) {
+	case *ast.FuncDecl:
+		return declV, true
+	case *ast.GenDecl:
+		return declV, declV.Tok == token.TYPE
+	}
+	return nil, false
+}
+
+// appendTopLevelDeclToSessionSrc は関数・メソッド・型の宣言をsessionSrcのトップレベルに追加する
+// 同じ名前の宣言がすでにあれば置き換えて、定義し直せるようにする
+func (e *Executor) appendTopLevelDeclToSessionSrc(decl ast.Decl) error {
+	if funcDecl, ok := decl.(*ast.FuncDecl); ok && funcDecl.Recv == nil {
+		switch funcDecl.Name.Name {
+		case "main", "init":
+			return errs.NewBadInputError(fmt.Sprintf("%s function cannot be declared in the console", funcDecl.Name.Name))
+		}
+	}
+	if err := e.addImportPathsOfNode(decl); err != nil {
+		return err
+	}
+
+	change := topLevelDeclChange{
+		decl:       decl,
+		registered: e.declRegistry.TopLevelDecls,
+		inputSeq:   e.nextInputSeq(),
+	}
+	keys := topLevelDeclKeys(decl)
+	replacedIdx := slices.IndexFunc(e.sessionSrc.Decls, func(sessionDecl ast.Decl) bool {
+		return slices.ContainsFunc(topLevelDeclKeys(sessionDecl), func(key string) bool {
+			return slices.Contains(keys, key)
+		})
+	})
+	if replacedIdx >= 0 {
+		change.replaced = e.sessionSrc.Decls[replacedIdx]
+		e.sessionSrc.Decls[replacedIdx] = decl
+	} else {
+		e.sessionSrc.Decls = append(e.sessionSrc.Decls, decl)
+	}
+	e.topLevelDeclChanges = append(e.topLevelDeclChanges, change)
+	e.topLevelDeclChangedInSession = true
+	return nil
+}
+
+// revertLastTopLevelDeclChange は最後にトップレベルに追加した宣言を取り消し、置き換えた宣言があれば元に戻す
+func (e *Executor) revertLastTopLevelDeclChange() {
+	if len(e.topLevelDeclChanges) == 0 {
+		return
+	}
+	change := e.topLevelDeclChanges[len(e.topLevelDeclChanges)-1]
+	e.topLevelDeclChanges = e.topLevelDeclChanges[:len(e.topLevelDeclChanges)-1]
+
+	idx := slices.Index(e.sessionSrc.Decls, change.decl)
+	switch {
+	case idx < 0:
+	case change.replaced != nil:
+		e.sessionSrc.Decls[idx] = change.replaced
+	default:
+		e.sessionSrc.Decls = slices.Delete(e.sessionSrc.Decls, idx, idx+1)
+	}
+	e.declRegistry.TopLevelDecls = change.registered
+}
+
+// isLastInputTopLevelDecl は最後の入力が、main関数の文ではなくトップレベルの宣言だったかを返す
+func (e *Executor) isLastInputTopLevelDecl(stmtGroups [][]ast.Stmt) bool {
+	if len(e.topLevelDeclChanges) == 0 {
+		return false
+	}
+	if len(stmtGroups) == 0 {
+		return true
+	}
+	lastStmt := stmtGroups[len(stmtGroups)-1][0]
+	return e.topLevelDeclChanges[len(e.topLevelDeclChanges)-1].inputSeq > e.stmtInputSeqs[lastStmt]
+}
+
+// nextInputSeq はセッションに書き込む入力の入力順を払い出す
+func (e *Executor) nextInputSeq() int {
+	e.inputCount++
+	return e.inputCount
+}
+
+// recordStmtInputSeq はmain関数に書き込んだ入力文の入力順を記録する
+func (e *Executor) recordStmtInputSeq(stmt ast.Stmt) {
+	if e.stmtInputSeqs == nil {
+		e.stmtInputSeqs = make(map[ast.Stmt]int)
+	}
+	e.stmtInputSeqs[stmt] = e.nextInputSeq()
+}
+
+// isTopLevelDeclName はセッションのトップレベルに宣言された関数・型の名前かを返す
+func (e *Executor) isTopLevelDeclName(name string) bool {
+	for _, decl := range e.sessionSrc.Decls {
+		if slices.Contains(topLevelDeclKeys(decl), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// topLevelDeclKeys はトップレベルの宣言を識別するキーを返す
+// 関数と型は名前、メソッドは`レシーバの型名.メソッド名`になる。main関数とimport宣言は対象外
+func topLevelDeclKeys(decl ast.Decl) []string {
+	switch declV := decl.(type) {
+	case *ast.FuncDecl:
+		if declV.Recv == nil {
+			if declV.Name.Name == "main" {
+				return nil
+			}
+			return []string{declV.Name.Name}
+		}
+		if len(declV.Recv.List) == 0 {
+			return nil
+		}
+		return []string{receiverTypeName(declV.Recv.List[0].Type) + "." + declV.Name.Name}
+	case *ast.GenDecl:
+		if declV.Tok != token.TYPE {
+			return nil
+		}
+		var keys []string
+		for _, spec := range declV.Specs {
+			keys = append(keys, spec.(*ast.TypeSpec).Name.Name)
+		}
+		return keys
+	}
+	return nil
+}
+
+// receiverTypeName はレシーバの型の式から型名を取り出す（例: *Counter[T] -> Counter）
+func receiverTypeName(expr ast.Expr) string {
+	switch exprV := expr.(type) {
+	case *ast.StarExpr:
+		return receiverTypeName(exprV.X)
+	case *ast.IndexExpr:
+		return receiverTypeName(exprV.X)
+	case *ast.IndexListExpr:
+		return receiverTypeName(exprV.X)
+	case *ast.ParenExpr:
+		return receiverTypeName(exprV.X)
+	case *ast.Ident:
+		return exprV.Name
+	}
+	return ""
+}
@@ -0,0 +1,269 @@
+package executor
+
+import (
+	"bytes"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kakkky/gonsole/declregistry"
+	"github.com/kakkky/gonsole/types"
+	"go.uber.org/mock/gomock"
+)
+
+func TestExecutor_writeInSessionSrc_TopLevelDecl(t *testing.T) {
+	tests := []struct {
+		name             string
+		sessionSrc       string
+		input            string
+		resolvedPkgNames []types.PkgName
+		expectedSrc      string
+		// expectedRevertedSrc は実行に失敗して元に戻した後のソースで、空ならsessionSrcと同じになる
+		expectedRevertedSrc string
+		expectedErrMsg      string
+	}{
+		{
+			name: "function is declared at top level with its imports",
+			sessionSrc: `package main
+
+func main() {
+}
+`,
+			input:            "func shout(s string) string { return strings.ToUpper(s) }",
+			resolvedPkgNames: []types.PkgName{"strings"},
+			expectedSrc: `package main
+
+import "strings"
+
+func main() {
+}
+func shout(s string) string {
+	return strings.ToUpper(s)
+}
+`,
+			expectedRevertedSrc: `package main
+
+import ()
+
+func main() {
+}
+`,
+		},
+		{
+			name: "receiver and fields of declared type are not packages",
+			sessionSrc: `package main
+
+func main() {
+}
+
+type Counter struct{ Value int }
+`,
+			input: "func (c *Counter) Inc() int { c.Value++; return c.Value }",
+			expectedSrc: `package main
+
+func main() {
+}
+
+type Counter struct{ Value int }
+
+func (c *Counter) Inc() int {
+	c.Value++
+	return c.Value
+}
+`,
+		},
+		{
+			name: "redeclared function replaces previous declaration",
+			sessionSrc: `package main
+
+func main() {
+	x := double(1)
+	_ = x
+}
+func double(n int) int {
+	return n * 2
+}
+func triple(n int) int {
+	return n * 3
+}
+`,
+			input: "func double(n int) int { return n + n }",
+			expectedSrc: `package main
+
+func main() {
+	x := double(1)
+	_ = x
+}
+func double(n int) int {
+	return n + n
+}
+func triple(n int) int {
+	return n * 3
+}
+`,
+		},
+		{
+			name: "type block is declared at top level",
+			sessionSrc: `package main
+
+func main() {
+}
+`,
+			input: "type (\nCelsius float64\nFahrenheit float64\n)",
+			expectedSrc: `package main
+
+func main() {
+}
+
+type (
+	Celsius    float64
+	Fahrenheit float64
+)
+`,
+		},
+		{
+			name: "main function cannot be declared",
+			sessionSrc: `package main
+
+func main() {
+}
+`,
+			input:          "func main() {}",
+			expectedErrMsg: "main function cannot be declared in the console",
+		},
+	}
+
+	importPaths := map[types.PkgName]types.ImportPath{
+		"strings": `"strings"`,
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockImportPathResolver := NewMockimportPathResolver(ctrl)
+			for _, pkgName := range tt.resolvedPkgNames {
+				mockImportPathResolver.EXPECT().resolve(pkgName).Return(importPaths[pkgName], nil).Times(1)
+			}
+			defer clearImportsAddedInSession()
+
+			sessionSrc, err := parser.ParseFile(token.NewFileSet(), "", tt.sessionSrc, 0)
+			if err != nil {
+				t.Fatalf("failed to parse session source: %v", err)
+			}
+			sut := &Executor{
+				declRegistry:       declregistry.NewRegistry(),
+				sessionSrc:         sessionSrc,
+				importPathResolver: mockImportPathResolver,
+			}
+
+			err = sut.writeInSessionSrc(tt.input)
+			if tt.expectedErrMsg != "" {
+				if err == nil || err.Error() != tt.expectedErrMsg {
+					t.Errorf("expected error %q, got %v", tt.expectedErrMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("writeInSessionSrc() returned an error: %v", err)
+			}
+
+			got, err := sut.Source()
+			if err != nil {
+				t.Fatalf("Source() returned an error: %v", err)
+			}
+			if diff := cmp.Diff(tt.expectedSrc, got); diff != "" {
+				t.Errorf("session source mismatch (-want +got):\n%s", diff)
+			}
+
+			// 実行に失敗した場合は元に戻る
+			if err := sut.cleanErrElmFromSessionSrc(); err != nil {
+				t.Fatalf("cleanErrElmFromSessionSrc() returned an error: %v", err)
+			}
+			var revertedSrc bytes.Buffer
+			if err := format.Node(&revertedSrc, token.NewFileSet(), sut.sessionSrc); err != nil {
+				t.Fatalf("failed to format session source: %v", err)
+			}
+			expectedRevertedSrc := tt.expectedRevertedSrc
+			if expectedRevertedSrc == "" {
+				expectedRevertedSrc = tt.sessionSrc
+			}
+			if diff := cmp.Diff(expectedRevertedSrc, revertedSrc.String()); diff != "" {
+				t.Errorf("reverted session source mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExecutor_Undo_TopLevelDecl(t *testing.T) {
+	sut := &Executor{
+		declRegistry: declregistry.NewRegistry(),
+		sessionSrc:   initSessionSrc(),
+	}
+	inputs := []string{
+		"x := 1",
+		"func double(n int) int { return n * 2 }",
+		"y := double(x)",
+		"func double(n int) int { return n + n }",
+	}
+	for _, input := range inputs {
+		if err := sut.writeInSessionSrc(input); err != nil {
+			t.Fatalf("writeInSessionSrc(%q) returned an error: %v", input, err)
+		}
+	}
+
+	// 入力した順とは逆に取り消される
+	expectedSrcs := []string{
+		`package main
+
+func main() {
+	x := 1
+	_ = x
+	y := double(x)
+	_ = y
+}
+func double(n int) int {
+	return n * 2
+}
+`,
+		`package main
+
+func main() {
+	x := 1
+	_ = x
+}
+func double(n int) int {
+	return n * 2
+}
+`,
+		`package main
+
+func main() {
+	x := 1
+	_ = x
+}
+`,
+		`package main
+
+func main() {
+}
+`,
+	}
+	for _, expectedSrc := range expectedSrcs {
+		if err := sut.Undo(); err != nil {
+			t.Fatalf("Undo() returned an error: %v", err)
+		}
+		got, err := sut.Source()
+		if err != nil {
+			t.Fatalf("Source() returned an error: %v", err)
+		}
+		if diff := cmp.Diff(expectedSrc, got); diff != "" {
+			t.Errorf("session source mismatch (-want +got):\n%s", diff)
+		}
+	}
+
+	if err := sut.Undo(); err == nil || err.Error() != "nothing to undo" {
+		t.Errorf("expected error %q, got %v", "nothing to undo", err)
+	}
+}
@@ -0,0 +1,321 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	// go:embedディレクティブ用
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/kakkky/gonsole/errs"
+)
+
+//go:embed worker_host.go.txt
+var workerHostSrc []byte
+
+// workerDoneMarker は1つの文の実行が終わったことを示す、ワーカーの標準出力上の区切り
+// worker_host.go.txtのdoneMarkerと一致させる必要がある
+const workerDoneMarker = "\x00gonsole-done\x00"
+
+// errWorkerExited はワーカープロセスが予期せず終了したことを表す
+// Executorはワーカーを起動し直し、実行済みの文を再実行してセッションを復元する
+var errWorkerExited = errs.NewInternalError("worker process exited unexpectedly; restarting it and re-running the session")
+
+//go:generate mockgen -package=executor -source=./worker.go -destination=./worker_mock.go
+type worker interface {
+	startWorker() error
+	evalInWorker(ctx context.Context, timeout time.Duration, req *workerEvalRequest, stdout io.Writer, stderr io.Writer) error
+	execInWorker(ctx context.Context, timeout time.Duration, targetFile string, stdout io.Writer, stderr io.Writer) error
+	stopWorker() error
+}
+
+// defaultWorker はセッション中に常駐するプロセスを管理する
+// 常駐プロセスは起動時にプロジェクトのパッケージをリンクしてビルドし、入力された文はビルドせずに評価させる
+// 評価できない文だけを、入力のたびにプラグインとしてビルドして読み込ませる
+type defaultWorker struct {
+	commander
+	// symbolPkgPatterns はワーカーにリンクするプロジェクトのパッケージのパターン
+	symbolPkgPatterns []string
+	dir               string
+	cmd               *exec.Cmd
+	requests          *os.File
+	responses         *json.Decoder
+	stdout            *workerOutput
+	stderr            *workerOutput
+	done              chan struct{}
+	pluginCount       int
+}
+
+// workerOutput はワーカーの出力の書き込み先を、実行中の文ごとに切り替える
+// 文を実行していない間の出力（文の実行後も動き続けるgoroutineの出力など）は、そのまま端末に書き出す
+type workerOutput struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (wo *workerOutput) Write(p []byte) (int, error) {
+	wo.mu.Lock()
+	defer wo.mu.Unlock()
+	return wo.w.Write(p)
+}
+
+func (wo *workerOutput) set(w io.Writer) {
+	wo.mu.Lock()
+	defer wo.mu.Unlock()
+	wo.w = w
+}
+
+// workerRequest はワーカーに送る1回の入力の内容で、PluginとEvalのどちらか一方を持つ
+// worker_host.go.txtのrequestと一致させる必要がある
+type workerRequest struct {
+	Plugin string             `json:"plugin,omitempty"`
+	Eval   *workerEvalRequest `json:"eval,omitempty"`
+}
+
+// workerResponse はワーカーから返される実行結果
+type workerResponse struct {
+	Error string `json:"error,omitempty"`
+	// Unsupported はワーカーが評価できなかった理由で、その場合は文を何も実行していない
+	Unsupported string `json:"unsupported,omitempty"`
+}
+
+func newDefaultWorker(commander commander) *defaultWorker {
+	return &defaultWorker{
+		commander:         commander,
+		symbolPkgPatterns: []string{"./..."},
+	}
+}
+
+func (dw *defaultWorker) startWorker() error {
+	dir, err := os.MkdirTemp("", "gonsole-worker-")
+	if err != nil {
+		return errs.NewInternalError("failed to create worker directory").Wrap(err)
+	}
+	dw.dir = dir
+
+	hostBinFile := filepath.Join(dir, "host")
+	if err := dw.buildHost(hostBinFile); err != nil {
+		return err
+	}
+
+	// fd3で入力の内容を送り、fd4で実行結果を受け取る
+	requestsReader, requestsWriter, err := os.Pipe()
+	if err != nil {
+		return errs.NewInternalError("failed to create pipe").Wrap(err)
+	}
+	responsesReader, responsesWriter, err := os.Pipe()
+	if err != nil {
+		return errs.NewInternalError("failed to create pipe").Wrap(err)
+	}
+	cmd := exec.Command(hostBinFile)
+	// 実行中の文を中断する場合は、ワーカーごと終了させる
+	setProcessGroup(cmd)
+	dw.stdout = &workerOutput{w: os.Stdout}
+	dw.stderr = &workerOutput{w: os.Stderr}
+	cmd.Stderr = dw.stderr
+	cmd.ExtraFiles = []*os.File{requestsReader, responsesWriter}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return errs.NewInternalError("failed to create pipe").Wrap(err)
+	}
+	if err := cmd.Start(); err != nil {
+		return errs.NewInternalError("failed to start worker").Wrap(err)
+	}
+	// 子プロセスに渡した側はこちらでは使わない
+	if err := requestsReader.Close(); err != nil {
+		return errs.NewInternalError("failed to close pipe").Wrap(err)
+	}
+	if err := responsesWriter.Close(); err != nil {
+		return errs.NewInternalError("failed to close pipe").Wrap(err)
+	}
+
+	dw.cmd = cmd
+	dw.requests = requestsWriter
+	dw.responses = json.NewDecoder(responsesReader)
+	// 中断によってワーカーを終了させた後も、転送する側がブロックしないように1つ分の余裕を持たせる
+	dw.done = make(chan struct{}, 1)
+	// 出力が多い場合にワーカーが書き込みでブロックしないよう、標準出力は常に読み続ける
+	go forwardWorkerOutputs(stdout, dw.stdout, dw.done)
+	return nil
+}
+
+// evalInWorker は文をビルドせずにワーカーで評価する
+// ワーカーが評価できない文であれば、何も実行せずに*workerEvalUnsupportedErrorを返す
+// ctxが終了するか、評価を始めてからtimeoutを過ぎるとワーカーごと終了させる
+func (dw *defaultWorker) evalInWorker(ctx context.Context, timeout time.Duration, req *workerEvalRequest, stdout io.Writer, stderr io.Writer) error {
+	if dw.cmd == nil {
+		return errWorkerExited
+	}
+	res, err := dw.request(ctx, timeout, workerRequest{Eval: req}, stdout, stderr)
+	if err != nil {
+		return err
+	}
+	if res.Unsupported != "" {
+		return &workerEvalUnsupportedError{reason: res.Unsupported}
+	}
+	return workerResponseErr(res)
+}
+
+// execInWorker は文をプラグインとしてビルドし、ワーカーで実行する
+// ビルドはctxが終了すると中断し、実行はそれに加えて実行を始めてからtimeoutを過ぎるとワーカーごと終了させる
+func (dw *defaultWorker) execInWorker(ctx context.Context, timeout time.Duration, targetFile string, stdout io.Writer, stderr io.Writer) error {
+	if dw.cmd == nil {
+		return errWorkerExited
+	}
+
+	dw.pluginCount++
+	pluginFile := filepath.Join(dw.dir, fmt.Sprintf("session_%d.so", dw.pluginCount))
+	// 内容が同じプラグインは同一のものとみなされて読み込めないので、ソースに連番を書き足して区別する
+	if err := appendPluginID(targetFile, dw.pluginCount); err != nil {
+		return err
+	}
+	if err := dw.execGoBuildPlugin(ctx, targetFile, pluginFile); err != nil {
+		return err
+	}
+	// 読み込んだプラグインはワーカーが終了するまで解放されないが、ファイルは読み込んだ後に不要になる
+	defer os.Remove(pluginFile)
+	// ビルド中に中断された場合は、ワーカーで実行しない
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	res, err := dw.request(ctx, timeout, workerRequest{Plugin: pluginFile}, stdout, stderr)
+	if err != nil {
+		return err
+	}
+	return workerResponseErr(res)
+}
+
+// request は入力の内容をワーカーに送り、実行が終わるまで待って実行結果を返す
+// 実行中の出力はstdoutとstderrに書き込む
+func (dw *defaultWorker) request(ctx context.Context, timeout time.Duration, req workerRequest, stdout io.Writer, stderr io.Writer) (*workerResponse, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, errs.NewInternalError("failed to encode worker request").Wrap(err)
+	}
+
+	runCtx, cancel := withRunTimeout(ctx, timeout)
+	defer cancel()
+	dw.stdout.set(stdout)
+	dw.stderr.set(stderr)
+	defer func() {
+		dw.stdout.set(os.Stdout)
+		dw.stderr.set(os.Stderr)
+	}()
+	if _, err := fmt.Fprintf(dw.requests, "%s\n", data); err != nil {
+		return nil, errWorkerExited
+	}
+	responses := make(chan error, 1)
+	var res workerResponse
+	go func() {
+		responses <- dw.responses.Decode(&res)
+	}()
+	select {
+	case err := <-responses:
+		if err != nil {
+			return nil, errWorkerExited
+		}
+	case <-runCtx.Done():
+		// 文の実行は途中で止められないので、ワーカーごと終了させる
+		// 実行済みの文の値は失われるので、Executorがワーカーを起動し直して復元する
+		if err := killProcessGroup(dw.cmd); err != nil {
+			return nil, errs.NewInternalError("failed to stop worker").Wrap(err)
+		}
+		<-responses
+		if err := dw.stopWorker(); err != nil {
+			return nil, err
+		}
+		return nil, errors.Join(errWorkerExited, runCtx.Err())
+	}
+	// 文の出力を全て書き出してから、書き込み先を戻す
+	if _, ok := <-dw.done; !ok {
+		return nil, errWorkerExited
+	}
+	return &res, nil
+}
+
+// workerResponseErr は実行結果のエラーを、入力の誤りとして返す
+func workerResponseErr(res *workerResponse) error {
+	if res.Error != "" {
+		return errs.NewBadInputError(fmt.Sprintf("\n%s\n", res.Error))
+	}
+	return nil
+}
+
+func (dw *defaultWorker) stopWorker() error {
+	if dw.cmd != nil {
+		// リクエストを閉じるとワーカーは終了する
+		if err := dw.requests.Close(); err != nil {
+			return errs.NewInternalError("failed to close pipe").Wrap(err)
+		}
+		// 予期せず終了していた場合の終了ステータスは既に報告しているので無視する
+		_ = dw.cmd.Wait()
+		dw.cmd = nil
+	}
+	if dw.dir != "" {
+		if err := os.RemoveAll(dw.dir); err != nil {
+			return errs.NewInternalError("failed to remove worker directory").Wrap(err)
+		}
+		dw.dir = ""
+	}
+	return nil
+}
+
+func appendPluginID(targetFile string, pluginID int) error {
+	f, err := os.OpenFile(targetFile, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		return errs.NewInternalError("failed to open plugin source").Wrap(err)
+	}
+	if _, err := fmt.Fprintf(f, "\n// gonsole session %d\n", pluginID); err != nil {
+		_ = f.Close()
+		return errs.NewInternalError("failed to write plugin source").Wrap(err)
+	}
+	if err := f.Close(); err != nil {
+		return errs.NewInternalError("failed to close plugin source").Wrap(err)
+	}
+	return nil
+}
+
+// forwardWorkerOutputs はワーカーの標準出力を届いた順にoutに書き出し、文の実行が終わるたびにdoneに送る
+// ワーカーが終了するとdoneを閉じる
+func forwardWorkerOutputs(stdout io.Reader, out io.Writer, done chan<- struct{}) {
+	buf := make([]byte, 4096)
+	var pending []byte
+	for {
+		n, err := stdout.Read(buf)
+		data := append(pending, buf[:n]...)
+		for {
+			output, rest, found := splitAtMarker(data, workerDoneMarker)
+			// 書き込み先のエラーで転送を止めると、ワーカーが書き込みでブロックするので無視する
+			_, _ = out.Write(output)
+			if !found {
+				pending = bytes.Clone(rest)
+				break
+			}
+			done <- struct{}{}
+			data = rest
+		}
+		if err != nil {
+			_, _ = out.Write(pending)
+			close(done)
+			return
+		}
+	}
+}
+
+// workerBuildErr はビルドエラーの出力をエラーメッセージに含める
+func workerBuildErr(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return fmt.Errorf("%w\n%s", err, exitErr.Stderr)
+	}
+	return err
+}
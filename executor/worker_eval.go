@@ -0,0 +1,1097 @@
+package executor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	gotypes "go/types"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/kakkky/gonsole/errs"
+)
+
+// workerEvalRequest はワーカーにビルドせずに評価させる文で、worker_host.go.txtのevalRequestと一致させる必要がある
+type workerEvalRequest struct {
+	// Shadows は再宣言により名前を付け替えた変数で、ワーカーは評価の前に元の名前で保持している値を引き継ぐ
+	Shadows []workerShadow `json:"shadows,omitempty"`
+	Stmts   []*workerNode  `json:"stmts"`
+	// Locals は文の中（forやifなど）で宣言される変数の数
+	Locals int `json:"locals,omitempty"`
+	// Format は式の評価結果の表示形式
+	Format string `json:"format"`
+}
+
+type workerShadow struct {
+	Name         string `json:"name"`
+	ShadowedName string `json:"shadowedName"`
+}
+
+// workerNode は評価する式・文で、worker_host.go.txtのnodeと一致させる必要がある
+//
+// 各フィールドの意味はOpごとに異なる
+//   - 式: const(Type, Value), nil, var(Name), local(Slot), global(Name), func(Name), field(X, Index), method(X, Name, Flag=アドレスを取る),
+//     call(X=関数と引数, Flag=...で展開), builtin(Name, Type, X, Flag=...で展開), conv(Type, X), assert(Type, X, Flag=カンマok),
+//     index(X, Flag=カンマok), slice(X=対象と3つの添字, Flag=3つの添字), binary(Name, Type, X), unary(Name, Type, X, Flag=カンマok),
+//     addr(X), deref(X), composite(Type, X, Index=フィールドや要素の位置), display(X)
+//   - 代入先: blank, newvar(Name, Type), newlocal(Slot, Type), その他の式
+//   - 文: expr(X), assign(Lhs, X, Name=複合代入の演算子), block(Body), if(Init, Cond, Body, Else), for(Init, Cond, Post, Body, Index=初期化文で宣言した変数),
+//     range(X, Lhs=キーと値, Body), switch(Init, Cond, Body=case), case(X, Body), break, continue, go(X), send(X), nop
+type workerNode struct {
+	Op    string         `json:"op"`
+	Name  string         `json:"name,omitempty"`
+	Value string         `json:"value,omitempty"`
+	Type  *workerTypeRef `json:"type,omitempty"`
+	Slot  int            `json:"slot,omitempty"`
+	Index []int          `json:"index,omitempty"`
+	Flag  bool           `json:"flag,omitempty"`
+	X     []*workerNode  `json:"x,omitempty"`
+	Lhs   []*workerNode  `json:"lhs,omitempty"`
+	Init  *workerNode    `json:"init,omitempty"`
+	Cond  *workerNode    `json:"cond,omitempty"`
+	Post  *workerNode    `json:"post,omitempty"`
+	Body  []*workerNode  `json:"body,omitempty"`
+	Else  []*workerNode  `json:"else,omitempty"`
+}
+
+// workerTypeRef は型の表現で、worker_host.go.txtのtypeRefと一致させる必要がある
+// 名前付きの型は`importパス.名前`で表し、ワーカーにリンクされた型から探す
+type workerTypeRef struct {
+	Kind     string            `json:"kind"`
+	Name     string            `json:"name,omitempty"`
+	Len      int               `json:"len,omitempty"`
+	Dir      int               `json:"dir,omitempty"`
+	Key      *workerTypeRef    `json:"key,omitempty"`
+	Elem     *workerTypeRef    `json:"elem,omitempty"`
+	Params   []*workerTypeRef  `json:"params,omitempty"`
+	Results  []*workerTypeRef  `json:"results,omitempty"`
+	Variadic bool              `json:"variadic,omitempty"`
+	Fields   []*workerFieldRef `json:"fields,omitempty"`
+}
+
+type workerFieldRef struct {
+	Name string         `json:"name"`
+	Type *workerTypeRef `json:"type"`
+	Tag  string         `json:"tag,omitempty"`
+}
+
+// workerEvalUnsupportedError はワーカーが評価できない文であることを表す
+// Executorは文をプラグインとしてビルドして実行する
+type workerEvalUnsupportedError struct {
+	reason string
+}
+
+func (e *workerEvalUnsupportedError) Error() string {
+	return "cannot evaluate the statement in the worker: " + e.reason
+}
+
+func unsupportedf(format string, args ...interface{}) error {
+	return &workerEvalUnsupportedError{reason: fmt.Sprintf(format, args...)}
+}
+
+// workerCheckedSession は型検査したセッションのソース
+type workerCheckedSession struct {
+	file *ast.File
+	pkg  *gotypes.Package
+	info *gotypes.Info
+}
+
+// workerChecker はワーカーモードで文を評価する前に、セッションを型検査する
+// importしたパッケージの型はコンパイル済みのエクスポートデータから読み込み、ワーカーを起動し直すまで使い回す
+type workerChecker struct {
+	commander
+	// exportFiles はimportパスごとのエクスポートデータのファイル
+	exportFiles map[string]string
+	importer    gotypes.Importer
+}
+
+func newWorkerChecker(commander commander) *workerChecker {
+	wc := &workerChecker{
+		commander:   commander,
+		exportFiles: make(map[string]string),
+	}
+	wc.importer = importer.ForCompiler(token.NewFileSet(), "gc", wc.lookup)
+	return wc
+}
+
+// lookup はパッケージのエクスポートデータを開く
+func (wc *workerChecker) lookup(importPath string) (io.ReadCloser, error) {
+	if err := wc.listExportFiles([]string{importPath}); err != nil {
+		return nil, err
+	}
+	exportFile, ok := wc.exportFiles[importPath]
+	if !ok || exportFile == "" {
+		return nil, fmt.Errorf("export data of %s not found", importPath)
+	}
+	return os.Open(exportFile)
+}
+
+// listExportFiles はまだ調べていないパッケージのエクスポートデータのファイルを、まとめて調べる
+func (wc *workerChecker) listExportFiles(importPaths []string) error {
+	var missing []string
+	for _, importPath := range importPaths {
+		if _, ok := wc.exportFiles[importPath]; !ok {
+			missing = append(missing, importPath)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	cmdOut, err := wc.execGoListExport(missing)
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(cmdOut))
+	for scanner.Scan() {
+		importPath, exportFile, ok := strings.Cut(scanner.Text(), "\t")
+		if ok {
+			wc.exportFiles[importPath] = exportFile
+		}
+	}
+	return nil
+}
+
+// check はセッションのソースを型検査する
+// 型の情報は文の位置をもとに解決されるので、ソースを書き出してから位置付きでパースし直して検査する
+func (wc *workerChecker) check(src *ast.File) (*workerCheckedSession, error) {
+	var buf bytes.Buffer
+	if err := format.Node(&buf, token.NewFileSet(), src); err != nil {
+		return nil, errs.NewInternalError("failed to format AST node").Wrap(err)
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "gonsole_session.go", buf.Bytes(), 0)
+	if err != nil {
+		return nil, errs.NewInternalError("failed to parse session source").Wrap(err)
+	}
+
+	var importPaths []string
+	for _, importSpec := range file.Imports {
+		importPath, err := strconv.Unquote(importSpec.Path.Value)
+		if err != nil || importPath == "C" {
+			return nil, unsupportedf("import %s", importSpec.Path.Value)
+		}
+		importPaths = append(importPaths, importPath)
+	}
+	if err := wc.listExportFiles(importPaths); err != nil {
+		return nil, err
+	}
+
+	var checkErrs []string
+	conf := gotypes.Config{
+		Importer: wc.importer,
+		Error: func(err error) {
+			// 未使用の変数やimportは、セッションの実行には影響しない
+			msg := err.Error()
+			if strings.Contains(msg, "declared and not used") || strings.Contains(msg, "imported and not used") {
+				return
+			}
+			checkErrs = append(checkErrs, msg)
+		},
+	}
+	info := &gotypes.Info{
+		Types:      make(map[ast.Expr]gotypes.TypeAndValue),
+		Instances:  make(map[*ast.Ident]gotypes.Instance),
+		Defs:       make(map[*ast.Ident]gotypes.Object),
+		Uses:       make(map[*ast.Ident]gotypes.Object),
+		Implicits:  make(map[ast.Node]gotypes.Object),
+		Selections: make(map[*ast.SelectorExpr]*gotypes.Selection),
+		Scopes:     make(map[ast.Node]*gotypes.Scope),
+	}
+	pkg, _ := conf.Check("main", fset, []*ast.File{file}, info)
+	if len(checkErrs) > 0 {
+		return nil, errs.NewBadInputError("failed to type-check session: " + strings.Join(checkErrs, "; "))
+	}
+	return &workerCheckedSession{file: file, pkg: pkg, info: info}, nil
+}
+
+// checkWorkerSession はsessionSrcを型検査する
+// 式の評価結果を表示する文は、変数の登録と同じく表示のランタイムのスタブで型を解決する
+func (e *Executor) checkWorkerSession() (*workerCheckedSession, error) {
+	src := e.sessionSrc
+	if e.endsWithDisplayStmt() {
+		stubbed, err := e.addDisplayStub(e.sessionSrc)
+		if err != nil {
+			return nil, err
+		}
+		src = stubbed
+	}
+	return e.workerChecker.check(src)
+}
+
+// prepareWorkerEval は未実行の文を型検査し、ワーカーがビルドせずに評価できる形に変換する
+// 変換できなかった場合の評価のリクエストはnilで、文はプラグインとしてビルドして実行する
+// 型検査のエラーもプラグインのビルドで報告されるので、型検査できなかった場合は型検査の結果もnilを返す
+func (e *Executor) prepareWorkerEval(executedStmtCount int) (*workerCheckedSession, *workerEvalRequest) {
+	if e.workerChecker == nil {
+		return nil, nil
+	}
+	checked, err := e.checkWorkerSession()
+	if err != nil {
+		return nil, nil
+	}
+	req, err := e.compileWorkerEvalRequest(checked, executedStmtCount)
+	if err != nil {
+		return checked, nil
+	}
+	return checked, req
+}
+
+// evalInWorkerOrPlugin は未実行の文をワーカーで評価する
+// ワーカーにリンクされていないシンボルを参照するなど、ワーカーが評価できなかった場合はプラグインとしてビルドして実行する
+func (e *Executor) evalInWorkerOrPlugin(ctx context.Context, req *workerEvalRequest, executedStmtCount int, tmpFile *os.File, tmpFileName string, fset *token.FileSet, stdout io.Writer, stderr io.Writer) error {
+	err := e.evalInWorker(ctx, e.timeout, req, stdout, stderr)
+	var unsupportedErr *workerEvalUnsupportedError
+	if !errors.As(err, &unsupportedErr) {
+		return err
+	}
+
+	pluginSrc, err := e.buildWorkerPluginSrc(executedStmtCount)
+	if err != nil {
+		return err
+	}
+	if e.endsWithDisplayStmt() {
+		if pluginSrc, err = e.addDisplayRuntime(pluginSrc); err != nil {
+			return err
+		}
+	}
+	if err := e.flush(pluginSrc, tmpFile, fset); err != nil {
+		return err
+	}
+	return e.execInWorker(ctx, e.timeout, tmpFileName, stdout, stderr)
+}
+
+// compileWorkerEvalRequest は型検査したセッションの未実行の文を、ワーカーが評価できる形に変換する
+func (e *Executor) compileWorkerEvalRequest(checked *workerCheckedSession, executedStmtCount int) (*workerEvalRequest, error) {
+	mainFunc := getMainFunc(checked.file)
+	c := &workerCompiler{
+		info:       checked.info,
+		sessionPkg: checked.pkg,
+		mainScope:  checked.info.Scopes[mainFunc.Type],
+		locals:     make(map[gotypes.Object]int),
+	}
+	req := &workerEvalRequest{Format: string(e.displayFormat)}
+	for _, shadowed := range e.shadowedInSession {
+		req.Shadows = append(req.Shadows, workerShadow{Name: string(shadowed.name), ShadowedName: string(shadowed.shadowedName)})
+	}
+	for _, stmt := range mainFunc.Body.List[executedStmtCount:] {
+		n, err := c.compileStmt(stmt)
+		if err != nil {
+			return nil, err
+		}
+		req.Stmts = append(req.Stmts, n)
+	}
+	req.Locals = len(c.locals)
+	return req, nil
+}
+
+// workerCompiler は型検査した文を、ワーカーが評価できる形に変換する
+// ワーカーにリンクされていない、またはリフレクションで扱えない要素を含む文は評価できないとしてエラーを返す
+type workerCompiler struct {
+	info       *gotypes.Info
+	sessionPkg *gotypes.Package
+	// mainScope はmain関数のスコープで、ここで宣言された変数はワーカーが保持する
+	mainScope *gotypes.Scope
+	// locals は文の中で宣言された変数と、その変数の位置
+	locals map[gotypes.Object]int
+}
+
+func (c *workerCompiler) compileStmts(stmts []ast.Stmt) ([]*workerNode, error) {
+	nodes := make([]*workerNode, 0, len(stmts))
+	for _, stmt := range stmts {
+		n, err := c.compileStmt(stmt)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
+
+// compileOptionalStmt はifやforの初期化文など、省略できる文を変換する
+func (c *workerCompiler) compileOptionalStmt(stmt ast.Stmt) (*workerNode, error) {
+	if stmt == nil {
+		return nil, nil
+	}
+	return c.compileStmt(stmt)
+}
+
+func (c *workerCompiler) compileStmt(stmt ast.Stmt) (*workerNode, error) {
+	switch stmtV := stmt.(type) {
+	case *ast.ExprStmt:
+		x, err := c.compileExpr(stmtV.X)
+		if err != nil {
+			return nil, err
+		}
+		return &workerNode{Op: "expr", X: []*workerNode{x}}, nil
+	case *ast.AssignStmt:
+		return c.compileAssign(stmtV)
+	case *ast.IncDecStmt:
+		return c.compileIncDec(stmtV)
+	case *ast.DeclStmt:
+		return c.compileDecl(stmtV)
+	case *ast.BlockStmt:
+		body, err := c.compileStmts(stmtV.List)
+		if err != nil {
+			return nil, err
+		}
+		return &workerNode{Op: "block", Body: body}, nil
+	case *ast.IfStmt:
+		return c.compileIf(stmtV)
+	case *ast.ForStmt:
+		return c.compileFor(stmtV)
+	case *ast.RangeStmt:
+		return c.compileRange(stmtV)
+	case *ast.SwitchStmt:
+		return c.compileSwitch(stmtV)
+	case *ast.BranchStmt:
+		if stmtV.Label != nil || (stmtV.Tok != token.BREAK && stmtV.Tok != token.CONTINUE) {
+			return nil, unsupportedf("%s statement", stmtV.Tok)
+		}
+		return &workerNode{Op: stmtV.Tok.String()}, nil
+	case *ast.GoStmt:
+		call, err := c.compileExpr(stmtV.Call)
+		if err != nil {
+			return nil, err
+		}
+		if call.Op != "call" {
+			return nil, unsupportedf("go statement calling %s", call.Op)
+		}
+		return &workerNode{Op: "go", X: []*workerNode{call}}, nil
+	case *ast.SendStmt:
+		ch, err := c.compileExpr(stmtV.Chan)
+		if err != nil {
+			return nil, err
+		}
+		value, err := c.compileExpr(stmtV.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &workerNode{Op: "send", X: []*workerNode{ch, value}}, nil
+	case *ast.EmptyStmt:
+		return &workerNode{Op: "nop"}, nil
+	}
+	return nil, unsupportedf("statement %T", stmt)
+}
+
+func (c *workerCompiler) compileAssign(stmt *ast.AssignStmt) (*workerNode, error) {
+	n := &workerNode{Op: "assign"}
+	switch stmt.Tok {
+	case token.DEFINE, token.ASSIGN:
+	default:
+		// 複合代入(x += y)は、演算子を残して代入として評価する
+		n.Name = strings.TrimSuffix(stmt.Tok.String(), "=")
+	}
+	for _, lhs := range stmt.Lhs {
+		target, err := c.compileTarget(lhs, stmt.Tok == token.DEFINE)
+		if err != nil {
+			return nil, err
+		}
+		n.Lhs = append(n.Lhs, target)
+	}
+	values, err := c.compileValues(stmt.Rhs, len(stmt.Lhs))
+	if err != nil {
+		return nil, err
+	}
+	n.X = values
+	return n, nil
+}
+
+// compileValues は代入する値を変換する。複数の代入先に1つの式を代入する場合は、カンマok形式の式として変換する
+func (c *workerCompiler) compileValues(exprs []ast.Expr, targetCount int) ([]*workerNode, error) {
+	var values []*workerNode
+	for _, expr := range exprs {
+		value, err := c.compileExpr(expr)
+		if err != nil {
+			return nil, err
+		}
+		if len(exprs) == 1 && targetCount == 2 {
+			switch value.Op {
+			case "index", "assert", "unary":
+				value.Flag = true
+			}
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// compileTarget は代入先を変換する。defineの場合は、新しく宣言される変数を宣言として変換する
+func (c *workerCompiler) compileTarget(expr ast.Expr, define bool) (*workerNode, error) {
+	ident, ok := expr.(*ast.Ident)
+	if ok && ident.Name == "_" {
+		return &workerNode{Op: "blank"}, nil
+	}
+	if ok && define {
+		if obj := c.info.Defs[ident]; obj != nil {
+			return c.declareVar(obj)
+		}
+	}
+	return c.compileExpr(expr)
+}
+
+// declareVar は変数の宣言を変換する
+// main関数の直下で宣言された変数はワーカーが保持し、文の中で宣言された変数はその文の評価の間だけ使う
+func (c *workerCompiler) declareVar(obj gotypes.Object) (*workerNode, error) {
+	typ, err := c.typeRef(obj.Type())
+	if err != nil {
+		return nil, err
+	}
+	if obj.Parent() == c.mainScope {
+		return &workerNode{Op: "newvar", Name: obj.Name(), Type: typ}, nil
+	}
+	slot := len(c.locals)
+	c.locals[obj] = slot
+	return &workerNode{Op: "newlocal", Slot: slot, Type: typ}, nil
+}
+
+// compileIncDec はx++とx--を、x += 1とx -= 1として変換する
+func (c *workerCompiler) compileIncDec(stmt *ast.IncDecStmt) (*workerNode, error) {
+	target, err := c.compileExpr(stmt.X)
+	if err != nil {
+		return nil, err
+	}
+	one, err := c.constNode(c.info.TypeOf(stmt.X), constant.MakeInt64(1))
+	if err != nil {
+		return nil, err
+	}
+	op := "+"
+	if stmt.Tok == token.DEC {
+		op = "-"
+	}
+	return &workerNode{Op: "assign", Name: op, Lhs: []*workerNode{target}, X: []*workerNode{one}}, nil
+}
+
+func (c *workerCompiler) compileDecl(stmt *ast.DeclStmt) (*workerNode, error) {
+	genDecl, ok := stmt.Decl.(*ast.GenDecl)
+	if !ok {
+		return nil, unsupportedf("declaration %T", stmt.Decl)
+	}
+	switch genDecl.Tok {
+	case token.CONST:
+		// 定数は参照する式で値に置き換えるので、宣言自体は評価するものがない
+		return &workerNode{Op: "nop"}, nil
+	case token.VAR:
+	default:
+		return nil, unsupportedf("%s declaration", genDecl.Tok)
+	}
+	block := &workerNode{Op: "block"}
+	for _, spec := range genDecl.Specs {
+		valueSpec := spec.(*ast.ValueSpec)
+		n := &workerNode{Op: "assign"}
+		for _, name := range valueSpec.Names {
+			target, err := c.compileTarget(name, true)
+			if err != nil {
+				return nil, err
+			}
+			n.Lhs = append(n.Lhs, target)
+		}
+		values, err := c.compileValues(valueSpec.Values, len(valueSpec.Names))
+		if err != nil {
+			return nil, err
+		}
+		n.X = values
+		block.Body = append(block.Body, n)
+	}
+	return block, nil
+}
+
+func (c *workerCompiler) compileIf(stmt *ast.IfStmt) (*workerNode, error) {
+	init, err := c.compileOptionalStmt(stmt.Init)
+	if err != nil {
+		return nil, err
+	}
+	cond, err := c.compileExpr(stmt.Cond)
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.compileStmts(stmt.Body.List)
+	if err != nil {
+		return nil, err
+	}
+	n := &workerNode{Op: "if", Init: init, Cond: cond, Body: body}
+	if stmt.Else != nil {
+		elseNode, err := c.compileStmt(stmt.Else)
+		if err != nil {
+			return nil, err
+		}
+		n.Else = []*workerNode{elseNode}
+	}
+	return n, nil
+}
+
+func (c *workerCompiler) compileFor(stmt *ast.ForStmt) (*workerNode, error) {
+	localCount := len(c.locals)
+	init, err := c.compileOptionalStmt(stmt.Init)
+	if err != nil {
+		return nil, err
+	}
+	n := &workerNode{Op: "for", Init: init}
+	// 初期化文で宣言した変数は、繰り返しごとに新しい変数になる
+	for slot := localCount; slot < len(c.locals); slot++ {
+		n.Index = append(n.Index, slot)
+	}
+	if stmt.Cond != nil {
+		if n.Cond, err = c.compileExpr(stmt.Cond); err != nil {
+			return nil, err
+		}
+	}
+	if n.Post, err = c.compileOptionalStmt(stmt.Post); err != nil {
+		return nil, err
+	}
+	if n.Body, err = c.compileStmts(stmt.Body.List); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func (c *workerCompiler) compileRange(stmt *ast.RangeStmt) (*workerNode, error) {
+	switch c.info.TypeOf(stmt.X).Underlying().(type) {
+	case *gotypes.Signature:
+		return nil, unsupportedf("range over function")
+	}
+	x, err := c.compileExpr(stmt.X)
+	if err != nil {
+		return nil, err
+	}
+	n := &workerNode{Op: "range", X: []*workerNode{x}}
+	for _, expr := range []ast.Expr{stmt.Key, stmt.Value} {
+		if expr == nil {
+			n.Lhs = append(n.Lhs, nil)
+			continue
+		}
+		target, err := c.compileTarget(expr, stmt.Tok == token.DEFINE)
+		if err != nil {
+			return nil, err
+		}
+		n.Lhs = append(n.Lhs, target)
+	}
+	if n.Body, err = c.compileStmts(stmt.Body.List); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func (c *workerCompiler) compileSwitch(stmt *ast.SwitchStmt) (*workerNode, error) {
+	init, err := c.compileOptionalStmt(stmt.Init)
+	if err != nil {
+		return nil, err
+	}
+	n := &workerNode{Op: "switch", Init: init}
+	if stmt.Tag != nil {
+		if n.Cond, err = c.compileExpr(stmt.Tag); err != nil {
+			return nil, err
+		}
+	}
+	for _, clause := range stmt.Body.List {
+		caseClause := clause.(*ast.CaseClause)
+		caseNode := &workerNode{Op: "case"}
+		for _, expr := range caseClause.List {
+			x, err := c.compileExpr(expr)
+			if err != nil {
+				return nil, err
+			}
+			caseNode.X = append(caseNode.X, x)
+		}
+		if caseNode.Body, err = c.compileStmts(caseClause.Body); err != nil {
+			return nil, err
+		}
+		n.Body = append(n.Body, caseNode)
+	}
+	return n, nil
+}
+
+func (c *workerCompiler) compileExpr(expr ast.Expr) (*workerNode, error) {
+	tv, ok := c.info.Types[expr]
+	if !ok {
+		return nil, unsupportedf("expression %T without type", expr)
+	}
+	if tv.Value != nil {
+		return c.constNode(tv.Type, tv.Value)
+	}
+	if tv.IsNil() {
+		return &workerNode{Op: "nil"}, nil
+	}
+	// セッションで宣言した型はワーカーにリンクされていないので、その値を扱う式は評価できない
+	if c.referencesSessionType(tv.Type, make(map[gotypes.Type]bool)) {
+		return nil, unsupportedf("type %s declared in the console", tv.Type)
+	}
+
+	switch exprV := expr.(type) {
+	case *ast.ParenExpr:
+		return c.compileExpr(exprV.X)
+	case *ast.Ident:
+		return c.compileIdent(exprV)
+	case *ast.SelectorExpr:
+		return c.compileSelector(exprV)
+	case *ast.CallExpr:
+		return c.compileCall(exprV, tv.Type)
+	case *ast.IndexExpr:
+		if _, ok := c.info.TypeOf(exprV.X).Underlying().(*gotypes.Signature); ok {
+			return nil, unsupportedf("generic function")
+		}
+		return c.compileNode("index", nil, exprV.X, exprV.Index)
+	case *ast.SliceExpr:
+		n, err := c.compileNode("slice", nil, exprV.X, exprV.Low, exprV.High, exprV.Max)
+		if err != nil {
+			return nil, err
+		}
+		n.Flag = exprV.Slice3
+		return n, nil
+	case *ast.StarExpr:
+		return c.compileNode("deref", nil, exprV.X)
+	case *ast.UnaryExpr:
+		switch exprV.Op {
+		case token.AND:
+			return c.compileNode("addr", nil, exprV.X)
+		case token.ARROW:
+			n, err := c.compileNode("unary", nil, exprV.X)
+			if err != nil {
+				return nil, err
+			}
+			n.Name = exprV.Op.String()
+			return n, nil
+		}
+		// 論理否定の結果は、オペランドと異なる型（名前のないbool）になる場合がある
+		var resultType gotypes.Type
+		if exprV.Op == token.NOT {
+			resultType = gotypes.Default(tv.Type)
+		}
+		n, err := c.compileNode("unary", resultType, exprV.X)
+		if err != nil {
+			return nil, err
+		}
+		n.Name = exprV.Op.String()
+		return n, nil
+	case *ast.BinaryExpr:
+		// 比較と論理演算の結果は、オペランドと異なる型になる場合がある
+		var resultType gotypes.Type
+		switch exprV.Op {
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ, token.LAND, token.LOR:
+			resultType = gotypes.Default(tv.Type)
+		}
+		n, err := c.compileNode("binary", resultType, exprV.X, exprV.Y)
+		if err != nil {
+			return nil, err
+		}
+		n.Name = exprV.Op.String()
+		return n, nil
+	case *ast.CompositeLit:
+		return c.compileComposite(exprV, tv.Type)
+	case *ast.TypeAssertExpr:
+		if exprV.Type == nil {
+			return nil, unsupportedf("type switch")
+		}
+		// カンマok形式では式の型が値とboolの組として記録されるので、アサーションする型を使う
+		return c.compileNode("assert", c.info.TypeOf(exprV.Type), exprV.X)
+	}
+	return nil, unsupportedf("expression %T", expr)
+}
+
+// compileNode は式の子を変換したノードを生成する。typがnilでなければノードの型にする
+// スライス式の省略された添字のように、子のnilはそのままnilとして残す
+func (c *workerCompiler) compileNode(op string, typ gotypes.Type, exprs ...ast.Expr) (*workerNode, error) {
+	n := &workerNode{Op: op}
+	if typ != nil {
+		typeRef, err := c.typeRef(typ)
+		if err != nil {
+			return nil, err
+		}
+		n.Type = typeRef
+	}
+	for _, expr := range exprs {
+		if expr == nil {
+			n.X = append(n.X, nil)
+			continue
+		}
+		x, err := c.compileExpr(expr)
+		if err != nil {
+			return nil, err
+		}
+		n.X = append(n.X, x)
+	}
+	return n, nil
+}
+
+func (c *workerCompiler) compileIdent(ident *ast.Ident) (*workerNode, error) {
+	switch obj := c.info.Uses[ident].(type) {
+	case *gotypes.Var:
+		if slot, ok := c.locals[obj]; ok {
+			return &workerNode{Op: "local", Slot: slot}, nil
+		}
+		if obj.Parent() == c.mainScope {
+			return &workerNode{Op: "var", Name: obj.Name()}, nil
+		}
+	case *gotypes.Nil:
+		return &workerNode{Op: "nil"}, nil
+	}
+	return nil, unsupportedf("identifier %s", ident.Name)
+}
+
+func (c *workerCompiler) compileSelector(selectorExpr *ast.SelectorExpr) (*workerNode, error) {
+	selection, ok := c.info.Selections[selectorExpr]
+	if !ok {
+		// パッケージの関数・変数
+		switch obj := c.info.Uses[selectorExpr.Sel].(type) {
+		case *gotypes.Var:
+			return &workerNode{Op: "global", Name: obj.Pkg().Path() + "." + obj.Name()}, nil
+		case *gotypes.Func:
+			if obj.Type().(*gotypes.Signature).TypeParams().Len() > 0 {
+				return nil, unsupportedf("generic function %s", obj.Name())
+			}
+			return &workerNode{Op: "func", Name: obj.Pkg().Path() + "." + obj.Name()}, nil
+		}
+		return nil, unsupportedf("selector %s", selectorExpr.Sel.Name)
+	}
+
+	x, err := c.compileExpr(selectorExpr.X)
+	if err != nil {
+		return nil, err
+	}
+	switch selection.Kind() {
+	case gotypes.FieldVal:
+		// 非公開のフィールドは、リフレクションでは値を取り出せない
+		typ := selection.Recv()
+		for _, i := range selection.Index() {
+			if ptr, ok := typ.Underlying().(*gotypes.Pointer); ok {
+				typ = ptr.Elem()
+			}
+			field := typ.Underlying().(*gotypes.Struct).Field(i)
+			if !field.Exported() {
+				return nil, unsupportedf("unexported field %s", field.Name())
+			}
+			typ = field.Type()
+		}
+		return &workerNode{Op: "field", X: []*workerNode{x}, Index: selection.Index()}, nil
+	case gotypes.MethodVal:
+		method := selection.Obj()
+		if !method.Exported() {
+			return nil, unsupportedf("unexported method %s", method.Name())
+		}
+		// ポインタのメソッドを変数の値から呼び出す場合は、変数のアドレスから呼び出す
+		needsAddr := gotypes.NewMethodSet(selection.Recv()).Lookup(method.Pkg(), method.Name()) == nil
+		return &workerNode{Op: "method", Name: method.Name(), Flag: needsAddr, X: []*workerNode{x}}, nil
+	}
+	return nil, unsupportedf("method expression %s", selectorExpr.Sel.Name)
+}
+
+func (c *workerCompiler) compileCall(call *ast.CallExpr, resultType gotypes.Type) (*workerNode, error) {
+	fun := ast.Unparen(call.Fun)
+	if c.info.Types[fun].IsType() {
+		return c.compileNode("conv", resultType, call.Args...)
+	}
+	if ident, ok := fun.(*ast.Ident); ok {
+		switch obj := c.info.Uses[ident].(type) {
+		case *gotypes.Builtin:
+			return c.compileBuiltin(call, obj.Name(), resultType)
+		case *gotypes.Func:
+			if obj.Name() == displayFuncName && obj.Pkg() == c.sessionPkg {
+				return c.compileNode("display", nil, call.Args...)
+			}
+		}
+	}
+	var funIdent *ast.Ident
+	switch funV := fun.(type) {
+	case *ast.Ident:
+		funIdent = funV
+	case *ast.SelectorExpr:
+		funIdent = funV.Sel
+	}
+	if _, ok := c.info.Instances[funIdent]; ok {
+		return nil, unsupportedf("generic function %s", funIdent.Name)
+	}
+
+	n, err := c.compileNode("call", nil, append([]ast.Expr{fun}, call.Args...)...)
+	if err != nil {
+		return nil, err
+	}
+	n.Flag = call.Ellipsis.IsValid()
+	return n, nil
+}
+
+func (c *workerCompiler) compileBuiltin(call *ast.CallExpr, name string, resultType gotypes.Type) (*workerNode, error) {
+	var n *workerNode
+	var err error
+	switch name {
+	case "len", "cap", "delete", "copy", "clear", "close", "panic":
+		n, err = c.compileNode("builtin", nil, call.Args...)
+	case "append", "min", "max":
+		n, err = c.compileNode("builtin", resultType, call.Args...)
+	case "make":
+		n, err = c.compileNode("builtin", c.info.TypeOf(call.Args[0]), call.Args[1:]...)
+	case "new":
+		n, err = c.compileNode("builtin", c.info.TypeOf(call.Args[0]))
+	default:
+		return nil, unsupportedf("builtin %s", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	n.Name = name
+	n.Flag = call.Ellipsis.IsValid()
+	return n, nil
+}
+
+func (c *workerCompiler) compileComposite(lit *ast.CompositeLit, typ gotypes.Type) (*workerNode, error) {
+	// 要素の型を省略した&T{...}は、ポインタの型として記録されている
+	if ptr, ok := typ.Underlying().(*gotypes.Pointer); ok && lit.Type == nil {
+		elem, err := c.compileComposite(lit, ptr.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &workerNode{Op: "addr", X: []*workerNode{elem}}, nil
+	}
+	typeRef, err := c.typeRef(typ)
+	if err != nil {
+		return nil, err
+	}
+	n := &workerNode{Op: "composite", Type: typeRef}
+	addElem := func(index int, expr ast.Expr) error {
+		x, err := c.compileExpr(expr)
+		if err != nil {
+			return err
+		}
+		n.Index = append(n.Index, index)
+		n.X = append(n.X, x)
+		return nil
+	}
+	switch typV := typ.Underlying().(type) {
+	case *gotypes.Struct:
+		for i, elt := range lit.Elts {
+			index := i
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				index = fieldIndex(typV, kv.Key.(*ast.Ident).Name)
+				elt = kv.Value
+			}
+			if err := addElem(index, elt); err != nil {
+				return nil, err
+			}
+		}
+	case *gotypes.Slice, *gotypes.Array:
+		index := 0
+		for _, elt := range lit.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				key, _ := constant.Int64Val(c.info.Types[kv.Key].Value)
+				index = int(key)
+				elt = kv.Value
+			}
+			if err := addElem(index, elt); err != nil {
+				return nil, err
+			}
+			index++
+		}
+	case *gotypes.Map:
+		// マップはキーと値を交互に並べる
+		for _, elt := range lit.Elts {
+			kv := elt.(*ast.KeyValueExpr)
+			for _, expr := range []ast.Expr{kv.Key, kv.Value} {
+				x, err := c.compileExpr(expr)
+				if err != nil {
+					return nil, err
+				}
+				n.X = append(n.X, x)
+			}
+		}
+	default:
+		return nil, unsupportedf("composite literal of %s", typ)
+	}
+	return n, nil
+}
+
+func fieldIndex(structType *gotypes.Struct, name string) int {
+	for i := range structType.NumFields() {
+		if structType.Field(i).Name() == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// constNode は定数を、型の種類に応じた文字列の値として変換する
+func (c *workerCompiler) constNode(typ gotypes.Type, value constant.Value) (*workerNode, error) {
+	typ = gotypes.Default(typ)
+	typeRef, err := c.typeRef(typ)
+	if err != nil {
+		return nil, err
+	}
+	basic, ok := typ.Underlying().(*gotypes.Basic)
+	if !ok {
+		return nil, unsupportedf("constant of type %s", typ)
+	}
+	var str string
+	info := basic.Info()
+	switch {
+	case info&gotypes.IsBoolean != 0:
+		str = strconv.FormatBool(constant.BoolVal(value))
+	case info&gotypes.IsString != 0:
+		str = constant.StringVal(value)
+	case info&gotypes.IsInteger != 0:
+		str = constant.ToInt(value).ExactString()
+	case info&gotypes.IsFloat != 0:
+		f, _ := constant.Float64Val(constant.ToFloat(value))
+		str = strconv.FormatFloat(f, 'g', -1, 64)
+	case info&gotypes.IsComplex != 0:
+		complexValue := constant.ToComplex(value)
+		re, _ := constant.Float64Val(constant.Real(complexValue))
+		im, _ := constant.Float64Val(constant.Imag(complexValue))
+		str = strconv.FormatFloat(re, 'g', -1, 64) + " " + strconv.FormatFloat(im, 'g', -1, 64)
+	default:
+		return nil, unsupportedf("constant of type %s", typ)
+	}
+	return &workerNode{Op: "const", Type: typeRef, Value: str}, nil
+}
+
+// referencesSessionType は型がセッションで宣言した型を含むかを返す
+func (c *workerCompiler) referencesSessionType(typ gotypes.Type, visited map[gotypes.Type]bool) bool {
+	if visited[typ] {
+		return false
+	}
+	visited[typ] = true
+	switch typV := gotypes.Unalias(typ).(type) {
+	case *gotypes.Named:
+		return typV.Obj().Pkg() == c.sessionPkg
+	case *gotypes.Pointer:
+		return c.referencesSessionType(typV.Elem(), visited)
+	case *gotypes.Slice:
+		return c.referencesSessionType(typV.Elem(), visited)
+	case *gotypes.Array:
+		return c.referencesSessionType(typV.Elem(), visited)
+	case *gotypes.Chan:
+		return c.referencesSessionType(typV.Elem(), visited)
+	case *gotypes.Map:
+		return c.referencesSessionType(typV.Key(), visited) || c.referencesSessionType(typV.Elem(), visited)
+	case *gotypes.Tuple:
+		for i := range typV.Len() {
+			if c.referencesSessionType(typV.At(i).Type(), visited) {
+				return true
+			}
+		}
+	case *gotypes.Signature:
+		return c.referencesSessionType(typV.Params(), visited) || c.referencesSessionType(typV.Results(), visited)
+	case *gotypes.Struct:
+		for i := range typV.NumFields() {
+			if c.referencesSessionType(typV.Field(i).Type(), visited) {
+				return true
+			}
+		}
+	case *gotypes.Interface:
+		for i := range typV.NumMethods() {
+			if c.referencesSessionType(typV.Method(i).Type(), visited) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// typeRef は型をワーカーが解決できる表現に変換する
+func (c *workerCompiler) typeRef(typ gotypes.Type) (*workerTypeRef, error) {
+	switch typV := gotypes.Unalias(gotypes.Default(typ)).(type) {
+	case *gotypes.Basic:
+		if typV.Kind() == gotypes.UnsafePointer || typV.Kind() == gotypes.Invalid {
+			return nil, unsupportedf("type %s", typV)
+		}
+		return &workerTypeRef{Kind: "basic", Name: gotypes.Typ[typV.Kind()].Name()}, nil
+	case *gotypes.Named:
+		obj := typV.Obj()
+		if obj.Pkg() == nil && obj.Name() == "error" {
+			return &workerTypeRef{Kind: "basic", Name: "error"}, nil
+		}
+		if obj.Pkg() == nil || obj.Pkg() == c.sessionPkg || !obj.Exported() || obj.Parent() != obj.Pkg().Scope() || typV.TypeArgs().Len() > 0 {
+			return nil, unsupportedf("type %s", typV)
+		}
+		return &workerTypeRef{Kind: "named", Name: obj.Pkg().Path() + "." + obj.Name()}, nil
+	case *gotypes.Pointer:
+		return c.elemTypeRef("pointer", typV.Elem())
+	case *gotypes.Slice:
+		return c.elemTypeRef("slice", typV.Elem())
+	case *gotypes.Array:
+		ref, err := c.elemTypeRef("array", typV.Elem())
+		if err != nil {
+			return nil, err
+		}
+		ref.Len = int(typV.Len())
+		return ref, nil
+	case *gotypes.Chan:
+		ref, err := c.elemTypeRef("chan", typV.Elem())
+		if err != nil {
+			return nil, err
+		}
+		// reflect.ChanDirの値にする
+		switch typV.Dir() {
+		case gotypes.SendRecv:
+			ref.Dir = 3
+		case gotypes.SendOnly:
+			ref.Dir = 2
+		case gotypes.RecvOnly:
+			ref.Dir = 1
+		}
+		return ref, nil
+	case *gotypes.Map:
+		ref, err := c.elemTypeRef("map", typV.Elem())
+		if err != nil {
+			return nil, err
+		}
+		if ref.Key, err = c.typeRef(typV.Key()); err != nil {
+			return nil, err
+		}
+		return ref, nil
+	case *gotypes.Signature:
+		if typV.TypeParams().Len() > 0 {
+			return nil, unsupportedf("generic function type")
+		}
+		ref := &workerTypeRef{Kind: "func", Variadic: typV.Variadic()}
+		for i := range typV.Params().Len() {
+			param, err := c.typeRef(typV.Params().At(i).Type())
+			if err != nil {
+				return nil, err
+			}
+			ref.Params = append(ref.Params, param)
+		}
+		for i := range typV.Results().Len() {
+			result, err := c.typeRef(typV.Results().At(i).Type())
+			if err != nil {
+				return nil, err
+			}
+			ref.Results = append(ref.Results, result)
+		}
+		return ref, nil
+	case *gotypes.Struct:
+		// リフレクションでは、非公開のフィールドや埋め込みフィールドを持つ構造体は作れない
+		ref := &workerTypeRef{Kind: "struct"}
+		for i := range typV.NumFields() {
+			field := typV.Field(i)
+			if !field.Exported() || field.Embedded() {
+				return nil, unsupportedf("struct with field %s", field.Name())
+			}
+			fieldType, err := c.typeRef(field.Type())
+			if err != nil {
+				return nil, err
+			}
+			ref.Fields = append(ref.Fields, &workerFieldRef{Name: field.Name(), Type: fieldType, Tag: typV.Tag(i)})
+		}
+		return ref, nil
+	case *gotypes.Interface:
+		if typV.Empty() {
+			return &workerTypeRef{Kind: "basic", Name: "any"}, nil
+		}
+	}
+	return nil, unsupportedf("type %s", typ)
+}
+
+func (c *workerCompiler) elemTypeRef(kind string, elem gotypes.Type) (*workerTypeRef, error) {
+	elemRef, err := c.typeRef(elem)
+	if err != nil {
+		return nil, err
+	}
+	return &workerTypeRef{Kind: kind, Elem: elemRef}, nil
+}
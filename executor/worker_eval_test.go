@@ -0,0 +1,143 @@
+package executor
+
+import (
+	"errors"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExecutor_compileWorkerEvalRequest(t *testing.T) {
+	intType := &workerTypeRef{Kind: "basic", Name: "int"}
+	tests := []struct {
+		name                string
+		sessionSrc          string
+		executedStmtCount   int
+		expected            *workerEvalRequest
+		expectedUnsupported bool
+	}{
+		{
+			name: "variable held by worker is referenced and new variable is declared",
+			sessionSrc: `package main
+
+func main() {
+	x := 1
+	_ = x
+	y := x + 2
+	_ = y
+}
+`,
+			executedStmtCount: 2,
+			expected: &workerEvalRequest{
+				Stmts: []*workerNode{
+					{
+						Op: "assign",
+						Lhs: []*workerNode{
+							{Op: "newvar", Name: "y", Type: intType},
+						},
+						X: []*workerNode{
+							{Op: "binary", Name: "+", X: []*workerNode{
+								{Op: "var", Name: "x"},
+								{Op: "const", Value: "2", Type: intType},
+							}},
+						},
+					},
+					{Op: "assign", Lhs: []*workerNode{{Op: "blank"}}, X: []*workerNode{{Op: "var", Name: "y"}}},
+				},
+			},
+		},
+		{
+			name: "variable declared in the statement is evaluated as local",
+			sessionSrc: `package main
+
+func main() {
+	s := []int{1}
+	_ = s
+	for i := range s {
+		s[i] *= 2
+	}
+}
+`,
+			executedStmtCount: 2,
+			expected: &workerEvalRequest{
+				Stmts: []*workerNode{
+					{
+						Op:  "range",
+						X:   []*workerNode{{Op: "var", Name: "s"}},
+						Lhs: []*workerNode{{Op: "newlocal", Type: intType}, nil},
+						Body: []*workerNode{
+							{
+								Op:   "assign",
+								Name: "*",
+								Lhs: []*workerNode{
+									{Op: "index", X: []*workerNode{{Op: "var", Name: "s"}, {Op: "local"}}},
+								},
+								X: []*workerNode{{Op: "const", Value: "2", Type: intType}},
+							},
+						},
+					},
+				},
+				Locals: 1,
+			},
+		},
+		{
+			name: "type declared in the console is built as plugin",
+			sessionSrc: `package main
+
+type point struct{ X int }
+
+func main() {
+	p := point{X: 1}
+	_ = p
+}
+`,
+			expectedUnsupported: true,
+		},
+		{
+			name: "function literal is built as plugin",
+			sessionSrc: `package main
+
+func main() {
+	f := func() int { return 1 }
+	_ = f
+}
+`,
+			expectedUnsupported: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionSrc, err := parser.ParseFile(token.NewFileSet(), "", tt.sessionSrc, 0)
+			if err != nil {
+				t.Fatalf("failed to parse session source: %v", err)
+			}
+			// importのないセッションは、パッケージのエクスポートデータを調べずに型検査できる
+			sut := &Executor{
+				sessionSrc:    sessionSrc,
+				workerChecker: newWorkerChecker(nil),
+			}
+			checked, err := sut.checkWorkerSession()
+			if err != nil {
+				t.Fatalf("checkWorkerSession() returned an error: %v", err)
+			}
+
+			got, err := sut.compileWorkerEvalRequest(checked, tt.executedStmtCount)
+			if tt.expectedUnsupported {
+				var unsupportedErr *workerEvalUnsupportedError
+				if !errors.As(err, &unsupportedErr) {
+					t.Errorf("expected unsupported error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("compileWorkerEvalRequest() returned an error: %v", err)
+			}
+			if diff := cmp.Diff(tt.expected, got); diff != "" {
+				t.Errorf("eval request mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package executor
+
+import (
+	// go:embedディレクティブ用
+	_ "embed"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/kakkky/gonsole/errs"
+	"github.com/kakkky/gonsole/types"
+)
+
+//go:embed worker_plugin_runtime.go.txt
+var workerPluginRuntimeSrc []byte
+
+// workerVarsName はワーカーが保持する変数の値を受け渡すマップの引数名
+const workerVarsName = "gonsoleVars"
+
+// buildWorkerPluginSrc はsessionSrcから、ワーカーに読み込ませるプラグインのソースを組み立てる
+// 未実行の文だけをGonsoleRun関数の中で実行し、参照・宣言する変数はワーカーが保持するマップとやり取りする
+// ワーカーが評価できない文だけをプラグインとしてビルドする
+// 定数はワーカーに保持できないので、実行済みの定数宣言は毎回含める
+func (e *Executor) buildWorkerPluginSrc(executedStmtCount int) (*ast.File, error) {
+	pluginSrc, err := cloneFile(e.sessionSrc)
+	if err != nil {
+		return nil, err
+	}
+
+	mainFunc := getMainFunc(pluginSrc)
+	var constStmts []ast.Stmt
+	constNames := make(map[types.DeclName]bool)
+	for _, stmt := range mainFunc.Body.List[:executedStmtCount] {
+		if isConstDeclStmt(stmt) {
+			constStmts = append(constStmts, stmt)
+			for _, name := range constNamesOfStmt(stmt) {
+				constNames[name] = true
+			}
+		}
+	}
+	newStmts := mainFunc.Body.List[executedStmtCount:]
+
+	// 未実行の文から参照されている、実行済みの文で宣言された変数をワーカーから読み込む
+	declaredNames := make(map[types.DeclName]bool)
+	for _, stmt := range newStmts {
+		for _, name := range declNamesOfStmt(stmt) {
+			declaredNames[name] = true
+		}
+	}
+	var loadNames []types.DeclName
+	loaded := make(map[types.DeclName]bool)
+	for _, stmt := range newStmts {
+		for _, name := range e.referencedDeclNames(stmt) {
+			if loaded[name] || constNames[name] || declaredNames[name] {
+				continue
+			}
+			loaded[name] = true
+			loadNames = append(loadNames, name)
+		}
+	}
+	var body []ast.Stmt
+	body = append(body, constStmts...)
+	// 再宣言により名前を付け替えた変数には、元の名前で保持されている値を引き継ぐ
+	body = append(body, shadowedValueCopyStmts(workerVarsName, e.shadowedInSession, func(shadowedDecl) bool {
+		return true
+	})...)
+	for _, name := range loadNames {
+		loadStmts, err := e.workerLoadStmts(pluginSrc, name)
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, loadStmts...)
+	}
+	body = append(body, newStmts...)
+
+	// 読み込んだ変数は書き換えられている可能性があるので書き戻し、宣言した変数はワーカーに保持させる
+	for _, name := range loadNames {
+		body = append(body, workerWriteBackStmt(name))
+	}
+	for _, stmt := range newStmts {
+		for _, name := range declNamesOfStmt(stmt) {
+			if !loaded[name] {
+				loaded[name] = true
+				body = append(body, workerStoreStmt(name))
+			}
+		}
+	}
+
+	pluginSrc.Decls = replaceMainFunc(pluginSrc.Decls, &ast.FuncDecl{
+		Name: ast.NewIdent("GonsoleRun"),
+		Type: &ast.FuncType{
+			Params: &ast.FieldList{
+				List: []*ast.Field{
+					{
+						Names: []*ast.Ident{ast.NewIdent(workerVarsName)},
+						// AST的には表現が不正確になるがこちらの方がシンプルに書けるのでIdentに押し込める
+						Type: ast.NewIdent("map[string]interface{}"),
+					},
+				},
+			},
+		},
+		Body: &ast.BlockStmt{List: body},
+	})
+	removeUnusedImports(pluginSrc)
+	if len(loadNames) > 0 {
+		if err := addRuntime(pluginSrc, "worker plugin", workerPluginRuntimeSrc, nil); err != nil {
+			return nil, err
+		}
+	}
+	return pluginSrc, nil
+}
+
+// launchWorker はワーカーを起動する
+// 型検査に使うパッケージの情報は変更前のコードのものかもしれないので、ワーカーと合わせて作り直す
+func (e *Executor) launchWorker() error {
+	e.workerChecker = newWorkerChecker(e.commander)
+	return e.startWorker()
+}
+
+// relaunchWorker はワーカーを終了させてから起動し直す。保持していた変数の値は失われる
+func (e *Executor) relaunchWorker() error {
+	if err := e.stopWorker(); err != nil {
+		return err
+	}
+	return e.launchWorker()
+}
+
+// restartWorker はワーカーを起動し直し、実行済みの文をまとめて実行して変数の値を復元する
+func (e *Executor) restartWorker(tmpFile *os.File, tmpFileName string, fset *token.FileSet) error {
+	if err := e.relaunchWorker(); err != nil {
+		return err
+	}
+	return e.restoreWorker(tmpFile, tmpFileName, fset)
+}
+
+// restoreWorker は起動し直したワーカーで、実行済みの文をまとめて実行して変数の値を復元する
+func (e *Executor) restoreWorker(tmpFile *os.File, tmpFileName string, fset *token.FileSet) error {
+	replaySrc, err := e.buildWorkerPluginSrc(0)
+	if err != nil {
+		return err
+	}
+	if err := e.flush(replaySrc, tmpFile, fset); err != nil {
+		return err
+	}
+	// 再実行による出力は表示しない
+	ctx, stop := e.newExecContext()
+	defer stop()
+	if err := e.execInWorker(ctx, e.timeout, tmpFileName, io.Discard, io.Discard); err != nil {
+		return errs.NewInternalError("failed to restore session in worker").Wrap(workerBuildErr(err))
+	}
+	return e.flush(e.sessionSrc, tmpFile, fset)
+}
+
+// workerLoadStmts はワーカーから変数の値を読み込む`gonsoleRef_x := gonsoleLoad[T](gonsoleVars, "x")`と`x := *gonsoleRef_x`の形の文を生成する
+// ワーカーは変数の値をポインタで保持しているので、読み込んだポインタを通して書き戻す
+func (e *Executor) workerLoadStmts(pluginSrc *ast.File, name types.DeclName) ([]ast.Stmt, error) {
+	var typeExpr ast.Expr
+	for _, decl := range e.declRegistry.Decls {
+		if decl.Name != name || decl.TypeExpr == "" {
+			continue
+		}
+		parsed, err := parser.ParseExpr(string(decl.TypeExpr))
+		if err != nil || !addTypeImportPaths(pluginSrc, decl.TypeImportPaths) {
+			continue
+		}
+		typeExpr = parsed
+	}
+	if typeExpr == nil {
+		return nil, errs.NewBadInputError(fmt.Sprintf("%s cannot be used in worker mode because its type cannot be written in source code", name))
+	}
+
+	return []ast.Stmt{
+		&ast.AssignStmt{
+			Lhs: []ast.Expr{ast.NewIdent(workerRefName(name))},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{
+				&ast.CallExpr{
+					Fun: &ast.IndexExpr{X: ast.NewIdent("gonsoleLoad"), Index: typeExpr},
+					Args: []ast.Expr{
+						ast.NewIdent(workerVarsName),
+						&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(string(name))},
+					},
+				},
+			},
+		},
+		&ast.AssignStmt{
+			Lhs: []ast.Expr{ast.NewIdent(string(name))},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{&ast.StarExpr{X: ast.NewIdent(workerRefName(name))}},
+		},
+	}, nil
+}
+
+// workerWriteBackStmt は読み込んだ変数の値をワーカーに書き戻す`*gonsoleRef_x = x`の形の文を生成する
+func workerWriteBackStmt(name types.DeclName) ast.Stmt {
+	return &ast.AssignStmt{
+		Lhs: []ast.Expr{&ast.StarExpr{X: ast.NewIdent(workerRefName(name))}},
+		Tok: token.ASSIGN,
+		Rhs: []ast.Expr{ast.NewIdent(string(name))},
+	}
+}
+
+// workerStoreStmt は宣言した変数をワーカーに保持させる`gonsoleVars["x"] = &x`の形の文を生成する
+func workerStoreStmt(name types.DeclName) ast.Stmt {
+	return &ast.AssignStmt{
+		Lhs: []ast.Expr{workerVarsIndexExpr(name)},
+		Tok: token.ASSIGN,
+		Rhs: []ast.Expr{&ast.UnaryExpr{Op: token.AND, X: ast.NewIdent(string(name))}},
+	}
+}
+
+// workerRefName は読み込んだ変数の値へのポインタを持つ変数名
+func workerRefName(name types.DeclName) string {
+	return "gonsoleRef_" + string(name)
+}
+
+func workerVarsIndexExpr(name types.DeclName) ast.Expr {
+	return mapIndexExpr(workerVarsName, string(name))
+}
+
+func replaceMainFunc(decls []ast.Decl, funcDecl *ast.FuncDecl) []ast.Decl {
+	for i, decl := range decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Name.Name == "main" {
+			decls[i] = funcDecl
+		}
+	}
+	return decls
+}
+
+func isConstDeclStmt(stmt ast.Stmt) bool {
+	declStmt, ok := stmt.(*ast.DeclStmt)
+	if !ok {
+		return false
+	}
+	genDecl, ok := declStmt.Decl.(*ast.GenDecl)
+	return ok && genDecl.Tok == token.CONST
+}
+
+func constNamesOfStmt(stmt ast.Stmt) []types.DeclName {
+	var names []types.DeclName
+	for _, spec := range stmt.(*ast.DeclStmt).Decl.(*ast.GenDecl).Specs {
+		for _, name := range spec.(*ast.ValueSpec).Names {
+			names = append(names, types.DeclName(name.Name))
+		}
+	}
+	return names
+}
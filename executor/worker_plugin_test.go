@@ -0,0 +1,249 @@
+package executor
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kakkky/gonsole/declregistry"
+	"github.com/kakkky/gonsole/types"
+)
+
+func TestExecutor_buildWorkerPluginSrc(t *testing.T) {
+	tests := []struct {
+		name               string
+		sessionSrc         string
+		executedStmtCount  int
+		decls              []declregistry.Decl
+		shadowedInSession  []shadowedDecl
+		expectedRunFunc    string
+		expectedImports    []string
+		expectedErrMessage string
+	}{
+		{
+			name: "new statement stores declared variable",
+			sessionSrc: `package main
+
+func main() {
+	x := 1
+	_ = x
+}
+`,
+			executedStmtCount: 0,
+			expectedRunFunc: `func GonsoleRun(gonsoleVars map[string]interface{}) {
+	x := 1
+	_ = x
+	gonsoleVars["x"] = &x
+}`,
+		},
+		{
+			name: "referenced variable is loaded from worker and stored back",
+			sessionSrc: `package main
+
+import (
+	"example.com/animal"
+	"fmt"
+)
+
+func main() {
+	dog := animal.NewDog("Pochi", 3)
+	_ = dog
+	fmt.Println(dog.Bark())
+}
+`,
+			executedStmtCount: 2,
+			decls: []declregistry.Decl{
+				{Name: "dog", Pointered: true, TypeName: "Dog", TypePkgName: "animal", TypeExpr: "*animal.Dog", TypeImportPaths: []types.ImportPath{`"example.com/animal"`}},
+			},
+			expectedRunFunc: `func GonsoleRun(gonsoleVars map[string]interface{}) {
+	gonsoleRef_dog := gonsoleLoad[*animal.Dog](gonsoleVars, "dog")
+	dog := *gonsoleRef_dog
+	fmt.Println(dog.Bark())
+	*gonsoleRef_dog = dog
+}`,
+			expectedImports: []string{`"example.com/animal"`, `"fmt"`, `"fmt"`, `"reflect"`, `"strings"`},
+		},
+		{
+			name: "import used only by executed statement is removed",
+			sessionSrc: `package main
+
+import "example.com/shop"
+
+func main() {
+	order := shop.NewOrder()
+	_ = order
+	x := 1
+	_ = x
+}
+`,
+			executedStmtCount: 2,
+			decls: []declregistry.Decl{
+				{Name: "order", TypeName: "Order", TypePkgName: "model", TypeExpr: "model.Order", TypeImportPaths: []types.ImportPath{`"example.com/model"`}},
+			},
+			expectedRunFunc: `func GonsoleRun(gonsoleVars map[string]interface{}) {
+	x := 1
+	_ = x
+	gonsoleVars["x"] = &x
+}`,
+		},
+		{
+			name: "executed const declaration is kept",
+			sessionSrc: `package main
+
+func main() {
+	const c = 5
+	_ = c
+	x := 1
+	_ = x
+	y := c + x
+	_ = y
+}
+`,
+			executedStmtCount: 4,
+			decls: []declregistry.Decl{
+				{Name: "c", TypeName: "int", TypeExpr: "int"},
+				{Name: "x", TypeName: "int", TypeExpr: "int"},
+			},
+			expectedRunFunc: `func GonsoleRun(gonsoleVars map[string]interface{}) {
+	const c = 5
+	gonsoleRef_x := gonsoleLoad[int](gonsoleVars, "x")
+	x := *gonsoleRef_x
+	y := c + x
+	_ = y
+	*gonsoleRef_x = x
+	gonsoleVars["y"] = &y
+}`,
+			expectedImports: []string{`"fmt"`, `"reflect"`, `"strings"`},
+		},
+		{
+			name: "shadowed variable takes over the value held with the original name",
+			sessionSrc: `package main
+
+func main() {
+	gonsoleShadowed1_x := 1
+	_ = gonsoleShadowed1_x
+	x := gonsoleShadowed1_x + 1
+	_ = x
+}
+`,
+			executedStmtCount: 2,
+			decls: []declregistry.Decl{
+				{Name: "gonsoleShadowed1_x", TypeName: "int", TypeExpr: "int", Shadowed: true},
+			},
+			shadowedInSession: []shadowedDecl{
+				{name: "x", shadowedName: "gonsoleShadowed1_x"},
+			},
+			expectedRunFunc: `func GonsoleRun(gonsoleVars map[string]interface{}) {
+	gonsoleVars["gonsoleShadowed1_x"] = gonsoleVars["x"]
+	gonsoleRef_gonsoleShadowed1_x := gonsoleLoad[int](gonsoleVars, "gonsoleShadowed1_x")
+	gonsoleShadowed1_x := *gonsoleRef_gonsoleShadowed1_x
+	x := gonsoleShadowed1_x + 1
+	_ = x
+	*gonsoleRef_gonsoleShadowed1_x = gonsoleShadowed1_x
+	gonsoleVars["x"] = &x
+}`,
+			expectedImports: []string{`"fmt"`, `"reflect"`, `"strings"`},
+		},
+		{
+			name: "variable of type declared in the console is loaded as the type of the plugin",
+			sessionSrc: `package main
+
+type point struct {
+	X int
+}
+
+func main() {
+	p := point{X: 1}
+	_ = p
+	p.X++
+}
+`,
+			executedStmtCount: 2,
+			decls: []declregistry.Decl{
+				{Name: "p", TypeName: "point", TypeExpr: "point"},
+			},
+			expectedRunFunc: `func GonsoleRun(gonsoleVars map[string]interface{}) {
+	gonsoleRef_p := gonsoleLoad[point](gonsoleVars, "p")
+	p := *gonsoleRef_p
+	p.X++
+	*gonsoleRef_p = p
+}`,
+			expectedImports: []string{`"fmt"`, `"reflect"`, `"strings"`},
+		},
+		{
+			name: "variable whose type cannot be written is an error",
+			sessionSrc: `package main
+
+func main() {
+	v := newValue()
+	_ = v
+	v.Print()
+}
+`,
+			executedStmtCount: 2,
+			decls: []declregistry.Decl{
+				{Name: "v", TypeName: "value"},
+			},
+			expectedErrMessage: "v cannot be used in worker mode because its type cannot be written in source code",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionSrc, err := parser.ParseFile(token.NewFileSet(), "", tt.sessionSrc, 0)
+			if err != nil {
+				t.Fatalf("failed to parse session source: %v", err)
+			}
+			registry := declregistry.NewRegistry()
+			registry.Decls = append(registry.Decls, tt.decls...)
+			sut := &Executor{
+				declRegistry:      registry,
+				sessionSrc:        sessionSrc,
+				shadowedInSession: tt.shadowedInSession,
+			}
+
+			got, err := sut.buildWorkerPluginSrc(tt.executedStmtCount)
+			if tt.expectedErrMessage != "" {
+				if err == nil || err.Error() != tt.expectedErrMessage {
+					t.Errorf("expected error %q, got %v", tt.expectedErrMessage, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("buildWorkerPluginSrc() returned an error: %v", err)
+			}
+
+			var runFunc *ast.FuncDecl
+			for _, decl := range got.Decls {
+				if fn, ok := decl.(*ast.FuncDecl); ok && fn.Name.Name == "GonsoleRun" {
+					runFunc = fn
+				}
+			}
+			if runFunc == nil {
+				t.Fatal("GonsoleRun func not found")
+			}
+			var gotRunFunc bytes.Buffer
+			if err := format.Node(&gotRunFunc, token.NewFileSet(), runFunc); err != nil {
+				t.Fatalf("failed to format GonsoleRun func: %v", err)
+			}
+			if diff := cmp.Diff(tt.expectedRunFunc, gotRunFunc.String()); diff != "" {
+				t.Errorf("GonsoleRun func mismatch (-want +got):\n%s", diff)
+			}
+
+			var gotImports []string
+			for _, importSpec := range got.Imports {
+				gotImports = append(gotImports, importSpec.Path.Value)
+			}
+			if diff := cmp.Diff(tt.expectedImports, gotImports); diff != "" {
+				t.Errorf("imports mismatch (-want +got):\n%s", diff)
+			}
+			if getMainFunc(got) != nil {
+				t.Error("main func should be replaced with GonsoleRun func")
+			}
+		})
+	}
+}
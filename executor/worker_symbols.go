@@ -0,0 +1,382 @@
+package executor
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"maps"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kakkky/gonsole/errs"
+	"golang.org/x/tools/go/packages"
+)
+
+// workerSymbolStdPkgs はプロジェクトのimportに関わらず、ワーカーに常にリンクする標準パッケージ
+var workerSymbolStdPkgs = []string{
+	"fmt", "strings", "strconv", "errors", "bytes", "math", "sort", "slices", "maps", "time",
+	"os", "io", "unicode/utf8", "sync", "context", "regexp", "encoding/json", "path/filepath",
+}
+
+// buildHost はワーカーのソースにシンボル表と表示のランタイムを追加して、ビルドする
+// プロジェクトのパッケージをimportできるように、ソースは作業ディレクトリに一時的に書き出してビルドする
+// プロジェクトのパッケージを含めてビルドできない場合は、標準パッケージだけをリンクしてビルドし直す
+func (dw *defaultWorker) buildHost(hostBinFile string) error {
+	err := dw.buildHostWithSymbols(hostBinFile, dw.symbolPkgPatterns)
+	if err != nil && len(dw.symbolPkgPatterns) > 0 {
+		err = dw.buildHostWithSymbols(hostBinFile, nil)
+	}
+	return err
+}
+
+func (dw *defaultWorker) buildHostWithSymbols(hostBinFile string, patterns []string) error {
+	pkgs, err := loadWorkerSymbolPkgs(patterns)
+	if err != nil {
+		return err
+	}
+	hostSrc, err := buildWorkerHostSrc(pkgs)
+	if err != nil {
+		return err
+	}
+
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	hostSrcFile := fmt.Sprintf("%d_gonsole_worker.go", r.Int63n(1e10))
+	if err := os.WriteFile(hostSrcFile, hostSrc, 0o644); err != nil {
+		return errs.NewInternalError("failed to write worker source").Wrap(err)
+	}
+	defer os.Remove(hostSrcFile)
+	if err := dw.execGoBuild(hostSrcFile, hostBinFile); err != nil {
+		return errs.NewInternalError("failed to build worker").Wrap(workerBuildErr(err))
+	}
+	return nil
+}
+
+// loadWorkerSymbolPkgs はワーカーにリンクするパッケージを読み込む
+// patternsに一致するパッケージと、それらが直接importするパッケージ、workerSymbolStdPkgsをリンクする
+// mainパッケージや読み込めなかったパッケージ、作業ディレクトリからimportできないinternalパッケージは除く
+// シンボル表には宣言の名前と種類が分かればよいので、型検査はせずにファイルの一覧だけを読み込む
+func loadWorkerSymbolPkgs(patterns []string) ([]*packages.Package, error) {
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedModule,
+	}
+	pkgs, err := packages.Load(cfg, slices.Concat(workerSymbolStdPkgs, patterns)...)
+	if err != nil {
+		return nil, errs.NewInternalError("failed to load packages to link to worker").Wrap(err)
+	}
+
+	loaded := make(map[string]bool)
+	for _, pkg := range pkgs {
+		loaded[pkg.PkgPath] = true
+	}
+	var importPaths []string
+	for _, pkg := range pkgs {
+		for importPath := range pkg.Imports {
+			if !loaded[importPath] {
+				loaded[importPath] = true
+				importPaths = append(importPaths, importPath)
+			}
+		}
+	}
+	if len(importPaths) > 0 {
+		imported, err := packages.Load(cfg, importPaths...)
+		if err != nil {
+			return nil, errs.NewInternalError("failed to load packages to link to worker").Wrap(err)
+		}
+		pkgs = append(pkgs, imported...)
+	}
+
+	cwdImportPath := workingDirImportPath(pkgs)
+	pkgs = slices.DeleteFunc(pkgs, func(pkg *packages.Package) bool {
+		return pkg.Name == "main" || len(pkg.Errors) > 0 ||
+			pkg.PkgPath == "unsafe" || pkg.PkgPath == "C" || strings.Contains(pkg.PkgPath, "/vendor/") ||
+			!isInternalImportable(pkg.PkgPath, cwdImportPath)
+	})
+	slices.SortFunc(pkgs, func(a, b *packages.Package) int {
+		return strings.Compare(a.PkgPath, b.PkgPath)
+	})
+	return slices.CompactFunc(pkgs, func(a, b *packages.Package) bool {
+		return a.PkgPath == b.PkgPath
+	}), nil
+}
+
+// workingDirImportPath は作業ディレクトリのimportパスを返す。モジュールの外であれば空文字を返す
+func workingDirImportPath(pkgs []*packages.Package) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for _, pkg := range pkgs {
+		if pkg.Module == nil || !pkg.Module.Main {
+			continue
+		}
+		rel, err := filepath.Rel(pkg.Module.Dir, wd)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return ""
+		}
+		return path.Join(pkg.Module.Path, filepath.ToSlash(rel))
+	}
+	return ""
+}
+
+// isInternalImportable はinternalパッケージであれば、importerPathのパッケージからimportできるかを返す
+// internalパッケージは、internalの親ディレクトリ以下のパッケージからだけimportできる
+func isInternalImportable(importPath string, importerPath string) bool {
+	var parent string
+	switch {
+	case strings.HasSuffix(importPath, "/internal"):
+		parent = strings.TrimSuffix(importPath, "/internal")
+	case strings.Contains(importPath, "/internal/"):
+		parent = importPath[:strings.LastIndex(importPath, "/internal/")]
+	case importPath == "internal" || strings.HasPrefix(importPath, "internal/"):
+		// 標準パッケージのinternalパッケージは、標準パッケージからだけimportできる
+		return false
+	default:
+		return true
+	}
+	return importerPath != "" && (importerPath == parent || strings.HasPrefix(importerPath, parent+"/"))
+}
+
+// buildWorkerHostSrc はワーカーのソースに、表示のランタイムとパッケージのシンボル表を追加したソースを生成する
+func buildWorkerHostSrc(pkgs []*packages.Package) ([]byte, error) {
+	hostSrc, err := parser.ParseFile(token.NewFileSet(), "", workerHostSrc, 0)
+	if err != nil {
+		return nil, errs.NewInternalError("failed to parse worker source").Wrap(err)
+	}
+	if err := addRuntime(hostSrc, "display", displayRuntimeSrc, nil); err != nil {
+		return nil, err
+	}
+	symbolSrc, err := workerSymbolSrc(pkgs)
+	if err != nil {
+		return nil, err
+	}
+	if err := addRuntime(hostSrc, "worker symbol", symbolSrc, nil); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, token.NewFileSet(), hostSrc); err != nil {
+		return nil, errs.NewInternalError("failed to format worker source").Wrap(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// workerSymbolSrc はパッケージの公開された関数・変数・型を、ワーカーのシンボル表に登録するinit関数のソースを生成する
+// 型引数を持つ関数・型と型エイリアス、制約にしか使えないインターフェースは、値や型として扱えないので登録しない
+func workerSymbolSrc(pkgs []*packages.Package) ([]byte, error) {
+	files := make([][]*ast.File, len(pkgs))
+	for i, pkg := range pkgs {
+		var err error
+		if files[i], err = parseGoFiles(pkg); err != nil {
+			return nil, err
+		}
+	}
+	constraints := constraintTypesOf(pkgs, files)
+
+	var imports, inits bytes.Buffer
+	for i, pkg := range pkgs {
+		symbols := exportedSymbolsOf(files[i])
+		maps.DeleteFunc(symbols, func(name string, tok token.Token) bool {
+			return tok == token.TYPE && constraints[pkg.PkgPath+"."+name]
+		})
+		if len(symbols) == 0 {
+			continue
+		}
+		alias := fmt.Sprintf("gonsolesym%d", i)
+		fmt.Fprintf(&imports, "\t%s %q\n", alias, pkg.PkgPath)
+		for _, name := range slices.Sorted(maps.Keys(symbols)) {
+			key := strconv.Quote(pkg.PkgPath + "." + name)
+			ref := alias + "." + name
+			switch symbols[name] {
+			case token.FUNC:
+				fmt.Fprintf(&inits, "\tsymbolFuncs[%s] = reflect.ValueOf(%s)\n", key, ref)
+			case token.VAR:
+				fmt.Fprintf(&inits, "\tsymbolVars[%s] = reflect.ValueOf(&%s).Elem()\n", key, ref)
+			case token.TYPE:
+				fmt.Fprintf(&inits, "\tsymbolTypes[%s] = reflect.TypeOf((*%s)(nil)).Elem()\n", key, ref)
+			}
+		}
+	}
+
+	var src bytes.Buffer
+	src.WriteString("package main\n\nimport (\n\t\"reflect\"\n")
+	src.Write(imports.Bytes())
+	src.WriteString(")\n\nfunc init() {\n")
+	src.Write(inits.Bytes())
+	src.WriteString("}\n")
+	return src.Bytes(), nil
+}
+
+// parseGoFiles はパッケージのビルド対象のファイルを、宣言を調べるために構文解析する
+func parseGoFiles(pkg *packages.Package) ([]*ast.File, error) {
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, fileName := range pkg.GoFiles {
+		file, err := parser.ParseFile(fset, fileName, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, errs.NewInternalError(fmt.Sprintf("failed to parse %s to link to worker", fileName)).Wrap(err)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// exportedSymbolsOf はファイルで宣言された公開された関数・変数・型の名前と、その種類（func, var, type）を返す
+func exportedSymbolsOf(files []*ast.File) map[string]token.Token {
+	symbols := make(map[string]token.Token)
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			switch declV := decl.(type) {
+			case *ast.FuncDecl:
+				if declV.Recv == nil && declV.Type.TypeParams == nil && declV.Name.IsExported() {
+					symbols[declV.Name.Name] = token.FUNC
+				}
+			case *ast.GenDecl:
+				for _, spec := range declV.Specs {
+					switch specV := spec.(type) {
+					case *ast.ValueSpec:
+						if declV.Tok != token.VAR {
+							continue
+						}
+						for _, name := range specV.Names {
+							if name.IsExported() {
+								symbols[name.Name] = token.VAR
+							}
+						}
+					case *ast.TypeSpec:
+						if !specV.Assign.IsValid() && specV.TypeParams == nil && specV.Name.IsExported() {
+							symbols[specV.Name.Name] = token.TYPE
+						}
+					}
+				}
+			}
+		}
+	}
+	return symbols
+}
+
+// workerTypeDecl は制約にしか使えない型かを調べるための、パッケージで宣言された型
+type workerTypeDecl struct {
+	pkgPath string
+	file    *ast.File
+	spec    *ast.TypeSpec
+}
+
+// constraintTypesOf はパッケージで宣言された型のうち、制約にしか使えないインターフェースを"importパス.型名"の集合で返す
+// 型検査はしないので、型の集合を含むインターフェースと、それを埋め込んだり元にしたりする型を構文から辿る
+// 読み込んでいないパッケージのインターフェースを埋め込んでいる場合は、分からないので制約として扱う
+func constraintTypesOf(pkgs []*packages.Package, files [][]*ast.File) map[string]bool {
+	decls := make(map[string]workerTypeDecl)
+	for i, pkg := range pkgs {
+		for _, file := range files[i] {
+			for _, decl := range file.Decls {
+				genDecl, ok := decl.(*ast.GenDecl)
+				if !ok || genDecl.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range genDecl.Specs {
+					typeSpec := spec.(*ast.TypeSpec)
+					decls[pkg.PkgPath+"."+typeSpec.Name.Name] = workerTypeDecl{pkgPath: pkg.PkgPath, file: file, spec: typeSpec}
+				}
+			}
+		}
+	}
+
+	constraints := make(map[string]bool)
+	// 埋め込んだ型が制約と分かると埋め込んだ側も制約になるので、増えなくなるまで繰り返す
+	for changed := true; changed; {
+		changed = false
+		for key, decl := range decls {
+			if !constraints[key] && isConstraintTypeDecl(decl, decls, constraints) {
+				constraints[key] = true
+				changed = true
+			}
+		}
+	}
+	return constraints
+}
+
+func isConstraintTypeDecl(decl workerTypeDecl, decls map[string]workerTypeDecl, constraints map[string]bool) bool {
+	iface, ok := decl.spec.Type.(*ast.InterfaceType)
+	if !ok {
+		// `type X Y`の形であれば、Yが制約であればXも制約になる
+		key, ok := typeDeclKey(decl.spec.Type, decl)
+		return ok && constraints[key]
+	}
+	for _, method := range iface.Methods.List {
+		if len(method.Names) > 0 {
+			continue
+		}
+		switch elem := method.Type.(type) {
+		case *ast.Ident:
+			if elem.Name == "error" || elem.Name == "any" {
+				continue
+			}
+		case *ast.BinaryExpr, *ast.UnaryExpr:
+			// 型の和集合（A | B）と、基になる型の集合（~T）
+			return true
+		}
+		// インターフェースでない型を埋め込むと型の集合を持つことになる
+		key, ok := typeDeclKey(method.Type, decl)
+		if !ok || constraints[key] {
+			return true
+		}
+		embedded, ok := decls[key]
+		if !ok {
+			return true
+		}
+		if _, isIface := embedded.spec.Type.(*ast.InterfaceType); !isIface {
+			return true
+		}
+	}
+	return false
+}
+
+// typeDeclKey は型を参照する式から、宣言されたパッケージを含めた"importパス.型名"を返す
+// 型名やパッケージの名前で参照していない場合はfalseを返す
+func typeDeclKey(expr ast.Expr, from workerTypeDecl) (string, bool) {
+	var key string
+	switch exprV := expr.(type) {
+	case *ast.Ident:
+		key = from.pkgPath + "." + exprV.Name
+	case *ast.SelectorExpr:
+		pkgIdent, ok := exprV.X.(*ast.Ident)
+		if !ok {
+			return "", false
+		}
+		importPath, ok := importPathOfName(from.file, pkgIdent.Name)
+		if !ok {
+			return "", false
+		}
+		key = importPath + "." + exprV.Sel.Name
+	default:
+		return "", false
+	}
+	return key, true
+}
+
+// importPathOfName はファイルでパッケージを参照している名前から、importパスを返す
+// エイリアスを付けていないimportは、パッケージ名がimportパスの最後の要素と同じとみなす
+func importPathOfName(file *ast.File, name string) (string, bool) {
+	for _, imp := range file.Imports {
+		importPath, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		pkgName := path.Base(importPath)
+		if imp.Name != nil {
+			pkgName = imp.Name.Name
+		}
+		if pkgName == name {
+			return importPath, true
+		}
+	}
+	return "", false
+}
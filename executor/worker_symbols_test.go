@@ -0,0 +1,140 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestWorkerSymbolSrc(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected string
+	}{
+		{
+			name: "exported funcs, vars and types are registered",
+			files: map[string]string{
+				"animal.go": `package animal
+
+type Dog struct{ Name string }
+
+func NewDog(name string) *Dog { return &Dog{Name: name} }
+
+func (d *Dog) Bark() string { return d.Name }
+
+func newCat() {}
+
+var Count, total = 1, 2
+
+const Max = 3
+`,
+			},
+			expected: `package main
+
+import (
+	"reflect"
+	gonsolesym0 "example.com/animal"
+)
+
+func init() {
+	symbolVars["example.com/animal.Count"] = reflect.ValueOf(&gonsolesym0.Count).Elem()
+	symbolTypes["example.com/animal.Dog"] = reflect.TypeOf((*gonsolesym0.Dog)(nil)).Elem()
+	symbolFuncs["example.com/animal.NewDog"] = reflect.ValueOf(gonsolesym0.NewDog)
+}
+`,
+		},
+		{
+			name: "generics, aliases and constraint interfaces are not registered",
+			files: map[string]string{
+				"number.go": `package animal
+
+import "io"
+
+type Number interface{ ~int | ~float64 }
+
+type Ordered interface {
+	Number
+	comparable
+}
+
+type Sizer interface{ Size() int }
+
+type ReadSizer interface {
+	Sizer
+	error
+}
+
+type Reader interface{ io.Reader }
+
+type Box[T any] struct{ V T }
+
+type Size = int
+
+func Max[T Number](a, b T) T { return a }
+`,
+			},
+			expected: `package main
+
+import (
+	"reflect"
+	gonsolesym0 "example.com/animal"
+)
+
+func init() {
+	symbolTypes["example.com/animal.ReadSizer"] = reflect.TypeOf((*gonsolesym0.ReadSizer)(nil)).Elem()
+	symbolTypes["example.com/animal.Sizer"] = reflect.TypeOf((*gonsolesym0.Sizer)(nil)).Elem()
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			pkg := &packages.Package{PkgPath: "example.com/animal"}
+			for name, src := range tt.files {
+				fileName := filepath.Join(dir, name)
+				if err := os.WriteFile(fileName, []byte(src), 0o644); err != nil {
+					t.Fatalf("failed to write %s: %v", name, err)
+				}
+				pkg.GoFiles = append(pkg.GoFiles, fileName)
+			}
+
+			got, err := workerSymbolSrc([]*packages.Package{pkg})
+			if err != nil {
+				t.Fatalf("workerSymbolSrc() returned an error: %v", err)
+			}
+			if diff := cmp.Diff(tt.expected, string(got)); diff != "" {
+				t.Errorf("symbol source mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestIsInternalImportable(t *testing.T) {
+	tests := []struct {
+		name         string
+		importPath   string
+		importerPath string
+		expected     bool
+	}{
+		{name: "not internal package", importPath: "example.com/app/animal", importerPath: "", expected: true},
+		{name: "internal package under importer's parent", importPath: "example.com/app/internal/calc", importerPath: "example.com/app", expected: true},
+		{name: "internal package from nested package", importPath: "example.com/app/internal", importerPath: "example.com/app/cmd", expected: true},
+		{name: "internal package of another tree", importPath: "example.com/app/internal/calc", importerPath: "example.com/lib", expected: false},
+		{name: "internal package outside module", importPath: "example.com/app/internal/calc", importerPath: "", expected: false},
+		{name: "internal package of standard library", importPath: "internal/poll", importerPath: "example.com/app", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isInternalImportable(tt.importPath, tt.importerPath); got != tt.expected {
+				t.Errorf("isInternalImportable(%q, %q) = %v, want %v", tt.importPath, tt.importerPath, got, tt.expected)
+			}
+		})
+	}
+}
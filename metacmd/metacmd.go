@@ -0,0 +1,63 @@
+package metacmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kakkky/gonsole/errs"
+)
+
+// Prefix はメタコマンドの接頭辞
+const Prefix = ":"
+
+// Command はREPLセッションを操作するメタコマンドを表す
+type Command struct {
+	Name        string // 接頭辞を含むコマンド名（例: ":help"）
+	Usage       string // 引数を含む使い方（例: ":drop <name>"）。引数がなければ空
+	Description string
+	Run         func(args []string) error
+}
+
+// Dispatcher はメタコマンドを管理し、入力に応じて実行する
+// ReplとCompleterで共有して使う
+type Dispatcher struct {
+	commands []Command
+}
+
+// NewDispatcher はDispatcherのインスタンスを生成する
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		commands: []Command{},
+	}
+}
+
+// Register はメタコマンドを登録する
+func (d *Dispatcher) Register(commands ...Command) {
+	d.commands = append(d.commands, commands...)
+}
+
+// Commands は登録されているメタコマンドを返す
+func (d *Dispatcher) Commands() []Command {
+	return d.commands
+}
+
+// Dispatch は入力されたメタコマンドを実行する
+func (d *Dispatcher) Dispatch(input string) error {
+	fields := strings.Fields(input)
+	if len(fields) == 0 || !IsMetaCommand(fields[0]) {
+		return errs.NewBadInputError(fmt.Sprintf("%q is not a command", input))
+	}
+
+	name, args := fields[0], fields[1:]
+	for _, command := range d.commands {
+		if command.Name == name {
+			return command.Run(args)
+		}
+	}
+	return errs.NewBadInputError(fmt.Sprintf("unknown command %s (type %shelp to see available commands)", name, Prefix))
+}
+
+// IsMetaCommand は入力がメタコマンドかを返す
+func IsMetaCommand(input string) bool {
+	return strings.HasPrefix(strings.TrimSpace(input), Prefix)
+}
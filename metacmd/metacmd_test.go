@@ -0,0 +1,92 @@
+package metacmd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kakkky/gonsole/errs"
+)
+
+func TestDispatcher_Dispatch(t *testing.T) {
+	tests := []struct {
+		name             string
+		input            string
+		expectedArgs     []string
+		expectedCalled   bool
+		expectedBadInput bool
+	}{
+		{
+			name:           "command without arguments",
+			input:          ":echo",
+			expectedArgs:   []string{},
+			expectedCalled: true,
+		},
+		{
+			name:           "command with arguments",
+			input:          "  :echo a  b ",
+			expectedArgs:   []string{"a", "b"},
+			expectedCalled: true,
+		},
+		{
+			name:             "unknown command",
+			input:            ":unknown",
+			expectedBadInput: true,
+		},
+		{
+			name:             "not a command",
+			input:            "x := 1",
+			expectedBadInput: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var called bool
+			var gotArgs []string
+			sut := NewDispatcher()
+			sut.Register(Command{
+				Name: ":echo",
+				Run: func(args []string) error {
+					called = true
+					gotArgs = args
+					return nil
+				},
+			})
+
+			err := sut.Dispatch(tt.input)
+
+			var badInputErr *errs.BadInputError
+			if tt.expectedBadInput != errors.As(err, &badInputErr) {
+				t.Errorf("Dispatch() error = %v, expected bad input error: %v", err, tt.expectedBadInput)
+			}
+			if called != tt.expectedCalled {
+				t.Errorf("command called = %v, want %v", called, tt.expectedCalled)
+			}
+			if diff := cmp.Diff(tt.expectedArgs, gotArgs); diff != "" {
+				t.Errorf("args mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestIsMetaCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected bool
+	}{
+		{name: "command", input: ":help", expected: true},
+		{name: "command with leading spaces", input: "  :vars", expected: true},
+		{name: "go statement", input: "x := 1", expected: false},
+		{name: "empty", input: "", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsMetaCommand(tt.input); got != tt.expected {
+				t.Errorf("IsMetaCommand(%q) = %v, want %v", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
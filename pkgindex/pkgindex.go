@@ -0,0 +1,159 @@
+package pkgindex
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kakkky/gonsole/errs"
+	"github.com/kakkky/gonsole/types"
+	"golang.org/x/tools/go/packages"
+)
+
+// Index はプロジェクト内のパッケージの、パッケージ名とimportパスの索引
+// パッケージの読み込みは大きなプロジェクトでは時間がかかるので、一度作った索引を使い回す
+// go.modやパッケージのディレクトリが変わった場合は、次に参照した時に作り直す
+type Index struct {
+	dir  string
+	pkgs []Pkg
+	// stampDirs は変更を検知するために更新時刻を調べる、パッケージのディレクトリとその親ディレクトリ
+	stampDirs []string
+	// stamp は索引を作った時点のgo.modとディレクトリの状態で、変更を検知するために使う
+	stamp uint64
+	built bool
+}
+
+// Pkg は索引に含まれるパッケージを表す
+type Pkg struct {
+	Name       types.PkgName
+	ImportPath types.ImportPath
+}
+
+// New はdir以下のパッケージの索引を生成する。索引は最初に参照した時に作られる
+func New(dir string) *Index {
+	return &Index{dir: dir}
+}
+
+// Set は読み込み済みのパッケージから索引を作る
+// 補完候補の生成などで読み込んだパッケージを渡すことで、読み込みを一度で済ませる
+func (idx *Index) Set(pkgs []*packages.Package) error {
+	stampDirs, err := idx.collectStampDirs(pkgs)
+	if err != nil {
+		return err
+	}
+	idx.stampDirs = stampDirs
+	stamp, err := idx.computeStamp()
+	if err != nil {
+		return err
+	}
+	idx.pkgs = make([]Pkg, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		// mainパッケージはimportできない
+		if pkg.Name == "main" {
+			continue
+		}
+		idx.pkgs = append(idx.pkgs, Pkg{
+			Name:       types.PkgName(pkg.Name),
+			ImportPath: types.ImportPath(strconv.Quote(pkg.PkgPath)),
+		})
+	}
+	idx.stamp = stamp
+	idx.built = true
+	return nil
+}
+
+// ImportPathsOf はパッケージ名に一致するパッケージのimportパスを返す
+// 索引を作った後にgo.modやパッケージのディレクトリが変わっていれば、作り直してから探す
+func (idx *Index) ImportPathsOf(pkgName types.PkgName) ([]types.ImportPath, error) {
+	if err := idx.refreshIfStale(); err != nil {
+		return nil, err
+	}
+	var importPaths []types.ImportPath
+	for _, pkg := range idx.pkgs {
+		if pkg.Name == pkgName {
+			importPaths = append(importPaths, pkg.ImportPath)
+		}
+	}
+	return importPaths, nil
+}
+
+func (idx *Index) refreshIfStale() error {
+	if idx.built {
+		stamp, err := idx.computeStamp()
+		if err != nil {
+			return err
+		}
+		if stamp == idx.stamp {
+			return nil
+		}
+	}
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles, // 変更の検知のためにパッケージのディレクトリを使う
+		Dir:  idx.dir,
+	}
+	pkgs, err := packages.Load(cfg, "./...")
+	if err != nil {
+		return errs.NewInternalError("failed to load packages").Wrap(err)
+	}
+	return idx.Set(pkgs)
+}
+
+// collectStampDirs はパッケージのディレクトリと、プロジェクトのルートまでの親ディレクトリを集める
+// ディレクトリの更新時刻は、その中のファイルやディレクトリが追加・削除・リネームされると変わるので、
+// パッケージの追加・削除はこれらのディレクトリのいずれかの更新時刻の変化として現れる
+func (idx *Index) collectStampDirs(pkgs []*packages.Package) ([]string, error) {
+	root, err := filepath.Abs(idx.dir)
+	if err != nil {
+		return nil, errs.NewInternalError("failed to resolve project directory").Wrap(err)
+	}
+	dirs := []string{root}
+	for _, pkg := range pkgs {
+		if pkg.Dir == "" {
+			continue
+		}
+		for dir := pkg.Dir; !slices.Contains(dirs, dir); dir = filepath.Dir(dir) {
+			dirs = append(dirs, dir)
+			// プロジェクトの外のパッケージ（go.workで使う別のモジュールなど）は、そのディレクトリだけを調べる
+			if rel, err := filepath.Rel(root, dir); err != nil || strings.HasPrefix(rel, "..") {
+				break
+			}
+		}
+	}
+	return dirs, nil
+}
+
+// computeStamp はgo.mod・go.workと、パッケージのディレクトリとその親ディレクトリの更新時刻からハッシュ値を計算する
+// 大きなプロジェクトでも参照のたびにディレクトリ全体をたどらないように、索引を作った時点のパッケージのディレクトリだけを調べる
+func (idx *Index) computeStamp() (uint64, error) {
+	hash := fnv.New64a()
+	for _, name := range []string{"go.mod", "go.work"} {
+		path := filepath.Join(idx.dir, name)
+		info, err := os.Stat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return 0, errs.NewInternalError("failed to check project files").Wrap(err)
+		}
+		fmt.Fprintf(hash, "%s:%d:%d\n", path, info.ModTime().UnixNano(), info.Size())
+	}
+	for _, dir := range idx.stampDirs {
+		info, err := os.Stat(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			// 削除されたディレクトリは、削除されたこと自体を状態として扱う
+			fmt.Fprintf(hash, "%s:removed\n", dir)
+			continue
+		}
+		if err != nil {
+			return 0, errs.NewInternalError("failed to check project directories").Wrap(err)
+		}
+		fmt.Fprintf(hash, "%s:%d\n", dir, info.ModTime().UnixNano())
+	}
+	return hash.Sum64(), nil
+}
@@ -0,0 +1,144 @@
+package pkgindex
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kakkky/gonsole/types"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestIndex_ImportPathsOf(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "go.mod"), "module example.com/app\n\ngo 1.21\n")
+	writeFile(t, filepath.Join(dir, "main.go"), "package main\n\nfunc main() {}\n")
+	writeFile(t, filepath.Join(dir, "animal", "utils", "utils.go"), "package utils\n")
+	writeFile(t, filepath.Join(dir, "testdata", "utils", "utils.go"), "package utils\n")
+
+	sut := New(dir)
+
+	// 最初に参照した時に索引が作られる
+	got, err := sut.ImportPathsOf("utils")
+	if err != nil {
+		t.Fatalf("ImportPathsOf() returned an error: %v", err)
+	}
+	if diff := cmp.Diff([]types.ImportPath{`"example.com/app/animal/utils"`}, got); diff != "" {
+		t.Errorf("ImportPathsOf() mismatch (-want +got):\n%s", diff)
+	}
+	got, err = sut.ImportPathsOf("main")
+	if err != nil {
+		t.Fatalf("ImportPathsOf() returned an error: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("expected main package not to be indexed, got %v", got)
+	}
+
+	// パッケージのディレクトリが増えた場合は作り直される
+	time.Sleep(10 * time.Millisecond)
+	writeFile(t, filepath.Join(dir, "plant", "utils", "utils.go"), "package utils\n")
+	got, err = sut.ImportPathsOf("utils")
+	if err != nil {
+		t.Fatalf("ImportPathsOf() returned an error: %v", err)
+	}
+	expected := []types.ImportPath{`"example.com/app/animal/utils"`, `"example.com/app/plant/utils"`}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("ImportPathsOf() mismatch after adding package (-want +got):\n%s", diff)
+	}
+}
+
+func TestIndex_Set(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "go.mod"), "module example.com/app\n\ngo 1.21\n")
+
+	sut := New(dir)
+	err := sut.Set([]*packages.Package{
+		{Name: "animal", PkgPath: "example.com/app/animal"},
+	})
+	if err != nil {
+		t.Fatalf("Set() returned an error: %v", err)
+	}
+
+	// 変更がなければ、渡されたパッケージの索引がそのまま使われる
+	got, err := sut.ImportPathsOf("animal")
+	if err != nil {
+		t.Fatalf("ImportPathsOf() returned an error: %v", err)
+	}
+	if diff := cmp.Diff([]types.ImportPath{`"example.com/app/animal"`}, got); diff != "" {
+		t.Errorf("ImportPathsOf() mismatch (-want +got):\n%s", diff)
+	}
+
+	// go.modが変わった場合は読み込み直される（このディレクトリにはanimalパッケージは存在しない）
+	time.Sleep(10 * time.Millisecond)
+	writeFile(t, filepath.Join(dir, "go.mod"), "module example.com/app\n\ngo 1.22\n")
+	got, err = sut.ImportPathsOf("animal")
+	if err != nil {
+		t.Fatalf("ImportPathsOf() returned an error: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("expected index to be rebuilt, got %v", got)
+	}
+}
+
+func TestIndex_computeStamp(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "go.mod"), "module example.com/app\n\ngo 1.21\n")
+	writeFile(t, filepath.Join(dir, "internal", "animal", "animal.go"), "package animal\n")
+	writeFile(t, filepath.Join(dir, "docs", "guide", "guide.md"), "# guide\n")
+
+	sut := New(dir)
+	if _, err := sut.ImportPathsOf("animal"); err != nil {
+		t.Fatalf("ImportPathsOf() returned an error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		expected bool
+	}{
+		{
+			name:     "file added outside package directories is not checked",
+			path:     filepath.Join("docs", "guide", "usage.md"),
+			expected: false,
+		},
+		{
+			name:     "file added to package directory changes stamp",
+			path:     filepath.Join("internal", "animal", "dog.go"),
+			expected: true,
+		},
+		{
+			name:     "directory added to parent of package directory changes stamp",
+			path:     filepath.Join("internal", "plant", "plant.go"),
+			expected: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, err := sut.computeStamp()
+			if err != nil {
+				t.Fatalf("computeStamp() returned an error: %v", err)
+			}
+			time.Sleep(10 * time.Millisecond)
+			writeFile(t, filepath.Join(dir, tt.path), "package x\n")
+			after, err := sut.computeStamp()
+			if err != nil {
+				t.Fatalf("computeStamp() returned an error: %v", err)
+			}
+			if got := before != after; got != tt.expected {
+				t.Errorf("stamp changed = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+}
@@ -0,0 +1,273 @@
+package repl
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/kakkky/gonsole/declregistry"
+	"github.com/kakkky/gonsole/errs"
+	"github.com/kakkky/gonsole/executor"
+	"github.com/kakkky/gonsole/metacmd"
+	"github.com/kakkky/gonsole/types"
+)
+
+// registerMetaCommands はREPLセッションを操作するメタコマンドを登録する
+func (r *Repl) registerMetaCommands() {
+	r.dispatcher.Register(
+		metacmd.Command{
+			Name:        metacmd.Prefix + "help",
+			Description: "show available commands",
+			Run:         r.help,
+		},
+		metacmd.Command{
+			Name:        metacmd.Prefix + "vars",
+			Description: "list declared variables and their types",
+			Run:         r.vars,
+		},
+		metacmd.Command{
+			Name:        metacmd.Prefix + "imports",
+			Description: "list imported packages",
+			Run:         r.imports,
+		},
+		metacmd.Command{
+			Name:        metacmd.Prefix + "bind",
+			Usage:       metacmd.Prefix + "bind [<package> [<import path>]]",
+			Description: "list, set or clear the import path used for a package name",
+			Run:         r.bind,
+		},
+		metacmd.Command{
+			Name:        metacmd.Prefix + "format",
+			Usage:       metacmd.Prefix + "format [go|json|compact]",
+			Description: "show or change how expression results are displayed",
+			Run:         r.format,
+		},
+		metacmd.Command{
+			Name:        metacmd.Prefix + "timeout",
+			Usage:       metacmd.Prefix + "timeout [<duration>|off]",
+			Description: "show or change how long an input may run before it is interrupted",
+			Run:         r.timeout,
+		},
+		metacmd.Command{
+			Name:        metacmd.Prefix + "source",
+			Description: "show the source code of the session",
+			Run:         r.source,
+		},
+		metacmd.Command{
+			Name:        metacmd.Prefix + "undo",
+			Description: "undo the last statement",
+			Run:         r.undo,
+		},
+		metacmd.Command{
+			Name:        metacmd.Prefix + "drop",
+			Usage:       metacmd.Prefix + "drop <name>",
+			Description: "remove a variable and every statement that depends on it",
+			Run:         r.drop,
+		},
+		metacmd.Command{
+			Name:        metacmd.Prefix + "reload",
+			Description: "reload the project packages and rerun the session against them",
+			Run:         r.reload,
+		},
+		metacmd.Command{
+			Name:        metacmd.Prefix + "reset",
+			Description: "discard all declarations and imports",
+			Run:         r.reset,
+		},
+		metacmd.Command{
+			Name:        metacmd.Prefix + "quit",
+			Description: "exit the session",
+			Run:         r.quitSession,
+		},
+	)
+}
+
+func (r *Repl) help(args []string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w)
+	for _, command := range r.dispatcher.Commands() {
+		usage := command.Usage
+		if usage == "" {
+			usage = command.Name
+		}
+		fmt.Fprintf(w, "  %s\t%s\n", usage, command.Description)
+	}
+	fmt.Fprintln(w)
+	return flushTabWriter(w)
+}
+
+func (r *Repl) vars(args []string) error {
+	// 再宣言により参照できなくなった変数は表示しない
+	decls := slices.DeleteFunc(slices.Clone(r.declRegistry.Decls), func(decl declregistry.Decl) bool {
+		return decl.Shadowed
+	})
+	if len(decls) == 0 {
+		fmt.Print("\nno variables declared\n\n")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w)
+	for _, decl := range decls {
+		fmt.Fprintf(w, "  %s\t%s\n", decl.Name, decl.TypeStr())
+	}
+	fmt.Fprintln(w)
+	return flushTabWriter(w)
+}
+
+func (r *Repl) imports(args []string) error {
+	imports := r.executor.Imports()
+	if len(imports) == 0 {
+		fmt.Print("\nno packages imported\n\n")
+		return nil
+	}
+	fmt.Println()
+	for _, imp := range imports {
+		fmt.Printf("  %s\n", imp)
+	}
+	fmt.Println()
+	return nil
+}
+
+func (r *Repl) bind(args []string) error {
+	switch len(args) {
+	case 0:
+		bindings := r.executor.ImportPathBindings()
+		if len(bindings) == 0 {
+			fmt.Print("\nno import paths bound\n\n")
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w)
+		for _, pkgName := range slices.Sorted(maps.Keys(bindings)) {
+			fmt.Fprintf(w, "  %s\t%s\n", pkgName, bindings[pkgName])
+		}
+		fmt.Fprintln(w)
+		return flushTabWriter(w)
+	case 1:
+		// importパスを指定しない場合は取り消して、次に参照した時に改めて選択させる
+		r.executor.UnbindImportPath(types.PkgName(args[0]))
+		fmt.Printf("\nunbound %s\n\n", args[0])
+		return nil
+	case 2:
+		importPath := args[1]
+		if !strings.HasPrefix(importPath, `"`) {
+			importPath = strconv.Quote(importPath)
+		}
+		if err := r.executor.BindImportPath(types.PkgName(args[0]), types.ImportPath(importPath)); err != nil {
+			return err
+		}
+		fmt.Printf("\nbound %s to %s\n\n", args[0], importPath)
+		return nil
+	}
+	return errs.NewBadInputError("usage: " + metacmd.Prefix + "bind [<package> [<import path>]]")
+}
+
+func (r *Repl) format(args []string) error {
+	switch len(args) {
+	case 0:
+		fmt.Printf("\ndisplay format: %s\n\n", r.executor.DisplayFormat())
+		return nil
+	case 1:
+		displayFormat, err := executor.ParseDisplayFormat(args[0])
+		if err != nil {
+			return err
+		}
+		r.executor.SetDisplayFormat(displayFormat)
+		fmt.Printf("\ndisplay format set to %s\n\n", displayFormat)
+		return nil
+	}
+	return errs.NewBadInputError("usage: " + metacmd.Prefix + "format [go|json|compact]")
+}
+
+func (r *Repl) timeout(args []string) error {
+	switch len(args) {
+	case 0:
+		if r.executor.Timeout() == 0 {
+			fmt.Print("\ntimeout: off\n\n")
+			return nil
+		}
+		fmt.Printf("\ntimeout: %s\n\n", r.executor.Timeout())
+		return nil
+	case 1:
+		timeout, err := executor.ParseTimeout(args[0])
+		if err != nil {
+			return err
+		}
+		r.executor.SetTimeout(timeout)
+		if timeout == 0 {
+			fmt.Print("\ntimeout turned off\n\n")
+			return nil
+		}
+		fmt.Printf("\ntimeout set to %s\n\n", timeout)
+		return nil
+	}
+	return errs.NewBadInputError("usage: " + metacmd.Prefix + "timeout [<duration>|off]")
+}
+
+func (r *Repl) source(args []string) error {
+	src, err := r.executor.Source()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\n%s\n", src)
+	return nil
+}
+
+func (r *Repl) undo(args []string) error {
+	if err := r.executor.Undo(); err != nil {
+		return err
+	}
+	fmt.Print("\nundid the last statement\n\n")
+	return nil
+}
+
+func (r *Repl) drop(args []string) error {
+	if len(args) != 1 {
+		return errs.NewBadInputError("usage: " + metacmd.Prefix + "drop <name>")
+	}
+	droppedNames, err := r.executor.Drop(types.DeclName(args[0]))
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(droppedNames))
+	for _, name := range droppedNames {
+		names = append(names, string(name))
+	}
+	fmt.Printf("\ndropped %s\n\n", strings.Join(names, ", "))
+	return nil
+}
+
+func (r *Repl) reload(args []string) error {
+	if err := r.completer.Reload(); err != nil {
+		return err
+	}
+	if err := r.executor.Reload(); err != nil {
+		return err
+	}
+	fmt.Print("\nreloaded the project and reran the session\n\n")
+	return nil
+}
+
+func (r *Repl) reset(args []string) error {
+	if err := r.executor.Reset(); err != nil {
+		return err
+	}
+	fmt.Print("\nsession reset\n\n")
+	return nil
+}
+
+func (r *Repl) quitSession(args []string) error {
+	r.quit = true
+	return nil
+}
+
+func flushTabWriter(w *tabwriter.Writer) error {
+	if err := w.Flush(); err != nil {
+		return errs.NewInternalError("failed to write command output").Wrap(err)
+	}
+	return nil
+}
@@ -2,39 +2,92 @@ package repl
 
 import (
 	"fmt"
-	"os"
+	"strings"
 
 	// go:embedディレクティブ用
 	_ "embed"
 
 	"github.com/kakkky/go-prompt"
 	"github.com/kakkky/gonsole/completer"
+	"github.com/kakkky/gonsole/declregistry"
+	"github.com/kakkky/gonsole/errs"
 	"github.com/kakkky/gonsole/executor"
+	"github.com/kakkky/gonsole/metacmd"
 	"github.com/kakkky/gonsole/version"
 )
 
 // Repl は対話型コンソールの実現を担う
 // 実際は go-prompt をラップしているだけ
 type Repl struct {
-	pt *prompt.Prompt
+	pt           *prompt.Prompt
+	completer    *completer.Completer
+	executor     *executor.Executor
+	declRegistry *declregistry.DeclRegistry
+	dispatcher   *metacmd.Dispatcher
+	// quit は:quitが入力されてセッションを終了するかどうか
+	quit bool
+	// pendingLines は文として完結するまで溜めている入力行
+	pendingLines []string
 }
 
 // NewRepl はReplのインスタンスを生成する
-func NewRepl(completer *completer.Completer, executor *executor.Executor) *Repl {
-	pt := prompt.New(
-		executor.Execute,
+func NewRepl(completer *completer.Completer, executor *executor.Executor, declRegistry *declregistry.DeclRegistry, dispatcher *metacmd.Dispatcher) *Repl {
+	r := &Repl{
+		completer:    completer,
+		executor:     executor,
+		declRegistry: declRegistry,
+		dispatcher:   dispatcher,
+	}
+	r.registerMetaCommands()
+	// Ctrl+Dは空行で押されるとRunから戻るので、呼び出し元でセッションの後片付けができる
+	r.pt = prompt.New(
+		r.execute,
 		completer.Complete,
 		prompt.OptionTitle("gonsole"),
+		prompt.OptionSetExitCheckerOnInput(func(in string, breakline bool) bool {
+			return breakline && r.quit
+		}),
+		prompt.OptionLivePrefix(r.livePrefix),
+		// 継続入力中のCtrl+Cは、溜めている入力行ごと破棄する
 		prompt.OptionAddKeyBind(prompt.KeyBind{
-			Key: prompt.ControlD,
-			Fn: func(buf *prompt.Buffer) {
-				os.Exit(0)
+			Key: prompt.ControlC,
+			Fn: func(*prompt.Buffer) {
+				r.pendingLines = nil
 			},
 		}),
 	)
-	return &Repl{
-		pt: pt,
+	return r
+}
+
+// execute は入力がメタコマンドならメタコマンドを、そうでなければコードを実行する
+// コードが文として完結していない場合は、続きの行が入力されるまで実行を保留する
+func (r *Repl) execute(input string) {
+	if len(r.pendingLines) == 0 && metacmd.IsMetaCommand(input) {
+		if err := r.dispatcher.Dispatch(input); err != nil {
+			errs.HandleError(err)
+		}
+		return
+	}
+	r.pendingLines = append(r.pendingLines, input)
+	src := strings.Join(r.pendingLines, "\n")
+	if executor.IsIncompleteInput(src) {
+		return
+	}
+	r.pendingLines = nil
+	r.executor.Execute(src)
+	// 実行した入力で使った識別子を、補完候補の上位に並べる
+	r.completer.RecordUse(src)
+}
+
+// continuationPrefix は継続入力中に表示するプロンプト
+const continuationPrefix = "... "
+
+// livePrefix は継続入力中であれば継続用のプロンプトを返す
+func (r *Repl) livePrefix() (string, bool) {
+	if len(r.pendingLines) == 0 {
+		return "", false
 	}
+	return continuationPrefix, true
 }
 
 // Run はREPLセッションを開始する
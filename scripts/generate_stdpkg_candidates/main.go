@@ -22,7 +22,7 @@ func main() {
 		completer.BuildStdPkgCandidatesMode = false
 		completer.SkipStdPkgMergeMode = false
 	}()
-	c, err := completer.NewCandidates(goSrcRoot)
+	c, err := completer.NewCandidates(goSrcRoot, "", nil)
 	if err != nil {
 		panic(err)
 	}
@@ -84,7 +84,8 @@ func formatValue(buf *bytes.Buffer, v reflect.Value, indent int) {
 		buf.WriteString("{\n")
 		for i := 0; i < v.NumField(); i++ {
 			field := v.Type().Field(i)
-			if !field.IsExported() {
+			// ゼロ値のフィールドは省略して、生成するファイルを小さくする
+			if !field.IsExported() || v.Field(i).IsZero() {
 				continue
 			}
 			buf.WriteString(strings.Repeat("\t", indent+1))
@@ -163,7 +164,7 @@ func formatValue(buf *bytes.Buffer, v reflect.Value, indent int) {
 func typeNameWithoutPkg(t reflect.Type) string {
 	fullName := t.String()
 	// "[]completer.funcSet" -> "[]funcSet"
-	// "map[types.PkgName][]completer.funcSet" -> "map[types.PkgName][]funcSet"
+	// "map[types.ImportPath][]completer.funcSet" -> "map[types.ImportPath][]funcSet"
 	// パッケージ名の部分を削除
 	result := strings.ReplaceAll(fullName, "completer.", "")
 	return result
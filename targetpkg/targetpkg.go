@@ -0,0 +1,50 @@
+package targetpkg
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/kakkky/gonsole/errs"
+	"github.com/kakkky/gonsole/types"
+	"golang.org/x/tools/go/packages"
+)
+
+// TargetPkg はセッションのコードを組み込む対象のパッケージを表す
+// セッションのコードはこのパッケージの一部としてビルドされるため、非公開の要素にもアクセスできる
+type TargetPkg struct {
+	Name       types.PkgName
+	ImportPath types.ImportPath
+	Dir        string
+}
+
+// Load は指定されたパターンに一致するパッケージを読み込む
+func Load(pattern string) (*TargetPkg, error) {
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles,
+	}
+	pkgs, err := packages.Load(cfg, pattern)
+	if err != nil {
+		return nil, errs.NewInternalError("failed to load target package").Wrap(err)
+	}
+	if len(pkgs) != 1 {
+		return nil, errs.NewBadInputError(fmt.Sprintf("-pkg must match exactly one package, but %q matched %d packages", pattern, len(pkgs)))
+	}
+
+	pkg := pkgs[0]
+	if len(pkg.Errors) > 0 {
+		return nil, errs.NewBadInputError(fmt.Sprintf("failed to load target package %q", pattern)).Wrap(pkg.Errors[0])
+	}
+	if len(pkg.GoFiles) == 0 {
+		return nil, errs.NewBadInputError(fmt.Sprintf("target package %q has no Go files", pattern))
+	}
+	// mainパッケージはimportできないため、セッションから呼び出せない
+	if pkg.Name == "main" {
+		return nil, errs.NewBadInputError(fmt.Sprintf("target package %q is a main package", pattern))
+	}
+
+	return &TargetPkg{
+		Name:       types.PkgName(pkg.Name),
+		ImportPath: types.ImportPath(strconv.Quote(pkg.PkgPath)),
+		Dir:        pkg.Dir,
+	}, nil
+}
@@ -0,0 +1,65 @@
+package targetpkg
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoad(t *testing.T) {
+	sampleDir, err := filepath.Abs("./testdata/sample")
+	if err != nil {
+		t.Fatalf("failed to get absolute path: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		pattern     string
+		expected    *TargetPkg
+		expectedErr bool
+	}{
+		{
+			name:    "load package",
+			pattern: "./testdata/sample",
+			expected: &TargetPkg{
+				Name:       "sample",
+				ImportPath: `"github.com/kakkky/gonsole/targetpkg/testdata/sample"`,
+				Dir:        sampleDir,
+			},
+		},
+		{
+			name:        "main package cannot be target",
+			pattern:     "./testdata/cmd",
+			expectedErr: true,
+		},
+		{
+			name:        "pattern matching multiple packages",
+			pattern:     "./testdata/...",
+			expectedErr: true,
+		},
+		{
+			name:        "package that does not exist",
+			pattern:     "./testdata/notfound",
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Load(tt.pattern)
+			if tt.expectedErr {
+				if err == nil {
+					t.Errorf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() returned an error: %v", err)
+			}
+			if diff := cmp.Diff(tt.expected, got); diff != "" {
+				t.Errorf("Load() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
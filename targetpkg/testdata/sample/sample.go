@@ -0,0 +1,5 @@
+package sample
+
+func newSample() int {
+	return 1
+}